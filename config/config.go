@@ -0,0 +1,300 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"connecthub/origin"
+)
+
+// EnvPrefix is prepended to every environment variable the config reads
+const EnvPrefix = "CONNECTHUB_"
+
+// Duration is a time.Duration that reads and writes as a string such as "24h"
+type Duration time.Duration
+
+// MarshalJSON writes the duration in time.Duration's string form
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON accepts a duration string such as "90m"
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"24h\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// Config holds the server settings. Values come from Default, then the config
+// file, then CONNECTHUB_* environment variables, then explicitly set flags.
+type Config struct {
+	Port             string   `json:"port"`
+	DBPath           string   `json:"db_path"`
+	SessionTTL       Duration `json:"session_ttl"`
+	MaxMessageLength int      `json:"max_message_length"`
+	AllowedOrigins   []string `json:"allowed_origins"`
+	BcryptCost       int      `json:"bcrypt_cost"`
+	SanitizeMode     string   `json:"sanitize_mode"`
+	// Retention prunes chat messages older than this; zero keeps them forever
+	Retention Duration `json:"retention"`
+	// MessageRate caps the messages, posts and comments one user may create per minute
+	MessageRate int `json:"message_rate"`
+	// MaxPostsPerDay caps the posts one user may create in 24 hours; zero means no cap
+	MaxPostsPerDay int `json:"max_posts_per_day"`
+	// DisplayName picks how senders are named in chat: "username" or "full_name"
+	DisplayName string `json:"display_name"`
+	// MaxConnections caps simultaneous WebSocket connections per user
+	MaxConnections int `json:"max_connections"`
+	// UploadDir is where avatars and attachments are stored; it is served under /static/uploads/
+	UploadDir string `json:"upload_dir"`
+	// MaxBodySize caps request bodies in bytes; 413 is returned beyond it
+	MaxBodySize int64 `json:"max_body_size"`
+	// MaxUploadSize is the larger cap applied to multipart upload bodies, in bytes
+	MaxUploadSize int64 `json:"max_upload_size"`
+	// PageSize is how many items a list endpoint returns when the request gives no limit
+	PageSize int `json:"page_size"`
+	// MaxPageSize caps the limit a request may ask a list endpoint for
+	MaxPageSize int `json:"max_page_size"`
+	// AllowAdHocCategories lets posts create categories by naming them; otherwise only admins add categories
+	AllowAdHocCategories bool `json:"allow_ad_hoc_categories"`
+	// Admins lists the usernames allowed to manage categories
+	Admins []string `json:"admins"`
+	// LogPreviewLength caps how many characters of message content a log line shows
+	LogPreviewLength int `json:"log_preview_length"`
+}
+
+// Default returns the settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Port:             "8080",
+		DBPath:           "./database/main.db",
+		SessionTTL:       Duration(24 * time.Hour),
+		MaxMessageLength: 4000,
+		MessageRate:      100,
+		BcryptCost:       bcrypt.DefaultCost,
+		SanitizeMode:     "escape",
+		DisplayName:      "username",
+		MaxConnections:   3,
+		UploadDir:        "./src/static/uploads",
+		MaxBodySize:      1 << 20,
+		MaxUploadSize:    20 << 20,
+		PageSize:         20,
+		MaxPageSize:      100,
+		LogPreviewLength: 50,
+	}
+}
+
+// setting ties a config field to its environment variable and flag name
+type setting struct {
+	env  string
+	flag string
+	set  func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"PORT", "port", func(c *Config, v string) error {
+		c.Port = v
+		return nil
+	}},
+	{"DB_PATH", "db", func(c *Config, v string) error {
+		c.DBPath = v
+		return nil
+	}},
+	{"SESSION_TTL", "session-ttl", func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		c.SessionTTL = Duration(d)
+		return err
+	}},
+	{"MAX_MESSAGE_LENGTH", "max-message-length", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.MaxMessageLength = n
+		return err
+	}},
+	{"MESSAGE_RATE", "message-rate", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.MessageRate = n
+		return err
+	}},
+	{"MAX_POSTS_PER_DAY", "max-posts-per-day", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.MaxPostsPerDay = n
+		return err
+	}},
+	{"MAX_CONNECTIONS", "max-connections", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.MaxConnections = n
+		return err
+	}},
+	{"ALLOWED_ORIGINS", "allowed-origins", func(c *Config, v string) error {
+		c.AllowedOrigins = origin.ParseList(v)
+		return nil
+	}},
+	{"BCRYPT_COST", "bcrypt-cost", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.BcryptCost = n
+		return err
+	}},
+	{"SANITIZE_MODE", "sanitize", func(c *Config, v string) error {
+		c.SanitizeMode = v
+		return nil
+	}},
+	{"DISPLAY_NAME", "display-name", func(c *Config, v string) error {
+		c.DisplayName = v
+		return nil
+	}},
+	{"UPLOAD_DIR", "upload-dir", func(c *Config, v string) error {
+		c.UploadDir = v
+		return nil
+	}},
+	{"MAX_BODY_SIZE", "max-body-size", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		c.MaxBodySize = n
+		return err
+	}},
+	{"MAX_UPLOAD_SIZE", "max-upload-size", func(c *Config, v string) error {
+		n, err := strconv.ParseInt(v, 10, 64)
+		c.MaxUploadSize = n
+		return err
+	}},
+	{"PAGE_SIZE", "page-size", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.PageSize = n
+		return err
+	}},
+	{"MAX_PAGE_SIZE", "max-page-size", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.MaxPageSize = n
+		return err
+	}},
+	{"LOG_PREVIEW_LENGTH", "log-preview-length", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		c.LogPreviewLength = n
+		return err
+	}},
+	{"RETENTION", "retention", func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		c.Retention = Duration(d)
+		return err
+	}},
+	{"ALLOW_AD_HOC_CATEGORIES", "allow-ad-hoc-categories", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.AllowAdHocCategories = b
+		return err
+	}},
+	{"ADMINS", "admins", func(c *Config, v string) error {
+		c.Admins = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				c.Admins = append(c.Admins, name)
+			}
+		}
+		return nil
+	}},
+}
+
+// Load builds a Config from the defaults, the JSON file at path (skipped when
+// path is empty) and CONNECTHUB_* environment variables, in that order
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return cfg, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+		log.Printf("[INFO] Config: Loaded settings from %s", path)
+	}
+
+	for _, s := range settings {
+		value, ok := os.LookupEnv(EnvPrefix + s.env)
+		if !ok {
+			continue
+		}
+		if err := s.set(&cfg, value); err != nil {
+			return cfg, fmt.Errorf("invalid %s%s: %w", EnvPrefix, s.env, err)
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// ApplyFlags overrides settings with flags the user set explicitly on fs, so a
+// flag's default never masks a value from the file or environment
+func (c *Config) ApplyFlags(fs *flag.FlagSet) error {
+	byName := make(map[string]setting, len(settings))
+	for _, s := range settings {
+		byName[s.flag] = s
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		s, ok := byName[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := s.set(c, f.Value.String()); setErr != nil {
+			err = fmt.Errorf("invalid -%s: %w", f.Name, setErr)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return c.Validate()
+}
+
+// Validate reports the first setting that cannot be used
+func (c Config) Validate() error {
+	switch {
+	case strings.TrimSpace(c.Port) == "":
+		return fmt.Errorf("port must not be empty")
+	case strings.TrimSpace(c.DBPath) == "":
+		return fmt.Errorf("db_path must not be empty")
+	case strings.TrimSpace(c.UploadDir) == "":
+		return fmt.Errorf("upload_dir must not be empty")
+	case c.SessionTTL <= 0:
+		return fmt.Errorf("session_ttl must be positive")
+	case c.MaxMessageLength <= 0:
+		return fmt.Errorf("max_message_length must be positive")
+	case c.MessageRate <= 0:
+		return fmt.Errorf("message_rate must be positive")
+	case c.MaxPostsPerDay < 0:
+		return fmt.Errorf("max_posts_per_day must not be negative")
+	case c.MaxConnections <= 0:
+		return fmt.Errorf("max_connections must be positive")
+	case c.MaxBodySize <= 0:
+		return fmt.Errorf("max_body_size must be positive")
+	case c.MaxUploadSize < c.MaxBodySize:
+		return fmt.Errorf("max_upload_size must be at least max_body_size")
+	case c.PageSize <= 0:
+		return fmt.Errorf("page_size must be positive")
+	case c.MaxPageSize < c.PageSize:
+		return fmt.Errorf("max_page_size must be at least page_size")
+	case c.LogPreviewLength <= 0:
+		return fmt.Errorf("log_preview_length must be positive")
+	case c.BcryptCost < bcrypt.MinCost || c.BcryptCost > bcrypt.MaxCost:
+		return fmt.Errorf("bcrypt_cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	case c.Retention < 0:
+		return fmt.Errorf("retention must not be negative")
+	case c.DisplayName != "username" && c.DisplayName != "full_name":
+		return fmt.Errorf("display_name must be \"username\" or \"full_name\"")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// MaxMessageAttachments caps how many files can be sent with one chat message
+const MaxMessageAttachments = 4
+
+// Attachment is a file uploaded for a chat message. It is stored as soon as it
+// is uploaded and linked to a message when the uploader sends one referencing
+// its URL; until then MessageID is zero.
+type Attachment struct {
+	ID        int    `json:"id"`
+	MessageID int    `json:"message_id,omitempty"`
+	URL       string `json:"url"`
+	Mime      string `json:"mime"`
+	Size      int64  `json:"size"`
+}
+
+// CreateAttachment records a file that userID uploaded but has not sent yet
+func CreateAttachment(db *sql.DB, uploaderID int, url, mime string, size int64) (*Attachment, error) {
+	res, err := db.Exec(`
+		INSERT INTO attachments (uploader_id, url, mime, size)
+		VALUES (?, ?, ?, ?)
+	`, uploaderID, url, mime, size)
+	if err != nil {
+		log.Printf("[ERROR] Failed to store attachment %s for user %d: %v", url, uploaderID, err)
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		log.Printf("[ERROR] Failed to get attachment ID for %s: %v", url, err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] Stored attachment %d (%s, %d bytes) for user %d", id, mime, size, uploaderID)
+	return &Attachment{ID: int(id), URL: url, Mime: mime, Size: size}, nil
+}
+
+// ClaimAttachments links attachments to messageID as part of the message's
+// transaction. Each attachment is looked up by URL and must have been uploaded
+// by uploaderID and not yet sent with another message; otherwise
+// ErrInvalidAttachment is returned and the caller should roll back.
+func ClaimAttachments(tx *sql.Tx, messageID, uploaderID int, attachments []Attachment) error {
+	if len(attachments) > MaxMessageAttachments {
+		return ErrTooManyAttachments
+	}
+
+	for _, a := range attachments {
+		res, err := tx.Exec(`
+			UPDATE attachments SET message_id = ?
+			WHERE url = ? AND uploader_id = ? AND message_id IS NULL
+		`, messageID, a.URL, uploaderID)
+		if err != nil {
+			log.Printf("[ERROR] Failed to attach %s to message %d: %v", a.URL, messageID, err)
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			log.Printf("[WARN] User %d tried to attach unknown or already sent file %s", uploaderID, a.URL)
+			return ErrInvalidAttachment
+		}
+	}
+	return nil
+}
+
+// GetMessageAttachments returns the files sent with a message, in upload order
+func GetMessageAttachments(db *sql.DB, messageID int) ([]Attachment, error) {
+	rows, err := db.Query(`
+		SELECT attachment_id, message_id, url, mime, size FROM attachments
+		WHERE message_id = ?
+		ORDER BY attachment_id
+	`, messageID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load attachments for message %d: %v", messageID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanAttachments(rows)
+}
+
+// loadMessageAttachments fills in Attachments for a page of messages with a single query
+func loadMessageAttachments(db *sql.DB, messages []Message) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	placeholders, args := inPlaceholders(ids)
+
+	rows, err := db.Query(`
+		SELECT attachment_id, message_id, url, mime, size FROM attachments
+		WHERE message_id IN (`+placeholders+`)
+		ORDER BY attachment_id
+	`, args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load attachments for %d messages: %v", len(messages), err)
+		return err
+	}
+	defer rows.Close()
+
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return err
+	}
+
+	byMessage := make(map[int][]Attachment)
+	for _, a := range attachments {
+		byMessage[a.MessageID] = append(byMessage[a.MessageID], a)
+	}
+	for i := range messages {
+		messages[i].Attachments = byMessage[messages[i].ID]
+	}
+	return nil
+}
+
+func scanAttachments(rows *sql.Rows) ([]Attachment, error) {
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.URL, &a.Mime, &a.Size); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
@@ -0,0 +1,30 @@
+package database
+
+import "fmt"
+
+// Avatars given to users who have not uploaded one, chosen by gender
+const (
+	MaleAvatar    = "/static/assets/male-avatar-boy-face-man-user-7.svg"
+	FemaleAvatar  = "/static/assets/female-avatar-girl-face-woman-user-9.svg"
+	DefaultAvatar = "/static/assets/default-avatar.png"
+)
+
+// AvatarForGender returns the avatar a new user of the given gender starts with
+func AvatarForGender(gender string) string {
+	switch gender {
+	case "male":
+		return MaleAvatar
+	case "female":
+		return FemaleAvatar
+	default:
+		return DefaultAvatar
+	}
+}
+
+// avatarColumn selects the avatar of the user row aliased as alias, falling
+// back to AvatarForGender when none is stored
+func avatarColumn(alias string) string {
+	return fmt.Sprintf(`COALESCE(NULLIF(%[1]s.Avatar, ''),
+		CASE %[1]s.gender WHEN 'male' THEN '%[2]s' WHEN 'female' THEN '%[3]s' ELSE '%[4]s' END)`,
+		alias, MaleAvatar, FemaleAvatar, DefaultAvatar)
+}
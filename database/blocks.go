@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// BlockUser records that blockerID no longer wants to see or hear from
+// blockedID. Blocking someone twice is not an error.
+func BlockUser(db *sql.DB, blockerID, blockedID int) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+
+	_, err := db.Exec("INSERT OR IGNORE INTO user_block (blocker_id, blocked_id) VALUES (?, ?)", blockerID, blockedID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to record block of user %d by user %d: %v", blockedID, blockerID, err)
+		return err
+	}
+
+	log.Printf("[INFO] User %d blocked user %d", blockerID, blockedID)
+	return nil
+}
+
+// UnblockUser lifts a block placed by blockerID. Unblocking someone who was
+// not blocked is not an error.
+func UnblockUser(db *sql.DB, blockerID, blockedID int) error {
+	_, err := db.Exec("DELETE FROM user_block WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to remove block of user %d by user %d: %v", blockedID, blockerID, err)
+		return err
+	}
+
+	log.Printf("[INFO] User %d unblocked user %d", blockerID, blockedID)
+	return nil
+}
+
+// IsBlocked reports whether either user has blocked the other
+func IsBlocked(db *sql.DB, userA, userB int) (bool, error) {
+	return isBlocked(db, userA, userB)
+}
+
+func isBlocked(q queryRower, userA, userB int) (bool, error) {
+	var blocked bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM user_block
+			WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?)
+		)`, userA, userB, userB, userA).Scan(&blocked)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check for a block between users %d and %d: %v", userA, userB, err)
+		return false, err
+	}
+	return blocked, nil
+}
+
+// blockedCondition excludes users on either side of a block with the viewer.
+// It takes the viewer's id twice.
+const blockedCondition = `user.userid NOT IN (
+	SELECT blocked_id FROM user_block WHERE blocker_id = ?
+	UNION
+	SELECT blocker_id FROM user_block WHERE blocked_id = ?)`
@@ -0,0 +1,230 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// CategoryCount is a category together with the number of visible posts in it
+type CategoryCount struct {
+	Category
+	PostCount int `json:"post_count"`
+}
+
+// GetCategoriesWithCounts returns every category with the number of posts filed
+// under it, most popular first. Deleted and scheduled posts are not counted,
+// and categories without posts are included with a count of zero.
+func GetCategoriesWithCounts(db *sql.DB) ([]CategoryCount, error) {
+	log.Printf("[DEBUG] Retrieving categories with post counts")
+
+	rows, err := db.Query(`
+		SELECT c.idcategories, c.name, COUNT(post.postid)
+		FROM categories c
+		LEFT JOIN post_has_categories phc ON phc.categories_idcategories = c.idcategories
+		LEFT JOIN post ON post.postid = phc.post_postid AND post.is_deleted = 0 AND `+publishedCondition+`
+		GROUP BY c.idcategories, c.name
+		ORDER BY COUNT(post.postid) DESC, c.name ASC
+	`, publishedCutoff())
+	if err != nil {
+		log.Printf("[ERROR] Failed to query category counts: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts, err := scanCategoryCounts(rows)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read category counts: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] Retrieved post counts for %d categories", len(counts))
+	return counts, nil
+}
+
+// GetTrendingCategories ranks categories by how many posts were created in them
+// during the last since, breaking ties alphabetically. Only categories with at
+// least one recent post are returned; a non-positive limit returns them all.
+func GetTrendingCategories(db *sql.DB, since time.Duration, limit int) ([]CategoryCount, error) {
+	cutoff := time.Now().Add(-since).Format("2006-01-02 15:04:05")
+	log.Printf("[DEBUG] Retrieving trending categories since %s (limit %d)", cutoff, limit)
+
+	rows, err := db.Query(`
+		SELECT c.idcategories, c.name, COUNT(post.postid) AS recent
+		FROM categories c
+		JOIN post_has_categories phc ON phc.categories_idcategories = c.idcategories
+		JOIN post ON post.postid = phc.post_postid
+		WHERE post.is_deleted = 0 AND post.post_at >= ? AND `+publishedCondition+`
+		GROUP BY c.idcategories, c.name
+		ORDER BY recent DESC, c.name ASC
+		LIMIT ?
+	`, cutoff, publishedCutoff(), sqlLimit(limit))
+	if err != nil {
+		log.Printf("[ERROR] Failed to query trending categories: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts, err := scanCategoryCounts(rows)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read trending categories: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] Retrieved %d trending categories", len(counts))
+	return counts, nil
+}
+
+func scanCategoryCounts(rows *sql.Rows) ([]CategoryCount, error) {
+	counts := []CategoryCount{}
+	for rows.Next() {
+		var cc CategoryCount
+		if err := rows.Scan(&cc.ID, &cc.Name, &cc.PostCount); err != nil {
+			return nil, err
+		}
+		counts = append(counts, cc)
+	}
+	return counts, rows.Err()
+}
+
+// allowAdHocCategories lets CreatePost create categories it does not know;
+// see SetAllowAdHocCategories
+var allowAdHocCategories = false
+
+// SetAllowAdHocCategories decides whether posts may create categories by
+// naming them. When disallowed, posts can only use existing categories and new
+// ones come from CreateCategory. Call before serving.
+func SetAllowAdHocCategories(allow bool) {
+	allowAdHocCategories = allow
+}
+
+// CreateCategory adds a category under its normalized name. Returns
+// ErrCategoryExists when a category of that name exists, ignoring case.
+func CreateCategory(db *sql.DB, name string) (*Category, error) {
+	name = NormalizeCategoryName(name)
+	if name == "" {
+		return nil, fmt.Errorf("category name is required")
+	}
+
+	var existing int
+	err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ? COLLATE NOCASE", name).Scan(&existing)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check for category '%s': %v", name, err)
+		return nil, err
+	}
+	if existing > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrCategoryExists, name)
+	}
+
+	res, err := db.Exec("INSERT INTO categories (name) VALUES (?)", name)
+	if err != nil {
+		log.Printf("[ERROR] Failed to create category '%s': %v", name, err)
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	InvalidateCategoryCache()
+
+	log.Printf("[INFO] Created category '%s' with ID %d", name, id)
+	return &Category{ID: int(id), Name: name}, nil
+}
+
+// NormalizeCategoryName trims a category name and collapses runs of whitespace,
+// so "  Machine   Learning " and "Machine Learning" name the same category.
+// Case is kept for display; lookups compare names case-insensitively.
+func NormalizeCategoryName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// GetDuplicateCategories groups categories whose names differ only in case or
+// spacing. Each group is ordered by ID, so its first entry is the natural one
+// to keep when merging the rest into it.
+func GetDuplicateCategories(db *sql.DB) ([][]Category, error) {
+	rows, err := db.Query("SELECT idcategories, name FROM categories ORDER BY idcategories")
+	if err != nil {
+		log.Printf("[ERROR] Failed to query categories for duplicates: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	groups := map[string][]Category{}
+	var order []string
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(NormalizeCategoryName(c.Name))
+		if _, seen := groups[key]; !seen {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	duplicates := [][]Category{}
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			duplicates = append(duplicates, groups[key])
+		}
+	}
+	return duplicates, nil
+}
+
+// MergeCategories folds category mergeID into keepID: posts filed under the
+// merged category move to the kept one, posts already in both keep a single
+// link, and the merged category is deleted. It is an administrative operation
+// for cleaning up duplicates; returns sql.ErrNoRows if either category is missing.
+func MergeCategories(db *sql.DB, keepID, mergeID int) error {
+	if keepID == mergeID {
+		return fmt.Errorf("cannot merge category %d into itself", keepID)
+	}
+	log.Printf("[WARN] Merging category %d into category %d", mergeID, keepID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for category merge: %v", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow("SELECT COUNT(*) FROM categories WHERE idcategories IN (?, ?)", keepID, mergeID).Scan(&found)
+	if err != nil {
+		return err
+	}
+	if found != 2 {
+		return sql.ErrNoRows
+	}
+
+	steps := []string{
+		// Drop links that would duplicate one the post already has to the kept category
+		`DELETE FROM post_has_categories
+			WHERE categories_idcategories = ?
+			AND post_postid IN (SELECT post_postid FROM post_has_categories WHERE categories_idcategories = ?)`,
+		"UPDATE post_has_categories SET categories_idcategories = ? WHERE categories_idcategories = ?",
+		"DELETE FROM categories WHERE idcategories = ?",
+	}
+	args := [][]interface{}{{mergeID, keepID}, {keepID, mergeID}, {mergeID}}
+	for i, query := range steps {
+		if _, err := tx.Exec(query, args[i]...); err != nil {
+			log.Printf("[ERROR] Failed to merge category %d into %d: %v", mergeID, keepID, err)
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit merge of category %d into %d: %v", mergeID, keepID, err)
+		return err
+	}
+	InvalidateCategoryCache()
+
+	log.Printf("[INFO] Merged category %d into category %d", mergeID, keepID)
+	return nil
+}
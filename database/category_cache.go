@@ -0,0 +1,130 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"sync"
+)
+
+// categoryCache holds the full category set so feeds can name each post's
+// categories without a query per post. It is loaded on first use and dropped
+// whenever categories are created, merged or the database changes.
+var categoryCache struct {
+	sync.RWMutex
+	loaded bool
+	names  map[int]string
+}
+
+// InvalidateCategoryCache forgets the cached categories; the next lookup
+// reloads them. Code that changes the categories table outside this package
+// must call it.
+func InvalidateCategoryCache() {
+	categoryCache.Lock()
+	categoryCache.loaded = false
+	categoryCache.names = nil
+	categoryCache.Unlock()
+}
+
+// categoryNames returns the cached id to name map, loading it if needed
+func categoryNames(db *sql.DB) (map[int]string, error) {
+	categoryCache.RLock()
+	if categoryCache.loaded {
+		names := categoryCache.names
+		categoryCache.RUnlock()
+		return names, nil
+	}
+	categoryCache.RUnlock()
+
+	rows, err := db.Query("SELECT idcategories, name FROM categories")
+	if err != nil {
+		log.Printf("[ERROR] Failed to load category cache: %v", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		names[id] = name
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	categoryCache.Lock()
+	categoryCache.loaded = true
+	categoryCache.names = names
+	categoryCache.Unlock()
+
+	log.Printf("[DEBUG] Cached %d categories", len(names))
+	return names, nil
+}
+
+// loadPostCategories fills in the categories of every post with one query for
+// their links, naming them from the category cache. A link to a category the
+// cache has not seen reloads it once, in case it was added behind our back.
+func loadPostCategories(db *sql.DB, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	placeholders, args := inPlaceholders(ids)
+
+	rows, err := db.Query(`
+		SELECT post_postid, categories_idcategories FROM post_has_categories
+		WHERE post_postid IN (`+placeholders+`)
+		ORDER BY id`, args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to query categories for %d posts: %v", len(posts), err)
+		return err
+	}
+	defer rows.Close()
+
+	type link struct{ postID, categoryID int }
+	var links []link
+	for rows.Next() {
+		var l link
+		if err := rows.Scan(&l.postID, &l.categoryID); err != nil {
+			return err
+		}
+		links = append(links, l)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	names, err := categoryNames(db)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		if _, ok := names[l.categoryID]; !ok {
+			InvalidateCategoryCache()
+			if names, err = categoryNames(db); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
+	byPost := map[int][]Category{}
+	for _, l := range links {
+		name, ok := names[l.categoryID]
+		if !ok {
+			continue
+		}
+		byPost[l.postID] = append(byPost[l.postID], Category{ID: l.categoryID, Name: name})
+	}
+	for i := range posts {
+		posts[i].Categories = byPost[posts[i].PostID]
+	}
+	return nil
+}
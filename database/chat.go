@@ -2,10 +2,14 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
 	"time"
+
+	"connecthub/logutil"
+	"connecthub/uploads"
 )
 
 type ChatMessage struct {
@@ -27,6 +31,21 @@ type Message struct {
 	SentAt          time.Time `json:"sent_at"`
 	IsRead          bool      `json:"is_read"`
 	RecipientOnline bool      `json:"recipient_online"`
+	// OnlineParticipants is only set for group conversations
+	OnlineParticipants int `json:"online_participants,omitempty"`
+	// ClientMsgID is the sender-supplied dedup key, if one was given
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Attachments are the files sent with the message, if any
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// DeliveredAt is when the message first reached a recipient's open connection
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+	// Status is MessageStatusSent, MessageStatusDelivered or MessageStatusRead
+	Status string `json:"status"`
+	// EditedAt is when the sender last edited the message; see GetMessageHistory
+	EditedAt *time.Time `json:"edited_at,omitempty"`
+	// ReplyToID is the message this one quotes, with a preview of it in ReplyTo
+	ReplyToID int             `json:"reply_to_message_id,omitempty"`
+	ReplyTo   *MessagePreview `json:"reply_to,omitempty"`
 }
 
 type Conversation struct {
@@ -34,60 +53,139 @@ type Conversation struct {
 	CreatedAt    time.Time    `json:"created_at"`
 	Participants []*User      `json:"participants"`
 	LastMessage  *ChatMessage `json:"last_message,omitempty"`
+	// UnreadCount is the number of messages from others past the viewer's read
+	// pointer; it is only filled in when listing a user's own conversations
+	UnreadCount int `json:"unread_count"`
+	// MessageCount and ParticipantCount summarise the conversation for chat lists
+	MessageCount     int `json:"message_count"`
+	ParticipantCount int `json:"participant_count"`
+	// OnlineCount is how many participants are connected; it is only filled in
+	// for a single conversation's details
+	OnlineCount int `json:"online_count"`
+}
+
+// PresenceChecker reports whether a user currently holds a live chat connection
+type PresenceChecker func(userID int) bool
+
+var presenceChecker PresenceChecker
+
+// SetPresenceChecker registers the function used to report recipient presence
+// on newly added messages. When unset, the online_status table is consulted.
+func SetPresenceChecker(checker PresenceChecker) {
+	presenceChecker = checker
 }
 
-var DB *sql.DB
+// MaxConversationParticipants caps the size of a group conversation
+const MaxConversationParticipants = 50
+
+// validateParticipants removes duplicate ids and checks that what remains is a
+// usable participant list: at least two distinct existing users and no more than
+// MaxConversationParticipants. The returned list keeps the caller's order.
+func validateParticipants(db *sql.DB, participants []int) ([]int, error) {
+	seen := make(map[int]bool, len(participants))
+	unique := make([]int, 0, len(participants))
+	for _, userID := range participants {
+		if userID <= 0 {
+			return nil, fmt.Errorf("%w: invalid user id %d", ErrUnknownParticipant, userID)
+		}
+		if !seen[userID] {
+			seen[userID] = true
+			unique = append(unique, userID)
+		}
+	}
 
-func CreateConversation(participants []int) (int, error) {
-	if DB == nil {
-		var err error
-		log.Printf("[DEBUG] Attempting to connect to SQLite database for creating conversation")
-		DB, err = sql.Open("sqlite3", "./database/main.db")
+	// A lone participant would be a "saved messages" thread, which is not a
+	// supported conversation kind yet
+	if len(unique) == 1 {
+		return nil, fmt.Errorf("%w: user %d", ErrSelfConversation, unique[0])
+	}
+	if len(unique) < 2 {
+		return nil, fmt.Errorf("%w (got %d)", ErrInvalidParticipants, len(unique))
+	}
+	if len(unique) > MaxConversationParticipants {
+		return nil, fmt.Errorf("%w: %d exceeds the limit of %d", ErrTooManyParticipants, len(unique), MaxConversationParticipants)
+	}
+
+	for _, userID := range unique {
+		exists, err := CheckUserExists(db, userID)
 		if err != nil {
-			log.Printf("[ERROR] Database connection failed in CreateConversation: %v", err)
-			return 0, err
+			return nil, err
 		}
-		log.Printf("[INFO] Successfully connected to SQLite database for creating conversation")
-	} else {
-		log.Printf("[DEBUG] Using existing database connection for creating conversation")
+		if !exists {
+			return nil, fmt.Errorf("%w: user %d", ErrUnknownParticipant, userID)
+		}
+	}
+	return unique, nil
+}
+
+// CreateConversation starts a conversation between the given users, or returns the
+// existing one for a pair that already has a conversation. Duplicate ids are
+// ignored; unknown users, a user on their own, fewer than two distinct users or
+// more than MaxConversationParticipants are rejected.
+func CreateConversation(db *sql.DB, participants []int) (int, error) {
+	return CreateConversationAs(db, 0, participants)
+}
+
+// CreateConversationAs is CreateConversation on behalf of creatorID. A new
+// conversation is refused with ErrDMsNotAllowed when another participant does
+// not accept conversations from the creator; an existing pair is still
+// returned. A creatorID of 0 skips that check.
+func CreateConversationAs(db *sql.DB, creatorID int, participants []int) (int, error) {
+	convID, _, err := FindOrCreateConversation(db, creatorID, participants)
+	return convID, err
+}
+
+// FindOrCreateConversation is CreateConversationAs that also reports whether
+// the conversation was created (true) or an existing 1:1 pair was reused.
+func FindOrCreateConversation(db *sql.DB, creatorID int, participants []int) (int, bool, error) {
+	participants, err := validateParticipants(db, participants)
+	if err != nil {
+		log.Printf("[WARN] Rejected conversation participants: %v", err)
+		return 0, false, err
 	}
 
-	tx, err := DB.Begin()
+	tx, err := db.Begin()
 	if err != nil {
 		log.Printf("[ERROR] Failed to begin transaction in CreateConversation: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	log.Printf("[DEBUG] Started transaction for creating conversation with %d participants", len(participants))
 
 	if len(participants) == 2 {
 		var existingConvID int
 		log.Printf("[DEBUG] Checking for existing conversation between users %d and %d", participants[0], participants[1])
-		err := tx.QueryRow(`
-			SELECT cp1.conversation_id
-			FROM conversation_participants cp1
-			JOIN conversation_participants cp2 ON cp1.conversation_id = cp2.conversation_id
-			WHERE cp1.user_id = ? AND cp2.user_id = ?
-			GROUP BY cp1.conversation_id
-			HAVING COUNT(DISTINCT cp1.user_id) = 1 AND COUNT(DISTINCT cp2.user_id) = 1
-		`, participants[0], participants[1]).Scan(&existingConvID)
+		err := tx.QueryRow(directConversationQuery, participants[0], participants[1]).Scan(&existingConvID)
 
 		if err == nil {
 			tx.Rollback()
 			log.Printf("[INFO] Found existing conversation (ID: %d) between users %d and %d", existingConvID, participants[0], participants[1])
-			return existingConvID, nil
+			return existingConvID, false, nil
 		} else if err != sql.ErrNoRows {
 			tx.Rollback()
 			log.Printf("[ERROR] Failed checking for existing conversation between users %d and %d: %v", participants[0], participants[1], err)
-			return 0, err
+			return 0, false, err
 		}
 		log.Printf("[DEBUG] No existing conversation found between users %d and %d, creating new one", participants[0], participants[1])
 	}
 
-	res, err := tx.Exec("INSERT INTO conversation (created_at) VALUES (CURRENT_TIMESTAMP)")
+	if creatorID > 0 {
+		if err := checkDMsAllowed(tx, creatorID, participants); err != nil {
+			tx.Rollback()
+			log.Printf("[WARN] User %d may not start a conversation with %v: %v", creatorID, participants, err)
+			return 0, false, err
+		}
+	}
+
+	// created_by stays NULL when nobody in particular started it
+	var createdBy interface{}
+	if creatorID > 0 {
+		createdBy = creatorID
+	}
+	res, err := tx.Exec("INSERT INTO conversation (created_by, created_at) VALUES (?, CURRENT_TIMESTAMP)", createdBy)
 	if err != nil {
 		tx.Rollback()
 		log.Printf("[ERROR] Failed to insert into conversation table: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	log.Printf("[DEBUG] Successfully inserted new conversation record")
 
@@ -95,7 +193,7 @@ func CreateConversation(participants []int) (int, error) {
 	if err != nil {
 		tx.Rollback()
 		log.Printf("[ERROR] Failed to get last insert ID for conversation: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	log.Printf("[DEBUG] Retrieved new conversation ID: %d", convID)
 
@@ -103,7 +201,7 @@ func CreateConversation(participants []int) (int, error) {
 	if err != nil {
 		tx.Rollback()
 		log.Printf("[ERROR] Failed to prepare statement for conversation_participants: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	defer stmt.Close()
 	log.Printf("[DEBUG] Prepared statement for adding participants to conversation %d", convID)
@@ -113,35 +211,38 @@ func CreateConversation(participants []int) (int, error) {
 		if err != nil {
 			tx.Rollback()
 			log.Printf("[ERROR] Failed to add user %d to conversation %d: %v", userID, convID, err)
-			return 0, err
+			return 0, false, err
 		}
 		log.Printf("[INFO] Added user %d to conversation %d", userID, convID)
 	}
 
 	if err := tx.Commit(); err != nil {
 		log.Printf("[ERROR] Failed to commit transaction for creating conversation: %v", err)
-		return 0, err
+		return 0, false, err
 	}
 	log.Printf("[DEBUG] Committed transaction for creating conversation %d", convID)
 
 	log.Printf("[INFO] Created conversation %d with participants: %v", int(convID), participants)
-	return int(convID), nil
+	return int(convID), true, nil
 }
 
-func GetConversationBetweenUsers(db *sql.DB, userID1, userID2 int) (int, error) {
-	query := `
-		SELECT cp1.conversation_id
-		FROM conversation_participants cp1
-		JOIN conversation_participants cp2 ON cp1.conversation_id = cp2.conversation_id
-		WHERE cp1.user_id = ? AND cp2.user_id = ?
-		GROUP BY cp1.conversation_id
-		HAVING COUNT(DISTINCT cp1.user_id) + COUNT(DISTINCT cp2.user_id) = 2
-		LIMIT 1
-	`
+// directConversationQuery finds the 1:1 conversation between two users. Group
+// chats both users belong to are skipped by requiring exactly two participants.
+const directConversationQuery = `
+	SELECT cp1.conversation_id
+	FROM conversation_participants cp1
+	JOIN conversation_participants cp2 ON cp1.conversation_id = cp2.conversation_id
+	WHERE cp1.user_id = ? AND cp2.user_id = ?
+		AND (SELECT COUNT(*) FROM conversation_participants cp
+			WHERE cp.conversation_id = cp1.conversation_id) = 2
+	ORDER BY cp1.conversation_id
+	LIMIT 1
+`
 
+func GetConversationBetweenUsers(db *sql.DB, userID1, userID2 int) (int, error) {
 	log.Printf("[DEBUG] Checking for conversation between users %d and %d", userID1, userID2)
 	var conversationID int
-	err := db.QueryRow(query, userID1, userID2).Scan(&conversationID)
+	err := db.QueryRow(directConversationQuery, userID1, userID2).Scan(&conversationID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("[INFO] No conversation found between users %d and %d", userID1, userID2)
@@ -162,7 +263,7 @@ func SaveChatMessage(db *sql.DB, senderID, conversationID int, content string) (
 		VALUES (?, ?, ?, CURRENT_TIMESTAMP, 0)
 	`
 
-	contentPreview := truncateContent(content)
+	contentPreview := logutil.Preview(content)
 	log.Printf("[DEBUG] Saving message from user %d in conversation %d: '%s'", senderID, conversationID, contentPreview)
 	result, err := db.Exec(query, conversationID, senderID, content)
 	if err != nil {
@@ -233,18 +334,65 @@ func GetConversationParticipants(db *sql.DB, conversationID int) ([]int, error)
 	return participants, nil
 }
 
+// MessageOrder says which end of a conversation's history a page starts from
+type MessageOrder string
+
+const (
+	// OrderNewestFirst pages back from the latest message; it is the default
+	OrderNewestFirst MessageOrder = "desc"
+	// OrderOldestFirst returns messages in chronological order, for clients that display them as-is
+	OrderOldestFirst MessageOrder = "asc"
+)
+
+// ValidMessageOrder reports whether order is one GetConversationMessagesOrdered understands
+func ValidMessageOrder(order MessageOrder) bool {
+	return order == OrderNewestFirst || order == OrderOldestFirst
+}
+
+// GetConversationMessagesFor is GetConversationMessagesOrdered on behalf of userID.
+// Only participants may read a conversation; anyone else gets ErrNotParticipant,
+// or ErrConversationNotFound if there is no such conversation.
+func GetConversationMessagesFor(db *sql.DB, conversationID, userID, limit, offset int, order MessageOrder) ([]Message, error) {
+	isParticipant, err := IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant {
+		var exists bool
+		if err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM conversation WHERE conversation_id = ?)", conversationID).Scan(&exists); err != nil {
+			log.Printf("[ERROR] Failed to check conversation %d exists: %v", conversationID, err)
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrConversationNotFound
+		}
+		log.Printf("[WARN] User %d tried to read conversation %d without being a participant", userID, conversationID)
+		return nil, ErrNotParticipant
+	}
+	return GetConversationMessagesOrdered(db, conversationID, limit, offset, order)
+}
+
+// GetConversationMessages returns a page of the conversation's messages, newest first
 func GetConversationMessages(db *sql.DB, conversationID, limit, offset int) ([]Message, error) {
+	return GetConversationMessagesOrdered(db, conversationID, limit, offset, OrderNewestFirst)
+}
+
+// GetConversationMessagesOrdered returns a page of the conversation's messages,
+// newest first unless order is OrderOldestFirst
+func GetConversationMessagesOrdered(db *sql.DB, conversationID, limit, offset int, order MessageOrder) ([]Message, error) {
 	messages := []Message{}
 
-	// PAGINATION FIX: Order by sent_at DESC to get newest messages first for proper pagination
-	// This allows offset to work correctly - offset 0 gets the newest messages
-	// Frontend will reverse the order for display if needed
+	direction := "DESC"
+	if order == OrderOldestFirst {
+		direction = "ASC"
+	}
+
 	query := `
-		SELECT m.message_id, m.conversation_id, m.sender_id, u.Username, m.content, m.sent_at, m.is_read
+		SELECT m.message_id, m.conversation_id, m.sender_id, ` + displayNameColumn("u") + `, m.content, m.sent_at, m.is_read, m.delivered_at, m.edited_at, m.reply_to_message_id
 		FROM message m
 		JOIN user u ON m.sender_id = u.userid
 		WHERE m.conversation_id = ?
-		ORDER BY m.sent_at DESC
+		ORDER BY m.sent_at ` + direction + `, m.message_id ` + direction + `
 		LIMIT ? OFFSET ?
 	`
 
@@ -260,9 +408,11 @@ func GetConversationMessages(db *sql.DB, conversationID, limit, offset int) ([]M
 	for rows.Next() {
 		var msg Message
 		var sentAtStr string
+		var deliveredAt, editedAt sql.NullTime
+		var replyToID sql.NullInt64
 		err := rows.Scan(
 			&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName,
-			&msg.Content, &sentAtStr, &msg.IsRead,
+			&msg.Content, &sentAtStr, &msg.IsRead, &deliveredAt, &editedAt, &replyToID,
 		)
 		if err != nil {
 			log.Printf("[ERROR] Failed to scan message from conversation %d: %v", conversationID, err)
@@ -280,17 +430,86 @@ func GetConversationMessages(db *sql.DB, conversationID, limit, offset int) ([]M
 			}
 			log.Printf("[DEBUG] Parsed timestamp for message %d: %v", msg.ID, msg.SentAt)
 		}
+		msg.setStatus(deliveredAt)
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Time
+		}
+		msg.ReplyToID = int(replyToID.Int64)
 
 		messages = append(messages, msg)
 	}
 
-	// PAGINATION FIX: Remove array reversal since we now order by DESC in the query
-	// Messages are returned in newest-first order, frontend will handle display order
+	if err := loadMessageAttachments(db, messages); err != nil {
+		return nil, err
+	}
+	if err := loadReplyPreviews(db, messages); err != nil {
+		return nil, err
+	}
 
 	log.Printf("[INFO] Retrieved %d messages from conversation %d (limit: %d, offset: %d)", len(messages), conversationID, limit, offset)
 	return messages, nil
 }
 
+// GetConversationMessagesAfter returns up to limit messages in the conversation
+// with an id greater than afterMessageID, oldest first. Reconnecting clients use
+// it to catch up on whatever arrived while they were away.
+func GetConversationMessagesAfter(db *sql.DB, conversationID, afterMessageID, limit int) ([]Message, error) {
+	log.Printf("[DEBUG] Retrieving messages after %d in conversation %d (limit %d)", afterMessageID, conversationID, limit)
+
+	rows, err := db.Query(`
+		SELECT m.message_id, m.conversation_id, m.sender_id, `+displayNameColumn("u")+`, m.content, m.sent_at, m.is_read, m.delivered_at, m.edited_at, m.reply_to_message_id
+		FROM message m
+		JOIN user u ON m.sender_id = u.userid
+		WHERE m.conversation_id = ? AND m.message_id > ?
+		ORDER BY m.message_id ASC
+		LIMIT ?
+	`, conversationID, afterMessageID, sqlLimit(limit))
+	if err != nil {
+		log.Printf("[ERROR] Failed to retrieve messages after %d in conversation %d: %v", afterMessageID, conversationID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []Message{}
+	for rows.Next() {
+		var msg Message
+		var sentAtStr string
+		var deliveredAt, editedAt sql.NullTime
+		var replyToID sql.NullInt64
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName, &msg.Content, &sentAtStr, &msg.IsRead, &deliveredAt, &editedAt, &replyToID); err != nil {
+			log.Printf("[ERROR] Failed to scan message from conversation %d: %v", conversationID, err)
+			return nil, err
+		}
+
+		msg.SentAt, err = time.Parse(time.RFC3339, sentAtStr)
+		if err != nil {
+			msg.SentAt, err = time.Parse("2006-01-02 15:04:05", sentAtStr)
+			if err != nil {
+				log.Printf("[WARN] Failed to parse timestamp '%s' for message %d: %v", sentAtStr, msg.ID, err)
+				msg.SentAt = time.Time{}
+			}
+		}
+		msg.setStatus(deliveredAt)
+		if editedAt.Valid {
+			msg.EditedAt = &editedAt.Time
+		}
+		msg.ReplyToID = int(replyToID.Int64)
+		messages = append(messages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if err := loadMessageAttachments(db, messages); err != nil {
+		return nil, err
+	}
+	if err := loadReplyPreviews(db, messages); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Retrieved %d messages after %d in conversation %d", len(messages), afterMessageID, conversationID)
+	return messages, nil
+}
+
 func MarkMessagesAsRead(db *sql.DB, conversationID, userID int) error {
 	query := `
 		UPDATE message
@@ -307,24 +526,100 @@ func MarkMessagesAsRead(db *sql.DB, conversationID, userID int) error {
 
 	affected, _ := result.RowsAffected()
 	log.Printf("[INFO] Marked %d messages as read in conversation %d for user %d", affected, conversationID, userID)
+
+	// Keep the read pointer in step so both unread computations agree
+	var latestID sql.NullInt64
+	if err := db.QueryRow("SELECT MAX(message_id) FROM message WHERE conversation_id = ?", conversationID).Scan(&latestID); err != nil {
+		log.Printf("[WARN] Failed to find latest message in conversation %d: %v", conversationID, err)
+	} else if latestID.Valid {
+		if err := SetLastRead(db, conversationID, userID, int(latestID.Int64)); err != nil {
+			log.Printf("[WARN] Failed to advance read pointer in conversation %d for user %d: %v", conversationID, userID, err)
+		}
+	}
 	return nil
 }
 
+// GetUserConversations returns every conversation the user takes part in,
+// most recently active first
 func GetUserConversations(db *sql.DB, userID int) ([]Conversation, error) {
+	return GetUserConversationsPaginated(db, userID, 0, 0, false)
+}
+
+// GetUserConversationsPaginated returns a page of the user's conversations,
+// most recently active first. With unreadOnly set, only conversations holding
+// messages the user has not read are listed. A non-positive limit returns every
+// conversation from offset onwards.
+func GetUserConversationsPaginated(db *sql.DB, userID, limit, offset int, unreadOnly bool) ([]Conversation, error) {
+	log.Printf("[DEBUG] Retrieving conversations for user %d (limit %d, offset %d, unread only %t)", userID, limit, offset, unreadOnly)
+	return queryUserConversations(db, userID, "? = 0 OR conv.unread > 0", []interface{}{unreadOnly}, limit, offset)
+}
+
+// SearchUserConversations returns the user's conversations in which another
+// participant's username, first or last name, or the latest message contains
+// query, ignoring case. Results are most recently active first; an empty query
+// matches nothing.
+func SearchUserConversations(db *sql.DB, userID int, query string) ([]Conversation, error) {
+	log.Printf("[DEBUG] Searching conversations of user %d for %q", userID, query)
+
+	term := strings.TrimSpace(query)
+	if term == "" {
+		return []Conversation{}, nil
+	}
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+
+	condition := `conv.conversation_id IN (
+			SELECT cp2.conversation_id FROM conversation_participants cp2
+			JOIN user u ON u.userid = cp2.user_id
+			WHERE cp2.user_id != ?
+			AND (u.Username LIKE ? ESCAPE '\' OR u.F_name LIKE ? ESCAPE '\' OR u.L_name LIKE ? ESCAPE '\')
+		) OR (
+			SELECT m.content FROM message m
+			WHERE m.conversation_id = conv.conversation_id
+			ORDER BY m.message_id DESC LIMIT 1
+		) LIKE ? ESCAPE '\'`
+	return queryUserConversations(db, userID, condition, []interface{}{userID, pattern, pattern, pattern, pattern}, 0, 0)
+}
+
+// GetSharedConversations returns the conversations userID and otherUserID are
+// both in, the one-to-one chat and any groups alike, most recently active first
+func GetSharedConversations(db *sql.DB, userID, otherUserID int) ([]Conversation, error) {
+	log.Printf("[DEBUG] Retrieving conversations user %d shares with user %d", userID, otherUserID)
+
+	condition := `conv.conversation_id IN (
+			SELECT conversation_id FROM conversation_participants WHERE user_id = ?
+		)`
+	return queryUserConversations(db, userID, condition, []interface{}{otherUserID}, 0, 0)
+}
+
+// queryUserConversations lists the user's conversations matching condition,
+// with their unread counts, most recently active first. condition filters the
+// derived table conv, whose columns are conversation_id, created_at, unread
+// and last_activity.
+func queryUserConversations(db *sql.DB, userID int, condition string, args []interface{}, limit, offset int) ([]Conversation, error) {
 	conversations := []Conversation{}
 
-	log.Printf("[DEBUG] Retrieving conversations for user %d", userID)
+	queryArgs := append([]interface{}{userID}, args...)
+	queryArgs = append(queryArgs, sqlLimit(limit), offset)
 	rows, err := db.Query(`
-		SELECT c.conversation_id, c.created_at
-		FROM conversation c
-		JOIN conversation_participants cp ON c.conversation_id = cp.conversation_id
-		WHERE cp.user_id = ?
-		ORDER BY (
-			SELECT MAX(sent_at)
-			FROM message
-			WHERE conversation_id = c.conversation_id
-		) DESC
-	`, userID)
+		SELECT conv.conversation_id, conv.created_at, conv.unread
+		FROM (
+			SELECT c.conversation_id, c.created_at,
+				(SELECT COUNT(*) FROM message m
+					WHERE m.conversation_id = c.conversation_id
+					AND m.sender_id != cp.user_id
+					AND m.message_id > COALESCE((
+						SELECT last_read_message_id FROM conversation_read_state rs
+						WHERE rs.conversation_id = c.conversation_id AND rs.user_id = cp.user_id
+					), 0)) AS unread,
+				(SELECT MAX(sent_at) FROM message WHERE conversation_id = c.conversation_id) AS last_activity
+			FROM conversation c
+			JOIN conversation_participants cp ON c.conversation_id = cp.conversation_id
+			WHERE cp.user_id = ?
+		) conv
+		WHERE `+condition+`
+		ORDER BY conv.last_activity DESC, conv.conversation_id DESC
+		LIMIT ? OFFSET ?
+	`, queryArgs...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to get conversations for user %d: %v", userID, err)
 		return nil, err
@@ -334,178 +629,337 @@ func GetUserConversations(db *sql.DB, userID int) ([]Conversation, error) {
 
 	for rows.Next() {
 		var conv Conversation
-		err := rows.Scan(&conv.ID, &conv.CreatedAt)
+		err := rows.Scan(&conv.ID, &conv.CreatedAt, &conv.UnreadCount)
 		if err != nil {
 			log.Printf("[ERROR] Failed to scan conversation for user %d: %v", userID, err)
 			return nil, err
 		}
 		log.Printf("[DEBUG] Scanned conversation ID %d for user %d", conv.ID, userID)
 
-		users, err := getConversationParticipants(conv.ID, db)
-		if err != nil {
-			log.Printf("[ERROR] Failed to get participants for conversation %d: %v", conv.ID, err)
-			return nil, err
-		}
-		participants := make([]*User, len(users))
-		for i := range users {
-			participants[i] = &users[i]
-		}
-		conv.Participants = participants
-		log.Printf("[DEBUG] Retrieved %d participants for conversation %d", len(participants), conv.ID)
-
-		lastMsg, err := getLastMessage(conv.ID, db)
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("[ERROR] Failed to get last message for conversation %d: %v", conv.ID, err)
-		} else if err == sql.ErrNoRows {
-			conv.LastMessage = nil
-			log.Printf("[DEBUG] No last message found for conversation %d", conv.ID)
-		} else {
-			conv.LastMessage = &ChatMessage{
-				ID:             lastMsg.ID,
-				ConversationID: lastMsg.ConversationID,
-				SenderID:       lastMsg.SenderID,
-				SenderName:     lastMsg.SenderName,
-				Content:        lastMsg.Content,
-				SentAt:         lastMsg.SentAt,
-				IsRead:         lastMsg.IsRead,
-			}
-			log.Printf("[DEBUG] Retrieved last message ID %d for conversation %d", lastMsg.ID, conv.ID)
-		}
-
 		conversations = append(conversations, conv)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating conversations for user %d: %v", userID, err)
 		return nil, err
 	}
+	rows.Close()
+
+	if err := hydrateConversations(db, conversations); err != nil {
+		return nil, err
+	}
 
 	log.Printf("[INFO] Retrieved %d conversations for user %d", len(conversations), userID)
 	return conversations, nil
 }
 
-func getConversationParticipants(conversationID int, db *sql.DB) ([]User, error) {
-	participants := []User{}
+// hydrateConversations fills in participants and last messages for a page of
+// conversations using one query for each, regardless of how many conversations there are
+func hydrateConversations(db *sql.DB, conversations []Conversation) error {
+	if len(conversations) == 0 {
+		return nil
+	}
 
-	log.Printf("[DEBUG] Querying participants for conversation %d", conversationID)
-	rows, err := db.Query(`
-		SELECT u.userid, u.Username, u.Email, u.F_name, u.L_name, u.Avatar
-		FROM user u
-		JOIN conversation_participants cp ON u.userid = cp.user_id
-		WHERE cp.conversation_id = ?
-	`, conversationID)
+	ids := make([]int, len(conversations))
+	for i, conv := range conversations {
+		ids[i] = conv.ID
+	}
+
+	participants, err := getParticipantsForConversations(db, ids)
 	if err != nil {
-		log.Printf("[ERROR] Failed to query participants for conversation %d: %v", conversationID, err)
-		return nil, err
+		log.Printf("[ERROR] Failed to get participants for conversations %v: %v", ids, err)
+		return err
 	}
-	defer rows.Close()
-	log.Printf("[DEBUG] Successfully queried participants for conversation %d", conversationID)
 
-	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Avatar)
-		if err != nil {
-			log.Printf("[ERROR] Failed to scan participant for conversation %d: %v", conversationID, err)
-			return nil, err
-		}
-		log.Printf("[DEBUG] Scanned participant ID %d for conversation %d", user.ID, conversationID)
-		participants = append(participants, user)
+	lastMessages, messageCounts, err := getLastMessagesForConversations(db, ids)
+	if err != nil {
+		// A missing preview should not hide the conversation list
+		log.Printf("[ERROR] Failed to get last messages for conversations %v: %v", ids, err)
+		lastMessages, messageCounts = map[int]*ChatMessage{}, map[int]int{}
 	}
-	if err := rows.Err(); err != nil {
-		log.Printf("[ERROR] Error iterating participants for conversation %d: %v", conversationID, err)
-		return nil, err
+
+	for i := range conversations {
+		conv := &conversations[i]
+		conv.Participants = participants[conv.ID]
+		if conv.Participants == nil {
+			conv.Participants = []*User{}
+		}
+		conv.LastMessage = lastMessages[conv.ID]
+		conv.MessageCount = messageCounts[conv.ID]
+		conv.ParticipantCount = len(conv.Participants)
 	}
 
-	log.Printf("[INFO] Retrieved %d participants for conversation %d", len(participants), conversationID)
-	return participants, nil
+	log.Printf("[DEBUG] Hydrated %d conversations with participants and last messages", len(conversations))
+	return nil
 }
 
-func getLastMessage(conversationID int, db *sql.DB) (*Message, error) {
-	var msg Message
-	var sentAtStr string
+// inPlaceholders builds a "?,?,?" list and matching arguments for an IN clause
+func inPlaceholders(ids []int) (string, []interface{}) {
+	placeholders := make([]string, len(ids))
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	return strings.Join(placeholders, ","), args
+}
 
-	log.Printf("[DEBUG] Retrieving last message for conversation %d", conversationID)
-	err := db.QueryRow(`
-		SELECT m.message_id, m.conversation_id, m.sender_id, u.Username, m.content, m.sent_at, m.is_read
-		FROM message m
-		JOIN user u ON m.sender_id = u.userid
-		WHERE m.conversation_id = ?
-		ORDER BY m.sent_at DESC
-		LIMIT 1
-	`, conversationID).Scan(
-		&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName,
-		&msg.Content, &sentAtStr, &msg.IsRead,
-	)
-	log.Printf("[DEBUG] Successfully queried last message for conversation %d", conversationID)
+// getParticipantsForConversations loads the participants of several conversations at once, keyed by conversation id
+func getParticipantsForConversations(db *sql.DB, conversationIDs []int) (map[int][]*User, error) {
+	placeholders, args := inPlaceholders(conversationIDs)
 
+	rows, err := db.Query(`
+		SELECT cp.conversation_id, u.userid, u.Username, u.Email, u.F_name, u.L_name, u.Avatar, `+lastSeenColumn("u.userid")+`
+		FROM conversation_participants cp
+		JOIN user u ON u.userid = cp.user_id
+		WHERE cp.conversation_id IN (`+placeholders+`)
+		ORDER BY cp.conversation_id, cp.id
+	`, args...)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			log.Printf("[INFO] No messages found in conversation %d", conversationID)
+		return nil, err
+	}
+	defer rows.Close()
+
+	participants := make(map[int][]*User, len(conversationIDs))
+	for rows.Next() {
+		var conversationID int
+		var lastSeen sql.NullString
+		user := &User{}
+		if err := rows.Scan(&conversationID, &user.ID, &user.Username, &user.Email, &user.FirstName, &user.LastName, &user.Avatar, &lastSeen); err != nil {
 			return nil, err
 		}
-		log.Printf("[ERROR] Failed to get last message for conversation %d: %v", conversationID, err)
-		return nil, err
+		user.LastSeen = parseTimestamp(lastSeen)
+		participants[conversationID] = append(participants[conversationID], user)
 	}
+	return participants, rows.Err()
+}
 
-	msg.SentAt, err = time.Parse(time.RFC3339, sentAtStr)
+// getLastMessagesForConversations loads the newest message and message count of several conversations at once, keyed by conversation id.
+// Conversations without messages are absent from the result.
+func getLastMessagesForConversations(db *sql.DB, conversationIDs []int) (map[int]*ChatMessage, map[int]int, error) {
+	placeholders, args := inPlaceholders(conversationIDs)
+
+	rows, err := db.Query(`
+		SELECT message_id, conversation_id, sender_id, sender_name, content, sent_at, is_read, message_count
+		FROM (
+			SELECT m.message_id, m.conversation_id, m.sender_id, `+displayNameColumn("u")+` AS sender_name, m.content, m.sent_at, m.is_read,
+			       ROW_NUMBER() OVER (PARTITION BY m.conversation_id ORDER BY m.sent_at DESC, m.message_id DESC) AS rn,
+			       COUNT(*) OVER (PARTITION BY m.conversation_id) AS message_count
+			FROM message m
+			JOIN user u ON m.sender_id = u.userid
+			WHERE m.conversation_id IN (`+placeholders+`)
+		)
+		WHERE rn = 1
+	`, args...)
 	if err != nil {
-		layout := "2006-01-02 15:04:05"
-		msg.SentAt, err = time.Parse(layout, sentAtStr)
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	lastMessages := make(map[int]*ChatMessage, len(conversationIDs))
+	messageCounts := make(map[int]int, len(conversationIDs))
+	for rows.Next() {
+		msg := &ChatMessage{}
+		var sentAtStr string
+		var count int
+		if err := rows.Scan(&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName, &msg.Content, &sentAtStr, &msg.IsRead, &count); err != nil {
+			return nil, nil, err
+		}
+
+		msg.SentAt, err = time.Parse(time.RFC3339, sentAtStr)
 		if err != nil {
-			log.Printf("[WARN] Failed to parse timestamp '%s' for last message in conversation %d: %v", sentAtStr, conversationID, err)
-			msg.SentAt = time.Time{}
+			layout := "2006-01-02 15:04:05"
+			msg.SentAt, err = time.Parse(layout, sentAtStr)
+			if err != nil {
+				log.Printf("[WARN] Failed to parse timestamp '%s' for last message in conversation %d: %v", sentAtStr, msg.ConversationID, err)
+				msg.SentAt = time.Time{}
+			}
 		}
+		lastMessages[msg.ConversationID] = msg
+		messageCounts[msg.ConversationID] = count
 	}
-	log.Printf("[DEBUG] Retrieved last message ID %d for conversation %d", msg.ID, conversationID)
+	return lastMessages, messageCounts, rows.Err()
+}
 
-	return &msg, nil
+// maxClientMsgIDLength bounds client-supplied dedup keys; a UUID is 36 characters
+const maxClientMsgIDLength = 64
+
+// ValidClientMsgID reports whether id is acceptable as a message dedup key:
+// at most 64 letters, digits, hyphens or underscores, as in a UUID
+func ValidClientMsgID(id string) bool {
+	if id == "" || len(id) > maxClientMsgIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// AddMessageToConversation stores a new message from senderID in the conversation,
+// linking any previously uploaded attachments to it
+func AddMessageToConversation(db *sql.DB, conversationID, senderID int, content string, attachments ...Attachment) (*Message, error) {
+	return AddMessageWithClientID(db, conversationID, senderID, content, "", 0, attachments...)
 }
 
-func AddMessageToConversation(db *sql.DB, conversationID, senderID int, content string) (*Message, error) {
+// AddMessageWithClientID stores a message tagged with the client's dedup key.
+// If the sender already sent a message with the same key, that message is
+// returned instead of inserting a duplicate, so clients can safely retry.
+// An empty key disables deduplication. A non-zero replyToID quotes that
+// message, which must be in the same conversation (ErrInvalidReply otherwise).
+// A sender outside the conversation gets ErrNotParticipant, or
+// ErrConversationNotFound if the conversation does not exist.
+func AddMessageWithClientID(db *sql.DB, conversationID, senderID int, content, clientMsgID string, replyToID int, attachments ...Attachment) (*Message, error) {
+	if clientMsgID != "" && !ValidClientMsgID(clientMsgID) {
+		log.Printf("[WARN] Rejected malformed client_msg_id from user %d", senderID)
+		return nil, ErrInvalidClientMsgID
+	}
+	if len(attachments) > MaxMessageAttachments {
+		log.Printf("[WARN] User %d tried to send %d attachments in one message", senderID, len(attachments))
+		return nil, ErrTooManyAttachments
+	}
+	if err := checkLength("content", content, maxMessageLength); err != nil {
+		return nil, err
+	}
+
 	tx, err := db.Begin()
 	if err != nil {
 		log.Printf("[ERROR] Failed to begin transaction for adding message: %v", err)
 		return nil, err
 	}
 	log.Printf("[DEBUG] Started transaction for adding message from user %d to conversation %d", senderID, conversationID)
-	contentPreview := truncateContent(content)
+	contentPreview := logutil.Preview(content)
 	log.Printf("[DEBUG] Content of message to be added: '%s'", contentPreview)
 
-	// Get recipient ID and check if they're online
-	var recipientID int
-	err = tx.QueryRow(`
+	// Only participants may post into a conversation
+	var isParticipant bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM conversation_participants WHERE conversation_id = ? AND user_id = ?)", conversationID, senderID).Scan(&isParticipant); err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to check whether user %d is in conversation %d: %v", senderID, conversationID, err)
+		return nil, err
+	}
+	if !isParticipant {
+		var exists bool
+		err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM conversation WHERE conversation_id = ?)", conversationID).Scan(&exists)
+		tx.Rollback()
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrConversationNotFound
+		}
+		log.Printf("[WARN] User %d tried to message conversation %d without being a participant", senderID, conversationID)
+		return nil, ErrNotParticipant
+	}
+
+	// Collect the other participants so their presence can be reported to the sender
+	rows, err := tx.Query(`
         SELECT user_id 
         FROM conversation_participants 
         WHERE conversation_id = ? AND user_id != ?
-        LIMIT 1
-    `, conversationID, senderID).Scan(&recipientID)
+    `, conversationID, senderID)
 	if err != nil {
 		tx.Rollback()
-		log.Printf("[ERROR] Failed to get recipient ID: %v", err)
+		log.Printf("[ERROR] Failed to get recipient IDs: %v", err)
 		return nil, err
 	}
+	var recipientIDs []int
+	for rows.Next() {
+		var recipientID int
+		if err := rows.Scan(&recipientID); err != nil {
+			rows.Close()
+			tx.Rollback()
+			log.Printf("[ERROR] Failed to scan recipient ID: %v", err)
+			return nil, err
+		}
+		recipientIDs = append(recipientIDs, recipientID)
+	}
+	rows.Close()
+	if len(recipientIDs) == 0 {
+		tx.Rollback()
+		log.Printf("[ERROR] Conversation %d has no recipients besides user %d", conversationID, senderID)
+		return nil, sql.ErrNoRows
+	}
 
-	// Check if recipient is online (for notification purposes, but allow offline messaging)
-	var isOnline bool
-	err = tx.QueryRow(`
-        SELECT EXISTS (
-            SELECT 1 FROM online_status
-            WHERE user_id = ?
-            AND status = 'online'
-            AND last_seen > datetime('now', '-5 minutes')
-        )
-    `, recipientID).Scan(&isOnline)
-	if err != nil {
-		log.Printf("[WARN] Failed to check recipient online status (continuing anyway): %v", err)
-		isOnline = false // Default to offline if check fails
+	// A block ends a direct conversation in both directions
+	if len(recipientIDs) == 1 {
+		blocked, err := isBlocked(tx, senderID, recipientIDs[0])
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if blocked {
+			tx.Rollback()
+			log.Printf("[WARN] User %d may not message user %d, one has blocked the other", senderID, recipientIDs[0])
+			return nil, ErrDMsNotAllowed
+		}
+	}
+
+	// Presence is informational only; offline recipients still receive the message
+	onlineCount := 0
+	for _, recipientID := range recipientIDs {
+		if isParticipantOnline(tx, recipientID) {
+			onlineCount++
+		}
 	}
 
-	log.Printf("[DEBUG] Recipient %d online status: %v (allowing message regardless)", recipientID, isOnline)
+	log.Printf("[DEBUG] %d of %d recipients online in conversation %d (allowing message regardless)", onlineCount, len(recipientIDs), conversationID)
+
+	if clientMsgID != "" {
+		var existingID int
+		err := tx.QueryRow("SELECT message_id FROM message WHERE sender_id = ? AND client_msg_id = ?", senderID, clientMsgID).Scan(&existingID)
+		if err == nil {
+			msg, err := getMessageTx(tx, existingID)
+			if err != nil {
+				tx.Rollback()
+				log.Printf("[ERROR] Failed to fetch existing message %d for client_msg_id: %v", existingID, err)
+				return nil, err
+			}
+			if msg.ConversationID != conversationID {
+				tx.Rollback()
+				log.Printf("[WARN] User %d reused client_msg_id of message %d in conversation %d", senderID, existingID, conversationID)
+				return nil, ErrClientMsgIDConflict
+			}
+			if err := tx.Commit(); err != nil {
+				log.Printf("[ERROR] Failed to commit transaction for message %d: %v", existingID, err)
+				return nil, err
+			}
+
+			msg.RecipientOnline = onlineCount > 0
+			if len(recipientIDs) > 1 {
+				msg.OnlineParticipants = onlineCount
+			}
+			log.Printf("[INFO] Message %d already stored for this client_msg_id, skipping duplicate send from user %d", existingID, senderID)
+			return msg, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			tx.Rollback()
+			log.Printf("[ERROR] Failed to look up client_msg_id for user %d: %v", senderID, err)
+			return nil, err
+		}
+	}
+
+	var replyTo interface{}
+	if replyToID != 0 {
+		if err := checkReplyTarget(tx, conversationID, replyToID); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		replyTo = replyToID
+	}
 
 	// Insert message regardless of recipient online status (modern chat behavior)
+	var clientKey interface{}
+	if clientMsgID != "" {
+		clientKey = clientMsgID
+	}
 	res, err := tx.Exec(`
-        INSERT INTO message (conversation_id, sender_id, content, sent_at, is_read)
-        VALUES (?, ?, ?, CURRENT_TIMESTAMP, 0)
-    `, conversationID, senderID, content)
+        INSERT INTO message (conversation_id, sender_id, content, sent_at, is_read, client_msg_id, reply_to_message_id)
+        VALUES (?, ?, ?, CURRENT_TIMESTAMP, 0, ?, ?)
+    `, conversationID, senderID, content, clientKey, replyTo)
 
 	if err != nil {
 		tx.Rollback()
@@ -522,60 +976,132 @@ func AddMessageToConversation(db *sql.DB, conversationID, senderID int, content
 	}
 	log.Printf("[DEBUG] Retrieved new message ID: %d", messageID)
 
+	if err := ClaimAttachments(tx, int(messageID), senderID, attachments); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	// The message the sender was composing has now been sent
+	if _, err := tx.Exec("DELETE FROM message_drafts WHERE conversation_id = ? AND user_id = ?", conversationID, senderID); err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to clear draft of user %d in conversation %d: %v", senderID, conversationID, err)
+		return nil, err
+	}
+
+	msg, err := getMessageTx(tx, int(messageID))
+	if err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to fetch message %d after insertion: %v", messageID, err)
+		return nil, err
+	}
+	log.Printf("[DEBUG] Fetched details for message ID %d", messageID)
+
+	msg.RecipientOnline = onlineCount > 0
+	if len(recipientIDs) > 1 {
+		msg.OnlineParticipants = onlineCount
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit transaction for message %d: %v", messageID, err)
+		return nil, err
+	}
+	log.Printf("[DEBUG] Committed transaction for message ID %d", messageID)
+
+	log.Printf("[INFO] Added message %d from user %d to conversation %d: '%s'", messageID, senderID, conversationID, logutil.Preview(content))
+	return msg, nil
+}
+
+// getMessageTx loads a single message with its sender's display name
+func getMessageTx(tx *sql.Tx, messageID int) (*Message, error) {
 	var msg Message
 	var sentAtStr string
-	err = tx.QueryRow(`
-		SELECT m.message_id, m.conversation_id, m.sender_id, u.Username, m.content, m.sent_at, m.is_read
+	var clientMsgID sql.NullString
+	var deliveredAt, editedAt sql.NullTime
+	var replyToID sql.NullInt64
+	err := tx.QueryRow(`
+		SELECT m.message_id, m.conversation_id, m.sender_id, `+displayNameColumn("u")+`, m.content, m.sent_at, m.is_read, m.client_msg_id, m.delivered_at, m.edited_at, m.reply_to_message_id
 		FROM message m
 		JOIN user u ON m.sender_id = u.userid
 		WHERE m.message_id = ?
 	`, messageID).Scan(
 		&msg.ID, &msg.ConversationID, &msg.SenderID, &msg.SenderName,
-		&msg.Content, &sentAtStr, &msg.IsRead,
+		&msg.Content, &sentAtStr, &msg.IsRead, &clientMsgID, &deliveredAt, &editedAt, &replyToID,
 	)
+	if err != nil {
+		return nil, err
+	}
+	msg.ClientMsgID = clientMsgID.String
+	msg.setStatus(deliveredAt)
+	if editedAt.Valid {
+		msg.EditedAt = &editedAt.Time
+	}
+	msg.ReplyToID = int(replyToID.Int64)
 
+	rows, err := tx.Query(`
+		SELECT attachment_id, message_id, url, mime, size FROM attachments
+		WHERE message_id = ?
+		ORDER BY attachment_id
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	msg.Attachments, err = scanAttachments(rows)
+	rows.Close()
 	if err != nil {
-		tx.Rollback()
-		log.Printf("[ERROR] Failed to fetch message %d after insertion: %v", messageID, err)
 		return nil, err
 	}
-	log.Printf("[DEBUG] Fetched details for message ID %d", messageID)
+
+	replies := []Message{msg}
+	if err := loadReplyPreviews(tx, replies); err != nil {
+		return nil, err
+	}
+	msg.ReplyTo = replies[0].ReplyTo
 
 	msg.SentAt, err = time.Parse(time.RFC3339, sentAtStr)
 	if err != nil {
 		layout := "2006-01-02 15:04:05"
 		msg.SentAt, err = time.Parse(layout, sentAtStr)
 		if err != nil {
-			log.Printf("[WARN] Failed to parse timestamp '%s' for new message %d: %v", sentAtStr, messageID, err)
+			log.Printf("[WARN] Failed to parse timestamp '%s' for message %d: %v", sentAtStr, messageID, err)
 			msg.SentAt = time.Time{}
 		}
 	}
-	log.Printf("[DEBUG] Parsed timestamp for message ID %d: %v", messageID, msg.SentAt)
+	return &msg, nil
+}
 
-	if err := tx.Commit(); err != nil {
-		log.Printf("[ERROR] Failed to commit transaction for message %d: %v", messageID, err)
-		return nil, err
+// isParticipantOnline asks the registered presence checker, falling back to a
+// recent online_status row when no live connection tracker is available
+func isParticipantOnline(tx *sql.Tx, userID int) bool {
+	if presenceChecker != nil {
+		return presenceChecker(userID)
 	}
-	log.Printf("[DEBUG] Committed transaction for message ID %d", messageID)
 
-	log.Printf("[INFO] Added message %d from user %d to conversation %d: '%s'", messageID, senderID, conversationID, truncateContent(content))
-	return &msg, nil
+	var isOnline bool
+	err := tx.QueryRow(`
+        SELECT EXISTS (
+            SELECT 1 FROM online_status
+            WHERE user_id = ?
+            AND status = 'online'
+            AND last_seen > datetime('now', '-5 minutes')
+        )
+    `, userID).Scan(&isOnline)
+	if err != nil {
+		log.Printf("[WARN] Failed to check online status for user %d (assuming offline): %v", userID, err)
+		return false
+	}
+	return isOnline
 }
 
+// GetConversationsWithIDs loads conversations by id. It has no viewer, so
+// UnreadCount is left at zero; use GetUserConversations for a user's inbox.
 func GetConversationsWithIDs(db *sql.DB, conversationIDs []int) ([]Conversation, error) {
 	if len(conversationIDs) == 0 {
 		log.Printf("[INFO] GetConversationsWithIDs called with empty ID list")
 		return []Conversation{}, nil
 	}
 
-	query := "SELECT conversation_id, created_at FROM conversation WHERE conversation_id IN ("
-	placeholders := make([]string, len(conversationIDs))
-	args := make([]interface{}, len(conversationIDs))
-	for i, id := range conversationIDs {
-		placeholders[i] = "?"
-		args[i] = id
-	}
-	query += fmt.Sprintf("%s)", strings.Join(placeholders, ","))
+	placeholders, args := inPlaceholders(conversationIDs)
+	query := "SELECT conversation_id, created_at FROM conversation WHERE conversation_id IN (" + placeholders + ")"
 
 	log.Printf("[DEBUG] Querying conversations with IDs: %v", conversationIDs)
 	rows, err := db.Query(query, args...)
@@ -596,43 +1122,17 @@ func GetConversationsWithIDs(db *sql.DB, conversationIDs []int) ([]Conversation,
 		}
 		log.Printf("[DEBUG] Scanned conversation ID %d", conv.ID)
 
-		users, err := getConversationParticipants(conv.ID, db)
-		if err != nil {
-			log.Printf("[ERROR] Failed to get participants for conversation %d: %v", conv.ID, err)
-			return nil, err
-		}
-		participants := make([]*User, len(users))
-		for i := range users {
-			participants[i] = &users[i]
-		}
-		conv.Participants = participants
-		log.Printf("[DEBUG] Retrieved %d participants for conversation %d", len(participants), conv.ID)
-
-		lastMsg, err := getLastMessage(conv.ID, db)
-		if err != nil && err != sql.ErrNoRows {
-			log.Printf("[ERROR] Failed to get last message for conversation %d: %v", conv.ID, err)
-		} else if err == sql.ErrNoRows {
-			conv.LastMessage = nil
-			log.Printf("[DEBUG] No last message found for conversation %d", conv.ID)
-		} else {
-			conv.LastMessage = &ChatMessage{
-				ID:             lastMsg.ID,
-				ConversationID: lastMsg.ConversationID,
-				SenderID:       lastMsg.SenderID,
-				SenderName:     lastMsg.SenderName,
-				Content:        lastMsg.Content,
-				SentAt:         lastMsg.SentAt,
-				IsRead:         lastMsg.IsRead,
-			}
-			log.Printf("[DEBUG] Retrieved last message ID %d for conversation %d", lastMsg.ID, conv.ID)
-		}
-
 		conversations = append(conversations, conv)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating conversations with IDs %v: %v", conversationIDs, err)
 		return nil, err
 	}
+	rows.Close()
+
+	if err := hydrateConversations(db, conversations); err != nil {
+		return nil, err
+	}
 
 	log.Printf("[INFO] Retrieved %d/%d conversations with requested IDs", len(conversations), len(conversationIDs))
 	return conversations, nil
@@ -653,32 +1153,18 @@ func CheckUserExists(db *sql.DB, userID int) (bool, error) {
 	return exists, nil
 }
 
+// GetUnreadMessageCount counts the user's unread messages in a conversation.
+// It goes by their read pointer, like the conversation lists, so one member
+// reading a group does not clear it for the others.
 func GetUnreadMessageCount(db *sql.DB, conversationID, userID int) (int, error) {
-	var count int
-
-	query := `
-		SELECT COUNT(*) FROM message m
-		WHERE m.conversation_id = ? 
-		AND m.sender_id != ? 
-		AND m.is_read = 0
-	`
-
-	log.Printf("[DEBUG] Retrieving unread message count for user %d in conversation %d", userID, conversationID)
-	err := db.QueryRow(query, conversationID, userID).Scan(&count)
-	if err != nil {
-		log.Printf("[ERROR] Failed to get unread message count for user %d in conversation %d: %v", userID, conversationID, err)
-		return 0, err
-	}
-
-	log.Printf("[INFO] User %d has %d unread messages in conversation %d", userID, count, conversationID)
-	return count, nil
+	return GetUnreadCountSinceLastRead(db, conversationID, userID)
 }
 
 func GetConversationParticipantsDetails(db *sql.DB, conversationID int) ([]*User, error) {
 	var participants []*User
 
 	query := `
-		SELECT u.userid, u.Username, u.Email, u.F_name, u.L_name, u.Avatar
+		SELECT u.userid, u.Username, u.Email, u.F_name, u.L_name, u.Avatar, ` + lastSeenColumn("u.userid") + `
 		FROM user u
 		JOIN conversation_participants cp ON u.userid = cp.user_id
 		WHERE cp.conversation_id = ?
@@ -695,17 +1181,18 @@ func GetConversationParticipantsDetails(db *sql.DB, conversationID int) ([]*User
 
 	for rows.Next() {
 		user := &User{}
-		var avatarNullable sql.NullString
+		var avatarNullable, lastSeen sql.NullString
 
 		if err := rows.Scan(
 			&user.ID, &user.Username, &user.Email,
-			&user.FirstName, &user.LastName, &avatarNullable,
+			&user.FirstName, &user.LastName, &avatarNullable, &lastSeen,
 		); err != nil {
 			log.Printf("[ERROR] Failed to scan participant details in conversation %d: %v", conversationID, err)
 			return nil, err
 		}
 
 		user.Avatar = avatarNullable
+		user.LastSeen = parseTimestamp(lastSeen)
 		log.Printf("[DEBUG] Scanned participant ID %d details for conversation %d", user.ID, conversationID)
 		participants = append(participants, user)
 	}
@@ -714,9 +1201,104 @@ func GetConversationParticipantsDetails(db *sql.DB, conversationID int) ([]*User
 	return participants, nil
 }
 
-func truncateContent(content string) string {
-	if len(content) > 50 {
-		return content[:47] + "..."
+// pruneBatchSize bounds how many messages PruneOldMessages deletes per transaction
+const pruneBatchSize = 500
+
+// pruneBatch selects the next batch of messages sent before the cutoff, keeping
+// the latest message of every conversation. It is ordered so that every
+// statement of one transaction sees the same batch.
+const pruneBatch = `
+	SELECT message_id FROM message
+	WHERE julianday(sent_at) < julianday(?)
+	AND message_id NOT IN (SELECT MAX(message_id) FROM message GROUP BY conversation_id)
+	ORDER BY message_id
+	LIMIT ?
+`
+
+// PruneOldMessages deletes messages sent before the retention window, keeping the
+// latest message of every conversation so list previews stay intact, together
+// with their attachments and edit history. Deletion runs in batches to avoid
+// holding long write locks. Returns the number of deleted messages.
+func PruneOldMessages(db *sql.DB, olderThan time.Duration) (int, error) {
+	if olderThan <= 0 {
+		return 0, fmt.Errorf("retention window must be positive")
+	}
+
+	cutoff := time.Now().Add(-olderThan).UTC().Format("2006-01-02 15:04:05")
+	log.Printf("[DEBUG] Pruning messages sent before %s", cutoff)
+
+	total := 0
+	for {
+		affected, attachmentURLs, err := pruneMessageBatch(db, cutoff)
+		if err != nil {
+			log.Printf("[ERROR] Failed to prune old messages after %d deletions: %v", total, err)
+			return total, err
+		}
+		for _, url := range attachmentURLs {
+			if err := uploads.Remove(url); err != nil {
+				log.Printf("[WARN] Failed to remove attachment %s of pruned message: %v", url, err)
+			}
+		}
+
+		total += affected
+		if affected < pruneBatchSize {
+			break
+		}
+	}
+
+	log.Printf("[INFO] Pruned %d messages sent before %s", total, cutoff)
+	return total, nil
+}
+
+// pruneMessageBatch deletes one batch of old messages and the rows hanging off
+// them in a single transaction, returning how many messages went and the URLs
+// of the attachment files the caller must remove now that it has committed
+func pruneMessageBatch(db *sql.DB, cutoff string) (int, []string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT url FROM attachments WHERE message_id IN ("+pruneBatch+")", cutoff, pruneBatchSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	attachmentURLs := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		attachmentURLs = append(attachmentURLs, url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	dependents := []string{
+		"DELETE FROM attachments WHERE message_id IN (" + pruneBatch + ")",
+		"DELETE FROM message_edits WHERE message_id IN (" + pruneBatch + ")",
+	}
+	for _, query := range dependents {
+		if _, err := tx.Exec(query, cutoff, pruneBatchSize); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM message WHERE message_id IN ("+pruneBatch+")", cutoff, pruneBatchSize)
+	if err != nil {
+		return 0, nil, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
 	}
-	return content
+	return int(affected), attachmentURLs, nil
 }
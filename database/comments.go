@@ -0,0 +1,143 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// DeletedCommentPlaceholder replaces the content of a soft-deleted comment
+const DeletedCommentPlaceholder = "[deleted]"
+
+// DuplicateCommentWindow is how long a user must wait before repeating the same
+// comment on the same post, which stops double submits and copy-paste spam
+const DuplicateCommentWindow = 10 * time.Second
+
+// checkDuplicateComment returns ErrDuplicateComment when userID already left
+// content on postID within DuplicateCommentWindow
+func checkDuplicateComment(db *sql.DB, postID, userID int, content string) error {
+	cutoff := time.Now().Add(-DuplicateCommentWindow).Format("2006-01-02 15:04:05")
+	var duplicate bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM comment
+			WHERE post_postid = ? AND user_userid = ? AND content = ? AND is_deleted = 0 AND comment_at >= ?
+		)`, postID, userID, content, cutoff).Scan(&duplicate)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check for duplicate comment on post %d: %v", postID, err)
+		return err
+	}
+	if duplicate {
+		log.Printf("[WARN] Rejected duplicate comment on post %d by user %d", postID, userID)
+		return ErrDuplicateComment
+	}
+	return nil
+}
+
+// GetCommentByID loads a comment with its author's name and avatar. A deleted
+// comment comes back as a tombstone. Returns sql.ErrNoRows if there is no such
+// comment.
+func GetCommentByID(db *sql.DB, commentID int) (Comment, error) {
+	var comment Comment
+	var editedAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT comment.commentid, comment.post_postid, comment.user_userid, user.F_name, user.L_name, user.Username, comment.content, comment.comment_at, `+avatarColumn("user")+`, comment.edited_at, comment.is_deleted
+		FROM comment
+		JOIN user ON comment.user_userid = user.userid
+		WHERE comment.commentid = ?`, commentID).
+		Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.FirstName, &comment.LastName, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.Avatar, &editedAt, &comment.IsDeleted)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[ERROR] Failed to load comment %d: %v", commentID, err)
+		}
+		return comment, err
+	}
+
+	finishComment(&comment, editedAt)
+	return comment, nil
+}
+
+// EditComment replaces the content of userID's comment and stamps edited_at.
+// Returns sql.ErrNoRows if the comment does not exist or was deleted, and
+// ErrNotCommentOwner if it belongs to someone else.
+func EditComment(db *sql.DB, commentID, userID int, content string) error {
+	log.Printf("[DEBUG] User %d editing comment %d", userID, commentID)
+
+	if err := checkLength("content", content, MaxCommentLength); err != nil {
+		return err
+	}
+
+	if err := checkCommentOwner(db, commentID, userID); err != nil {
+		return err
+	}
+
+	editedAt := time.Now().Format("2006-01-02 15:04:05")
+	res, err := db.Exec("UPDATE comment SET content = ?, edited_at = ? WHERE commentid = ? AND is_deleted = 0", content, editedAt, commentID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to edit comment %d: %v", commentID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[INFO] User %d edited comment %d", userID, commentID)
+	return nil
+}
+
+// DeleteComment soft-deletes userID's comment, leaving a tombstone in the
+// thread and dropping it from the post's comment count. Returns the same
+// errors as EditComment.
+func DeleteComment(db *sql.DB, commentID, userID int) error {
+	if err := checkCommentOwner(db, commentID, userID); err != nil {
+		return err
+	}
+	return RemoveComment(db, commentID)
+}
+
+// RemoveComment soft-deletes a comment without checking who wrote it. It is the
+// administrative override; requests from users should go through DeleteComment.
+// Returns sql.ErrNoRows if the comment does not exist or is already deleted.
+func RemoveComment(db *sql.DB, commentID int) error {
+	log.Printf("[DEBUG] Soft-deleting comment %d", commentID)
+
+	res, err := db.Exec("UPDATE comment SET is_deleted = 1 WHERE commentid = ? AND is_deleted = 0", commentID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to soft-delete comment %d: %v", commentID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("[INFO] Comment %d not found or already deleted", commentID)
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[INFO] Soft-deleted comment %d", commentID)
+	return nil
+}
+
+// checkCommentOwner confirms a live comment exists and was written by userID
+func checkCommentOwner(db *sql.DB, commentID, userID int) error {
+	var ownerID int
+	err := db.QueryRow("SELECT user_userid FROM comment WHERE commentid = ? AND is_deleted = 0", commentID).Scan(&ownerID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[ERROR] Failed to load comment %d: %v", commentID, err)
+		}
+		return err
+	}
+	if ownerID != userID {
+		log.Printf("[WARN] User %d is not the author of comment %d", userID, commentID)
+		return ErrNotCommentOwner
+	}
+	return nil
+}
+
+// finishComment fills the edit stamp and hides the content of a deleted comment
+func finishComment(comment *Comment, editedAt sql.NullTime) {
+	if editedAt.Valid {
+		comment.EditedAt = &editedAt.Time
+	}
+	if comment.IsDeleted {
+		comment.Content = DeletedCommentPlaceholder
+	}
+}
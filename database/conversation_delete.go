@@ -0,0 +1,218 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+
+	"connecthub/uploads"
+)
+
+// LeaveConversation removes userID from a conversation and returns the ids of
+// the participants who remain. When the last participant leaves, the
+// conversation and its messages are deleted. Returns ErrConversationNotFound
+// for an unknown conversation and ErrNotParticipant when the user is not in it.
+func LeaveConversation(db *sql.DB, conversationID, userID int) ([]int, error) {
+	log.Printf("[DEBUG] User %d leaving conversation %d", userID, conversationID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for user %d leaving conversation %d: %v", userID, conversationID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM conversation_participants WHERE conversation_id = ? AND user_id = ?", conversationID, userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to remove user %d from conversation %d: %v", userID, conversationID, err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		var exists bool
+		if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM conversation WHERE conversation_id = ?)", conversationID).Scan(&exists); err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, ErrConversationNotFound
+		}
+		return nil, ErrNotParticipant
+	}
+
+	if _, err := tx.Exec("DELETE FROM conversation_read_state WHERE conversation_id = ? AND user_id = ?", conversationID, userID); err != nil {
+		log.Printf("[ERROR] Failed to clear read state of user %d in conversation %d: %v", userID, conversationID, err)
+		return nil, err
+	}
+	if _, err := tx.Exec("DELETE FROM message_drafts WHERE conversation_id = ? AND user_id = ?", conversationID, userID); err != nil {
+		log.Printf("[ERROR] Failed to clear draft of user %d in conversation %d: %v", userID, conversationID, err)
+		return nil, err
+	}
+
+	remaining, err := participantIDs(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	var attachmentURLs []string
+	if len(remaining) == 0 {
+		if attachmentURLs, err = deleteConversationRows(tx, conversationID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit user %d leaving conversation %d: %v", userID, conversationID, err)
+		return nil, err
+	}
+	removeAttachmentFiles(conversationID, attachmentURLs)
+
+	log.Printf("[INFO] User %d left conversation %d, %d participants remain", userID, conversationID, len(remaining))
+	return remaining, nil
+}
+
+// DeleteConversation permanently removes a conversation for everyone on behalf
+// of userID, with its messages, attachments and read state, and returns the ids
+// of the participants it had. Any participant may delete a 1:1 chat; a group
+// only its creator, other members get ErrNotConversationCreator and should
+// leave instead. Returns ErrConversationNotFound if it does not exist and
+// ErrNotParticipant if userID is not in it.
+func DeleteConversation(db *sql.DB, conversationID, userID int) ([]int, error) {
+	log.Printf("[WARN] User %d permanently deleting conversation %d", userID, conversationID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for deleting conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var createdBy sql.NullInt64
+	err = tx.QueryRow("SELECT created_by FROM conversation WHERE conversation_id = ?", conversationID).Scan(&createdBy)
+	if err == sql.ErrNoRows {
+		return nil, ErrConversationNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to look up conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+
+	participants, err := participantIDs(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !containsID(participants, userID) {
+		return nil, ErrNotParticipant
+	}
+	if len(participants) > 2 && (!createdBy.Valid || int(createdBy.Int64) != userID) {
+		return nil, ErrNotConversationCreator
+	}
+
+	attachmentURLs, err := deleteConversationRows(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit deleting conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+	removeAttachmentFiles(conversationID, attachmentURLs)
+
+	log.Printf("[INFO] Deleted conversation %d and its %d participants", conversationID, len(participants))
+	return participants, nil
+}
+
+// containsID reports whether id is in ids
+func containsID(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// removeAttachmentFiles deletes the uploaded files of a deleted conversation.
+// Call only after the transaction removing their rows has committed.
+func removeAttachmentFiles(conversationID int, urls []string) {
+	for _, url := range urls {
+		if err := uploads.Remove(url); err != nil {
+			log.Printf("[WARN] Failed to remove attachment %s of deleted conversation %d: %v", url, conversationID, err)
+		}
+	}
+}
+
+// conversationAttachmentURLs lists the upload URLs attached to a conversation's messages
+func conversationAttachmentURLs(tx *sql.Tx, conversationID int) ([]string, error) {
+	rows, err := tx.Query(`
+		SELECT a.url FROM attachments a
+		JOIN message m ON m.message_id = a.message_id
+		WHERE m.conversation_id = ?`, conversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list attachments of conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// participantIDs lists a conversation's participants in ascending id order
+func participantIDs(tx *sql.Tx, conversationID int) ([]int, error) {
+	rows, err := tx.Query("SELECT user_id FROM conversation_participants WHERE conversation_id = ? ORDER BY user_id", conversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to list participants of conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// deleteConversationRows removes a conversation and everything hanging off it,
+// returning the URLs of the attachment files the caller must remove once the
+// transaction commits
+func deleteConversationRows(tx *sql.Tx, conversationID int) ([]string, error) {
+	attachmentURLs, err := conversationAttachmentURLs(tx, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := []string{
+		"DELETE FROM attachments WHERE message_id IN (SELECT message_id FROM message WHERE conversation_id = ?)",
+		"DELETE FROM message_edits WHERE message_id IN (SELECT message_id FROM message WHERE conversation_id = ?)",
+		"DELETE FROM message WHERE conversation_id = ?",
+		"DELETE FROM conversation_read_state WHERE conversation_id = ?",
+		"DELETE FROM message_drafts WHERE conversation_id = ?",
+		"DELETE FROM conversation_participants WHERE conversation_id = ?",
+	}
+	for _, query := range dependents {
+		if _, err := tx.Exec(query, conversationID); err != nil {
+			log.Printf("[ERROR] Failed to remove dependent rows of conversation %d: %v", conversationID, err)
+			return nil, err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM conversation WHERE conversation_id = ?", conversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to delete conversation %d: %v", conversationID, err)
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrConversationNotFound
+	}
+	return attachmentURLs, nil
+}
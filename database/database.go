@@ -6,12 +6,32 @@ import (
 	"os"
 	"strings"
 
+	"connecthub/logutil"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// DefaultPath is where the SQLite database lives unless SetPath is called
+const DefaultPath = "./database/main.db"
+
+var dbPath = DefaultPath
+
+// SetPath changes the database file used by DataBase and every handler that
+// opens its own connection. Call it before the server starts.
+func SetPath(path string) {
+	log.Printf("[INFO] Using database at %s", path)
+	dbPath = path
+	InvalidateCategoryCache()
+}
+
+// Path returns the database file in use
+func Path() string {
+	return dbPath
+}
+
 func DataBase() {
-	log.Printf("[DEBUG] Attempting to connect to SQLite database at ./database/main.db")
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	log.Printf("[DEBUG] Attempting to connect to SQLite database at %s", Path())
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Fatal("[FATAL] Failed to connect to the database: ", err)
 	}
@@ -43,6 +63,7 @@ func DataBase() {
 			title  TEXT NULL,
 			post_at DATETIME NOT NULL,
 			user_userid INTEGER NOT NULL,
+			slug TEXT,
 			FOREIGN KEY (user_userid) REFERENCES user(userid)
 		);`,
 
@@ -75,6 +96,8 @@ func DataBase() {
 			Avatar TEXT,
 			gender TEXT,
 			date_of_birth DATE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (current_session) REFERENCES session(sessionid)
 		);`,
 
@@ -114,12 +137,107 @@ func DataBase() {
 			FOREIGN KEY (user_id) REFERENCES user(userid)
 		);`,
 
+		`
+		CREATE TABLE IF NOT EXISTS conversation_read_state (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_read_message_id INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversation(conversation_id),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS post_reaction (
+			post_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			reaction TEXT NOT NULL DEFAULT 'like',
+			reacted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (post_id, user_id),
+			FOREIGN KEY (post_id) REFERENCES post(postid),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS attachments (
+			attachment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			uploader_id INTEGER NOT NULL,
+			url TEXT NOT NULL UNIQUE,
+			mime TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES message(message_id),
+			FOREIGN KEY (uploader_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS user_block (
+			blocker_id INTEGER NOT NULL,
+			blocked_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (blocker_id, blocked_id),
+			FOREIGN KEY (blocker_id) REFERENCES user(userid),
+			FOREIGN KEY (blocked_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS notification (
+			notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			post_id INTEGER,
+			actor_id INTEGER,
+			count INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			is_read INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES user(userid),
+			FOREIGN KEY (post_id) REFERENCES post(postid),
+			FOREIGN KEY (actor_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS user_privacy (
+			user_id INTEGER PRIMARY KEY,
+			show_last_seen INTEGER NOT NULL DEFAULT 1,
+			show_online INTEGER NOT NULL DEFAULT 1,
+			allow_dms_from TEXT NOT NULL DEFAULT 'everyone',
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS message_edits (
+			edit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			edited_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES message(message_id)
+		);`,
+
+		`
+		CREATE TABLE IF NOT EXISTS message_drafts (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversation(conversation_id),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
 		`CREATE INDEX IF NOT EXISTS idx_message_conversation ON message(conversation_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_message_sender ON message(sender_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_conversation_participants_user ON conversation_participants(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_conversation_participants_conv ON conversation_participants(conversation_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_online_status_user ON online_status(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_online_status_last_seen ON online_status(last_seen);`,
+		`CREATE INDEX IF NOT EXISTS idx_post_reaction_user ON post_reaction(user_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_attachments_message ON attachments(message_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_user_block_blocked ON user_block(blocked_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_notification_user ON notification(user_id, post_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_message_edits_message ON message_edits(message_id);`,
 	}
 
 	for i, query := range createTables {
@@ -133,6 +251,52 @@ func DataBase() {
 
 	log.Println("[INFO] Database tables initialized successfully")
 
+	// Bring databases created by older versions up to the current schema
+	columnMigrations := []struct {
+		table, column, definition string
+	}{
+		{"post", "slug", "TEXT"},
+		{"post", "image", "TEXT"},
+		{"message", "client_msg_id", "TEXT"},
+		{"post", "is_deleted", "INTEGER NOT NULL DEFAULT 0"},
+		{"post", "publish_at", "DATETIME"},
+		{"post", "is_pinned", "INTEGER NOT NULL DEFAULT 0"},
+		{"post", "is_profile_pinned", "INTEGER NOT NULL DEFAULT 0"},
+		{"comment", "edited_at", "DATETIME"},
+		{"comment", "is_deleted", "INTEGER NOT NULL DEFAULT 0"},
+		{"message", "delivered_at", "DATETIME"},
+		{"message", "edited_at", "DATETIME"},
+		{"message", "reply_to_message_id", "INTEGER"},
+		{"conversation", "created_by", "INTEGER"},
+		{"user_privacy", "show_online", "INTEGER NOT NULL DEFAULT 1"},
+		{"user_privacy", "allow_dms_from", "TEXT NOT NULL DEFAULT 'everyone'"},
+		// SQLite cannot add a column defaulting to CURRENT_TIMESTAMP, so
+		// accounts created before these columns existed keep NULL
+		{"user", "created_at", "DATETIME"},
+		{"user", "updated_at", "DATETIME"},
+	}
+
+	for _, m := range columnMigrations {
+		if err := ensureColumn(db, m.table, m.column, m.definition); err != nil {
+			log.Fatalf("[FATAL] Failed to add column %s.%s: %v", m.table, m.column, err)
+		}
+	}
+
+	postMigrationStatements := []string{
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_post_slug ON post(slug);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_message_client_msg_id ON message(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;`,
+	}
+
+	for i, query := range postMigrationStatements {
+		if _, err := db.Exec(query); err != nil {
+			log.Fatalf("[FATAL] Failed to run migration statement #%d: %v", i+1, err)
+		}
+	}
+
+	if err := backfillPostSlugs(db); err != nil {
+		log.Printf("[ERROR] Failed to backfill post slugs: %v", err)
+	}
+
 	var count int
 	log.Printf("[DEBUG] Checking if categories table is populated")
 	err = db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&count)
@@ -199,11 +363,14 @@ func DataBase() {
 	} else {
 		log.Printf("[INFO] Categories table already populated with %d entries, skipping insertion", count)
 	}
+
+	// Whatever was cached came from before this database was set up
+	InvalidateCategoryCache()
 }
 
 func DropDataBase() {
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for dropping tables")
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Fatal("[FATAL] Failed to connect to the database for dropping tables: ", err)
 	}
@@ -216,10 +383,18 @@ func DropDataBase() {
 	const DropPostHasCategoriesTable = `DROP TABLE IF EXISTS post_has_categories;`
 	const DropSessionsTable = `DROP TABLE IF EXISTS session;`
 	const DropUserTable = `DROP TABLE IF EXISTS user;`
+	const DropMessageDraftsTable = `DROP TABLE IF EXISTS message_drafts;`
 	const DropConversationTable = `DROP TABLE IF EXISTS conversation;`
 	const DropConversationParticipantsTable = `DROP TABLE IF EXISTS conversation_participants;`
 	const DropMessageTable = `DROP TABLE IF EXISTS message;`
+	const DropMessageEditsTable = `DROP TABLE IF EXISTS message_edits;`
 	const DropOnlineStatusTable = `DROP TABLE IF EXISTS online_status;`
+	const DropPostReactionTable = `DROP TABLE IF EXISTS post_reaction;`
+	const DropConversationReadStateTable = `DROP TABLE IF EXISTS conversation_read_state;`
+	const DropAttachmentsTable = `DROP TABLE IF EXISTS attachments;`
+	const DropUserBlockTable = `DROP TABLE IF EXISTS user_block;`
+	const DropNotificationTable = `DROP TABLE IF EXISTS notification;`
+	const DropUserPrivacyTable = `DROP TABLE IF EXISTS user_privacy;`
 
 	dropTableStatements := []string{
 		DropCategoriesTable,
@@ -228,10 +403,18 @@ func DropDataBase() {
 		DropPostHasCategoriesTable,
 		DropSessionsTable,
 		DropUserTable,
+		DropMessageDraftsTable,
 		DropConversationTable,
 		DropConversationParticipantsTable,
 		DropMessageTable,
+		DropMessageEditsTable,
 		DropOnlineStatusTable,
+		DropPostReactionTable,
+		DropConversationReadStateTable,
+		DropAttachmentsTable,
+		DropUserBlockTable,
+		DropNotificationTable,
+		DropUserPrivacyTable,
 	}
 
 	for i, stmt := range dropTableStatements {
@@ -246,37 +429,52 @@ func DropDataBase() {
 	log.Println("[INFO] Database tables dropped successfully")
 }
 
+// LoadTestData seeds the fixture set described in fixtures.go, the same
+// users, posts and conversations the test suite uses
 func LoadTestData() error {
-	log.Printf("[DEBUG] Attempting to connect to SQLite database for loading test data")
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
+	if err != nil {
+		log.Printf("[ERROR] Failed to connect to the database for loading test data: %v", err)
+		return err
+	}
+	defer db.Close()
+
+	return SeedFixtures(db)
+}
+
+// LoadDemoData loads the larger demo community from seed_data.sql into an
+// empty database
+func LoadDemoData() error {
+	log.Printf("[DEBUG] Attempting to connect to SQLite database for loading demo data")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
-		log.Fatal("[FATAL] Failed to connect to the database for loading test data: ", err)
+		log.Fatal("[FATAL] Failed to connect to the database for loading demo data: ", err)
 		return err
 	}
 	defer db.Close()
-	log.Printf("[INFO] Successfully connected to SQLite database for loading test data")
+	log.Printf("[INFO] Successfully connected to SQLite database for loading demo data")
 
 	// Check if user table is already populated
 	var count int
-	log.Printf("[DEBUG] Checking if user table is populated before loading test data")
+	log.Printf("[DEBUG] Checking if user table is populated before loading demo data")
 	err = db.QueryRow("SELECT COUNT(*) FROM user").Scan(&count)
 	if err != nil {
-		log.Printf("[ERROR] Failed to query user table count before loading test data: %v", err)
+		log.Printf("[ERROR] Failed to query user table count before loading demo data: %v", err)
 		return err
 	}
 	log.Printf("[INFO] User table contains %d records", count)
 	if count > 0 {
-		log.Printf("[INFO] Skipping test data loading as user table is already populated")
+		log.Printf("[INFO] Skipping demo data loading as user table is already populated")
 		return nil
 	}
 
-	log.Printf("[DEBUG] Reading seed data file for test data loading")
+	log.Printf("[DEBUG] Reading seed data file for demo data loading")
 	fileContent, err := os.ReadFile("./database/seed_data.sql")
 	if err != nil {
 		log.Printf("[ERROR] Failed to read seed data file: %v", err)
 		return err
 	}
-	log.Printf("[INFO] Successfully read seed data file for test data loading")
+	log.Printf("[INFO] Successfully read seed data file for demo data loading")
 
 	log.Printf("[INFO] Loaded %d bytes from seed_data.sql file", len(fileContent))
 
@@ -285,10 +483,10 @@ func LoadTestData() error {
 
 	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("[ERROR] Failed to start transaction for test data: %v", err)
+		log.Printf("[ERROR] Failed to start transaction for demo data: %v", err)
 		return err
 	}
-	log.Printf("[DEBUG] Started transaction for loading test data")
+	log.Printf("[DEBUG] Started transaction for loading demo data")
 
 	executedCount := 0
 	for i, statement := range statements {
@@ -301,29 +499,53 @@ func LoadTestData() error {
 		if err != nil {
 			tx.Rollback()
 			log.Printf("[ERROR] Failed to execute statement #%d: %v", i+1, err)
-			log.Printf("[ERROR] Statement: %s", truncateSQL(statement))
+			log.Printf("[ERROR] Statement: %s", logutil.Truncate(statement, sqlPreviewLength))
 			return err
 		}
 		executedCount++
 		if (executedCount % 10) == 0 {
-			log.Printf("[INFO] Executed %d statements for test data", executedCount)
+			log.Printf("[INFO] Executed %d statements for demo data", executedCount)
 		}
 	}
 
 	err = tx.Commit()
 	if err != nil {
-		log.Printf("[ERROR] Failed to commit transaction for test data: %v", err)
+		log.Printf("[ERROR] Failed to commit transaction for demo data: %v", err)
 		return err
 	}
-	log.Printf("[DEBUG] Committed transaction for loading test data")
+	log.Printf("[DEBUG] Committed transaction for loading demo data")
 
-	log.Printf("[INFO] Test data loaded successfully! Executed %d statements", executedCount)
+	log.Printf("[INFO] Demo data loaded successfully! Executed %d statements", executedCount)
 	return nil
 }
 
-func truncateSQL(sql string) string {
-	if len(sql) > 100 {
-		return sql[:97] + "..."
+// ensureColumn adds a column to an existing table if it is not already present
+func ensureColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return err
 	}
-	return sql
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if strings.EqualFold(name, column) {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Adding column %s.%s", table, column)
+	_, err = db.Exec("ALTER TABLE " + table + " ADD COLUMN " + column + " " + definition)
+	return err
 }
+
+// sqlPreviewLength caps how much of a statement is logged, in characters
+const sqlPreviewLength = 100
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Message delivery states, in the order a message moves through them
+const (
+	MessageStatusSent      = "sent"
+	MessageStatusDelivered = "delivered"
+	MessageStatusRead      = "read"
+)
+
+// MarkMessageDelivered stamps delivered_at the first time a message reaches a
+// recipient and returns the stamp. Later calls return the original time.
+func MarkMessageDelivered(db *sql.DB, messageID int) (time.Time, error) {
+	_, err := db.Exec("UPDATE message SET delivered_at = CURRENT_TIMESTAMP WHERE message_id = ? AND delivered_at IS NULL", messageID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to mark message %d delivered: %v", messageID, err)
+		return time.Time{}, err
+	}
+
+	var deliveredAt sql.NullTime
+	if err := db.QueryRow("SELECT delivered_at FROM message WHERE message_id = ?", messageID).Scan(&deliveredAt); err != nil {
+		log.Printf("[ERROR] Failed to read delivery time of message %d: %v", messageID, err)
+		return time.Time{}, err
+	}
+	return deliveredAt.Time, nil
+}
+
+// setStatus fills DeliveredAt and derives Status from the read and delivery state
+func (m *Message) setStatus(deliveredAt sql.NullTime) {
+	if deliveredAt.Valid {
+		m.DeliveredAt = &deliveredAt.Time
+	}
+
+	switch {
+	case m.IsRead:
+		m.Status = MessageStatusRead
+	case m.DeliveredAt != nil:
+		m.Status = MessageStatusDelivered
+	default:
+		m.Status = MessageStatusSent
+	}
+}
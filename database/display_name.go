@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Display name formats accepted by SetDisplayNameFormat
+const (
+	DisplayNameUsername = "username"
+	DisplayNameFullName = "full_name"
+)
+
+var displayNameFormat = DisplayNameUsername
+
+// SetDisplayNameFormat chooses how users are named on messages, typing
+// indicators and notifications. Call before serving.
+func SetDisplayNameFormat(format string) error {
+	switch format {
+	case DisplayNameUsername, DisplayNameFullName:
+		displayNameFormat = format
+		return nil
+	}
+	return fmt.Errorf("unknown display name format %q (want %q or %q)", format, DisplayNameUsername, DisplayNameFullName)
+}
+
+// DisplayNameFormat returns the format chosen with SetDisplayNameFormat
+func DisplayNameFormat() string {
+	return displayNameFormat
+}
+
+// DisplayName returns the name shown for the user in chat. In full-name mode a
+// user without a first or last name falls back to their username.
+func (u *User) DisplayName() string {
+	if displayNameFormat == DisplayNameFullName {
+		if name := strings.TrimSpace(strings.TrimSpace(u.FirstName) + " " + strings.TrimSpace(u.LastName)); name != "" {
+			return name
+		}
+	}
+	return u.Username
+}
+
+// GetDisplayName looks up the display name of a single user
+func GetDisplayName(db *sql.DB, userID int) (string, error) {
+	var name string
+	err := db.QueryRow("SELECT "+displayNameColumn("u")+" FROM user u WHERE u.userid = ?", userID).Scan(&name)
+	return name, err
+}
+
+// displayNameColumn is the SQL expression for the display name of the user table
+// aliased as alias, so queries that join senders agree with User.DisplayName
+func displayNameColumn(alias string) string {
+	if displayNameFormat == DisplayNameFullName {
+		return fmt.Sprintf("COALESCE(NULLIF(TRIM(TRIM(COALESCE(%[1]s.F_name, '')) || ' ' || TRIM(COALESCE(%[1]s.L_name, ''))), ''), %[1]s.Username)", alias)
+	}
+	return alias + ".Username"
+}
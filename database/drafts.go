@@ -0,0 +1,73 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// DraftMessage is the half-typed message a user left in a conversation's composer
+type DraftMessage struct {
+	ConversationID int       `json:"conversation_id"`
+	Content        string    `json:"content"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// SaveDraftMessage stores userID's draft for a conversation, replacing any
+// earlier one. Saving empty content clears the draft. Returns
+// ErrNotParticipant if the user is not in the conversation.
+func SaveDraftMessage(db *sql.DB, conversationID, userID int, content string) error {
+	if err := checkLength("content", content, maxMessageLength); err != nil {
+		return err
+	}
+
+	isParticipant, err := IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		return err
+	}
+	if !isParticipant {
+		log.Printf("[WARN] User %d tried to save a draft in conversation %d they are not in", userID, conversationID)
+		return ErrNotParticipant
+	}
+
+	if content == "" {
+		return DeleteDraftMessage(db, conversationID, userID)
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO message_drafts (conversation_id, user_id, content, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(conversation_id, user_id) DO UPDATE SET content = excluded.content, updated_at = excluded.updated_at
+	`, conversationID, userID, content)
+	if err != nil {
+		log.Printf("[ERROR] Failed to save draft of user %d in conversation %d: %v", userID, conversationID, err)
+		return err
+	}
+
+	log.Printf("[DEBUG] Saved draft of user %d in conversation %d", userID, conversationID)
+	return nil
+}
+
+// GetDraftMessage returns userID's draft for a conversation. Returns
+// sql.ErrNoRows if there is none.
+func GetDraftMessage(db *sql.DB, conversationID, userID int) (*DraftMessage, error) {
+	draft := DraftMessage{ConversationID: conversationID}
+	err := db.QueryRow("SELECT content, updated_at FROM message_drafts WHERE conversation_id = ? AND user_id = ?", conversationID, userID).
+		Scan(&draft.Content, &draft.UpdatedAt)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[ERROR] Failed to load draft of user %d in conversation %d: %v", userID, conversationID, err)
+		}
+		return nil, err
+	}
+	return &draft, nil
+}
+
+// DeleteDraftMessage clears userID's draft for a conversation, if any
+func DeleteDraftMessage(db *sql.DB, conversationID, userID int) error {
+	if _, err := db.Exec("DELETE FROM message_drafts WHERE conversation_id = ? AND user_id = ?", conversationID, userID); err != nil {
+		log.Printf("[ERROR] Failed to delete draft of user %d in conversation %d: %v", userID, conversationID, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import "errors"
+
+// Sentinel errors returned by the database layer so callers can tell
+// expected failures apart from genuine database errors.
+var (
+	// ErrInvalidCredentials is returned when the identifier is unknown or the password does not match
+	ErrInvalidCredentials = errors.New("invalid credentials")
+
+	// ErrInvalidClientMsgID is returned when a client-supplied message key is malformed
+	ErrInvalidClientMsgID = errors.New("invalid client_msg_id")
+
+	// ErrClientMsgIDConflict is returned when a sender reuses a message key in a different conversation
+	ErrClientMsgIDConflict = errors.New("client_msg_id already used in another conversation")
+
+	// ErrInvalidParticipants is returned when a conversation would have fewer than two distinct, valid users
+	ErrInvalidParticipants = errors.New("a conversation needs at least two distinct participants")
+
+	// ErrSelfConversation is returned when every participant id names the same user
+	ErrSelfConversation = errors.New("cannot start a conversation with yourself")
+
+	// ErrTooManyParticipants is returned when a group conversation exceeds MaxConversationParticipants
+	ErrTooManyParticipants = errors.New("too many conversation participants")
+
+	// ErrUnknownParticipant is returned when a participant id does not belong to any user
+	ErrUnknownParticipant = errors.New("participant does not exist")
+
+	// ErrUnknownUsername is returned when a username does not belong to any user
+	ErrUnknownUsername = errors.New("no user with that username")
+
+	// ErrUnknownCategory is returned when a post names a category that does not
+	// exist and ad-hoc categories are disabled
+	ErrUnknownCategory = errors.New("unknown category")
+
+	// ErrPostQuotaExceeded is returned when a user has already created the daily maximum of posts
+	ErrPostQuotaExceeded = errors.New("daily post limit reached")
+
+	// ErrCategoryExists is returned when creating a category whose name is already taken
+	ErrCategoryExists = errors.New("category already exists")
+
+	// ErrInvalidAttachment is returned when a message references a file the sender cannot attach
+	ErrInvalidAttachment = errors.New("attachment not found or already sent")
+
+	// ErrTooManyAttachments is returned when a message carries more than MaxMessageAttachments files
+	ErrTooManyAttachments = errors.New("too many attachments")
+
+	// ErrInvalidPinScope is returned when pinning a post to a listing that does not exist
+	ErrInvalidPinScope = errors.New("invalid pin scope")
+
+	// ErrPostNotFound is returned when commenting on a post that does not exist or is not published yet
+	ErrPostNotFound = errors.New("post not found")
+
+	// ErrPostDeleted is returned when commenting on a post that has been soft-deleted
+	ErrPostDeleted = errors.New("post has been deleted")
+
+	// ErrDuplicateComment is returned when a user repeats a comment on the same post within DuplicateCommentWindow
+	ErrDuplicateComment = errors.New("duplicate comment")
+
+	// ErrNotCommentOwner is returned when a user edits or deletes someone else's comment
+	ErrNotCommentOwner = errors.New("comment belongs to another user")
+
+	// ErrNotMessageOwner is returned when a user edits someone else's chat message
+	ErrNotMessageOwner = errors.New("message belongs to another user")
+
+	// ErrInvalidReply is returned when a message quotes one that is not in its conversation
+	ErrInvalidReply = errors.New("replied-to message is not in this conversation")
+
+	// ErrSelfBlock is returned when a user tries to block themselves
+	ErrSelfBlock = errors.New("cannot block yourself")
+
+	// ErrDMsNotAllowed is returned when a participant does not accept new conversations from the creator
+	ErrDMsNotAllowed = errors.New("participant does not accept messages from you")
+
+	// ErrInvalidPrivacy is returned when privacy settings name an unknown allow_dms_from value
+	ErrInvalidPrivacy = errors.New("invalid privacy settings")
+
+	// ErrNotParticipant is returned when a user acts on a conversation they are not part of
+	ErrNotParticipant = errors.New("user is not a participant in the conversation")
+
+	// ErrNotConversationCreator is returned when a group member other than its creator tries to delete it for everyone
+	ErrNotConversationCreator = errors.New("only the creator can delete a group conversation")
+
+	// ErrConversationNotFound is returned when a conversation id matches no conversation
+	ErrConversationNotFound = errors.New("conversation not found")
+
+	// ErrUnsupportedFormat is returned when an export is requested in a format that is not offered
+	ErrUnsupportedFormat = errors.New("unsupported export format")
+
+	// ErrTooLong is wrapped by LengthError when text exceeds its field's limit
+	ErrTooLong = errors.New("text too long")
+)
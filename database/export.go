@@ -0,0 +1,348 @@
+package database
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ExportProfile is the account section of a data export. The password hash and
+// session token are deliberately left out.
+type ExportProfile struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Email       string `json:"email"`
+	Gender      string `json:"gender,omitempty"`
+	DateOfBirth string `json:"date_of_birth,omitempty"`
+	Avatar      string `json:"avatar,omitempty"`
+}
+
+// ExportPost is a post written by the exporting user
+type ExportPost struct {
+	ID         int      `json:"id"`
+	Title      string   `json:"title"`
+	Content    string   `json:"content"`
+	Image      string   `json:"image,omitempty"`
+	PostedAt   string   `json:"posted_at"`
+	Categories []string `json:"categories"`
+}
+
+// ExportComment is a comment written by the exporting user
+type ExportComment struct {
+	ID          int    `json:"id"`
+	PostID      int    `json:"post_id"`
+	Content     string `json:"content"`
+	CommentedAt string `json:"commented_at"`
+}
+
+// ExportedConversation is a conversation the exporting user takes part in
+type ExportedConversation struct {
+	ID           int      `json:"id"`
+	CreatedAt    string   `json:"created_at"`
+	Participants []string `json:"participants"`
+}
+
+// ExportMessage is a message from one of the exporting user's conversations
+type ExportMessage struct {
+	ID             int    `json:"id"`
+	ConversationID int    `json:"conversation_id"`
+	SenderID       int    `json:"sender_id"`
+	SenderName     string `json:"sender_name"`
+	Content        string `json:"content"`
+	SentAt         string `json:"sent_at"`
+}
+
+// ExportUserData assembles everything stored about a user into one JSON
+// document. Prefer WriteUserData when the result goes straight to a writer.
+func ExportUserData(db *sql.DB, userID int) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteUserData(db, userID, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteUserData streams a user's profile, posts, comments, conversations and
+// messages to w as a single JSON object. Rows are encoded as they are read so
+// memory use stays flat however much the user has written. Messages are limited
+// to conversations the user participates in; other people's posts and comments
+// are never included. Returns sql.ErrNoRows if the user does not exist.
+func WriteUserData(db *sql.DB, userID int, w io.Writer) error {
+	log.Printf("[DEBUG] Exporting data for user %d", userID)
+
+	user, err := GetUserByID(db, userID)
+	if err != nil {
+		return err
+	}
+
+	profile := ExportProfile{
+		ID:          user.ID,
+		Username:    user.Username,
+		FirstName:   user.FirstName,
+		LastName:    user.LastName,
+		Email:       user.Email,
+		Gender:      user.Gender,
+		DateOfBirth: user.DateOfBirth,
+		Avatar:      user.Avatar.String,
+	}
+
+	ew := &exportWriter{w: w, enc: json.NewEncoder(w)}
+	ew.raw("{")
+	ew.field("exported_at", time.Now().UTC().Format(time.RFC3339))
+	ew.raw(",")
+	ew.field("profile", profile)
+	if ew.err != nil {
+		return ew.err
+	}
+
+	sections := []struct {
+		name  string
+		query string
+		scan  func(*sql.Rows) (interface{}, error)
+	}{
+		{"posts", `
+			SELECT p.postid, p.title, p.content, COALESCE(p.image, ''), p.post_at,
+				COALESCE((SELECT GROUP_CONCAT(c.name, ',')
+					FROM post_has_categories pc
+					JOIN categories c ON pc.categories_idcategories = c.idcategories
+					WHERE pc.post_postid = p.postid), '')
+			FROM post p
+			WHERE p.user_userid = ?
+			ORDER BY p.post_at, p.postid`, scanExportPost},
+		{"comments", `
+			SELECT commentid, post_postid, COALESCE(content, ''), COALESCE(comment_at, '')
+			FROM comment
+			WHERE user_userid = ?
+			ORDER BY comment_at, commentid`, scanExportComment},
+		{"conversations", `
+			SELECT c.conversation_id, c.created_at,
+				(SELECT GROUP_CONCAT(u.Username, ',')
+					FROM conversation_participants cp2
+					JOIN user u ON cp2.user_id = u.userid
+					WHERE cp2.conversation_id = c.conversation_id)
+			FROM conversation c
+			JOIN conversation_participants cp ON cp.conversation_id = c.conversation_id
+			WHERE cp.user_id = ?
+			ORDER BY c.conversation_id`, scanExportConversation},
+		{"messages", `
+			SELECT m.message_id, m.conversation_id, m.sender_id, u.Username, m.content, m.sent_at
+			FROM message m
+			JOIN user u ON m.sender_id = u.userid
+			JOIN conversation_participants cp ON cp.conversation_id = m.conversation_id AND cp.user_id = ?
+			ORDER BY m.conversation_id, m.message_id`, scanExportMessage},
+	}
+
+	for _, section := range sections {
+		if err := ew.array(db, section.name, section.query, userID, section.scan); err != nil {
+			log.Printf("[ERROR] Failed to export %s for user %d: %v", section.name, userID, err)
+			return err
+		}
+	}
+
+	ew.raw("}")
+	if ew.err != nil {
+		return ew.err
+	}
+
+	log.Printf("[INFO] Exported data for user %d", userID)
+	return nil
+}
+
+// exportWriter writes a JSON object piece by piece, remembering the first error
+type exportWriter struct {
+	w   io.Writer
+	enc *json.Encoder
+	err error
+}
+
+func (ew *exportWriter) raw(s string) {
+	if ew.err == nil {
+		_, ew.err = io.WriteString(ew.w, s)
+	}
+}
+
+func (ew *exportWriter) value(v interface{}) {
+	if ew.err == nil {
+		ew.err = ew.enc.Encode(v)
+	}
+}
+
+func (ew *exportWriter) field(name string, v interface{}) {
+	ew.raw(fmt.Sprintf("%q:", name))
+	ew.value(v)
+}
+
+// array runs query and writes each scanned row as an element of a JSON array
+func (ew *exportWriter) array(db *sql.DB, name, query string, userID int, scan func(*sql.Rows) (interface{}, error)) error {
+	rows, err := db.Query(query, userID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	ew.raw(fmt.Sprintf(",%q:[", name))
+	first := true
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if !first {
+			ew.raw(",")
+		}
+		first = false
+		ew.value(item)
+		if ew.err != nil {
+			return ew.err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	ew.raw("]")
+	return ew.err
+}
+
+func scanExportPost(rows *sql.Rows) (interface{}, error) {
+	var p ExportPost
+	var categories string
+	if err := rows.Scan(&p.ID, &p.Title, &p.Content, &p.Image, &p.PostedAt, &categories); err != nil {
+		return nil, err
+	}
+	p.Categories = splitExportList(categories)
+	return p, nil
+}
+
+func scanExportComment(rows *sql.Rows) (interface{}, error) {
+	var c ExportComment
+	err := rows.Scan(&c.ID, &c.PostID, &c.Content, &c.CommentedAt)
+	return c, err
+}
+
+func scanExportConversation(rows *sql.Rows) (interface{}, error) {
+	var c ExportedConversation
+	var participants string
+	if err := rows.Scan(&c.ID, &c.CreatedAt, &participants); err != nil {
+		return nil, err
+	}
+	c.Participants = splitExportList(participants)
+	return c, nil
+}
+
+func scanExportMessage(rows *sql.Rows) (interface{}, error) {
+	var m ExportMessage
+	err := rows.Scan(&m.ID, &m.ConversationID, &m.SenderID, &m.SenderName, &m.Content, &m.SentAt)
+	return m, err
+}
+
+// splitExportList turns a GROUP_CONCAT result into a non-nil slice
+func splitExportList(list string) []string {
+	if list == "" {
+		return []string{}
+	}
+	return strings.Split(list, ",")
+}
+
+// Conversation export formats
+const (
+	ExportFormatJSON = "json"
+	ExportFormatCSV  = "csv"
+)
+
+// ConversationTranscript is the JSON form of a conversation export
+type ConversationTranscript struct {
+	ConversationID int             `json:"conversation_id"`
+	ExportedAt     string          `json:"exported_at"`
+	Participants   []string        `json:"participants"`
+	Messages       []ExportMessage `json:"messages"`
+}
+
+// ExportConversation returns a transcript of every message in conversationID,
+// oldest first, as JSON or CSV. Only participants may export a conversation;
+// anyone else gets ErrNotParticipant. An unknown format returns
+// ErrUnsupportedFormat.
+func ExportConversation(db *sql.DB, conversationID, userID int, format string) ([]byte, error) {
+	if format != ExportFormatJSON && format != ExportFormatCSV {
+		return nil, ErrUnsupportedFormat
+	}
+
+	isParticipant, err := IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant {
+		return nil, ErrNotParticipant
+	}
+
+	transcript := ConversationTranscript{
+		ConversationID: conversationID,
+		ExportedAt:     time.Now().UTC().Format(time.RFC3339),
+		Participants:   []string{},
+		Messages:       []ExportMessage{},
+	}
+
+	var participants sql.NullString
+	err = db.QueryRow(`
+		SELECT GROUP_CONCAT(`+displayNameColumn("u")+`, ',')
+		FROM conversation_participants cp
+		JOIN user u ON cp.user_id = u.userid
+		WHERE cp.conversation_id = ?`, conversationID).Scan(&participants)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load participants for conversation %d export: %v", conversationID, err)
+		return nil, err
+	}
+	transcript.Participants = splitExportList(participants.String)
+
+	rows, err := db.Query(`
+		SELECT m.message_id, m.conversation_id, m.sender_id, `+displayNameColumn("u")+`, m.content, m.sent_at
+		FROM message m
+		JOIN user u ON m.sender_id = u.userid
+		WHERE m.conversation_id = ?
+		ORDER BY m.sent_at, m.message_id`, conversationID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load messages for conversation %d export: %v", conversationID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scanExportMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		transcript.Messages = append(transcript.Messages, item.(ExportMessage))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] User %d exported %d messages from conversation %d as %s", userID, len(transcript.Messages), conversationID, format)
+	if format == ExportFormatCSV {
+		return transcriptCSV(transcript)
+	}
+	return json.Marshal(transcript)
+}
+
+// transcriptCSV renders a transcript as CSV with a header row
+func transcriptCSV(transcript ConversationTranscript) ([]byte, error) {
+	var buf bytes.Buffer
+	cw := csv.NewWriter(&buf)
+	cw.Write([]string{"message_id", "sent_at", "sender_id", "sender_name", "content"})
+	for _, m := range transcript.Messages {
+		cw.Write([]string{strconv.Itoa(m.ID), m.SentAt, strconv.Itoa(m.SenderID), m.SenderName, m.Content})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// FixturePassword is the password of every fixture user
+const FixturePassword = "password123"
+
+// FixtureUser is a user created by SeedFixtures. ID is the userid it gets.
+type FixtureUser struct {
+	ID          int
+	FirstName   string
+	LastName    string
+	Username    string
+	Email       string
+	Gender      string
+	DateOfBirth string
+	Avatar      string
+}
+
+// FixturePost is a post created by SeedFixtures, filed under Categories,
+// which are created if missing
+type FixturePost struct {
+	ID         int
+	UserID     int
+	Title      string
+	Content    string
+	PostAt     string
+	Categories []string
+}
+
+// FixtureComment is a comment created by SeedFixtures
+type FixtureComment struct {
+	ID        int
+	PostID    int
+	UserID    int
+	Content   string
+	CommentAt string
+}
+
+// FixtureMessage is one message of a FixtureConversation
+type FixtureMessage struct {
+	SenderID int
+	Content  string
+	SentAt   string
+}
+
+// FixtureConversation is a conversation created by SeedFixtures
+type FixtureConversation struct {
+	ID           int
+	CreatedAt    string
+	Participants []int
+	Messages     []FixtureMessage
+}
+
+// FixtureUsers are the users SeedFixtures creates, all with FixturePassword
+var FixtureUsers = []FixtureUser{
+	{ID: 1, FirstName: "John", LastName: "Doe", Username: "johndoe", Email: "john@example.com", Gender: "male", DateOfBirth: "1990-01-01", Avatar: MaleAvatar},
+	{ID: 2, FirstName: "Jane", LastName: "Smith", Username: "janesmith", Email: "jane@example.com", Gender: "female", DateOfBirth: "1992-05-15", Avatar: FemaleAvatar},
+	{ID: 3, FirstName: "Bob", LastName: "Johnson", Username: "bobjohnson", Email: "bob@example.com", Gender: "male", DateOfBirth: "1988-12-10", Avatar: MaleAvatar},
+	{ID: 4, FirstName: "Alice", LastName: "Brown", Username: "alicebrown", Email: "alice@example.com", Gender: "female", DateOfBirth: "1995-03-20", Avatar: FemaleAvatar},
+	{ID: 5, FirstName: "Charlie", LastName: "Wilson", Username: "charliewilson", Email: "charlie@example.com", Gender: "male", DateOfBirth: "1987-08-05", Avatar: MaleAvatar},
+}
+
+// FixturePosts are the posts SeedFixtures creates, one per fixture user
+var FixturePosts = []FixturePost{
+	{ID: 1, UserID: 1, Title: "Welcome to the Forum", Content: "This is the first post on our forum! Welcome everyone!", PostAt: "2024-01-01 09:00:00", Categories: []string{"General"}},
+	{ID: 2, UserID: 2, Title: "Technology Discussion", Content: "Let's talk about the latest tech trends and innovations.", PostAt: "2024-01-02 09:00:00", Categories: []string{"Technology"}},
+	{ID: 3, UserID: 3, Title: "Sports Update", Content: "Latest sports news and updates from around the world.", PostAt: "2024-01-03 09:00:00", Categories: []string{"Sports"}},
+	{ID: 4, UserID: 4, Title: "Entertainment News", Content: "What's happening in the world of entertainment?", PostAt: "2024-01-04 09:00:00", Categories: []string{"Entertainment"}},
+	{ID: 5, UserID: 5, Title: "Science Discoveries", Content: "Amazing scientific breakthroughs and discoveries.", PostAt: "2024-01-05 09:00:00", Categories: []string{"Science"}},
+}
+
+// FixtureComments are the comments SeedFixtures creates
+var FixtureComments = []FixtureComment{
+	{ID: 1, PostID: 1, UserID: 2, Content: "Great post! Thanks for sharing this information.", CommentAt: "2024-01-01 10:00:00"},
+	{ID: 2, PostID: 1, UserID: 3, Content: "I completely agree with your points here.", CommentAt: "2024-01-01 11:00:00"},
+	{ID: 3, PostID: 2, UserID: 1, Content: "Very interesting topic, looking forward to more discussions.", CommentAt: "2024-01-02 10:00:00"},
+	{ID: 4, PostID: 3, UserID: 4, Content: "Thanks for the update! This is very helpful.", CommentAt: "2024-01-03 10:00:00"},
+	{ID: 5, PostID: 4, UserID: 5, Content: "Excellent analysis and well-written post.", CommentAt: "2024-01-04 10:00:00"},
+}
+
+// FixtureConversations are the conversations SeedFixtures creates: a direct
+// chat between the first two users and a group of the first three
+var FixtureConversations = []FixtureConversation{
+	{
+		ID: 1, CreatedAt: "2024-01-06 09:00:00", Participants: []int{1, 2},
+		Messages: []FixtureMessage{
+			{SenderID: 1, Content: "Hi Jane, how are you?", SentAt: "2024-01-06 09:00:00"},
+			{SenderID: 2, Content: "Doing well, thanks John!", SentAt: "2024-01-06 09:01:00"},
+		},
+	},
+	{
+		ID: 2, CreatedAt: "2024-01-07 09:00:00", Participants: []int{1, 2, 3},
+		Messages: []FixtureMessage{
+			{SenderID: 3, Content: "Welcome to the group chat.", SentAt: "2024-01-07 09:00:00"},
+		},
+	},
+}
+
+// SeedFixtures fills an empty database with the fixture users, posts,
+// comments and conversations, so their ids and credentials are the same on
+// every run. A database that already has users is left untouched.
+func SeedFixtures(db *sql.DB) error {
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM user").Scan(&count); err != nil {
+		log.Printf("[ERROR] Failed to count users before seeding fixtures: %v", err)
+		return err
+	}
+	if count > 0 {
+		log.Printf("[INFO] Skipping fixtures, user table already has %d records", count)
+		return nil
+	}
+
+	// Every fixture user shares a password, so it is hashed once
+	hashedPassword, err := hashPassword(FixturePassword)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range FixtureUsers {
+		_, err := tx.Exec(`INSERT INTO user (userid, F_name, L_name, Username, Email, gender, date_of_birth, password, Avatar)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			u.ID, u.FirstName, u.LastName, u.Username, u.Email, u.Gender, u.DateOfBirth, hashedPassword, u.Avatar)
+		if err != nil {
+			return fmt.Errorf("fixture user %s: %w", u.Username, err)
+		}
+	}
+
+	for _, p := range FixturePosts {
+		_, err := tx.Exec("INSERT INTO post (postid, title, content, post_at, user_userid, slug) VALUES (?, ?, ?, ?, ?, ?)",
+			p.ID, p.Title, p.Content, p.PostAt, p.UserID, Slugify(p.Title))
+		if err != nil {
+			return fmt.Errorf("fixture post %d: %w", p.ID, err)
+		}
+		for _, name := range p.Categories {
+			categoryID, err := fixtureCategory(tx, name)
+			if err != nil {
+				return fmt.Errorf("fixture category %s: %w", name, err)
+			}
+			if _, err := tx.Exec("INSERT INTO post_has_categories (post_postid, categories_idcategories) VALUES (?, ?)", p.ID, categoryID); err != nil {
+				return fmt.Errorf("fixture post %d category %s: %w", p.ID, name, err)
+			}
+		}
+	}
+
+	for _, c := range FixtureComments {
+		_, err := tx.Exec("INSERT INTO comment (commentid, content, comment_at, post_postid, user_userid) VALUES (?, ?, ?, ?, ?)",
+			c.ID, c.Content, c.CommentAt, c.PostID, c.UserID)
+		if err != nil {
+			return fmt.Errorf("fixture comment %d: %w", c.ID, err)
+		}
+	}
+
+	for _, conv := range FixtureConversations {
+		if _, err := tx.Exec("INSERT INTO conversation (conversation_id, created_at) VALUES (?, ?)", conv.ID, conv.CreatedAt); err != nil {
+			return fmt.Errorf("fixture conversation %d: %w", conv.ID, err)
+		}
+		for _, userID := range conv.Participants {
+			if _, err := tx.Exec("INSERT INTO conversation_participants (conversation_id, user_id) VALUES (?, ?)", conv.ID, userID); err != nil {
+				return fmt.Errorf("fixture conversation %d participant %d: %w", conv.ID, userID, err)
+			}
+		}
+		for _, m := range conv.Messages {
+			if _, err := tx.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at) VALUES (?, ?, ?, ?)",
+				conv.ID, m.SenderID, m.Content, m.SentAt); err != nil {
+				return fmt.Errorf("fixture conversation %d message: %w", conv.ID, err)
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	log.Printf("[INFO] Seeded %d fixture users, %d posts, %d comments and %d conversations",
+		len(FixtureUsers), len(FixturePosts), len(FixtureComments), len(FixtureConversations))
+	return nil
+}
+
+// fixtureCategory returns the id of the category called name, creating it if needed
+func fixtureCategory(tx *sql.Tx, name string) (int, error) {
+	var id int
+	err := tx.QueryRow("SELECT idcategories FROM categories WHERE name = ? COLLATE NOCASE ORDER BY idcategories LIMIT 1", name).Scan(&id)
+	if err == sql.ErrNoRows {
+		res, err := tx.Exec("INSERT INTO categories (name) VALUES (?)", name)
+		if err != nil {
+			return 0, err
+		}
+		newID, err := res.LastInsertId()
+		return int(newID), err
+	}
+	return id, err
+}
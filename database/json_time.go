@@ -0,0 +1,62 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// jsonTime is how API responses carry timestamps: RFC 3339 in UTC, or null
+// for a zero time so clients never see the year-1 sentinel left behind by a
+// stored value that failed to parse
+type jsonTime time.Time
+
+func (t jsonTime) MarshalJSON() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(time.Time(t).UTC().Format(time.RFC3339))
+}
+
+// MarshalJSON encodes the post with PostAt as a jsonTime
+func (p Post) MarshalJSON() ([]byte, error) {
+	type post Post
+	return json.Marshal(struct {
+		post
+		PostAt jsonTime
+	}{post(p), jsonTime(p.PostAt)})
+}
+
+// MarshalJSON encodes the comment with CreatedAt as a jsonTime
+func (c Comment) MarshalJSON() ([]byte, error) {
+	type comment Comment
+	return json.Marshal(struct {
+		comment
+		CreatedAt jsonTime
+	}{comment(c), jsonTime(c.CreatedAt)})
+}
+
+// MarshalJSON encodes the message with SentAt as a jsonTime
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	return json.Marshal(struct {
+		message
+		SentAt jsonTime `json:"sent_at"`
+	}{message(m), jsonTime(m.SentAt)})
+}
+
+// parseTimestamp reads a nullable column filled from CURRENT_TIMESTAMP, which
+// SQLite stores as UTC text, returning nil for NULL or unparseable values
+func parseTimestamp(value sql.NullString) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04:05", time.RFC3339} {
+		if t, err := time.Parse(layout, value.String); err == nil {
+			return &t
+		}
+	}
+	log.Printf("[WARN] Failed to parse timestamp '%s'", value.String)
+	return nil
+}
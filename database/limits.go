@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"unicode/utf8"
+)
+
+// Length limits for user-written text, counted in characters
+const (
+	MaxTitleLength       = 200
+	MaxPostContentLength = 10000
+	MaxCommentLength     = 2000
+)
+
+// maxMessageLength caps chat message content; see SetMaxMessageLength
+var maxMessageLength = 4000
+
+// SetMaxMessageLength changes the chat message limit to match the server's
+// configured max_message_length. Call before serving.
+func SetMaxMessageLength(n int) {
+	maxMessageLength = n
+}
+
+// LengthError reports which field exceeded its limit. It matches ErrTooLong
+// with errors.Is.
+type LengthError struct {
+	Field string
+	Max   int
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("%s is too long (max %d characters)", e.Field, e.Max)
+}
+
+func (e *LengthError) Unwrap() error {
+	return ErrTooLong
+}
+
+// checkLength rejects value if it has more than max characters
+func checkLength(field, value string, max int) error {
+	if n := utf8.RuneCountInString(value); n > max {
+		log.Printf("[WARN] Rejected %s of %d characters (max %d)", field, n, max)
+		return &LengthError{Field: field, Max: max}
+	}
+	return nil
+}
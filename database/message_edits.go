@@ -0,0 +1,113 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// MessageEdit is an earlier version of a chat message, kept when the sender
+// edits it
+type MessageEdit struct {
+	ID        int       `json:"id"`
+	MessageID int       `json:"message_id"`
+	Content   string    `json:"content"`
+	EditedAt  time.Time `json:"edited_at"`
+}
+
+// EditMessage replaces the content of userID's message and stamps edited_at.
+// The previous content is appended to message_edits so the history can be
+// shown later. Returns sql.ErrNoRows if the message does not exist and
+// ErrNotMessageOwner if someone else sent it.
+func EditMessage(db *sql.DB, messageID, userID int, content string) error {
+	log.Printf("[DEBUG] User %d editing message %d", userID, messageID)
+
+	if err := checkLength("content", content, maxMessageLength); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for editing message %d: %v", messageID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var senderID int
+	var previous string
+	err = tx.QueryRow("SELECT sender_id, content FROM message WHERE message_id = ?", messageID).Scan(&senderID, &previous)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[ERROR] Failed to load message %d: %v", messageID, err)
+		}
+		return err
+	}
+	if senderID != userID {
+		log.Printf("[WARN] User %d is not the sender of message %d", userID, messageID)
+		return ErrNotMessageOwner
+	}
+
+	editedAt := time.Now().Format("2006-01-02 15:04:05")
+	if _, err := tx.Exec("INSERT INTO message_edits (message_id, content, edited_at) VALUES (?, ?, ?)", messageID, previous, editedAt); err != nil {
+		log.Printf("[ERROR] Failed to record previous content of message %d: %v", messageID, err)
+		return err
+	}
+	if _, err := tx.Exec("UPDATE message SET content = ?, edited_at = ? WHERE message_id = ?", content, editedAt, messageID); err != nil {
+		log.Printf("[ERROR] Failed to edit message %d: %v", messageID, err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit edit of message %d: %v", messageID, err)
+		return err
+	}
+
+	log.Printf("[INFO] User %d edited message %d", userID, messageID)
+	return nil
+}
+
+// GetMessageHistory returns the earlier versions of a message, oldest first.
+// Only participants of the message's conversation may read it. Returns
+// sql.ErrNoRows if the message does not exist and ErrNotParticipant if userID
+// is not in the conversation.
+func GetMessageHistory(db *sql.DB, messageID, userID int) ([]MessageEdit, error) {
+	var conversationID int
+	err := db.QueryRow("SELECT conversation_id FROM message WHERE message_id = ?", messageID).Scan(&conversationID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[ERROR] Failed to load message %d: %v", messageID, err)
+		}
+		return nil, err
+	}
+
+	isParticipant, err := IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant {
+		log.Printf("[WARN] User %d requested history of message %d outside their conversations", userID, messageID)
+		return nil, ErrNotParticipant
+	}
+
+	rows, err := db.Query(`
+		SELECT edit_id, message_id, content, edited_at FROM message_edits
+		WHERE message_id = ?
+		ORDER BY edit_id ASC
+	`, messageID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load history of message %d: %v", messageID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	edits := []MessageEdit{}
+	for rows.Next() {
+		var edit MessageEdit
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.Content, &edit.EditedAt); err != nil {
+			log.Printf("[ERROR] Failed to scan history of message %d: %v", messageID, err)
+			return nil, err
+		}
+		edits = append(edits, edit)
+	}
+	return edits, rows.Err()
+}
@@ -0,0 +1,90 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// MessagePreview is the short form of a replied-to message quoted above a reply
+type MessagePreview struct {
+	ID         int    `json:"id"`
+	SenderID   int    `json:"sender_id"`
+	SenderName string `json:"sender_name"`
+	Content    string `json:"content"`
+}
+
+// replyPreviewLength caps the quoted content carried with a reply, in characters
+const replyPreviewLength = 100
+
+// queryer is satisfied by both *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// AddReplyToConversation stores a message quoting replyToID, which must be a
+// message in the same conversation. Returns ErrInvalidReply otherwise.
+func AddReplyToConversation(db *sql.DB, conversationID, senderID, replyToID int, content string, attachments ...Attachment) (*Message, error) {
+	return AddMessageWithClientID(db, conversationID, senderID, content, "", replyToID, attachments...)
+}
+
+// checkReplyTarget returns ErrInvalidReply unless replyToID is a message in conversationID
+func checkReplyTarget(q queryRower, conversationID, replyToID int) error {
+	var parentConversationID int
+	err := q.QueryRow("SELECT conversation_id FROM message WHERE message_id = ?", replyToID).Scan(&parentConversationID)
+	if err == sql.ErrNoRows || (err == nil && parentConversationID != conversationID) {
+		log.Printf("[WARN] Rejected reply to message %d from outside conversation %d", replyToID, conversationID)
+		return ErrInvalidReply
+	}
+	return err
+}
+
+// loadReplyPreviews fills in ReplyTo for the replies among messages with a
+// single query. Replies whose quoted message no longer exists get no preview.
+func loadReplyPreviews(q queryer, messages []Message) error {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, msg := range messages {
+		if msg.ReplyToID > 0 && !seen[msg.ReplyToID] {
+			seen[msg.ReplyToID] = true
+			ids = append(ids, msg.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	placeholders, args := inPlaceholders(ids)
+	rows, err := q.Query(`
+		SELECT m.message_id, m.sender_id, `+displayNameColumn("u")+`, m.content
+		FROM message m
+		JOIN user u ON m.sender_id = u.userid
+		WHERE m.message_id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load %d quoted messages: %v", len(ids), err)
+		return err
+	}
+	defer rows.Close()
+
+	previews := make(map[int]*MessagePreview, len(ids))
+	for rows.Next() {
+		preview := &MessagePreview{}
+		if err := rows.Scan(&preview.ID, &preview.SenderID, &preview.SenderName, &preview.Content); err != nil {
+			return err
+		}
+		if content := []rune(preview.Content); len(content) > replyPreviewLength {
+			preview.Content = string(content[:replyPreviewLength-3]) + "..."
+		}
+		previews[preview.ID] = preview
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range messages {
+		if messages[i].ReplyToID > 0 {
+			messages[i].ReplyTo = previews[messages[i].ReplyToID]
+		}
+	}
+	return nil
+}
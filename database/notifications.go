@@ -0,0 +1,192 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Notification types
+const (
+	NotificationComment = "comment"
+)
+
+// CommentBatchWindow is how long after a comment notification further comments
+// on the same post are folded into it instead of notifying again
+const CommentBatchWindow = 2 * time.Minute
+
+// Notification tells a user that something happened to their content. Count
+// is how many events were coalesced into it; ActorID is the most recent actor.
+type Notification struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Type      string    `json:"type"`
+	PostID    int       `json:"post_id"`
+	ActorID   int       `json:"actor_id"`
+	Count     int       `json:"count"`
+	Message   string    `json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	IsRead    bool      `json:"is_read"`
+}
+
+// NotifyComment records that commenterID commented on postID for the post's
+// author. A comment within CommentBatchWindow of an unread comment notification
+// for the same post bumps that notification's count rather than adding a new
+// one. The returned bool reports whether a new notification was created, so
+// callers push only once per batch. Commenting on your own post notifies no
+// one and returns a nil notification.
+func NotifyComment(db *sql.DB, postID, commenterID int) (*Notification, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, false, err
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	if err := tx.QueryRow("SELECT user_userid FROM post WHERE postid = ?", postID).Scan(&authorID); err != nil {
+		return nil, false, err
+	}
+	if authorID == commenterID {
+		return nil, false, nil
+	}
+
+	stamp := now().Format("2006-01-02 15:04:05")
+	cutoff := now().Add(-CommentBatchWindow).Format("2006-01-02 15:04:05")
+
+	var notificationID int
+	created := false
+	err = tx.QueryRow(`
+		SELECT notification_id FROM notification
+		WHERE user_id = ? AND type = ? AND post_id = ? AND is_read = 0 AND created_at > ?
+		ORDER BY notification_id DESC LIMIT 1
+	`, authorID, NotificationComment, postID, cutoff).Scan(&notificationID)
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.Exec(`
+			INSERT INTO notification (user_id, type, post_id, actor_id, count, created_at, updated_at)
+			VALUES (?, ?, ?, ?, 1, ?, ?)
+		`, authorID, NotificationComment, postID, commenterID, stamp, stamp)
+		if err != nil {
+			log.Printf("[ERROR] Failed to create comment notification for post %d: %v", postID, err)
+			return nil, false, err
+		}
+		id, _ := res.LastInsertId()
+		notificationID = int(id)
+		created = true
+	case err != nil:
+		return nil, false, err
+	default:
+		if _, err := tx.Exec("UPDATE notification SET count = count + 1, actor_id = ?, updated_at = ? WHERE notification_id = ?",
+			commenterID, stamp, notificationID); err != nil {
+			log.Printf("[ERROR] Failed to update comment notification %d: %v", notificationID, err)
+			return nil, false, err
+		}
+	}
+
+	notification, err := scanNotification(tx.QueryRow("SELECT "+notificationColumns+" FROM notification WHERE notification_id = ?", notificationID))
+	if err != nil {
+		return nil, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, false, err
+	}
+
+	log.Printf("[INFO] Comment notification %d for user %d on post %d now counts %d", notification.ID, authorID, postID, notification.Count)
+	return notification, created, nil
+}
+
+// CreateNotification records a single notification of notificationType for
+// userID. A zero postID or actorID is stored as no post or actor. Comment
+// notifications should go through NotifyComment so they are batched.
+func CreateNotification(db *sql.DB, userID int, notificationType string, postID, actorID int) (*Notification, error) {
+	stamp := now().Format("2006-01-02 15:04:05")
+	res, err := db.Exec(`
+		INSERT INTO notification (user_id, type, post_id, actor_id, count, created_at, updated_at)
+		VALUES (?, ?, NULLIF(?, 0), NULLIF(?, 0), 1, ?, ?)
+	`, userID, notificationType, postID, actorID, stamp, stamp)
+	if err != nil {
+		log.Printf("[ERROR] Failed to create %s notification for user %d: %v", notificationType, userID, err)
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Created %s notification %d for user %d", notificationType, id, userID)
+	return scanNotification(db.QueryRow("SELECT "+notificationColumns+" FROM notification WHERE notification_id = ?", id))
+}
+
+// GetNotifications returns a page of the user's notifications, newest
+// activity first. A non-positive limit returns all of them from offset onwards.
+func GetNotifications(db *sql.DB, userID, limit, offset int) ([]Notification, error) {
+	rows, err := db.Query("SELECT "+notificationColumns+` FROM notification
+		WHERE user_id = ?
+		ORDER BY updated_at DESC, notification_id DESC
+		LIMIT ? OFFSET ?`, userID, sqlLimit(limit), offset)
+	if err != nil {
+		log.Printf("[ERROR] Failed to query notifications for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, *notification)
+	}
+	return notifications, rows.Err()
+}
+
+// GetUnreadNotificationCount counts the user's notifications not yet read
+func GetUnreadNotificationCount(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notification WHERE user_id = ? AND is_read = 0", userID).Scan(&count)
+	if err != nil {
+		log.Printf("[ERROR] Failed to count unread notifications for user %d: %v", userID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// MarkNotificationRead marks one of the user's notifications read. Returns
+// sql.ErrNoRows if the notification does not exist or belongs to someone else.
+func MarkNotificationRead(db *sql.DB, userID, notificationID int) error {
+	res, err := db.Exec("UPDATE notification SET is_read = 1 WHERE notification_id = ? AND user_id = ?", notificationID, userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to mark notification %d read for user %d: %v", notificationID, userID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// notificationColumns is the column list scanNotification reads
+const notificationColumns = "notification_id, user_id, type, COALESCE(post_id, 0), COALESCE(actor_id, 0), count, created_at, updated_at, is_read"
+
+func scanNotification(row rowScanner) (*Notification, error) {
+	var n Notification
+	if err := row.Scan(&n.ID, &n.UserID, &n.Type, &n.PostID, &n.ActorID, &n.Count, &n.CreatedAt, &n.UpdatedAt, &n.IsRead); err != nil {
+		return nil, err
+	}
+	n.Message = notificationMessage(n)
+	return &n, nil
+}
+
+// notificationMessage is the text shown for a notification
+func notificationMessage(n Notification) string {
+	if n.Type == NotificationComment {
+		if n.Count == 1 {
+			return "New comment on your post"
+		}
+		return fmt.Sprintf("%d new comments on your post", n.Count)
+	}
+	return "New activity"
+}
@@ -0,0 +1,86 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// DeletedPostPlaceholder replaces the title and content of a soft-deleted post
+const DeletedPostPlaceholder = "[deleted]"
+
+// DeletePost soft-deletes a post: it drops out of every feed, but its id still
+// resolves to a tombstone so comments and links to it keep their context.
+// Returns sql.ErrNoRows if the post does not exist or is already deleted.
+func DeletePost(db *sql.DB, postID int) error {
+	log.Printf("[DEBUG] Soft-deleting post %d", postID)
+
+	res, err := db.Exec("UPDATE post SET is_deleted = 1 WHERE postid = ? AND is_deleted = 0", postID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to soft-delete post %d: %v", postID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Printf("[INFO] Post %d not found or already deleted", postID)
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[INFO] Soft-deleted post %d", postID)
+	return nil
+}
+
+// HardDeletePost permanently removes a post together with its comments,
+// categories and reactions. It is the administrative override for content that
+// must not survive even as a tombstone; ordinary deletes should use DeletePost.
+func HardDeletePost(db *sql.DB, postID int) error {
+	log.Printf("[WARN] Permanently deleting post %d", postID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for hard delete of post %d: %v", postID, err)
+		return err
+	}
+
+	dependents := []string{
+		"DELETE FROM comment WHERE post_postid = ?",
+		"DELETE FROM post_has_categories WHERE post_postid = ?",
+		"DELETE FROM post_reaction WHERE post_id = ?",
+	}
+	for _, query := range dependents {
+		if _, err := tx.Exec(query, postID); err != nil {
+			tx.Rollback()
+			log.Printf("[ERROR] Failed to remove dependent rows of post %d: %v", postID, err)
+			return err
+		}
+	}
+
+	res, err := tx.Exec("DELETE FROM post WHERE postid = ?", postID)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to delete post %d: %v", postID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return sql.ErrNoRows
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit hard delete of post %d: %v", postID, err)
+		return err
+	}
+
+	log.Printf("[INFO] Permanently deleted post %d", postID)
+	return nil
+}
+
+// tombstonePost hides everything a soft-deleted post said while keeping its
+// id, author and timestamps so threads still make sense
+func tombstonePost(post *Post) {
+	post.Title = DeletedPostPlaceholder
+	post.Content = DeletedPostPlaceholder
+	post.Image = sql.NullString{}
+	post.ImageBase64 = ""
+	post.Categories = nil
+	post.WordCount = 0
+	post.ReadingTimeSeconds = 0
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// SetPostImage stores the static path of the image attached to a post
+func SetPostImage(db *sql.DB, postID int, imagePath string) error {
+	_, err := db.Exec("UPDATE post SET image = ? WHERE postid = ?", imagePath, postID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to set image for post ID %d: %v", postID, err)
+		return err
+	}
+
+	log.Printf("[INFO] Image set for post ID %d", postID)
+	return nil
+}
+
+// LoadPostImages fills in the Image field for a page of posts with a single query
+func LoadPostImages(db *sql.DB, posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	placeholders, args := inPlaceholders(ids)
+
+	rows, err := db.Query("SELECT postid, image FROM post WHERE image IS NOT NULL AND postid IN ("+placeholders+")", args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load images for %d posts: %v", len(posts), err)
+		return err
+	}
+	defer rows.Close()
+
+	images := make(map[int]sql.NullString)
+	for rows.Next() {
+		var postID int
+		var image sql.NullString
+		if err := rows.Scan(&postID, &image); err != nil {
+			return err
+		}
+		images[postID] = image
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range posts {
+		if image, ok := images[posts[i].PostID]; ok {
+			posts[i].Image = image
+		}
+	}
+	return nil
+}
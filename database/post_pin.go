@@ -0,0 +1,60 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// PinScope says which listing a pinned post sorts to the top of
+type PinScope string
+
+const (
+	// PinGlobal pins a post to the top of the main feed; only admins may use it
+	PinGlobal PinScope = "global"
+	// PinProfile pins a post to the top of its author's profile feed
+	PinProfile PinScope = "profile"
+)
+
+// pinColumns maps each scope to the post column that records it
+var pinColumns = map[PinScope]string{
+	PinGlobal:  "is_pinned",
+	PinProfile: "is_profile_pinned",
+}
+
+// ValidPinScope reports whether scope names a listing posts can be pinned to
+func ValidPinScope(scope PinScope) bool {
+	_, ok := pinColumns[scope]
+	return ok
+}
+
+// PinPost pins a post in the given scope. It does not check who is asking:
+// callers allow PinProfile for the post's author and PinGlobal for admins.
+// Returns sql.ErrNoRows if the post does not exist or was deleted.
+func PinPost(db *sql.DB, postID int, scope PinScope) error {
+	return setPinned(db, postID, scope, true)
+}
+
+// UnpinPost removes a post's pin in the given scope. Returns the same errors
+// as PinPost.
+func UnpinPost(db *sql.DB, postID int, scope PinScope) error {
+	return setPinned(db, postID, scope, false)
+}
+
+func setPinned(db *sql.DB, postID int, scope PinScope, pinned bool) error {
+	column, ok := pinColumns[scope]
+	if !ok {
+		return ErrInvalidPinScope
+	}
+
+	res, err := db.Exec("UPDATE post SET "+column+" = ? WHERE postid = ? AND is_deleted = 0", pinned, postID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to set %s pin of post %d: %v", scope, postID, err)
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	log.Printf("[INFO] Set %s pin of post %d to %v", scope, postID, pinned)
+	return nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"log"
+	"time"
+)
+
+// PostQuotaWindow is the rolling period the daily post cap counts over
+const PostQuotaWindow = 24 * time.Hour
+
+// maxPostsPerDay caps how many posts one user may create per PostQuotaWindow;
+// zero leaves posting uncapped. See SetMaxPostsPerDay.
+var maxPostsPerDay = 0
+
+// postQuotaExempt holds the ids of the users the cap does not apply to
+var postQuotaExempt = map[int]bool{}
+
+// SetMaxPostsPerDay caps how many posts each user may create in a rolling 24
+// hours. Zero or less turns the cap off. Call before serving.
+func SetMaxPostsPerDay(n int) {
+	if n < 0 {
+		n = 0
+	}
+	maxPostsPerDay = n
+}
+
+// SetPostQuotaExempt replaces the users allowed to post past the daily cap
+func SetPostQuotaExempt(userIDs []int) {
+	postQuotaExempt = make(map[int]bool, len(userIDs))
+	for _, id := range userIDs {
+		postQuotaExempt[id] = true
+	}
+}
+
+// checkPostQuota returns ErrPostQuotaExceeded when userID had already created
+// maxPostsPerDay posts within PostQuotaWindow before postID and is not exempt.
+// insertPost calls it inside the transaction that inserted postID, after the
+// insert, so the write lock is held and concurrent posts cannot both pass.
+func checkPostQuota(q queryRower, userID, postID int) error {
+	if maxPostsPerDay <= 0 || postQuotaExempt[userID] {
+		return nil
+	}
+
+	since := time.Now().Add(-PostQuotaWindow).Format("2006-01-02 15:04:05")
+	var recent int
+	err := q.QueryRow("SELECT COUNT(*) FROM post WHERE user_userid = ? AND post_at > ? AND postid != ?", userID, since, postID).Scan(&recent)
+	if err != nil {
+		log.Printf("[ERROR] Failed to count recent posts for user %d: %v", userID, err)
+		return err
+	}
+	if recent < maxPostsPerDay {
+		return nil
+	}
+
+	log.Printf("[WARN] User %d has created %d posts in the last %s, cap is %d", userID, recent, PostQuotaWindow, maxPostsPerDay)
+	return ErrPostQuotaExceeded
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// WordsPerMinute is the reading speed ReadingTimeSeconds is based on
+const WordsPerMinute = 200
+
+var (
+	// Elements whose contents are never read, dropped along with the tags
+	unreadBlockRe = regexp.MustCompile(`(?is)<(script|style)\b[^>]*>.*?</(script|style)\s*>`)
+	markupTagRe   = regexp.MustCompile(`(?s)<[^>]*>`)
+	// Markdown images and links keep their text and lose the URL
+	markdownLinkRe = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+)
+
+// setReadingStats fills in WordCount and ReadingTimeSeconds from the post content
+func setReadingStats(post *Post) {
+	post.WordCount = CountWords(post.Content)
+	post.ReadingTimeSeconds = ReadingTimeSeconds(post.WordCount)
+}
+
+// CountWords counts the words a reader sees in content, ignoring HTML tags
+// and markdown syntax
+func CountWords(content string) int {
+	text := unreadBlockRe.ReplaceAllString(content, " ")
+	text = markupTagRe.ReplaceAllString(text, " ")
+	text = markdownLinkRe.ReplaceAllString(text, "$1")
+
+	count := 0
+	for _, field := range strings.Fields(text) {
+		// List markers, heading hashes and rules are not words
+		if strings.IndexFunc(field, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }) >= 0 {
+			count++
+		}
+	}
+	return count
+}
+
+// ReadingTimeSeconds estimates how long words take to read at WordsPerMinute,
+// rounded up to the next second
+func ReadingTimeSeconds(words int) int {
+	return (words*60 + WordsPerMinute - 1) / WordsPerMinute
+}
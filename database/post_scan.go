@@ -0,0 +1,48 @@
+package database
+
+import (
+	"log"
+	"time"
+)
+
+// postColumns is the column list every post query selects, in the order
+// scanPost reads them. The author's row must be joined as user.
+const postColumns = `post.postid, post.title, post.content, post.post_at, post.user_userid,
+	user.Username, user.F_name, user.L_name, user.Avatar, post.is_pinned, post.is_profile_pinned,
+	(SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid AND comment.is_deleted = 0) AS Comments`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPost reads a row selected with postColumns into post. Columns a query
+// selects after postColumns are scanned into extra, in order.
+func scanPost(row rowScanner, post *Post, extra ...interface{}) error {
+	var postAt string
+	dest := []interface{}{
+		&post.PostID, &post.Title, &post.Content, &postAt, &post.UserUserID,
+		&post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.IsPinned, &post.IsProfilePinned, &post.Comments,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+
+	post.PostAt = parsePostTime(post.PostID, postAt)
+	setReadingStats(post)
+	return nil
+}
+
+// parsePostTime accepts both timestamp formats found in the post table,
+// falling back to the zero time for anything else
+func parsePostTime(postID int, postAt string) time.Time {
+	if t, err := time.Parse(time.RFC3339, postAt); err == nil {
+		return t
+	}
+	t, err := time.Parse("2006-01-02 15:04:05", postAt)
+	if err != nil {
+		log.Printf("[WARN] Failed to parse post_at '%s' for post ID %d: %v", postAt, postID, err)
+		return time.Time{}
+	}
+	return t
+}
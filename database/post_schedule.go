@@ -0,0 +1,44 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// now is the clock that decides whether a scheduled post is visible yet
+var now = time.Now
+
+// SetClock replaces the time source used for scheduled posts, allowing tests to
+// simulate elapsed time. A nil clock restores time.Now.
+func SetClock(clock func() time.Time) {
+	if clock == nil {
+		clock = time.Now
+	}
+	now = clock
+}
+
+// publishedCondition hides posts whose publish time has not arrived. It takes
+// publishedCutoff() as its argument.
+const publishedCondition = "(post.publish_at IS NULL OR post.publish_at <= ?)"
+
+// publishedCutoff formats the current time the way post timestamps are stored
+func publishedCutoff() string {
+	return now().Format("2006-01-02 15:04:05")
+}
+
+// PostVisibleTo reports whether viewerID can see postID: it exists and is
+// either published or viewerID's own. A viewerID of 0 sees only published posts.
+func PostVisibleTo(db *sql.DB, postID, viewerID int) (bool, error) {
+	var visible bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM post
+			WHERE post.postid = ? AND (post.user_userid = ? OR `+publishedCondition+`)
+		)`, postID, viewerID, publishedCutoff()).Scan(&visible)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check visibility of post %d: %v", postID, err)
+		return false, err
+	}
+	return visible, nil
+}
@@ -0,0 +1,203 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Who may start a conversation with a user
+const (
+	DMsFromEveryone = "everyone"
+	// DMsFromFollowers admits users who already share a conversation with
+	// the user; there is no follow list yet, so contacts stand in for followers
+	DMsFromFollowers = "followers"
+	DMsFromNone      = "none"
+)
+
+// UserPrivacy holds what a user lets others see about them and who may
+// message them. Users without a user_privacy row get DefaultPrivacy.
+type UserPrivacy struct {
+	ShowOnline   bool   `json:"show_online"`
+	ShowLastSeen bool   `json:"show_last_seen"`
+	AllowDMsFrom string `json:"allow_dms_from"`
+}
+
+// DefaultPrivacy is the visibility a user has until they change it
+func DefaultPrivacy() UserPrivacy {
+	return UserPrivacy{ShowOnline: true, ShowLastSeen: true, AllowDMsFrom: DMsFromEveryone}
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// GetUserPrivacy returns userID's privacy settings
+func GetUserPrivacy(db *sql.DB, userID int) (UserPrivacy, error) {
+	return getUserPrivacy(db, userID)
+}
+
+func getUserPrivacy(q queryRower, userID int) (UserPrivacy, error) {
+	privacy := DefaultPrivacy()
+	err := q.QueryRow("SELECT show_online, show_last_seen, allow_dms_from FROM user_privacy WHERE user_id = ?", userID).
+		Scan(&privacy.ShowOnline, &privacy.ShowLastSeen, &privacy.AllowDMsFrom)
+	if err == sql.ErrNoRows {
+		return privacy, nil
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to load privacy settings for user %d: %v", userID, err)
+		return privacy, err
+	}
+	return privacy, nil
+}
+
+// SetUserPrivacy replaces userID's privacy settings. An unknown
+// AllowDMsFrom value is rejected with ErrInvalidPrivacy.
+func SetUserPrivacy(db *sql.DB, userID int, privacy UserPrivacy) error {
+	switch privacy.AllowDMsFrom {
+	case DMsFromEveryone, DMsFromFollowers, DMsFromNone:
+	default:
+		return fmt.Errorf("%w: allow_dms_from must be %s, %s or %s", ErrInvalidPrivacy, DMsFromEveryone, DMsFromFollowers, DMsFromNone)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO user_privacy (user_id, show_online, show_last_seen, allow_dms_from) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			show_online = excluded.show_online,
+			show_last_seen = excluded.show_last_seen,
+			allow_dms_from = excluded.allow_dms_from
+	`, userID, privacy.ShowOnline, privacy.ShowLastSeen, privacy.AllowDMsFrom)
+	if err != nil {
+		log.Printf("[ERROR] Failed to save privacy settings for user %d: %v", userID, err)
+		return err
+	}
+
+	log.Printf("[INFO] Updated privacy settings for user %d", userID)
+	return nil
+}
+
+// HiddenPresenceUsers returns which of ids have turned off show_online
+func HiddenPresenceUsers(db *sql.DB, ids []int) (map[int]bool, error) {
+	hidden := make(map[int]bool)
+	if len(ids) == 0 {
+		return hidden, nil
+	}
+
+	placeholders, args := inPlaceholders(ids)
+	rows, err := db.Query("SELECT user_id FROM user_privacy WHERE show_online = 0 AND user_id IN ("+placeholders+")", args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load presence settings for %d users: %v", len(ids), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return nil, err
+		}
+		hidden[userID] = true
+	}
+	return hidden, rows.Err()
+}
+
+// CanMessage reports whether senderID may start a conversation with
+// recipientID under the recipient's allow_dms_from setting. Nobody may when
+// either of them has blocked the other.
+func CanMessage(db *sql.DB, senderID, recipientID int) (bool, error) {
+	return canMessage(db, senderID, recipientID)
+}
+
+func canMessage(q queryRower, senderID, recipientID int) (bool, error) {
+	if senderID == recipientID {
+		return true, nil
+	}
+
+	blocked, err := isBlocked(q, senderID, recipientID)
+	if err != nil || blocked {
+		return false, err
+	}
+
+	privacy, err := getUserPrivacy(q, recipientID)
+	if err != nil {
+		return false, err
+	}
+
+	switch privacy.AllowDMsFrom {
+	case DMsFromNone:
+		return false, nil
+	case DMsFromFollowers:
+		var shared bool
+		err := q.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM conversation_participants a
+				JOIN conversation_participants b ON a.conversation_id = b.conversation_id
+				WHERE a.user_id = ? AND b.user_id = ?
+			)`, senderID, recipientID).Scan(&shared)
+		if err != nil {
+			log.Printf("[ERROR] Failed to check contact between users %d and %d: %v", senderID, recipientID, err)
+			return false, err
+		}
+		return shared, nil
+	default:
+		return true, nil
+	}
+}
+
+// checkDMsAllowed returns ErrDMsNotAllowed naming every participant who does
+// not accept new conversations from creatorID
+func checkDMsAllowed(q queryRower, creatorID int, participants []int) error {
+	var refused []string
+	for _, userID := range participants {
+		allowed, err := canMessage(q, creatorID, userID)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			refused = append(refused, fmt.Sprint(userID))
+		}
+	}
+	if len(refused) > 0 {
+		return fmt.Errorf("%w: user %s", ErrDMsNotAllowed, strings.Join(refused, ", "))
+	}
+	return nil
+}
+
+// GetLastSeen returns when userID was last connected and their recorded
+// status. A user who has hidden their last-seen time gets a zero time, as
+// does one who has never connected; the latter's status is "offline", and so
+// is that of a user who has hidden their online status.
+func GetLastSeen(db *sql.DB, userID int) (time.Time, string, error) {
+	var lastSeen sql.NullString
+	status := "offline"
+	err := db.QueryRow(`
+		SELECT `+lastSeenColumn("os.user_id")+`,
+			CASE WHEN COALESCE((SELECT show_online FROM user_privacy WHERE user_id = os.user_id), 1) = 1
+				THEN os.status ELSE 'offline' END
+		FROM online_status os
+		WHERE os.user_id = ?`, userID).Scan(&lastSeen, &status)
+	if err != nil && err != sql.ErrNoRows {
+		log.Printf("[ERROR] Failed to load last seen for user %d: %v", userID, err)
+		return time.Time{}, "", err
+	}
+
+	if t := parseTimestamp(lastSeen); t != nil {
+		return *t, status, nil
+	}
+	return time.Time{}, status, nil
+}
+
+// lastSeenColumn selects when the user whose id is in userIDColumn was last
+// connected, or NULL when they have hidden it. It is also NULL while they are
+// online, unless they hide their online status: blanking it then would give
+// their presence away.
+func lastSeenColumn(userIDColumn string) string {
+	return `(SELECT ls.last_seen FROM online_status ls
+		WHERE ls.user_id = ` + userIDColumn + `
+		AND (ls.status != 'online'
+			OR COALESCE((SELECT show_online FROM user_privacy WHERE user_id = ls.user_id), 1) = 0)
+		AND COALESCE((SELECT show_last_seen FROM user_privacy WHERE user_id = ls.user_id), 1) = 1)`
+}
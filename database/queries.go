@@ -2,12 +2,16 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
+
+	"connecthub/logutil"
 )
 
 type User struct {
@@ -21,6 +25,9 @@ type User struct {
 	Avatar           sql.NullString `json:"avatar"`
 	Gender           string         `json:"gender"`
 	DateOfBirth      string         `json:"date_of_birth"`
+	LastSeen         *time.Time     `json:"last_seen,omitempty"`
+	CreatedAt        *time.Time     `json:"created_at,omitempty"`
+	UpdatedAt        *time.Time     `json:"updated_at,omitempty"`
 }
 
 type Category struct {
@@ -39,6 +46,10 @@ type Comment struct {
 	Content   string
 	CreatedAt time.Time
 	Avatar    sql.NullString
+	// EditedAt is set once the author changes the comment
+	EditedAt *time.Time
+	// IsDeleted marks a tombstone whose content has been removed
+	IsDeleted bool
 }
 
 type Post struct {
@@ -55,6 +66,22 @@ type Post struct {
 	Comments    int
 	Categories  []Category
 	ImageBase64 string
+	Slug        string
+	Likes       int
+	Dislikes    int
+	// Score is likes minus dislikes
+	Score int
+	// IsDeleted marks a soft-deleted post whose content has been replaced by a placeholder
+	IsDeleted bool
+	// IsPinned puts the post at the top of the main feed
+	IsPinned bool
+	// IsProfilePinned puts the post at the top of its author's profile feed
+	IsProfilePinned bool
+	// WordCount and ReadingTimeSeconds are computed from Content when the post is fetched
+	WordCount          int
+	ReadingTimeSeconds int
+	// LikedByMe is whether the viewing user likes the post; see LoadLikedByMe
+	LikedByMe bool
 }
 
 type UserSession struct {
@@ -66,7 +93,7 @@ type UserSession struct {
 
 func Select(colToReturn, table, where, input string) (string, error) {
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for Select operation on table %s", table)
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed in Select for table %s: %v", table, err)
 		return "", err
@@ -94,7 +121,7 @@ func Select(colToReturn, table, where, input string) (string, error) {
 
 func ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for ExecuteQuery operation")
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed in ExecuteQuery: %v", err)
 		return nil, err
@@ -102,7 +129,7 @@ func ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
 	defer db.Close()
 	log.Printf("[INFO] Successfully connected to SQLite database for ExecuteQuery operation")
 
-	truncatedQuery := truncateSQL(query)
+	truncatedQuery := logutil.Truncate(query, sqlPreviewLength)
 	log.Printf("[DEBUG] Executing query: %s with %d arguments", truncatedQuery, len(args))
 
 	rows, err := db.Query(query, args...)
@@ -117,7 +144,7 @@ func ExecuteQuery(query string, args ...interface{}) (*sql.Rows, error) {
 
 func ExecuteNonQuery(query string, args ...interface{}) (sql.Result, error) {
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for ExecuteNonQuery operation")
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed in ExecuteNonQuery: %v", err)
 		return nil, err
@@ -125,7 +152,7 @@ func ExecuteNonQuery(query string, args ...interface{}) (sql.Result, error) {
 	defer db.Close()
 	log.Printf("[INFO] Successfully connected to SQLite database for ExecuteNonQuery operation")
 
-	truncatedQuery := truncateSQL(query)
+	truncatedQuery := logutil.Truncate(query, sqlPreviewLength)
 	log.Printf("[DEBUG] Executing non-query: %s with %d arguments", truncatedQuery, len(args))
 
 	result, err := db.Exec(query, args...)
@@ -141,7 +168,7 @@ func ExecuteNonQuery(query string, args ...interface{}) (sql.Result, error) {
 
 func CheckExists(table, condition string, args ...interface{}) (bool, error) {
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for CheckExists operation on table %s", table)
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed in CheckExists for table %s: %v", table, err)
 		return false, err
@@ -150,7 +177,7 @@ func CheckExists(table, condition string, args ...interface{}) (bool, error) {
 	log.Printf("[INFO] Successfully connected to SQLite database for CheckExists operation on table %s", table)
 
 	query := fmt.Sprintf("SELECT EXISTS(SELECT 1 FROM %s WHERE %s)", table, condition)
-	log.Printf("[DEBUG] Checking existence with query: %s with %d arguments", truncateSQL(query), len(args))
+	log.Printf("[DEBUG] Checking existence with query: %s with %d arguments", logutil.Truncate(query, sqlPreviewLength), len(args))
 
 	var exists bool
 	err = db.QueryRow(query, args...).Scan(&exists)
@@ -196,7 +223,7 @@ func GetCommentsForPost(db *sql.DB, postID int) ([]Comment, error) {
 	log.Printf("[DEBUG] Retrieving comments for post ID %d", postID)
 
 	query := `
-        SELECT comment.commentid, comment.post_postid, comment.user_userid, user.F_name, user.L_name, user.Username, comment.content, comment.comment_at, user.Avatar
+        SELECT comment.commentid, comment.post_postid, comment.user_userid, user.F_name, user.L_name, user.Username, comment.content, comment.comment_at, ` + avatarColumn("user") + `, comment.edited_at, comment.is_deleted
         FROM comment
         JOIN user ON comment.user_userid = user.userid
         WHERE comment.post_postid = ?`
@@ -211,11 +238,13 @@ func GetCommentsForPost(db *sql.DB, postID int) ([]Comment, error) {
 	for rows.Next() {
 		var comment Comment
 		var commentAt time.Time
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.FirstName, &comment.LastName, &comment.Username, &comment.Content, &commentAt, &comment.Avatar); err != nil {
+		var editedAt sql.NullTime
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.FirstName, &comment.LastName, &comment.Username, &comment.Content, &commentAt, &comment.Avatar, &editedAt, &comment.IsDeleted); err != nil {
 			log.Printf("[ERROR] Failed to scan comment row for post ID %d: %v", postID, err)
 			return nil, fmt.Errorf("GetCommentsForPost scan failed: %v", err)
 		}
 		comment.CreatedAt = commentAt
+		finishComment(&comment, editedAt)
 		comments = append(comments, comment)
 	}
 	if err := rows.Err(); err != nil {
@@ -227,16 +256,63 @@ func GetCommentsForPost(db *sql.DB, postID int) ([]Comment, error) {
 	return comments, nil
 }
 
+// GetCommentsForPostPaginated retrieves a page of comments for a post, oldest
+// first, along with the number of comments on the post. Deleted comments are
+// in the page as tombstones but not in the count, matching the post's
+// comment count.
+func GetCommentsForPostPaginated(db *sql.DB, postID, limit, offset int) ([]Comment, int, error) {
+	log.Printf("[DEBUG] Retrieving comments for post ID %d (limit %d, offset %d)", postID, limit, offset)
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM comment WHERE post_postid = ? AND is_deleted = 0", postID).Scan(&total); err != nil {
+		log.Printf("[ERROR] Failed to count comments for post ID %d: %v", postID, err)
+		return nil, 0, fmt.Errorf("GetCommentsForPostPaginated count failed: %v", err)
+	}
+
+	query := `
+        SELECT comment.commentid, comment.post_postid, comment.user_userid, user.F_name, user.L_name, user.Username, comment.content, comment.comment_at, ` + avatarColumn("user") + `, comment.edited_at, comment.is_deleted
+        FROM comment
+        JOIN user ON comment.user_userid = user.userid
+        WHERE comment.post_postid = ?
+        ORDER BY comment.comment_at ASC, comment.commentid ASC
+        LIMIT ? OFFSET ?`
+	rows, err := db.Query(query, postID, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] Failed to query comments for post ID %d: %v", postID, err)
+		return nil, 0, fmt.Errorf("GetCommentsForPostPaginated query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		var editedAt sql.NullTime
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.FirstName, &comment.LastName, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.Avatar, &editedAt, &comment.IsDeleted); err != nil {
+			log.Printf("[ERROR] Failed to scan comment row for post ID %d: %v", postID, err)
+			return nil, 0, fmt.Errorf("GetCommentsForPostPaginated scan failed: %v", err)
+		}
+		finishComment(&comment, editedAt)
+		comments = append(comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("[ERROR] Error iterating comment rows for post ID %d: %v", postID, err)
+		return nil, 0, fmt.Errorf("GetCommentsForPostPaginated row iteration error: %v", err)
+	}
+
+	log.Printf("[INFO] Retrieved %d of %d comments for post ID %d", len(comments), total, postID)
+	return comments, total, nil
+}
+
 func GetAllPosts(db *sql.DB) ([]Post, error) {
 	log.Printf("[DEBUG] Retrieving all posts")
 
 	query := `
-        SELECT post.postid, post.title, post.content, post.post_at, post.user_userid, user.Username, user.F_name, user.L_name, user.Avatar,
-               (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+        SELECT ` + postColumns + `
         FROM post
         JOIN user ON post.user_userid = user.userid
-        ORDER BY post.post_at DESC`
-	rows, err := db.Query(query)
+        WHERE post.is_deleted = 0 AND ` + publishedCondition + `
+        ORDER BY post.is_pinned DESC, post.post_at DESC`
+	rows, err := db.Query(query, publishedCutoff())
 	if err != nil {
 		log.Printf("[ERROR] Failed to query all posts: %v", err)
 		return nil, err
@@ -246,71 +322,82 @@ func GetAllPosts(db *sql.DB) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Title, &post.Content, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan post row: %v", err)
 			return nil, err
 		}
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' with multiple formats: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
 
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating post rows: %v", err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts", len(posts))
 	return posts, nil
 }
 
-func GetCategoriesForPost(db *sql.DB, postID int) ([]Category, error) {
-	log.Printf("[DEBUG] Retrieving categories for post ID %d", postID)
+// GetPostsSince returns up to limit posts that entered the feed after since,
+// oldest first, so a polling client can ask again from the newest one it got.
+// A scheduled post counts from its publish time. A non-positive limit returns
+// every such post.
+func GetPostsSince(db *sql.DB, since time.Time, limit int) ([]Post, error) {
+	cutoff := since.Local().Format("2006-01-02 15:04:05")
+	log.Printf("[DEBUG] Retrieving posts since %s (limit %d)", cutoff, limit)
 
-	query := `
-        SELECT c.idcategories, c.name
-        FROM categories c
-        JOIN post_has_categories phc ON c.idcategories = phc.categories_idcategories
-        WHERE phc.post_postid = ?`
-	rows, err := db.Query(query, postID)
+	rows, err := db.Query(`
+        SELECT `+postColumns+`
+        FROM post
+        JOIN user ON post.user_userid = user.userid
+        WHERE post.is_deleted = 0 AND `+publishedCondition+`
+            AND COALESCE(post.publish_at, post.post_at) > ?
+        ORDER BY COALESCE(post.publish_at, post.post_at) ASC, post.postid ASC
+        LIMIT ?`, publishedCutoff(), cutoff, sqlLimit(limit))
 	if err != nil {
-		log.Printf("[ERROR] Failed to query categories for post ID %d: %v", postID, err)
+		log.Printf("[ERROR] Failed to query posts since %s: %v", cutoff, err)
 		return nil, err
 	}
 	defer rows.Close()
 
-	var categories []Category
-	rowCount := 0
+	posts := []Post{}
 	for rows.Next() {
-		rowCount++
-		var category Category
-		if err := rows.Scan(&category.ID, &category.Name); err != nil {
-			log.Printf("[ERROR] Failed to scan category row for post ID %d: %v", postID, err)
-			return categories, err
+		var post Post
+		if err := scanPost(rows, &post); err != nil {
+			log.Printf("[ERROR] Failed to scan post row: %v", err)
+			return nil, err
 		}
-		categories = append(categories, category)
-	}
 
+		posts = append(posts, post)
+	}
 	if err := rows.Err(); err != nil {
-		log.Printf("[ERROR] Error iterating category rows for post ID %d: %v", postID, err)
-		return categories, err
+		log.Printf("[ERROR] Error iterating post rows: %v", err)
+		return nil, err
+	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
 	}
 
-	log.Printf("[INFO] Retrieved %d categories for post ID %d", len(categories), postID)
-	return categories, nil
+	log.Printf("[INFO] Retrieved %d posts since %s", len(posts), cutoff)
+	return posts, nil
+}
+
+// GetCategoriesForPost returns the categories a post is filed under, named
+// from the category cache
+func GetCategoriesForPost(db *sql.DB, postID int) ([]Category, error) {
+	log.Printf("[DEBUG] Retrieving categories for post ID %d", postID)
+
+	posts := []Post{{PostID: postID}}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[ERROR] Failed to query categories for post ID %d: %v", postID, err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] Retrieved %d categories for post ID %d", len(posts[0].Categories), postID)
+	return posts[0].Categories, nil
 }
 
 func GetComments(db *sql.DB) ([]Comment, error) {
@@ -345,8 +432,18 @@ func GetComments(db *sql.DB) ([]Comment, error) {
 	return comments, nil
 }
 
-func GetUserCommentedPosts(db *sql.DB, userid int, filter string) ([]Post, error) {
-	log.Printf("[DEBUG] Retrieving posts commented by user ID %d with filter '%s'", userid, filter)
+// sqlLimit maps a non-positive page size to SQLite's "no limit"
+func sqlLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
+// GetUserCommentedPosts retrieves posts the user has commented on.
+// A non-positive limit returns every matching post from offset onwards.
+func GetUserCommentedPosts(db *sql.DB, userid int, filter string, limit, offset int) ([]Post, error) {
+	log.Printf("[DEBUG] Retrieving posts commented by user ID %d with filter '%s' (limit %d, offset %d)", userid, filter, limit, offset)
 
 	order := "DESC"
 	if filter == "oldest" {
@@ -354,16 +451,19 @@ func GetUserCommentedPosts(db *sql.DB, userid int, filter string) ([]Post, error
 	}
 
 	query := fmt.Sprintf(`
-        SELECT DISTINCT post.postid, post.title, post.content, post.post_at, post.user_userid, u.Username, u.F_name, u.L_name, u.Avatar,
-               (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+        SELECT DISTINCT `+postColumns+`
         FROM post
         JOIN comment c ON post.postid = c.post_postid
-        JOIN user u ON post.user_userid = u.userid -- Join post user, not comment user for post details
+        JOIN user ON post.user_userid = user.userid -- Join post user, not comment user for post details
         WHERE c.user_userid = ? -- Filter by the user who commented
+        AND c.is_deleted = 0
+        AND post.is_deleted = 0
+        AND `+publishedCondition+`
         ORDER BY post.post_at %s
+        LIMIT ? OFFSET ?
     `, order)
 
-	rows, err := db.Query(query, userid)
+	rows, err := db.Query(query, userid, publishedCutoff(), sqlLimit(limit), offset)
 	if err != nil {
 		log.Printf("[ERROR] Failed to query posts commented by user ID %d: %v", userid, err)
 		return nil, err
@@ -374,27 +474,11 @@ func GetUserCommentedPosts(db *sql.DB, userid int, filter string) ([]Post, error
 
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Title, &post.Content, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan post row for user ID %d's commented posts: %v", userid, err)
 			return nil, err
 		}
 
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetUserCommentedPosts: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 
@@ -402,6 +486,9 @@ func GetUserCommentedPosts(db *sql.DB, userid int, filter string) ([]Post, error
 		log.Printf("[ERROR] Error iterating post rows for user ID %d's commented posts: %v", userid, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts commented by user ID %d", len(posts), userid)
 	return posts, nil
@@ -411,7 +498,9 @@ func GetUserByID(db *sql.DB, userID int) (User, error) {
 	log.Printf("[DEBUG] Retrieving user with ID %d", userID)
 
 	var user User
-	err := db.QueryRow("SELECT userid, F_name, L_name, Username, Email, Avatar, gender, date_of_birth FROM user WHERE userid = ?", userID).Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Email, &user.Avatar, &user.Gender, &user.DateOfBirth)
+	var createdAt, updatedAt sql.NullString
+	err := db.QueryRow("SELECT userid, F_name, L_name, Username, Email, Avatar, gender, date_of_birth, created_at, updated_at FROM user WHERE userid = ?", userID).
+		Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Email, &user.Avatar, &user.Gender, &user.DateOfBirth, &createdAt, &updatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("[INFO] No user found with ID %d", userID)
@@ -420,6 +509,8 @@ func GetUserByID(db *sql.DB, userID int) (User, error) {
 		}
 		return user, err
 	}
+	user.CreatedAt = parseTimestamp(createdAt)
+	user.UpdatedAt = parseTimestamp(updatedAt)
 
 	log.Printf("[INFO] Retrieved user with ID %d: username '%s'", userID, user.Username)
 	return user, nil
@@ -428,7 +519,7 @@ func GetUserByID(db *sql.DB, userID int) (User, error) {
 func GetAllUsers(db *sql.DB) ([]User, error) {
 	log.Printf("[DEBUG] Retrieving all users")
 
-	rows, err := db.Query("SELECT userid, F_name, L_name, Username, Email, Avatar FROM user")
+	rows, err := db.Query("SELECT u.userid, u.F_name, u.L_name, u.Username, u.Email, u.Avatar, " + lastSeenColumn("u.userid") + " FROM user u")
 	if err != nil {
 		log.Printf("[ERROR] Failed to query all users: %v", err)
 		return nil, err
@@ -438,12 +529,13 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 	var users []User
 	for rows.Next() {
 		var user User
-		var avatar sql.NullString
-		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Email, &avatar); err != nil {
+		var avatar, lastSeen sql.NullString
+		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Email, &avatar, &lastSeen); err != nil {
 			log.Printf("[ERROR] Failed to scan user row: %v", err)
 			return nil, err
 		}
 		user.Avatar = avatar
+		user.LastSeen = parseTimestamp(lastSeen)
 		users = append(users, user)
 	}
 
@@ -456,6 +548,75 @@ func GetAllUsers(db *sql.DB) ([]User, error) {
 	return users, nil
 }
 
+// GetUsersByIDs loads several users in one query, ordered by username.
+// Ids that do not belong to a user are skipped, and repeated ids are looked
+// up once.
+func GetUsersByIDs(db *sql.DB, ids []int) ([]User, error) {
+	if len(ids) == 0 {
+		return []User{}, nil
+	}
+
+	placeholders, args := inPlaceholders(uniqueIDs(ids))
+	rows, err := db.Query("SELECT userid, F_name, L_name, Username, Avatar FROM user WHERE userid IN ("+placeholders+") ORDER BY Username COLLATE NOCASE", args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to query %d users by id: %v", len(ids), err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]User, 0, len(ids))
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Avatar); err != nil {
+			log.Printf("[ERROR] Failed to scan user row: %v", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// uniqueIDs returns ids without repeats, keeping the first occurrence of each
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// GetUserIDsByUsernames resolves usernames to user ids, in the order given.
+// Matching ignores case and a leading "@", so mentions can be passed as they
+// are typed. Unknown names are reported together with ErrUnknownUsername.
+func GetUserIDsByUsernames(db *sql.DB, usernames []string) ([]int, error) {
+	ids := make([]int, 0, len(usernames))
+	var unknown []string
+	for _, name := range usernames {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "@")
+
+		var id int
+		err := db.QueryRow("SELECT userid FROM user WHERE LOWER(Username) = ?", NormalizeIdentifier(name)).Scan(&id)
+		if err == sql.ErrNoRows {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err != nil {
+			log.Printf("[ERROR] Failed to look up username '%s': %v", name, err)
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownUsername, strings.Join(unknown, ", "))
+	}
+	return ids, nil
+}
+
 func GetFilteredPosts(db *sql.DB, filter string) ([]Post, error) {
 	log.Printf("[DEBUG] Retrieving posts with filter '%s'", filter)
 
@@ -466,24 +627,33 @@ func GetFilteredPosts(db *sql.DB, filter string) ([]Post, error) {
 	switch filter {
 	case "oldest":
 		query = `
-            SELECT post.postid, post.content, post.title, post.post_at, post.user_userid, user.Username, user.F_name, user.L_name, user.Avatar,
-                   (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+            SELECT ` + postColumns + `, ` + postScoreColumn + `
             FROM post
             JOIN user ON post.user_userid = user.userid
+            WHERE post.is_deleted = 0 AND ` + publishedCondition + `
             ORDER BY post.post_at ASC
         `
-		rows, err = db.Query(query)
+		rows, err = db.Query(query, publishedCutoff())
+	case "top-rated":
+		query = `
+            SELECT ` + postColumns + `, ` + postScoreColumn + `
+            FROM post
+            JOIN user ON post.user_userid = user.userid
+            WHERE post.is_deleted = 0 AND ` + publishedCondition + `
+            ORDER BY Score DESC, post.post_at DESC
+        `
+		rows, err = db.Query(query, publishedCutoff())
 	case "all":
 		fallthrough
 	default:
 		query = `
-            SELECT post.postid, post.content, post.title, post.post_at, post.user_userid, user.Username, user.F_name, user.L_name, user.Avatar,
-                   (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+            SELECT ` + postColumns + `, ` + postScoreColumn + `
             FROM post
             JOIN user ON post.user_userid = user.userid
+            WHERE post.is_deleted = 0 AND ` + publishedCondition + `
             ORDER BY post.post_at DESC
         `
-		rows, err = db.Query(query)
+		rows, err = db.Query(query, publishedCutoff())
 	}
 
 	if err != nil {
@@ -495,34 +665,19 @@ func GetFilteredPosts(db *sql.DB, filter string) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Content, &post.Title, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post, &post.Score); err != nil {
 			log.Printf("[ERROR] Failed to scan post row with filter '%s': %v", filter, err)
 			return nil, err
 		}
-
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetFilteredPosts: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
-
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating post rows with filter '%s': %v", filter, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts with filter '%s'", len(posts), filter)
 	return posts, nil
@@ -532,15 +687,14 @@ func GetPostsByMultiCategory(db *sql.DB, categoryName string) ([]Post, error) {
 	log.Printf("[DEBUG] Retrieving posts by multi-category '%s'", categoryName)
 
 	rows, err := db.Query(`
-        SELECT post.postid, post.content, post.title, post.post_at, post.user_userid, user.Username, user.F_name, user.L_name, user.Avatar,
-               (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+        SELECT `+postColumns+`
         FROM post
         JOIN user ON post.user_userid = user.userid
         JOIN post_has_categories phc ON post.postid = phc.post_postid
         JOIN categories c ON phc.categories_idcategories = c.idcategories
-           WHERE c.name = ?
+           WHERE c.name = ? AND post.is_deleted = 0 AND `+publishedCondition+`
         ORDER BY post.post_at DESC
-    `, categoryName)
+    `, categoryName, publishedCutoff())
 	if err != nil {
 		log.Printf("[ERROR] Failed to query posts by category '%s': %v", categoryName, err)
 		return nil, err
@@ -550,33 +704,20 @@ func GetPostsByMultiCategory(db *sql.DB, categoryName string) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Content, &post.Title, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan post row for category '%s': %v", categoryName, err)
 			return nil, err
 		}
 
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetPostsByMultiCategory: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating post rows for category '%s': %v", categoryName, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts for category '%s'", len(posts), categoryName)
 	return posts, nil
@@ -586,15 +727,14 @@ func GetPostsByCategory(db *sql.DB, categoryName string) ([]Post, error) {
 	log.Printf("[DEBUG] Retrieving posts by category '%s'", categoryName)
 
 	rows, err := db.Query(`
-        SELECT post.postid, post.content, post.title, post.post_at, post.user_userid, user.Username, user.F_name, user.L_name, user.Avatar,
-               (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+        SELECT `+postColumns+`
         FROM post
         JOIN user ON post.user_userid = user.userid
         JOIN post_has_categories phc ON post.postid = phc.post_postid
         JOIN categories c ON phc.categories_idcategories = c.idcategories
-        WHERE c.name = ?
+        WHERE c.name = ? AND post.is_deleted = 0 AND `+publishedCondition+`
         ORDER BY post.post_at DESC
-    `, categoryName)
+    `, categoryName, publishedCutoff())
 	if err != nil {
 		log.Printf("[ERROR] Failed to query posts by category '%s': %v", categoryName, err)
 		return nil, err
@@ -604,63 +744,142 @@ func GetPostsByCategory(db *sql.DB, categoryName string) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Content, &post.Title, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan post row for category '%s': %v", categoryName, err)
 			return nil, err
 		}
 
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetPostsByCategory: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 	if err := rows.Err(); err != nil {
 		log.Printf("[ERROR] Error iterating post rows for category '%s': %v", categoryName, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts for category '%s'", len(posts), categoryName)
 	return posts, nil
 }
 
+// GetPostsByCategoryID retrieves the posts filed under a category, newest
+// first, so categories are told apart even when their names look alike. A
+// non-positive limit returns every matching post from offset onwards. Returns
+// ErrUnknownCategory if no category has that id.
+func GetPostsByCategoryID(db *sql.DB, categoryID, limit, offset int) ([]Post, error) {
+	log.Printf("[DEBUG] Retrieving posts by category ID %d (limit %d, offset %d)", categoryID, limit, offset)
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM categories WHERE idcategories = ?)", categoryID).Scan(&exists); err != nil {
+		log.Printf("[ERROR] Failed to look up category ID %d: %v", categoryID, err)
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrUnknownCategory
+	}
+
+	rows, err := db.Query(`
+        SELECT `+postColumns+`
+        FROM post
+        JOIN user ON post.user_userid = user.userid
+        JOIN post_has_categories phc ON post.postid = phc.post_postid
+        WHERE phc.categories_idcategories = ? AND post.is_deleted = 0 AND `+publishedCondition+`
+        ORDER BY post.post_at DESC
+        LIMIT ? OFFSET ?
+    `, categoryID, publishedCutoff(), sqlLimit(limit), offset)
+	if err != nil {
+		log.Printf("[ERROR] Failed to query posts by category ID %d: %v", categoryID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []Post{}
+	for rows.Next() {
+		var post Post
+		if err := scanPost(rows, &post); err != nil {
+			log.Printf("[ERROR] Failed to scan post row for category ID %d: %v", categoryID, err)
+			return nil, err
+		}
+
+		posts = append(posts, post)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("[ERROR] Error iterating post rows for category ID %d: %v", categoryID, err)
+		return nil, err
+	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
+
+	log.Printf("[INFO] Retrieved %d posts for category ID %d", len(posts), categoryID)
+	return posts, nil
+}
+
+// InsertPost stores a post with no categories, visible immediately. Like
+// CreatePost it is subject to the daily post cap.
 func InsertPost(db *sql.DB, content string, title string, userID string) (int, error) {
-	log.Printf("[DEBUG] Inserting new post for user ID %s with title '%s'", userID, title)
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID %q: %w", userID, err)
+	}
+	return insertPost(db, content, title, id, time.Time{})
+}
+
+// insertPost stores a post; a non-zero publishAt keeps it out of feeds until
+// then. Every post goes through here, so this is where the daily cap is applied.
+func insertPost(db *sql.DB, content, title string, userID int, publishAt time.Time) (int, error) {
+	log.Printf("[DEBUG] Inserting new post for user ID %d with title '%s'", userID, title)
+
+	if err := checkLength("title", title, MaxTitleLength); err != nil {
+		return 0, err
+	}
+	if err := checkLength("content", content, MaxPostContentLength); err != nil {
+		return 0, err
+	}
 
-	stmt, err := db.Prepare("INSERT INTO post (content, title, post_at, user_userid) VALUES (?, ?, ?, ?)")
+	tx, err := db.Begin()
 	if err != nil {
-		log.Printf("[ERROR] Failed to prepare insert post statement: %v", err)
+		log.Printf("[ERROR] Failed to begin transaction for new post: %v", err)
 		return 0, err
 	}
-	defer stmt.Close()
 
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
+	var publishKey interface{}
+	if !publishAt.IsZero() {
+		publishKey = publishAt.Local().Format("2006-01-02 15:04:05")
+	}
 
-	res, err := stmt.Exec(content, title, currentTime, userID)
+	res, err := tx.Exec("INSERT INTO post (content, title, post_at, user_userid, publish_at) VALUES (?, ?, ?, ?, ?)",
+		content, title, currentTime, userID, publishKey)
 	if err != nil {
+		tx.Rollback()
 		log.Printf("[ERROR] Failed to execute insert post statement: %v", err)
 		return 0, err
 	}
 
 	lastID, err := res.LastInsertId()
 	if err != nil {
+		tx.Rollback()
 		log.Printf("[ERROR] Failed to get last insert ID for post: %v", err)
 		return 0, err
 	}
 
-	log.Printf("[INFO] Inserted new post with ID %d for user ID %s", lastID, userID)
+	if err := checkPostQuota(tx, userID, int(lastID)); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit new post: %v", err)
+		return 0, err
+	}
+
+	if _, err := assignPostSlug(db, int(lastID), title); err != nil {
+		log.Printf("[WARN] Failed to assign slug to post ID %d: %v", lastID, err)
+	}
+
+	log.Printf("[INFO] Inserted new post with ID %d for user ID %d", lastID, userID)
 	return int(lastID), nil
 }
 
@@ -684,7 +903,19 @@ func InsertPostCategory(db *sql.DB, postID int, categoryID int) error {
 	return nil
 }
 
+// GetUserPosts returns a user's published posts as others see them, profile
+// pins first. filter "oldest" reverses the default newest-first order.
 func GetUserPosts(db *sql.DB, userID int, filter string) ([]Post, error) {
+	return userPosts(db, userID, filter, false)
+}
+
+// GetOwnPosts is the author's own view of their posts: like GetUserPosts but
+// including posts scheduled for later
+func GetOwnPosts(db *sql.DB, userID int) ([]Post, error) {
+	return userPosts(db, userID, "newest", true)
+}
+
+func userPosts(db *sql.DB, userID int, filter string, includeScheduled bool) ([]Post, error) {
 	log.Printf("[DEBUG] Retrieving posts for user ID %d with filter '%s'", userID, filter)
 
 	var x string
@@ -694,15 +925,19 @@ func GetUserPosts(db *sql.DB, userID int, filter string) ([]Post, error) {
 		x = "post.post_at DESC"
 	}
 
-	query := `SELECT
-		post.postid, post.content, post.title, post.post_at, post.user_userid,
-		user.avatar, user.F_name, user.L_name, user.Username,
-               (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+	args := []interface{}{userID}
+	visibility := ""
+	if !includeScheduled {
+		visibility = " AND " + publishedCondition
+		args = append(args, publishedCutoff())
+	}
+
+	query := `SELECT ` + postColumns + `
 	FROM post
 	JOIN user ON post.user_userid = user.userid
-	WHERE post.user_userid = ? ORDER BY ` + x
+	WHERE post.user_userid = ? AND post.is_deleted = 0` + visibility + ` ORDER BY post.is_profile_pinned DESC, ` + x
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		log.Printf("[ERROR] Failed to query posts for user ID %d: %v", userID, err)
 		return nil, err
@@ -712,27 +947,11 @@ func GetUserPosts(db *sql.DB, userID int, filter string) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Content, &post.Title, &postAt, &post.UserUserID, &post.Avatar, &post.FirstName, &post.LastName, &post.Username, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan post row for user ID %d: %v", userID, err)
 			return nil, err
 		}
 
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetUserPosts: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 
@@ -740,6 +959,9 @@ func GetUserPosts(db *sql.DB, userID int, filter string) ([]Post, error) {
 		log.Printf("[ERROR] Error iterating post rows for user ID %d: %v", userID, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d posts for user ID %d", len(posts), userID)
 	return posts, nil
@@ -755,9 +977,10 @@ func AuthenticateUser(db *sql.DB, identifier, password string) (*User, error) {
 	query := `
 		SELECT userid, F_name, L_name, Username, Email, password, Avatar, gender, date_of_birth
 		FROM user
-		WHERE Username = ? OR Email = ?
+		WHERE LOWER(Username) = ? OR LOWER(Email) = ?
 	`
 
+	identifier = NormalizeIdentifier(identifier)
 	err := db.QueryRow(query, identifier, identifier).Scan(
 		&user.ID, &user.FirstName, &user.LastName, &user.Username,
 		&user.Email, &hashedPassword, &user.Avatar, &user.Gender, &user.DateOfBirth,
@@ -766,7 +989,7 @@ func AuthenticateUser(db *sql.DB, identifier, password string) (*User, error) {
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("[WARN] No user found with identifier: %s", identifier)
-			return nil, fmt.Errorf("invalid credentials")
+			return nil, ErrInvalidCredentials
 		}
 		log.Printf("[ERROR] Database error during authentication: %v", err)
 		return nil, err
@@ -775,7 +998,7 @@ func AuthenticateUser(db *sql.DB, identifier, password string) (*User, error) {
 	// Verify password using bcrypt
 	if !verifyPassword(password, hashedPassword) {
 		log.Printf("[WARN] Password verification failed for user: %s", user.Username)
-		return nil, fmt.Errorf("invalid credentials")
+		return nil, ErrInvalidCredentials
 	}
 
 	log.Printf("[INFO] User authenticated successfully: %s (ID: %d)", user.Username, user.ID)
@@ -797,25 +1020,112 @@ func UpdateUserSession(db *sql.DB, userID int, sessionToken string) error {
 	return nil
 }
 
+// RevokeAllSessions ends every session userID holds, so no token issued to
+// them before now is accepted
+func RevokeAllSessions(db *sql.DB, userID int) error {
+	log.Printf("[DEBUG] Revoking all sessions for user ID %d", userID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for revoking sessions of user ID %d: %v", userID, err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE user SET current_session = NULL WHERE userid = ?", userID); err != nil {
+		log.Printf("[ERROR] Failed to clear current session of user ID %d: %v", userID, err)
+		return err
+	}
+	res, err := tx.Exec("DELETE FROM session WHERE userid = ?", userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to delete sessions of user ID %d: %v", userID, err)
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit revoking sessions of user ID %d: %v", userID, err)
+		return err
+	}
+
+	n, _ := res.RowsAffected()
+	log.Printf("[INFO] Revoked %d sessions for user ID %d", n, userID)
+	return nil
+}
+
+// UpdateUserAvatar stores a new avatar path for the user and returns the previous one
+func UpdateUserAvatar(db *sql.DB, userID int, avatarPath string) (string, error) {
+	log.Printf("[DEBUG] Updating avatar for user ID %d", userID)
+
+	var previous sql.NullString
+	if err := db.QueryRow("SELECT Avatar FROM user WHERE userid = ?", userID).Scan(&previous); err != nil {
+		log.Printf("[ERROR] Failed to load current avatar for user ID %d: %v", userID, err)
+		return "", err
+	}
+
+	if _, err := db.Exec("UPDATE user SET Avatar = ?, updated_at = CURRENT_TIMESTAMP WHERE userid = ?", avatarPath, userID); err != nil {
+		log.Printf("[ERROR] Failed to update avatar for user ID %d: %v", userID, err)
+		return "", err
+	}
+
+	log.Printf("[INFO] Avatar updated successfully for user ID %d", userID)
+	return previous.String, nil
+}
+
 // UserExists checks if a user with the given username or email already exists
 func UserExists(db *sql.DB, username, email string) (bool, error) {
 	log.Printf("[DEBUG] Checking if user exists with username: %s or email: %s", username, email)
 
-	var count int
-	query := `SELECT COUNT(*) FROM user WHERE Username = ? OR Email = ?`
-	err := db.QueryRow(query, username, email).Scan(&count)
+	usernameTaken, err := UsernameExists(db, username)
+	if err != nil {
+		return false, err
+	}
+
+	emailTaken, err := EmailExists(db, email)
 	if err != nil {
-		log.Printf("[ERROR] Failed to check user existence: %v", err)
 		return false, err
 	}
 
-	exists := count > 0
+	exists := usernameTaken || emailTaken
 	log.Printf("[INFO] User existence check: %v (username: %s, email: %s)", exists, username, email)
 	return exists, nil
 }
 
-// CreateUser creates a new user in the database
+// UsernameExists checks if a user with the given username already exists
+func UsernameExists(db *sql.DB, username string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM user WHERE LOWER(Username) = ?", NormalizeIdentifier(username)).Scan(&count)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check username existence: %v", err)
+		return false, err
+	}
+
+	log.Printf("[DEBUG] Username %s exists: %v", username, count > 0)
+	return count > 0, nil
+}
+
+// EmailExists checks if a user with the given email already exists
+func EmailExists(db *sql.DB, email string) (bool, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM user WHERE LOWER(Email) = ?", NormalizeIdentifier(email)).Scan(&count)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check email existence: %v", err)
+		return false, err
+	}
+
+	log.Printf("[DEBUG] Email %s exists: %v", email, count > 0)
+	return count > 0, nil
+}
+
+// NormalizeIdentifier trims and lowercases a username or email for case-insensitive comparison
+func NormalizeIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// CreateUser creates a new user in the database. The username keeps its display
+// casing but is trimmed; the email is stored normalized.
 func CreateUser(db *sql.DB, firstName, lastName, username, email, gender, dateOfBirth, password string) (int, error) {
+	username = strings.TrimSpace(username)
+	email = NormalizeIdentifier(email)
 	log.Printf("[DEBUG] Creating new user: %s (%s)", username, email)
 
 	// Hash the password
@@ -825,20 +1135,11 @@ func CreateUser(db *sql.DB, firstName, lastName, username, email, gender, dateOf
 		return 0, err
 	}
 
-	// Determine avatar based on gender
-	var avatarPath string
-	switch gender {
-	case "male":
-		avatarPath = "/static/assets/male-avatar-boy-face-man-user-7.svg"
-	case "female":
-		avatarPath = "/static/assets/female-avatar-girl-face-woman-user-9.svg"
-	default:
-		avatarPath = "/static/assets/default-avatar.png"
-	}
+	avatarPath := AvatarForGender(gender)
 
 	query := `
-		INSERT INTO user (F_name, L_name, Username, Email, gender, date_of_birth, password, Avatar)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO user (F_name, L_name, Username, Email, gender, date_of_birth, password, Avatar, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
 
 	result, err := db.Exec(query, firstName, lastName, username, email, gender, dateOfBirth, hashedPassword, avatarPath)
@@ -857,25 +1158,27 @@ func CreateUser(db *sql.DB, firstName, lastName, username, email, gender, dateOf
 	return int(userID), nil
 }
 
-// GetPostByID retrieves a single post by its ID
+// GetPostByID retrieves a single post by its ID. A post scheduled for later
+// is sql.ErrNoRows until it publishes.
 func GetPostByID(db *sql.DB, postID int) (Post, error) {
+	return GetPostByIDForViewer(db, postID, 0)
+}
+
+// GetPostByIDForViewer is GetPostByID that also finds viewerID's own scheduled
+// posts. A viewerID of 0 sees only published posts.
+func GetPostByIDForViewer(db *sql.DB, postID, viewerID int) (Post, error) {
 	log.Printf("[DEBUG] Retrieving post with ID %d", postID)
 
 	var post Post
 	query := `
-		SELECT post.postid, post.title, post.content, post.post_at, post.user_userid,
-		       user.Username, user.F_name, user.L_name, user.Avatar,
-		       (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
+		SELECT ` + postColumns + `,
+		       COALESCE(post.slug, ''), post.image, post.is_deleted
 		FROM post
 		JOIN user ON post.user_userid = user.userid
-		WHERE post.postid = ?
+		WHERE post.postid = ? AND (post.user_userid = ? OR ` + publishedCondition + `)
 	`
 
-	var postAt string
-	err := db.QueryRow(query, postID).Scan(
-		&post.PostID, &post.Title, &post.Content, &postAt, &post.UserUserID,
-		&post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments,
-	)
+	err := scanPost(db.QueryRow(query, postID, viewerID, publishedCutoff()), &post, &post.Slug, &post.Image, &post.IsDeleted)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -886,16 +1189,11 @@ func GetPostByID(db *sql.DB, postID int) (Post, error) {
 		return post, err
 	}
 
-	// Parse the timestamp
-	post.PostAt, err = time.Parse(time.RFC3339, postAt)
+	post.Likes, post.Dislikes, err = GetReactionCounts(db, postID)
 	if err != nil {
-		layout := "2006-01-02 15:04:05"
-		post.PostAt, err = time.Parse(layout, postAt)
-		if err != nil {
-			log.Printf("[WARN] Failed to parse post_at '%s' for post ID %d: %v", postAt, postID, err)
-			post.PostAt = time.Time{}
-		}
+		log.Printf("[WARN] Failed to fetch reaction counts for post ID %d: %v", postID, err)
 	}
+	post.Score = post.Likes - post.Dislikes
 
 	// Get categories for the post
 	categories, err := GetCategoriesForPost(db, post.PostID)
@@ -904,38 +1202,53 @@ func GetPostByID(db *sql.DB, postID int) (Post, error) {
 	}
 	post.Categories = categories
 
+	if post.IsDeleted {
+		tombstonePost(&post)
+	}
+
 	log.Printf("[INFO] Retrieved post with ID %d: title '%s'", postID, post.Title)
 	return post, nil
 }
 
-// CreatePost creates a new post with categories
+// CreatePost creates a new post with categories, visible immediately
 func CreatePost(db *sql.DB, userID int, title, content string, categories []string) (int, error) {
-	log.Printf("[DEBUG] Creating new post for user ID %d with title '%s'", userID, title)
+	return CreateScheduledPost(db, userID, title, content, categories, time.Time{})
+}
 
-	// Insert the post
-	postID, err := InsertPost(db, content, title, fmt.Sprintf("%d", userID))
-	if err != nil {
-		log.Printf("[ERROR] Failed to insert post: %v", err)
-		return 0, err
-	}
+// CreateScheduledPost creates a post that stays out of feeds, profiles and
+// lookups by others until publishAt. A zero publishAt publishes it at once.
+func CreateScheduledPost(db *sql.DB, userID int, title, content string, categories []string, publishAt time.Time) (int, error) {
+	log.Printf("[DEBUG] Creating new post for user ID %d with title '%s'", userID, title)
 
-	// Link categories to the post
-	for _, categoryIDStr := range categories {
-		// Convert category ID string to integer
-		categoryID, err := strconv.Atoi(categoryIDStr)
+	// Resolve categories first so an unknown name rejects the post before it
+	// is stored; "go" and "Go" resolve to the same one
+	var categoryIDs []int
+	linked := make(map[int]bool)
+	for _, token := range categories {
+		categoryID, err := resolveCategory(db, token)
+		if errors.Is(err, ErrUnknownCategory) {
+			log.Printf("[WARN] Rejected post from user %d: %v", userID, err)
+			return 0, err
+		}
 		if err != nil {
-			log.Printf("[WARN] Invalid category ID '%s', skipping: %v", categoryIDStr, err)
+			log.Printf("[WARN] Could not resolve category '%s', skipping: %v", token, err)
 			continue
 		}
-
-		// Verify category exists
-		var exists int
-		err = db.QueryRow("SELECT COUNT(*) FROM categories WHERE idcategories = ?", categoryID).Scan(&exists)
-		if err != nil || exists == 0 {
-			log.Printf("[WARN] Category ID %d not found, skipping: %v", categoryID, err)
+		if linked[categoryID] {
 			continue
 		}
+		linked[categoryID] = true
+		categoryIDs = append(categoryIDs, categoryID)
+	}
 
+	// Insert the post
+	postID, err := insertPost(db, content, title, userID, publishAt)
+	if err != nil {
+		log.Printf("[ERROR] Failed to insert post: %v", err)
+		return 0, err
+	}
+
+	for _, categoryID := range categoryIDs {
 		// Link post to category
 		err = InsertPostCategory(db, postID, categoryID)
 		if err != nil {
@@ -947,17 +1260,94 @@ func CreatePost(db *sql.DB, userID int, title, content string, categories []stri
 	return postID, nil
 }
 
-// AddComment adds a comment to a post
+// resolveCategory maps a category token to its ID. Numeric tokens are treated
+// as existing category IDs; anything else is normalized, looked up by name
+// ignoring case, and created if missing when ad-hoc categories are allowed.
+// An unknown ID, or a missing name otherwise, is ErrUnknownCategory.
+func resolveCategory(db *sql.DB, token string) (int, error) {
+	token = NormalizeCategoryName(token)
+	if token == "" {
+		return 0, fmt.Errorf("empty category")
+	}
+
+	if categoryID, err := strconv.Atoi(token); err == nil {
+		var exists int
+		err = db.QueryRow("SELECT COUNT(*) FROM categories WHERE idcategories = ?", categoryID).Scan(&exists)
+		if err != nil {
+			return 0, err
+		}
+		if exists == 0 {
+			return 0, fmt.Errorf("%w: ID %d", ErrUnknownCategory, categoryID)
+		}
+		log.Printf("[DEBUG] Category '%s' interpreted as ID %d", token, categoryID)
+		return categoryID, nil
+	}
+
+	var categoryID int
+	err := db.QueryRow("SELECT idcategories FROM categories WHERE name = ? COLLATE NOCASE ORDER BY idcategories LIMIT 1", token).Scan(&categoryID)
+	if err == nil {
+		log.Printf("[DEBUG] Category '%s' interpreted as name (ID %d)", token, categoryID)
+		return categoryID, nil
+	}
+	if err != sql.ErrNoRows {
+		return 0, err
+	}
+	if !allowAdHocCategories {
+		return 0, fmt.Errorf("%w: %s", ErrUnknownCategory, token)
+	}
+
+	result, err := db.Exec("INSERT INTO categories (name) VALUES (?)", token)
+	if err != nil {
+		return 0, err
+	}
+	newID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	InvalidateCategoryCache()
+	log.Printf("[INFO] Category '%s' interpreted as new name, created with ID %d", token, newID)
+	return int(newID), nil
+}
+
+// AddComment adds a comment to a post. Returns ErrPostNotFound unless the post
+// is visible to userID, ErrPostDeleted if it has been deleted, and
+// ErrDuplicateComment when the same comment is repeated within
+// DuplicateCommentWindow.
 func AddComment(db *sql.DB, postID, userID int, content string) error {
 	log.Printf("[DEBUG] Adding comment to post ID %d by user ID %d", postID, userID)
 
+	if err := checkLength("content", content, MaxCommentLength); err != nil {
+		return err
+	}
+
+	var deleted bool
+	err := db.QueryRow(`
+		SELECT post.is_deleted FROM post
+		WHERE post.postid = ? AND (post.user_userid = ? OR `+publishedCondition+`)`,
+		postID, userID, publishedCutoff()).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		log.Printf("[WARN] Rejected comment by user %d on post %d, which they cannot see", userID, postID)
+		return ErrPostNotFound
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to look up post %d for comment: %v", postID, err)
+		return err
+	}
+	if deleted {
+		log.Printf("[WARN] Rejected comment by user %d on deleted post %d", userID, postID)
+		return ErrPostDeleted
+	}
+	if err := checkDuplicateComment(db, postID, userID, content); err != nil {
+		return err
+	}
+
 	query := `
 		INSERT INTO comment (post_postid, user_userid, content, comment_at)
 		VALUES (?, ?, ?, ?)
 	`
 
 	currentTime := time.Now().Format("2006-01-02 15:04:05")
-	_, err := db.Exec(query, postID, userID, content, currentTime)
+	_, err = db.Exec(query, postID, userID, content, currentTime)
 	if err != nil {
 		log.Printf("[ERROR] Failed to add comment to post ID %d: %v", postID, err)
 		return err
@@ -973,25 +1363,22 @@ func GetPostsByUser(db *sql.DB, userID int) ([]Post, error) {
 	return GetUserPosts(db, userID, "newest")
 }
 
-// GetLikedPostsByUser retrieves posts liked by a specific user
-func GetLikedPostsByUser(db *sql.DB, userID int) ([]Post, error) {
-	log.Printf("[DEBUG] Retrieving liked posts by user ID %d", userID)
+// GetLikedPostsByUser retrieves posts liked by a specific user, most recently liked first.
+// A non-positive limit returns every liked post from offset onwards.
+func GetLikedPostsByUser(db *sql.DB, userID, limit, offset int) ([]Post, error) {
+	log.Printf("[DEBUG] Retrieving liked posts by user ID %d (limit %d, offset %d)", userID, limit, offset)
 
-	// This is a placeholder implementation since we don't have a likes table yet
-	// In a real implementation, you'd have a likes/reactions table
 	query := `
-		SELECT DISTINCT post.postid, post.title, post.content, post.post_at, post.user_userid,
-		       user.Username, user.F_name, user.L_name, user.Avatar,
-		       (SELECT COUNT(*) FROM comment WHERE comment.post_postid = post.postid) AS Comments
-		FROM post
+		SELECT ` + postColumns + `
+		FROM post_reaction r
+		JOIN post ON post.postid = r.post_id
 		JOIN user ON post.user_userid = user.userid
-		WHERE post.postid IN (
-			SELECT post_postid FROM comment WHERE user_userid = ?
-		)
-		ORDER BY post.post_at DESC
+		WHERE r.user_id = ? AND r.reaction = ? AND post.is_deleted = 0 AND ` + publishedCondition + `
+		ORDER BY r.reacted_at DESC, post.postid DESC
+		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.Query(query, userID)
+	rows, err := db.Query(query, userID, ReactionLike, publishedCutoff(), sqlLimit(limit), offset)
 	if err != nil {
 		log.Printf("[ERROR] Failed to query liked posts for user ID %d: %v", userID, err)
 		return nil, err
@@ -1001,27 +1388,11 @@ func GetLikedPostsByUser(db *sql.DB, userID int) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		var postAt string
-		if err := rows.Scan(&post.PostID, &post.Title, &post.Content, &postAt, &post.UserUserID, &post.Username, &post.FirstName, &post.LastName, &post.Avatar, &post.Comments); err != nil {
+		if err := scanPost(rows, &post); err != nil {
 			log.Printf("[ERROR] Failed to scan liked post row for user ID %d: %v", userID, err)
 			return nil, err
 		}
 
-		post.PostAt, err = time.Parse(time.RFC3339, postAt)
-		if err != nil {
-			layout := "2006-01-02 15:04:05"
-			post.PostAt, err = time.Parse(layout, postAt)
-			if err != nil {
-				log.Printf("[WARN] Failed to parse post_at '%s' in GetLikedPostsByUser: %v", postAt, err)
-				post.PostAt = time.Time{}
-			}
-		}
-
-		categories, err := GetCategoriesForPost(db, post.PostID)
-		if err != nil {
-			log.Printf("[WARN] Failed to fetch categories for post ID %d: %v", post.PostID, err)
-		}
-		post.Categories = categories
 		posts = append(posts, post)
 	}
 
@@ -1029,14 +1400,26 @@ func GetLikedPostsByUser(db *sql.DB, userID int) ([]Post, error) {
 		log.Printf("[ERROR] Error iterating liked post rows for user ID %d: %v", userID, err)
 		return nil, err
 	}
+	if err := loadPostCategories(db, posts); err != nil {
+		log.Printf("[WARN] Failed to fetch categories for posts: %v", err)
+	}
 
 	log.Printf("[INFO] Retrieved %d liked posts for user ID %d", len(posts), userID)
 	return posts, nil
 }
 
+// bcryptCost is the work factor for newly hashed passwords
+var bcryptCost = bcrypt.DefaultCost
+
+// SetBcryptCost changes the work factor used when hashing new passwords.
+// Existing hashes keep verifying since bcrypt stores the cost in the hash.
+func SetBcryptCost(cost int) {
+	bcryptCost = cost
+}
+
 // hashPassword hashes a password using bcrypt
 func hashPassword(password string) (string, error) {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+)
+
+// Reaction types a user can leave on a post. Each user holds at most one reaction per post.
+const (
+	ReactionLike    = "like"
+	ReactionDislike = "dislike"
+)
+
+// postScoreColumn selects a post's net score (likes minus dislikes) as Score
+const postScoreColumn = `(SELECT COALESCE(SUM(CASE post_reaction.reaction WHEN 'like' THEN 1 WHEN 'dislike' THEN -1 ELSE 0 END), 0)
+                    FROM post_reaction WHERE post_reaction.post_id = post.postid) AS Score`
+
+// SetReaction records a user's reaction on a post, replacing any earlier reaction
+// so switching between like and dislike never leaves two rows behind
+func SetReaction(db *sql.DB, userID, postID int, reaction string) error {
+	if reaction != ReactionLike && reaction != ReactionDislike {
+		return fmt.Errorf("unknown reaction %q", reaction)
+	}
+	log.Printf("[DEBUG] User %d reacting '%s' to post %d", userID, reaction, postID)
+
+	_, err := db.Exec(`
+		INSERT INTO post_reaction (post_id, user_id, reaction)
+		VALUES (?, ?, ?)
+		ON CONFLICT(post_id, user_id) DO UPDATE SET
+			reaction = excluded.reaction,
+			reacted_at = CASE WHEN post_reaction.reaction = excluded.reaction
+				THEN post_reaction.reacted_at ELSE CURRENT_TIMESTAMP END
+	`, postID, userID, reaction)
+	if err != nil {
+		log.Printf("[ERROR] Failed to record '%s' from user %d on post %d: %v", reaction, userID, postID, err)
+		return err
+	}
+
+	log.Printf("[INFO] User %d reacted '%s' to post %d", userID, reaction, postID)
+	return nil
+}
+
+// RemoveReaction clears whatever reaction a user has left on a post
+func RemoveReaction(db *sql.DB, userID, postID int) error {
+	log.Printf("[DEBUG] Removing reaction from user %d on post %d", userID, postID)
+
+	_, err := db.Exec("DELETE FROM post_reaction WHERE post_id = ? AND user_id = ?", postID, userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to remove reaction from user %d on post %d: %v", userID, postID, err)
+		return err
+	}
+	return nil
+}
+
+// LoadLikedByMe sets LikedByMe on the posts userID has liked, checking the
+// whole page with a single query
+func LoadLikedByMe(db *sql.DB, userID int, posts []Post) error {
+	if userID == 0 || len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(posts))
+	for i, post := range posts {
+		ids[i] = post.PostID
+	}
+	placeholders, args := inPlaceholders(ids)
+
+	rows, err := db.Query("SELECT post_id FROM post_reaction WHERE user_id = ? AND reaction = ? AND post_id IN ("+placeholders+")",
+		append([]interface{}{userID, ReactionLike}, args...)...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to load likes of user %d for %d posts: %v", userID, len(posts), err)
+		return err
+	}
+	defer rows.Close()
+
+	liked := make(map[int]bool)
+	for rows.Next() {
+		var postID int
+		if err := rows.Scan(&postID); err != nil {
+			return err
+		}
+		liked[postID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].LikedByMe = liked[posts[i].PostID]
+	}
+	return nil
+}
+
+// LikePost records that a user likes a post, replacing a dislike if there was one
+func LikePost(db *sql.DB, userID, postID int) error {
+	return SetReaction(db, userID, postID, ReactionLike)
+}
+
+// DislikePost records that a user dislikes a post, replacing a like if there was one
+func DislikePost(db *sql.DB, userID, postID int) error {
+	return SetReaction(db, userID, postID, ReactionDislike)
+}
+
+// UnlikePost removes a user's like from a post, leaving a dislike untouched
+func UnlikePost(db *sql.DB, userID, postID int) error {
+	log.Printf("[DEBUG] User %d unliking post %d", userID, postID)
+
+	_, err := db.Exec("DELETE FROM post_reaction WHERE post_id = ? AND user_id = ? AND reaction = ?", postID, userID, ReactionLike)
+	if err != nil {
+		log.Printf("[ERROR] Failed to remove like from user %d on post %d: %v", userID, postID, err)
+		return err
+	}
+
+	log.Printf("[INFO] User %d unliked post %d", userID, postID)
+	return nil
+}
+
+// GetReactionCounts returns the number of likes and dislikes on a post
+func GetReactionCounts(db *sql.DB, postID int) (likes, dislikes int, err error) {
+	err = db.QueryRow(`
+		SELECT COALESCE(SUM(reaction = 'like'), 0), COALESCE(SUM(reaction = 'dislike'), 0)
+		FROM post_reaction
+		WHERE post_id = ?
+	`, postID).Scan(&likes, &dislikes)
+	if err != nil {
+		log.Printf("[ERROR] Failed to count reactions for post %d: %v", postID, err)
+		return 0, 0, err
+	}
+	return likes, dislikes, nil
+}
@@ -0,0 +1,178 @@
+package database
+
+import (
+	"database/sql"
+	"log"
+)
+
+// SetLastRead moves a user's read pointer in a conversation forward to messageID.
+// The pointer never moves backwards, so out-of-order acknowledgements are harmless.
+func SetLastRead(db *sql.DB, conversationID, userID, messageID int) error {
+	log.Printf("[DEBUG] Setting last read message for user %d in conversation %d to %d", userID, conversationID, messageID)
+
+	_, err := db.Exec(`
+		INSERT INTO conversation_read_state (conversation_id, user_id, last_read_message_id)
+		VALUES (?, ?, ?)
+		ON CONFLICT(conversation_id, user_id) DO UPDATE SET
+			last_read_message_id = MAX(last_read_message_id, excluded.last_read_message_id),
+			updated_at = CURRENT_TIMESTAMP
+	`, conversationID, userID, messageID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to set last read message for user %d in conversation %d: %v", userID, conversationID, err)
+		return err
+	}
+	return nil
+}
+
+// GetLastRead returns the id of the last message the user has read in a conversation,
+// or 0 if they have never read it
+func GetLastRead(db *sql.DB, conversationID, userID int) (int, error) {
+	var messageID int
+	err := db.QueryRow(`
+		SELECT last_read_message_id FROM conversation_read_state
+		WHERE conversation_id = ? AND user_id = ?
+	`, conversationID, userID).Scan(&messageID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to get last read message for user %d in conversation %d: %v", userID, conversationID, err)
+		return 0, err
+	}
+	return messageID, nil
+}
+
+// GetUnreadCountSinceLastRead counts messages from other participants that arrived
+// after the user's read pointer
+func GetUnreadCountSinceLastRead(db *sql.DB, conversationID, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM message m
+		WHERE m.conversation_id = ?
+		AND m.sender_id != ?
+		AND m.message_id > COALESCE((
+			SELECT last_read_message_id FROM conversation_read_state
+			WHERE conversation_id = ? AND user_id = ?
+		), 0)
+	`, conversationID, userID, conversationID, userID).Scan(&count)
+	if err != nil {
+		log.Printf("[ERROR] Failed to count unread messages for user %d in conversation %d: %v", userID, conversationID, err)
+		return 0, err
+	}
+
+	log.Printf("[DEBUG] User %d has %d messages past their read pointer in conversation %d", userID, count, conversationID)
+	return count, nil
+}
+
+// GetTotalUnreadCount counts messages from other participants past the user's
+// read pointer across all of their conversations
+func GetTotalUnreadCount(db *sql.DB, userID int) (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM conversation_participants cp
+		LEFT JOIN conversation_read_state rs
+			ON rs.conversation_id = cp.conversation_id AND rs.user_id = cp.user_id
+		JOIN message m ON m.conversation_id = cp.conversation_id
+		WHERE cp.user_id = ?
+		AND m.message_id > COALESCE(rs.last_read_message_id, 0)
+		AND m.sender_id != cp.user_id
+	`, userID).Scan(&count)
+	if err != nil {
+		log.Printf("[ERROR] Failed to count total unread messages for user %d: %v", userID, err)
+		return 0, err
+	}
+	return count, nil
+}
+
+// unreadConversationsQuery finds the user's conversations holding a message
+// from someone else past their read pointer. The participant lookup uses
+// idx_conversation_participants_user, the read pointer the read state primary
+// key, and the message probe idx_message_conversation, which SQLite extends
+// with the message id.
+const unreadConversationsQuery = `
+	SELECT cp.conversation_id
+	FROM conversation_participants cp
+	LEFT JOIN conversation_read_state rs
+		ON rs.conversation_id = cp.conversation_id AND rs.user_id = cp.user_id
+	WHERE cp.user_id = ?
+	AND EXISTS (
+		SELECT 1 FROM message m
+		WHERE m.conversation_id = cp.conversation_id
+		AND m.message_id > COALESCE(rs.last_read_message_id, 0)
+		AND m.sender_id != cp.user_id
+	)
+	ORDER BY cp.conversation_id
+`
+
+// GetUnreadConversationIDs returns the conversations in which userID has
+// incoming messages past their read pointer, in one query
+func GetUnreadConversationIDs(db *sql.DB, userID int) ([]int, error) {
+	rows, err := db.Query(unreadConversationsQuery, userID)
+	if err != nil {
+		log.Printf("[ERROR] Failed to find conversations with unread messages for user %d: %v", userID, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkAllConversationsRead marks every unread incoming message in all of the
+// user's conversations as read and moves each read pointer to the newest message,
+// all in one transaction. Returns the number of messages marked.
+func MarkAllConversationsRead(db *sql.DB, userID int) (int, error) {
+	log.Printf("[DEBUG] Marking all conversations as read for user %d", userID)
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("[ERROR] Failed to begin transaction for marking all read for user %d: %v", userID, err)
+		return 0, err
+	}
+
+	res, err := tx.Exec(`
+		UPDATE message
+		SET is_read = 1
+		WHERE is_read = 0 AND sender_id != ?
+		AND conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id = ?)
+	`, userID, userID)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to mark messages as read for user %d: %v", userID, err)
+		return 0, err
+	}
+	affected, _ := res.RowsAffected()
+
+	_, err = tx.Exec(`
+		INSERT INTO conversation_read_state (conversation_id, user_id, last_read_message_id)
+		SELECT cp.conversation_id, cp.user_id, MAX(m.message_id)
+		FROM conversation_participants cp
+		JOIN message m ON m.conversation_id = cp.conversation_id
+		WHERE cp.user_id = ?
+		GROUP BY cp.conversation_id
+		ON CONFLICT(conversation_id, user_id) DO UPDATE SET
+			last_read_message_id = MAX(last_read_message_id, excluded.last_read_message_id),
+			updated_at = CURRENT_TIMESTAMP
+	`, userID)
+	if err != nil {
+		tx.Rollback()
+		log.Printf("[ERROR] Failed to advance read pointers for user %d: %v", userID, err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("[ERROR] Failed to commit marking all read for user %d: %v", userID, err)
+		return 0, err
+	}
+
+	log.Printf("[INFO] Marked %d messages as read across all conversations for user %d", affected, userID)
+	return int(affected), nil
+}
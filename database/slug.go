@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Slugify converts a title into a lowercase, hyphen-separated URL fragment
+func Slugify(title string) string {
+	var b strings.Builder
+	pendingHyphen := false
+
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if pendingHyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			pendingHyphen = false
+		} else {
+			pendingHyphen = true
+		}
+	}
+
+	return b.String()
+}
+
+// assignPostSlug generates a unique slug for a post from its title, appending a
+// numeric suffix for duplicates and falling back to the post ID for empty titles
+func assignPostSlug(db *sql.DB, postID int, title string) (string, error) {
+	base := Slugify(title)
+	if base == "" {
+		base = strconv.Itoa(postID)
+	}
+
+	slug := base
+	for n := 2; ; n++ {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM post WHERE slug = ? AND postid != ?", slug, postID).Scan(&count)
+		if err != nil {
+			return "", err
+		}
+		if count == 0 {
+			break
+		}
+		slug = fmt.Sprintf("%s-%d", base, n)
+	}
+
+	if _, err := db.Exec("UPDATE post SET slug = ? WHERE postid = ?", slug, postID); err != nil {
+		return "", err
+	}
+
+	log.Printf("[DEBUG] Assigned slug '%s' to post ID %d", slug, postID)
+	return slug, nil
+}
+
+// backfillPostSlugs assigns slugs to posts created before slugs existed
+func backfillPostSlugs(db *sql.DB) error {
+	rows, err := db.Query("SELECT postid, COALESCE(title, '') FROM post WHERE slug IS NULL OR slug = '' ORDER BY postid")
+	if err != nil {
+		return err
+	}
+
+	type pending struct {
+		id    int
+		title string
+	}
+	var posts []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.id, &p.title); err != nil {
+			rows.Close()
+			return err
+		}
+		posts = append(posts, p)
+	}
+	rows.Close()
+
+	for _, p := range posts {
+		if _, err := assignPostSlug(db, p.id, p.title); err != nil {
+			return err
+		}
+	}
+
+	if len(posts) > 0 {
+		log.Printf("[INFO] Backfilled slugs for %d posts", len(posts))
+	}
+	return nil
+}
+
+// GetPostBySlug retrieves a single post by its slug
+func GetPostBySlug(db *sql.DB, slug string) (Post, error) {
+	log.Printf("[DEBUG] Retrieving post with slug '%s'", slug)
+
+	var postID int
+	err := db.QueryRow("SELECT postid FROM post WHERE slug = ?", slug).Scan(&postID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			log.Printf("[INFO] No post found with slug '%s'", slug)
+		} else {
+			log.Printf("[ERROR] Failed to query post with slug '%s': %v", slug, err)
+		}
+		return Post{}, err
+	}
+
+	return GetPostByID(db, postID)
+}
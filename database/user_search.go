@@ -0,0 +1,71 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// likeEscaper escapes LIKE wildcards so a search term matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchUsers returns up to limit users whose username, first or last name
+// contains query, ignoring case. Usernames starting with query come first.
+func SearchUsers(db *sql.DB, query string, limit int) ([]User, error) {
+	return searchUsers(db, 0, query, limit)
+}
+
+// SearchUsersFor is SearchUsers as seen by viewerID: the viewer and anyone on
+// either side of a block with them are left out.
+func SearchUsersFor(db *sql.DB, viewerID int, query string, limit int) ([]User, error) {
+	return searchUsers(db, viewerID, query, limit)
+}
+
+func searchUsers(db *sql.DB, viewerID int, query string, limit int) ([]User, error) {
+	log.Printf("[DEBUG] Searching users for %q (viewer %d, limit %d)", query, viewerID, limit)
+
+	term := strings.TrimSpace(query)
+	if term == "" {
+		return []User{}, nil
+	}
+	pattern := "%" + likeEscaper.Replace(term) + "%"
+	prefix := likeEscaper.Replace(term) + "%"
+
+	conditions := "(user.Username LIKE ? ESCAPE '\\' OR user.F_name LIKE ? ESCAPE '\\' OR user.L_name LIKE ? ESCAPE '\\')"
+	args := []interface{}{pattern, pattern, pattern}
+	if viewerID > 0 {
+		conditions += " AND user.userid != ? AND " + blockedCondition
+		args = append(args, viewerID, viewerID, viewerID)
+	}
+	args = append(args, prefix, sqlLimit(limit))
+
+	rows, err := db.Query(fmt.Sprintf(`
+		SELECT user.userid, user.F_name, user.L_name, user.Username, user.Avatar
+		FROM user
+		WHERE %s
+		ORDER BY (user.Username LIKE ? ESCAPE '\') DESC, user.Username COLLATE NOCASE
+		LIMIT ?`, conditions), args...)
+	if err != nil {
+		log.Printf("[ERROR] Failed to search users for %q: %v", query, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.Scan(&user.ID, &user.FirstName, &user.LastName, &user.Username, &user.Avatar); err != nil {
+			log.Printf("[ERROR] Failed to scan user search row: %v", err)
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("[ERROR] Error iterating user search rows: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] User search for %q matched %d users", query, len(users))
+	return users, nil
+}
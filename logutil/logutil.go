@@ -0,0 +1,61 @@
+// Package logutil shortens user content and SQL for log lines, so previews
+// look the same everywhere and never split a multibyte character.
+package logutil
+
+import (
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// DefaultPreviewLength is the preview length used until SetPreviewLength is called
+const DefaultPreviewLength = 50
+
+var previewLength atomic.Int64
+
+func init() {
+	previewLength.Store(DefaultPreviewLength)
+}
+
+// SetPreviewLength sets how many characters Preview keeps. A non-positive
+// value restores the default. Call before serving.
+func SetPreviewLength(n int) {
+	if n <= 0 {
+		n = DefaultPreviewLength
+	}
+	previewLength.Store(int64(n))
+}
+
+// PreviewLength returns how many characters Preview keeps
+func PreviewLength() int {
+	return int(previewLength.Load())
+}
+
+// Preview shortens s to the configured preview length
+func Preview(s string) string {
+	return Truncate(s, PreviewLength())
+}
+
+// Truncate shortens s to at most max characters, replacing the end with "..."
+// when anything is cut. It counts and cuts whole runes, so multibyte content
+// stays valid UTF-8. A non-positive max leaves s unchanged.
+func Truncate(s string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s
+	}
+
+	const ellipsis = "..."
+	keep := max - len(ellipsis)
+	suffix := ellipsis
+	if keep <= 0 {
+		keep, suffix = max, ""
+	}
+
+	n := 0
+	for i := range s {
+		if n == keep {
+			return s[:i] + suffix
+		}
+		n++
+	}
+	return s
+}
@@ -11,17 +11,51 @@ import (
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"connecthub/config"
 	db "connecthub/database"
+	"connecthub/logutil"
+	"connecthub/paging"
+	"connecthub/sanitize"
 	"connecthub/server"
+	"connecthub/uploads"
 )
 
-// Command line flags
+// Command line flags. Settings flags override the config file and CONNECTHUB_*
+// environment variables, but only when given explicitly.
 var (
-	loadTestData = flag.Bool("test-data", false, "Load seed/test data into database")
-	serverPort   = flag.String("port", "8080", "Override default port 8080 with custom port")
+	configPath   = flag.String("config", os.Getenv(config.EnvPrefix+"CONFIG"), "Path to a JSON config file")
+	loadTestData = flag.Bool("test-data", false, "Seed the fixture users, posts and conversations used by the test suite")
 	resetDB      = flag.Bool("reset", false, "Clear existing database and create fresh empty database")
 )
 
+// registerSettingFlags adds a flag for each config setting that can be set on the command line
+func registerSettingFlags() {
+	defaults := config.Default()
+	flag.String("port", defaults.Port, "Override default port 8080 with custom port")
+	flag.String("db", defaults.DBPath, "Path to the SQLite database file")
+	flag.Duration("session-ttl", time.Duration(defaults.SessionTTL), "How long login sessions stay valid")
+	flag.Int("max-message-length", defaults.MaxMessageLength, "Maximum characters in a chat message")
+	flag.Int("message-rate", defaults.MessageRate, "Messages, posts and comments each user may create per minute")
+	flag.Int("max-posts-per-day", defaults.MaxPostsPerDay, "Posts each user may create in 24 hours; 0 disables the cap")
+	flag.Int("max-connections", defaults.MaxConnections, "WebSocket connections each user may hold open; the oldest is closed beyond this")
+	flag.String("allowed-origins", "", "Comma-separated cross-origin sites allowed to use the API and WebSocket; same-origin only when empty")
+	flag.Int("bcrypt-cost", defaults.BcryptCost, "bcrypt work factor for new password hashes")
+	flag.String("sanitize", defaults.SanitizeMode, "How to neutralize markup in posts and comments: escape or strip")
+	flag.String("display-name", defaults.DisplayName, "How chat senders are named: username or full_name")
+	flag.String("upload-dir", defaults.UploadDir, "Directory uploaded avatars and attachments are stored in")
+	flag.Int64("max-body-size", defaults.MaxBodySize, "Largest request body in bytes; bigger requests get 413")
+	flag.Int64("max-upload-size", defaults.MaxUploadSize, "Largest multipart upload body in bytes")
+	flag.Int("page-size", defaults.PageSize, "Items a list endpoint returns when no limit is given")
+	flag.Int("max-page-size", defaults.MaxPageSize, "Largest limit a list endpoint accepts")
+	flag.Int("log-preview-length", defaults.LogPreviewLength, "Characters of message content shown in log lines")
+	flag.Duration("retention", 0, "Delete chat messages older than this duration (e.g. 720h); 0 disables pruning")
+	flag.Bool("allow-ad-hoc-categories", defaults.AllowAdHocCategories, "Let posts create categories by naming them instead of only using existing ones")
+	flag.String("admins", "", "Comma-separated usernames allowed to create categories")
+}
+
+// retentionSweepInterval is how often old messages are pruned when retention is enabled
+const retentionSweepInterval = time.Hour
+
 func init() {
 	setupLogging()
 }
@@ -43,29 +77,34 @@ func initializeDatabase() {
 		log.Printf("[INFO] Database reinitialized successfully")
 	}
 
-	// Handle test-data flag or load test data by default if no users exist
-	if *loadTestData || shouldLoadTestDataByDefault() {
-		log.Printf("[INFO] Loading test data with properly hashed passwords")
-		err := db.LoadTestData()
+	// -test-data seeds the fixture users; an empty database otherwise gets the demo community
+	if *loadTestData {
+		log.Printf("[INFO] Loading fixture data")
+		if err := db.LoadTestData(); err != nil {
+			log.Printf("[ERROR] Failed to load fixture data: %v", err)
+		}
+	} else if shouldLoadDemoDataByDefault() {
+		log.Printf("[INFO] Loading demo data with properly hashed passwords")
+		err := db.LoadDemoData()
 		if err != nil {
-			log.Printf("[ERROR] Failed to load test data: %v", err)
+			log.Printf("[ERROR] Failed to load demo data: %v", err)
 		} else {
-			log.Printf("[INFO] Test data loaded successfully with hashed passwords")
+			log.Printf("[INFO] Demo data loaded successfully with hashed passwords")
 		}
 	}
 }
 
-// shouldLoadTestDataByDefault checks if test data should be loaded when no explicit flag is provided
-func shouldLoadTestDataByDefault() bool {
-	// Only load test data by default if no explicit flags are provided and user table is empty
+// shouldLoadDemoDataByDefault checks if demo data should be loaded when no explicit flag is provided
+func shouldLoadDemoDataByDefault() bool {
+	// Only load demo data by default if no explicit flags are provided and user table is empty
 	if *loadTestData || *resetDB {
 		return false // Explicit flags take precedence
 	}
 
-	log.Printf("[DEBUG] Checking if test data should be loaded by default")
-	dbConn, err := sql.Open("sqlite3", "./database/main.db")
+	log.Printf("[DEBUG] Checking if demo data should be loaded by default")
+	dbConn, err := sql.Open("sqlite3", db.Path())
 	if err != nil {
-		log.Printf("[ERROR] Database connection failed during default test data check: %v", err)
+		log.Printf("[ERROR] Database connection failed during default demo data check: %v", err)
 		return false
 	}
 	defer dbConn.Close()
@@ -73,15 +112,38 @@ func shouldLoadTestDataByDefault() bool {
 	var count int
 	err = dbConn.QueryRow("SELECT COUNT(*) FROM user").Scan(&count)
 	if err != nil {
-		log.Printf("[WARN] Failed to query user count, not loading test data by default: %v", err)
+		log.Printf("[WARN] Failed to query user count, not loading demo data by default: %v", err)
 		return false
 	}
 
 	shouldLoad := count == 0
-	log.Printf("[INFO] User table has %d records, loading test data by default: %v", count, shouldLoad)
+	log.Printf("[INFO] User table has %d records, loading demo data by default: %v", count, shouldLoad)
 	return shouldLoad
 }
 
+// startRetentionSweeper periodically prunes chat messages older than the retention window
+func startRetentionSweeper(olderThan time.Duration) {
+	log.Printf("[INFO] Message retention enabled: pruning messages older than %s every %s", olderThan, retentionSweepInterval)
+
+	go func() {
+		ticker := time.NewTicker(retentionSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			dbConn, err := sql.Open("sqlite3", db.Path())
+			if err != nil {
+				log.Printf("[ERROR] Retention sweeper: Database connection failed: %v", err)
+			} else {
+				if _, err := db.PruneOldMessages(dbConn, olderThan); err != nil {
+					log.Printf("[ERROR] Retention sweeper: Pruning failed: %v", err)
+				}
+				dbConn.Close()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
 func setupLogging() {
 	if _, err := os.Stat("logs"); os.IsNotExist(err) {
 		err := os.Mkdir("logs", 0755)
@@ -106,15 +168,39 @@ func setupLogging() {
 
 func main() {
 	// Parse command line flags
+	registerSettingFlags()
 	flag.Parse()
 
 	log.Printf("[INFO] Initializing application...")
 
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("[FATAL] Failed to load configuration: %v", err)
+	}
+	if err := cfg.ApplyFlags(flag.CommandLine); err != nil {
+		log.Fatalf("[FATAL] Invalid command line setting: %v", err)
+	}
+
+	sanitize.SetPolicy(sanitize.ParsePolicy(cfg.SanitizeMode))
+	db.SetPath(cfg.DBPath)
+	uploads.SetBaseDir(cfg.UploadDir)
+	paging.SetLimits(cfg.PageSize, cfg.MaxPageSize)
+	logutil.SetPreviewLength(cfg.LogPreviewLength)
+	db.SetBcryptCost(cfg.BcryptCost)
+	db.SetAllowAdHocCategories(cfg.AllowAdHocCategories)
+	if err := db.SetDisplayNameFormat(cfg.DisplayName); err != nil {
+		log.Fatalf("[FATAL] %v", err)
+	}
+
 	// Initialize database
 	initializeDatabase()
 
+	if cfg.Retention > 0 {
+		startRetentionSweeper(time.Duration(cfg.Retention))
+	}
+
 	// Create and initialize server
-	srv := server.NewHTTPServer(*serverPort)
+	srv := server.NewHTTPServer(cfg)
 	if err := srv.Initialize(); err != nil {
 		log.Fatalf("[FATAL] Failed to initialize server: %v", err)
 	}
@@ -0,0 +1,84 @@
+package origin
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Wildcard may be listed as an allowed origin to accept requests from anywhere.
+// Such requests are not trusted with credentials: see Policy.Trusts.
+const Wildcard = "*"
+
+// Policy decides which browser origins may call the API and open WebSocket
+// connections. Requests from the server's own host are always accepted; other
+// origins must be listed explicitly.
+type Policy struct {
+	allowAll bool
+	allowed  map[string]bool
+}
+
+// NewPolicy builds a Policy from a list of origins such as "https://app.example.com".
+// An empty list allows same-origin requests only.
+func NewPolicy(origins []string) *Policy {
+	p := &Policy{allowed: make(map[string]bool)}
+	for _, o := range origins {
+		o = normalize(o)
+		if o == "" {
+			continue
+		}
+		if o == Wildcard {
+			p.allowAll = true
+			continue
+		}
+		p.allowed[o] = true
+	}
+	return p
+}
+
+// ParseList splits a comma-separated list of origins, dropping empty entries
+func ParseList(list string) []string {
+	var origins []string
+	for _, o := range strings.Split(list, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	return origins
+}
+
+// Allows reports whether the request's Origin header is acceptable. Requests
+// without an Origin header come from non-browser clients or same-origin
+// navigation and are allowed.
+func (p *Policy) Allows(r *http.Request) bool {
+	o := r.Header.Get("Origin")
+	if o == "" {
+		return true
+	}
+	return p.AllowsOrigin(o, r.Host)
+}
+
+// AllowsOrigin reports whether a request from origin to host is acceptable
+func (p *Policy) AllowsOrigin(o, host string) bool {
+	return p.allowAll || p.Trusts(o, host)
+}
+
+// Trusts reports whether origin may make credentialed requests to host: it is
+// either listed explicitly or the server's own host. An origin let in only by
+// the wildcard is allowed but not trusted, since any site could claim it.
+func (p *Policy) Trusts(o, host string) bool {
+	o = normalize(o)
+	if p.allowed[o] {
+		return true
+	}
+
+	u, err := url.Parse(o)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
+
+func normalize(o string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(o)), "/")
+}
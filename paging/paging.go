@@ -0,0 +1,90 @@
+// Package paging parses the limit, offset and page query parameters list
+// endpoints accept, so every endpoint treats them the same way.
+package paging
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// Defaults used until SetLimits is called
+const (
+	DefaultLimit    = 20
+	DefaultMaxLimit = 100
+)
+
+var (
+	mu           sync.RWMutex
+	defaultLimit = DefaultLimit
+	maxLimit     = DefaultMaxLimit
+)
+
+// SetLimits sets the page size used when a request names none and the largest
+// one a request may ask for. Non-positive values restore the defaults, and max
+// is raised to def if it is smaller. Call before serving.
+func SetLimits(def, max int) {
+	if def <= 0 {
+		def = DefaultLimit
+	}
+	if max <= 0 {
+		max = DefaultMaxLimit
+	}
+	if max < def {
+		max = def
+	}
+
+	mu.Lock()
+	defaultLimit, maxLimit = def, max
+	mu.Unlock()
+}
+
+// Limits returns the configured default and maximum page sizes
+func Limits() (def, max int) {
+	mu.RLock()
+	defer mu.RUnlock()
+	return defaultLimit, maxLimit
+}
+
+// Parse reads limit and either offset or page from r using the configured
+// limits. A missing, malformed or non-positive limit gets the default and an
+// oversized one is capped at the maximum. An explicit offset wins over page;
+// a negative offset becomes 0 and a page below 1 becomes page 1.
+func Parse(r *http.Request) (limit, offset int) {
+	def, max := Limits()
+	return ParseWith(r, def, max)
+}
+
+// ParseWith is Parse with bounds of the endpoint's own, for lists whose natural
+// page size differs from the configured one
+func ParseWith(r *http.Request, def, max int) (limit, offset int) {
+	query := r.URL.Query()
+
+	limit = def
+	if parsed, err := strconv.Atoi(query.Get("limit")); err == nil && parsed > 0 {
+		limit = parsed
+	}
+	if limit > max {
+		limit = max
+	}
+
+	if raw := query.Get("offset"); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed > 0 {
+			offset = parsed
+		}
+		return limit, offset
+	}
+
+	page := 1
+	if parsed, err := strconv.Atoi(query.Get("page")); err == nil && parsed > 1 {
+		page = parsed
+	}
+	return limit, (page - 1) * limit
+}
+
+// Requested reports whether r asks for a page at all, for endpoints that
+// return their whole list unless told otherwise
+func Requested(r *http.Request) bool {
+	query := r.URL.Query()
+	return query.Has("limit") || query.Has("page") || query.Has("offset")
+}
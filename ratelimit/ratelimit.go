@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepEvery controls how many Allow calls pass between removals of idle buckets
+const sweepEvery = 1024
+
+// Limiter is a token-bucket rate limiter keyed by an arbitrary string such as a
+// client IP or user ID. Each key may burst up to the limit and refills evenly
+// over the period.
+type Limiter struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	capacity float64
+	perToken time.Duration
+	calls    int
+	now      func() time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New creates a Limiter allowing limit events per period for each key
+func New(limit int, period time.Duration) *Limiter {
+	if limit < 1 {
+		limit = 1
+	}
+	return &Limiter{
+		buckets:  make(map[string]*bucket),
+		capacity: float64(limit),
+		perToken: period / time.Duration(limit),
+		now:      time.Now,
+	}
+}
+
+// Allow consumes a token for key. When the bucket is empty it returns false and
+// how long the caller should wait before the next token becomes available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.calls++
+	if l.calls%sweepEvery == 0 {
+		l.sweep(now)
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[key] = b
+	} else {
+		b.tokens = math.Min(l.capacity, b.tokens+float64(now.Sub(b.last))/float64(l.perToken))
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) * float64(l.perToken))
+	return false, wait
+}
+
+// Reset forgets all state for key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.buckets, key)
+}
+
+// SetClock replaces the time source, allowing tests to simulate elapsed time
+func (l *Limiter) SetClock(now func() time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.now = now
+}
+
+// sweep drops buckets that have been idle long enough to be full again
+func (l *Limiter) sweep(now time.Time) {
+	fullAfter := time.Duration(l.capacity) * l.perToken
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= fullAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -29,7 +29,8 @@ type PostRepository interface {
 	GetFilteredPosts(filter string) ([]database.Post, error)
 	GetPostsByCategory(categoryName string) ([]database.Post, error)
 	GetPostsByUser(userID int) ([]database.Post, error)
-	GetLikedPostsByUser(userID int) ([]database.Post, error)
+	GetLikedPostsByUser(userID, limit, offset int) ([]database.Post, error)
+	GetCommentedPostsByUser(userID, limit, offset int) ([]database.Post, error)
 
 	// Post management
 	CreatePost(userID int, title, content string, categories []string) (int, error)
@@ -57,3 +58,11 @@ type MessageRepository interface {
 	MarkMessagesAsRead(conversationID, userID int) error
 	GetUnreadMessageCount(conversationID, userID int) (int, error)
 }
+
+// NotificationRepository defines the interface for notification data operations
+type NotificationRepository interface {
+	Create(userID int, notificationType string, postID, actorID int) (*database.Notification, error)
+	List(userID, limit, offset int) ([]database.Notification, error)
+	MarkRead(userID, notificationID int) error
+	UnreadCount(userID int) (int, error)
+}
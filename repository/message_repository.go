@@ -20,7 +20,7 @@ func NewMessageRepository(db *sql.DB) MessageRepository {
 // CreateConversation creates a new conversation with participants
 func (r *MessageRepositoryImpl) CreateConversation(participants []int) (int, error) {
 	log.Printf("[DEBUG] MessageRepository: Creating conversation with %d participants", len(participants))
-	return database.CreateConversation(participants)
+	return database.CreateConversation(r.db, participants)
 }
 
 // GetUserConversations retrieves all conversations for a user
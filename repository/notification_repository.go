@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+
+	"connecthub/database"
+)
+
+// NotificationRepositoryImpl implements the NotificationRepository interface
+type NotificationRepositoryImpl struct {
+	db *sql.DB
+}
+
+// NewNotificationRepository creates a new NotificationRepository instance
+func NewNotificationRepository(db *sql.DB) NotificationRepository {
+	return &NotificationRepositoryImpl{db: db}
+}
+
+// Create records a notification for a user
+func (r *NotificationRepositoryImpl) Create(userID int, notificationType string, postID, actorID int) (*database.Notification, error) {
+	log.Printf("[DEBUG] NotificationRepository: Creating %s notification for user %d", notificationType, userID)
+	return database.CreateNotification(r.db, userID, notificationType, postID, actorID)
+}
+
+// List retrieves a page of a user's notifications, newest activity first
+func (r *NotificationRepositoryImpl) List(userID, limit, offset int) ([]database.Notification, error) {
+	log.Printf("[DEBUG] NotificationRepository: Listing notifications for user %d (limit: %d, offset: %d)", userID, limit, offset)
+	return database.GetNotifications(r.db, userID, limit, offset)
+}
+
+// MarkRead marks one of a user's notifications as read
+func (r *NotificationRepositoryImpl) MarkRead(userID, notificationID int) error {
+	log.Printf("[DEBUG] NotificationRepository: Marking notification %d read for user %d", notificationID, userID)
+	return database.MarkNotificationRead(r.db, userID, notificationID)
+}
+
+// UnreadCount counts a user's unread notifications
+func (r *NotificationRepositoryImpl) UnreadCount(userID int) (int, error) {
+	log.Printf("[DEBUG] NotificationRepository: Counting unread notifications for user %d", userID)
+	return database.GetUnreadNotificationCount(r.db, userID)
+}
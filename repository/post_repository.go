@@ -47,10 +47,16 @@ func (r *PostRepositoryImpl) GetPostsByUser(userID int) ([]database.Post, error)
 	return database.GetPostsByUser(r.db, userID)
 }
 
-// GetLikedPostsByUser retrieves posts liked by a specific user
-func (r *PostRepositoryImpl) GetLikedPostsByUser(userID int) ([]database.Post, error) {
+// GetLikedPostsByUser retrieves a page of posts liked by a specific user
+func (r *PostRepositoryImpl) GetLikedPostsByUser(userID, limit, offset int) ([]database.Post, error) {
 	log.Printf("[DEBUG] PostRepository: Getting liked posts by user ID: %d", userID)
-	return database.GetLikedPostsByUser(r.db, userID)
+	return database.GetLikedPostsByUser(r.db, userID, limit, offset)
+}
+
+// GetCommentedPostsByUser retrieves a page of posts a specific user has commented on
+func (r *PostRepositoryImpl) GetCommentedPostsByUser(userID, limit, offset int) ([]database.Post, error) {
+	log.Printf("[DEBUG] PostRepository: Getting commented posts by user ID: %d", userID)
+	return database.GetUserCommentedPosts(r.db, userID, "newest", limit, offset)
 }
 
 // CreatePost creates a new post with categories
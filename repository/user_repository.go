@@ -35,15 +35,16 @@ func (r *UserRepositoryImpl) GetUserBySession(sessionToken string) (*database.Us
 	log.Printf("[DEBUG] UserRepository: Getting user by session token")
 
 	var user database.User
+	var createdAt sql.NullTime
 	query := `
-		SELECT userid, username, Email, F_name, L_name, date_of_birth, Avatar 
+		SELECT userid, username, Email, F_name, L_name, date_of_birth, Avatar, created_at 
 		FROM user 
 		WHERE current_session = ?
 	`
 
 	err := r.db.QueryRow(query, sessionToken).Scan(
 		&user.ID, &user.Username, &user.Email, &user.FirstName,
-		&user.LastName, &user.Password, &user.Avatar,
+		&user.LastName, &user.Password, &user.Avatar, &createdAt,
 	)
 
 	if err != nil {
@@ -55,6 +56,10 @@ func (r *UserRepositoryImpl) GetUserBySession(sessionToken string) (*database.Us
 		return nil, err
 	}
 
+	if createdAt.Valid {
+		user.CreatedAt = &createdAt.Time
+	}
+
 	log.Printf("[INFO] UserRepository: User found for session: %s (ID: %d)", user.Username, user.ID)
 	return &user, nil
 }
@@ -111,31 +116,11 @@ func (r *UserRepositoryImpl) UserExists(username, email string) (bool, error) {
 // EmailExists checks if a user with the given email already exists
 func (r *UserRepositoryImpl) EmailExists(email string) (bool, error) {
 	log.Printf("[DEBUG] UserRepository: Checking if email exists: %s", email)
-
-	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM user WHERE Email = ?", email).Scan(&count)
-	if err != nil {
-		log.Printf("[ERROR] UserRepository: Database error during email existence check: %v", err)
-		return false, err
-	}
-
-	exists := count > 0
-	log.Printf("[DEBUG] UserRepository: Email %s exists: %t", email, exists)
-	return exists, nil
+	return database.EmailExists(r.db, email)
 }
 
 // UsernameExists checks if a user with the given username already exists
 func (r *UserRepositoryImpl) UsernameExists(username string) (bool, error) {
 	log.Printf("[DEBUG] UserRepository: Checking if username exists: %s", username)
-
-	var count int
-	err := r.db.QueryRow("SELECT COUNT(*) FROM user WHERE username = ?", username).Scan(&count)
-	if err != nil {
-		log.Printf("[ERROR] UserRepository: Database error during username existence check: %v", err)
-		return false, err
-	}
-
-	exists := count > 0
-	log.Printf("[DEBUG] UserRepository: Username %s exists: %t", username, exists)
-	return exists, nil
+	return database.UsernameExists(r.db, username)
 }
@@ -0,0 +1,148 @@
+package sanitize
+
+import (
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Policy controls how markup in user content is neutralized
+type Policy int
+
+const (
+	// PolicyEscape escapes all markup so it is rendered as literal text
+	PolicyEscape Policy = iota
+	// PolicyStrip keeps a small set of formatting tags and removes everything else
+	PolicyStrip
+)
+
+// String returns the configuration name of the policy
+func (p Policy) String() string {
+	switch p {
+	case PolicyStrip:
+		return "strip"
+	default:
+		return "escape"
+	}
+}
+
+// ParsePolicy converts a configuration value into a Policy, defaulting to escape
+func ParsePolicy(name string) Policy {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "strip":
+		return PolicyStrip
+	default:
+		return PolicyEscape
+	}
+}
+
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = PolicyEscape
+)
+
+// SetPolicy changes the policy used by Clean
+func SetPolicy(p Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	log.Printf("[INFO] Sanitize: Using %s policy", p)
+	currentPolicy = p
+}
+
+// CurrentPolicy returns the policy used by Clean
+func CurrentPolicy() Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+// Clean neutralizes markup in user content according to the configured policy
+func Clean(content string) string {
+	return CleanWithPolicy(content, CurrentPolicy())
+}
+
+// CleanWithPolicy neutralizes markup in user content according to the given policy
+func CleanWithPolicy(content string, p Policy) string {
+	if p == PolicyStrip {
+		return strip(content)
+	}
+	return html.EscapeString(content)
+}
+
+var (
+	// Elements whose contents must be dropped along with the tags
+	dangerousBlockRe = regexp.MustCompile(`(?is)<(script|style|iframe|object|embed)\b[^>]*>.*?</(script|style|iframe|object|embed)\s*>`)
+	tagRe            = regexp.MustCompile(`(?s)<(/?)([a-zA-Z][a-zA-Z0-9]*)\b([^>]*)>`)
+	hrefRe           = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+	// Control characters and whitespace browsers ignore inside URL schemes
+	schemeNoiseRe = regexp.MustCompile(`[\x00-\x20]+`)
+)
+
+// allowedTags is the formatting subset kept by PolicyStrip; attributes are always dropped except a safe href on links
+var allowedTags = map[string]bool{
+	"a": true, "b": true, "blockquote": true, "br": true, "code": true, "em": true,
+	"i": true, "li": true, "ol": true, "p": true, "pre": true, "strong": true, "ul": true,
+}
+
+func strip(content string) string {
+	content = dangerousBlockRe.ReplaceAllString(content, "")
+
+	var b strings.Builder
+	last := 0
+	for _, loc := range tagRe.FindAllStringSubmatchIndex(content, -1) {
+		b.WriteString(escapeText(content[last:loc[0]]))
+		last = loc[1]
+
+		closing := content[loc[2]:loc[3]] == "/"
+		name := strings.ToLower(content[loc[4]:loc[5]])
+		if !allowedTags[name] {
+			continue
+		}
+
+		if closing {
+			b.WriteString("</" + name + ">")
+			continue
+		}
+
+		if name == "a" {
+			if href, ok := safeHref(content[loc[6]:loc[7]]); ok {
+				b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener">`)
+			} else {
+				b.WriteString("<a>")
+			}
+			continue
+		}
+		b.WriteString("<" + name + ">")
+	}
+	b.WriteString(escapeText(content[last:]))
+
+	return b.String()
+}
+
+// escapeText escapes stray angle brackets left outside recognized tags
+func escapeText(text string) string {
+	return strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// safeHref extracts the href attribute and accepts only http, https, mailto and relative URLs
+func safeHref(attrs string) (string, bool) {
+	m := hrefRe.FindStringSubmatch(attrs)
+	if m == nil {
+		return "", false
+	}
+	href := m[1] + m[2] + m[3]
+
+	normalized := strings.ToLower(schemeNoiseRe.ReplaceAllString(html.UnescapeString(href), ""))
+	if i := strings.Index(normalized, ":"); i >= 0 {
+		// A colon before any path separator means an explicit scheme
+		if j := strings.IndexAny(normalized, "/?#"); j == -1 || i < j {
+			scheme := normalized[:i]
+			if scheme != "http" && scheme != "https" && scheme != "mailto" {
+				return "", false
+			}
+		}
+	}
+	return href, true
+}
@@ -0,0 +1,126 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"connecthub/database"
+	"connecthub/uploads"
+)
+
+const (
+	maxAttachmentSize  = 10 << 20 // 10 MB
+	attachmentCategory = "attachments"
+)
+
+// attachmentExtensions maps the content types accepted in chat to file extensions
+var attachmentExtensions = map[string]string{
+	"image/png":       ".png",
+	"image/jpeg":      ".jpg",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// AttachmentResponse is returned after a successful attachment upload. The
+// attachment's URL is what the client sends back with the message.
+type AttachmentResponse struct {
+	Success    bool                 `json:"success"`
+	Attachment *database.Attachment `json:"attachment"`
+}
+
+// UploadMessageAttachmentAPI handles POST /api/messages/upload
+func UploadMessageAttachmentAPI(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		log.Printf("[WARN] UploadMessageAttachmentAPI: No session cookie from %s: %v", clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] UploadMessageAttachmentAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] UploadMessageAttachmentAPI: Invalid session %s from %s: %v", maskSessionToken(sessionCookie.Value), clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+1<<20)
+	if !parseMultipartBody(w, r, maxAttachmentSize, "Upload must be a multipart form no larger than 10 MB") {
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "MISSING_FILE", "Missing file")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAttachmentSize {
+		log.Printf("[WARN] UploadMessageAttachmentAPI: Attachment from user %d too large: %d bytes", userID, header.Size)
+		WriteAPIError(w, http.StatusBadRequest, "FILE_TOO_LARGE", "Attachments must be 10 MB or smaller")
+		return
+	}
+
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		log.Printf("[WARN] UploadMessageAttachmentAPI: Failed to read attachment from user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_FILE_TYPE", "Attachments must be a PNG, JPEG, GIF or WebP image, or a PDF")
+		return
+	}
+	mime := http.DetectContentType(sniff[:n])
+	ext, ok := attachmentExtensions[mime]
+	if !ok {
+		log.Printf("[WARN] UploadMessageAttachmentAPI: Rejected %s attachment from user %d", mime, userID)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_FILE_TYPE", "Attachments must be a PNG, JPEG, GIF or WebP image, or a PDF")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("[ERROR] UploadMessageAttachmentAPI: Failed to rewind upload: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "UPLOAD_FAILED", "Failed to store attachment")
+		return
+	}
+
+	// Keep the sender's name for the file but trust only the sniffed extension
+	name := strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename)) + ext
+	url, err := uploads.Save(attachmentCategory, name, file)
+	if err != nil {
+		log.Printf("[ERROR] UploadMessageAttachmentAPI: Failed to store attachment for user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "UPLOAD_FAILED", "Failed to store attachment")
+		return
+	}
+
+	attachment, err := database.CreateAttachment(db, userID, url, mime, header.Size)
+	if err != nil {
+		uploads.Remove(url)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to store attachment")
+		return
+	}
+
+	log.Printf("[INFO] UploadMessageAttachmentAPI: User %d uploaded attachment %s", userID, attachment.URL)
+	json.NewEncoder(w).Encode(AttachmentResponse{Success: true, Attachment: attachment})
+}
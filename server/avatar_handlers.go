@@ -0,0 +1,137 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"connecthub/database"
+	"connecthub/uploads"
+)
+
+const (
+	maxAvatarSize   = 2 << 20 // 2 MB
+	avatarCategory  = "avatars"
+	avatarURLPrefix = uploads.URLPrefix + avatarCategory + "/"
+)
+
+// avatarExtensions maps the accepted image content types to file extensions
+var avatarExtensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// AvatarResponse is returned after a successful avatar upload
+type AvatarResponse struct {
+	Success bool   `json:"success"`
+	Avatar  string `json:"avatar"`
+}
+
+// UploadAvatarAPI handles POST /api/user/avatar
+func UploadAvatarAPI(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		log.Printf("[WARN] UploadAvatarAPI: No session cookie from %s: %v", clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] UploadAvatarAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] UploadAvatarAPI: Invalid session %s from %s: %v", maskSessionToken(sessionCookie.Value), clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	// Leave headroom for the multipart envelope around the image itself
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarSize+1<<20)
+	if !parseMultipartBody(w, r, maxAvatarSize, "Upload must be a multipart form no larger than 2 MB") {
+		return
+	}
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		WriteAPIError(w, http.StatusBadRequest, "MISSING_FILE", "Missing avatar file")
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAvatarSize {
+		log.Printf("[WARN] UploadAvatarAPI: Avatar from user %d too large: %d bytes", userID, header.Size)
+		WriteAPIError(w, http.StatusBadRequest, "FILE_TOO_LARGE", "Avatar must be 2 MB or smaller")
+		return
+	}
+
+	// Trust the file contents rather than the client-supplied content type
+	sniff := make([]byte, 512)
+	n, err := io.ReadFull(file, sniff)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		log.Printf("[WARN] UploadAvatarAPI: Failed to read avatar from user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_FILE_TYPE", "Avatar must be a PNG, JPEG, GIF or WebP image")
+		return
+	}
+	ext, ok := avatarExtensions[http.DetectContentType(sniff[:n])]
+	if !ok {
+		log.Printf("[WARN] UploadAvatarAPI: Rejected non-image avatar from user %d", userID)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_FILE_TYPE", "Avatar must be a PNG, JPEG, GIF or WebP image")
+		return
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		log.Printf("[ERROR] UploadAvatarAPI: Failed to rewind upload: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "UPLOAD_FAILED", "Failed to store avatar")
+		return
+	}
+
+	avatarURL, err := uploads.Save(avatarCategory, fmt.Sprintf("%d%s", userID, ext), file)
+	if err != nil {
+		log.Printf("[ERROR] UploadAvatarAPI: Failed to store avatar for user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "UPLOAD_FAILED", "Failed to store avatar")
+		return
+	}
+
+	previous, err := database.UpdateUserAvatar(db, userID, avatarURL)
+	if err != nil {
+		uploads.Remove(avatarURL)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update avatar")
+		return
+	}
+
+	removeUploadedAvatar(previous)
+
+	log.Printf("[INFO] UploadAvatarAPI: User %d uploaded new avatar %s", userID, avatarURL)
+	json.NewEncoder(w).Encode(AvatarResponse{Success: true, Avatar: avatarURL})
+}
+
+// removeUploadedAvatar deletes a previously uploaded avatar; built-in defaults are left alone
+func removeUploadedAvatar(avatarURL string) {
+	if !strings.HasPrefix(avatarURL, avatarURLPrefix) {
+		return
+	}
+
+	if err := uploads.Remove(avatarURL); err != nil {
+		log.Printf("[WARN] Failed to remove old avatar %s: %v", avatarURL, err)
+	}
+}
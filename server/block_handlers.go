@@ -0,0 +1,79 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"connecthub/database"
+
+	"github.com/gorilla/mux"
+)
+
+// BlockUserAPI handles POST (block) and DELETE (unblock) /api/users/{id}/block.
+// Blocked users cannot start or continue a direct conversation with the
+// blocker, and each drops out of the other's user search.
+func BlockUserAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || targetID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid user ID")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] BlockUserAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] BlockUserAPI: Invalid session %s: %v", maskSessionToken(sessionCookie.Value), err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	if _, err := database.GetUserByID(db, targetID); err == sql.ErrNoRows {
+		WriteAPIError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	} else if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch user")
+		return
+	}
+
+	blocked := r.Method == "POST"
+	if blocked {
+		err = database.BlockUser(db, userID, targetID)
+	} else {
+		err = database.UnblockUser(db, userID, targetID)
+	}
+	if errors.Is(err, database.ErrSelfBlock) {
+		WriteAPIError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+		return
+	}
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update block")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "user_id": targetID, "blocked": blocked})
+}
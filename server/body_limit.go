@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+)
+
+// BodyLimitMiddleware caps how many bytes a handler may read from a request
+// body. Multipart uploads get maxUpload and everything else maxBody. A request
+// that declares a larger Content-Length is refused with 413 before any of it is
+// read; one that streams past the limit fails its read, which handlers report
+// through decodeJSONBody or parseMultipartBody.
+func BodyLimitMiddleware(maxBody, maxUpload int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			limit := maxBody
+			if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+				limit = maxUpload
+			}
+
+			if r.ContentLength > limit {
+				log.Printf("[WARN] BodyLimit: Rejected %s %s from %s, body of %d bytes exceeds %d",
+					r.Method, r.URL.Path, getClientIP(r), r.ContentLength, limit)
+				writeBodyTooLarge(w)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isBodyTooLarge reports whether err came from reading past the body limit
+func isBodyTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// writeBodyTooLarge sends the 413 response for an oversized request body
+func writeBodyTooLarge(w http.ResponseWriter) {
+	WriteAPIError(w, http.StatusRequestEntityTooLarge, "PAYLOAD_TOO_LARGE", "Request body too large")
+}
+
+// decodeJSONBody decodes the JSON request body into v. If that fails it writes
+// the error response, 413 for a body over the size limit and 400 for anything
+// else, and returns false.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	if isBodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return false
+	}
+	log.Printf("[WARN] %s %s: Invalid JSON from %s: %v", r.Method, r.URL.Path, getClientIP(r), err)
+	WriteAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+	return false
+}
+
+// parseMultipartBody parses a multipart upload, keeping up to maxMemory bytes
+// in memory. If that fails it writes the error response, 413 for a body over
+// the size limit and 400 with invalidMessage for anything else, and returns false.
+func parseMultipartBody(w http.ResponseWriter, r *http.Request, maxMemory int64, invalidMessage string) bool {
+	err := r.ParseMultipartForm(maxMemory)
+	if err == nil {
+		return true
+	}
+	if isBodyTooLarge(err) {
+		writeBodyTooLarge(w)
+		return false
+	}
+	log.Printf("[WARN] %s %s: Failed to parse upload from %s: %v", r.Method, r.URL.Path, getClientIP(r), err)
+	WriteAPIError(w, http.StatusBadRequest, "INVALID_UPLOAD", invalidMessage)
+	return false
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"log"
+	"net/http"
+
+	"connecthub/origin"
+)
+
+// corsMaxAge is how long, in seconds, browsers may cache a successful preflight
+const corsMaxAge = "600"
+
+// CORSMiddleware rejects requests from origins the policy does not allow and
+// adds the CORS headers browsers need for the ones it does
+func CORSMiddleware(policy *origin.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestOrigin := r.Header.Get("Origin")
+			if requestOrigin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+			if !policy.Allows(r) {
+				log.Printf("[WARN] CORS: Rejected %s %s from origin %s (%s)", r.Method, r.URL.Path, requestOrigin, getClientIP(r))
+				WriteAPIError(w, http.StatusForbidden, "ORIGIN_NOT_ALLOWED", "Origin not allowed")
+				return
+			}
+
+			// Origins let in only by the wildcard may read responses but not
+			// send the session cookie with their requests
+			if policy.Trusts(requestOrigin, r.Host) {
+				w.Header().Set("Access-Control-Allow-Origin", requestOrigin)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin.Wildcard)
+			}
+
+			if preflight {
+				w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+				if headers := r.Header.Get("Access-Control-Request-Headers"); headers != "" {
+					w.Header().Set("Access-Control-Allow-Headers", headers)
+				}
+				w.Header().Set("Access-Control-Max-Age", corsMaxAge)
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -117,7 +117,7 @@ func ErrHandler(w http.ResponseWriter, r *http.Request, errData *ErrorPageData)
 	)
 
 	// Check if this is an API request
-	if strings.HasPrefix(r.URL.Path, "/api/") {
+	if wantsJSON(r) {
 		// For API requests, return JSON error response
 		WriteAPIError(w, getStatusCodeFromErrorCode(errData.Code), errData.Code, errData.ErrorMsg)
 		return
@@ -160,7 +160,12 @@ func AutherrHandler(w http.ResponseWriter, r *http.Request, errData *ErrorPageDa
 		r.UserAgent(),
 	)
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	// API clients get the status they can act on; browsers go to the login page
+	if wantsJSON(r) {
+		WriteAPIError(w, getStatusCodeFromErrorCode(errData.Code), errData.Code, errData.ErrorMsg)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
 }
 
 func NewErrorData(code, message string) *ErrorPageData {
@@ -184,7 +189,7 @@ func getStatusCodeFromErrorCode(code string) int {
 	switch code {
 	case "400", "INVALID_JSON", "INVALID_PARAMETER", "MISSING_PARAMETER", "VALIDATION_ERROR", "MISSING_FIELD", "INVALID_EMAIL", "INVALID_USERNAME":
 		return http.StatusBadRequest
-	case "401", "INVALID_CREDENTIALS", "INVALID_SESSION", "USER_NOT_FOUND", "INCORRECT_PASSWORD":
+	case "401", "UNAUTHORIZED", "INVALID_CREDENTIALS", "INVALID_SESSION", "USER_NOT_FOUND", "INCORRECT_PASSWORD":
 		return http.StatusUnauthorized
 	case "403", "FORBIDDEN":
 		return http.StatusForbidden
@@ -192,7 +197,7 @@ func getStatusCodeFromErrorCode(code string) int {
 		return http.StatusNotFound
 	case "405", "METHOD_NOT_ALLOWED":
 		return http.StatusMethodNotAllowed
-	case "409", "DUPLICATE_ENTRY", "EMAIL_EXISTS", "USERNAME_EXISTS":
+	case "409", "DUPLICATE_ENTRY", "EMAIL_EXISTS", "USERNAME_EXISTS", "CATEGORY_EXISTS":
 		return http.StatusConflict
 	case "429", "RATE_LIMITED":
 		return http.StatusTooManyRequests
@@ -3,12 +3,20 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
 
 	"connecthub/database"
+	"connecthub/paging"
+	"connecthub/server/services"
 	"connecthub/websocket"
 )
 
@@ -24,6 +32,12 @@ func SetWebSocketManager(manager *websocket.Manager) {
 type SendMessageRequest struct {
 	ConversationID int    `json:"conversation_id"`
 	Content        string `json:"content"`
+	// ClientMsgID is an optional client-generated UUID; resending the same one returns the original message
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Attachments reference files previously uploaded through /api/messages/upload by URL
+	Attachments []database.Attachment `json:"attachments,omitempty"`
+	// ReplyToID optionally quotes an earlier message in the same conversation
+	ReplyToID int `json:"reply_to_message_id,omitempty"`
 }
 
 type SendMessageResponse struct {
@@ -37,9 +51,56 @@ type CreateConversationRequest struct {
 }
 
 type CreateConversationResponse struct {
-	Success        bool   `json:"success"`
-	ConversationID int    `json:"conversation_id,omitempty"`
-	Error          string `json:"error,omitempty"`
+	Success        bool                `json:"success"`
+	ConversationID int                 `json:"conversation_id,omitempty"`
+	Created        bool                `json:"created"`
+	Conversation   *ConversationDetail `json:"conversation,omitempty"`
+	Error          string              `json:"error,omitempty"`
+}
+
+// ConversationParticipant is the public profile of a conversation member
+type ConversationParticipant struct {
+	ID        int        `json:"id"`
+	Username  string     `json:"username"`
+	FirstName string     `json:"first_name"`
+	LastName  string     `json:"last_name"`
+	Avatar    string     `json:"avatar,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+// ConversationDetail carries what the client needs to render a chat header
+type ConversationDetail struct {
+	ID           int                       `json:"id"`
+	CreatedAt    time.Time                 `json:"created_at"`
+	IsGroup      bool                      `json:"is_group"`
+	Participants []ConversationParticipant `json:"participants"`
+}
+
+// loadConversationDetail builds the ConversationDetail for an existing conversation
+func loadConversationDetail(db *sql.DB, conversationID int) (*ConversationDetail, error) {
+	detail := &ConversationDetail{ID: conversationID}
+	if err := db.QueryRow("SELECT created_at FROM conversation WHERE conversation_id = ?", conversationID).Scan(&detail.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	users, err := database.GetConversationParticipantsDetails(db, conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	detail.Participants = make([]ConversationParticipant, 0, len(users))
+	for _, user := range users {
+		detail.Participants = append(detail.Participants, ConversationParticipant{
+			ID:        user.ID,
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Avatar:    user.Avatar.String,
+			LastSeen:  user.LastSeen,
+		})
+	}
+	detail.IsGroup = len(detail.Participants) > 2
+	return detail, nil
 }
 
 // SendMessageAPI handles POST /api/messages
@@ -54,19 +115,29 @@ func SendMessageAPI(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] SendMessageAPI: Processing POST request from %s", clientIP)
 
 	var req SendMessageRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[ERROR] SendMessageAPI: Failed to decode request: %v", err)
-		WriteAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
-	if req.ConversationID == 0 || strings.TrimSpace(req.Content) == "" {
+	if req.ConversationID == 0 || (strings.TrimSpace(req.Content) == "" && len(req.Attachments) == 0) {
 		log.Printf("[WARN] SendMessageAPI: Missing conversation_id or content: conversation_id=%v, content='%v'", req.ConversationID, req.Content)
 		WriteAPIError(w, http.StatusBadRequest, "MISSING_PARAMETER", "Missing conversation_id or content")
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	if utf8.RuneCountInString(req.Content) > maxMessageLength {
+		log.Printf("[WARN] SendMessageAPI: Message of %d characters exceeds limit of %d", utf8.RuneCountInString(req.Content), maxMessageLength)
+		WriteAPIError(w, http.StatusBadRequest, "MESSAGE_TOO_LONG", fmt.Sprintf("Message is too long. Please keep it under %d characters.", maxMessageLength))
+		return
+	}
+
+	if req.ClientMsgID != "" && !database.ValidClientMsgID(req.ClientMsgID) {
+		log.Printf("[WARN] SendMessageAPI: Malformed client_msg_id from %s", clientIP)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_CLIENT_MSG_ID", "client_msg_id must be a UUID")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] SendMessageAPI: Database connection failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -95,7 +166,40 @@ func SendMessageAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Insert the message
-	msg, err := database.AddMessageToConversation(db, req.ConversationID, senderID, req.Content)
+	msg, err := database.AddMessageWithClientID(db, req.ConversationID, senderID, req.Content, req.ClientMsgID, req.ReplyToID, req.Attachments...)
+	if errors.Is(err, database.ErrConversationNotFound) {
+		WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		return
+	}
+	if errors.Is(err, database.ErrNotParticipant) {
+		log.Printf("[WARN] SendMessageAPI: Sender %d is not a participant in conversation %d", senderID, req.ConversationID)
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant in this conversation")
+		return
+	}
+	if errors.Is(err, database.ErrClientMsgIDConflict) {
+		log.Printf("[WARN] SendMessageAPI: client_msg_id reused by sender %d outside conversation %d", senderID, req.ConversationID)
+		WriteAPIError(w, http.StatusConflict, "CLIENT_MSG_ID_CONFLICT", "client_msg_id was already used in another conversation")
+		return
+	}
+	if errors.Is(err, database.ErrTooLong) {
+		WriteAPIError(w, http.StatusBadRequest, "MESSAGE_TOO_LONG", err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrInvalidReply) {
+		log.Printf("[WARN] SendMessageAPI: Sender %d replied to message %d outside conversation %d", senderID, req.ReplyToID, req.ConversationID)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_REPLY", err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrInvalidAttachment) || errors.Is(err, database.ErrTooManyAttachments) {
+		log.Printf("[WARN] SendMessageAPI: Rejected attachments from sender %d: %v", senderID, err)
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_ATTACHMENT", err.Error())
+		return
+	}
+	if errors.Is(err, database.ErrDMsNotAllowed) {
+		log.Printf("[WARN] SendMessageAPI: Sender %d may not message conversation %d", senderID, req.ConversationID)
+		WriteAPIError(w, http.StatusForbidden, "DMS_NOT_ALLOWED", "This user is not accepting messages from you.")
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] SendMessageAPI: Failed to insert message for conversation ID %d: %v", req.ConversationID, err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -112,11 +216,16 @@ func SendMessageAPI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// GetMessages handles GET /api/messages
+// Page size bounds for a conversation's message history
+const (
+	messagesPageSize    = 50
+	maxMessagesPageSize = 200
+)
+
+// GetMessages handles GET /api/messages. Messages come newest first unless
+// order=asc asks for chronological order.
 func GetMessages(w http.ResponseWriter, r *http.Request) {
 	conversationIDStr := r.URL.Query().Get("conversation_id")
-	limitStr := r.URL.Query().Get("limit")
-	offsetStr := r.URL.Query().Get("offset")
 
 	if conversationIDStr == "" {
 		log.Printf("[WARN] GetMessages: Missing conversation_id parameter")
@@ -131,21 +240,19 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	limit := 50 // Default limit - increased for better user experience
-	if limitStr != "" {
-		if parsedLimit, err := strconv.Atoi(limitStr); err == nil && parsedLimit > 0 {
-			limit = parsedLimit
-		}
-	}
+	limit, offset := paging.ParseWith(r, messagesPageSize, maxMessagesPageSize)
 
-	offset := 0 // Default offset
-	if offsetStr != "" {
-		if parsedOffset, err := strconv.Atoi(offsetStr); err == nil && parsedOffset >= 0 {
-			offset = parsedOffset
-		}
+	order := database.OrderNewestFirst
+	if o := r.URL.Query().Get("order"); o != "" {
+		order = database.MessageOrder(strings.ToLower(o))
+	}
+	if !database.ValidMessageOrder(order) {
+		log.Printf("[WARN] GetMessages: Invalid order: %s", order)
+		http.Error(w, "order must be \"asc\" or \"desc\"", http.StatusBadRequest)
+		return
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetMessages: Database connection failed: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -169,16 +276,17 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if user is participant in conversation
-	var participantCount int
-	err = db.QueryRow("SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ? AND user_id = ?", conversationID, userID).Scan(&participantCount)
-	if err != nil || participantCount == 0 {
+	messages, err := database.GetConversationMessagesFor(db, conversationID, userID, limit, offset, order)
+	if errors.Is(err, database.ErrConversationNotFound) {
+		log.Printf("[WARN] GetMessages: Conversation %d not found", conversationID)
+		http.Error(w, "Conversation not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, database.ErrNotParticipant) {
 		log.Printf("[WARN] GetMessages: User %d not authorized for conversation %d", userID, conversationID)
 		http.Error(w, "Forbidden", http.StatusForbidden)
 		return
 	}
-
-	messages, err := database.GetConversationMessages(db, conversationID, limit, offset)
 	if err != nil {
 		log.Printf("[ERROR] GetMessages: Failed to fetch messages: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -191,9 +299,11 @@ func GetMessages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(messages)
 }
 
-// GetConversations handles GET /api/conversations
+// GetConversations handles GET /api/conversations. Passing page, limit or
+// offset returns one page; unread_only=true keeps only conversations with
+// unread messages. Without them every conversation is returned.
 func GetConversations(w http.ResponseWriter, r *http.Request) {
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetConversations: Database connection failed: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -216,7 +326,15 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	conversations, err := database.GetUserConversations(db, userID)
+	query := r.URL.Query()
+	unreadOnly := query.Get("unread_only") == "true" || query.Get("unread_only") == "1"
+
+	limit, offset := 0, 0
+	if paging.Requested(r) {
+		limit, offset = paging.Parse(r)
+	}
+
+	conversations, err := database.GetUserConversationsPaginated(db, userID, limit, offset, unreadOnly)
 	if err != nil {
 		log.Printf("[ERROR] GetConversations: Failed to fetch conversations: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -229,6 +347,97 @@ func GetConversations(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(conversations)
 }
 
+// SearchConversationsAPI handles GET /api/conversations/search?q=, filtering the
+// chat sidebar to conversations whose participants or latest message match q
+func SearchConversationsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] SearchConversationsAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] SearchConversationsAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	conversations, err := database.SearchUserConversations(db, userID, r.URL.Query().Get("q"))
+	if err != nil {
+		log.Printf("[ERROR] SearchConversationsAPI: Search failed for user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to search conversations")
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversations)
+}
+
+// SharedConversationsAPI handles GET /api/conversations/shared?user_id=,
+// listing the conversations the current user has with another user for a
+// "previous chats" view on their profile
+func SharedConversationsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	otherUserID, err := strconv.Atoi(r.URL.Query().Get("user_id"))
+	if err != nil || otherUserID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid user ID")
+		return
+	}
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] SharedConversationsAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] SharedConversationsAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	conversations, err := database.GetSharedConversations(db, userID, otherUserID)
+	if err != nil {
+		log.Printf("[ERROR] SharedConversationsAPI: Failed to load conversations user %d shares with user %d: %v", userID, otherUserID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load conversations")
+		return
+	}
+
+	json.NewEncoder(w).Encode(conversations)
+}
+
 // MarkMessagesAsReadAPI handles POST /api/messages/read
 func MarkMessagesAsReadAPI(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
@@ -244,10 +453,7 @@ func MarkMessagesAsReadAPI(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		ConversationID int `json:"conversation_id"`
 	}
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[ERROR] MarkMessagesAsReadAPI: Failed to decode request: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Invalid request format"})
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
@@ -259,7 +465,7 @@ func MarkMessagesAsReadAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get database connection
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] MarkMessagesAsReadAPI: Database connection failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -318,6 +524,68 @@ func MarkMessagesAsReadAPI(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
 }
 
+// MarkAllReadAPI handles POST /api/messages/read-all
+func MarkAllReadAPI(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+	if r.Method != "POST" {
+		log.Printf("[WARN] MarkAllReadAPI: Method not allowed: %s from %s", r.Method, clientIP)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Method not allowed"})
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] MarkAllReadAPI: Database connection failed: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Internal server error"})
+		return
+	}
+	defer db.Close()
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		log.Printf("[WARN] MarkAllReadAPI: No session cookie found")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] MarkAllReadAPI: Invalid session: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Unauthorized"})
+		return
+	}
+
+	// Note which conversations had unread messages so only their senders are notified
+	conversationIDs, err := database.GetUnreadConversationIDs(db, userID)
+	if err != nil {
+		log.Printf("[WARN] MarkAllReadAPI: Failed to list unread conversations for user %d: %v", userID, err)
+	}
+
+	marked, err := database.MarkAllConversationsRead(db, userID)
+	if err != nil {
+		log.Printf("[ERROR] MarkAllReadAPI: Failed to mark conversations read for user %d: %v", userID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "Failed to mark messages as read"})
+		return
+	}
+
+	if globalWSManager != nil {
+		for _, conversationID := range conversationIDs {
+			globalWSManager.SendReadStatusUpdate(conversationID, userID)
+		}
+	}
+
+	log.Printf("[INFO] MarkAllReadAPI: Marked %d messages read in %d conversations for user %d", marked, len(conversationIDs), userID)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "marked": marked})
+}
+
 // CreateConversationAPI handles POST /api/conversations
 func CreateConversationAPI(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
@@ -331,10 +599,7 @@ func CreateConversationAPI(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] CreateConversationAPI: Processing POST request from %s", clientIP)
 
 	var req CreateConversationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[ERROR] CreateConversationAPI: Failed to decode request: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Invalid request format"})
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
@@ -345,57 +610,513 @@ func CreateConversationAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get current user from session
+	db, currentUserID, ok := openConversationSession(w, r, "CreateConversationAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	writeNewConversation(w, db, currentUserID, req.Participants, "CreateConversationAPI")
+}
+
+// CreateConversationByUsernamesRequest names the other participants by
+// username, e.g. from an @mention
+type CreateConversationByUsernamesRequest struct {
+	Usernames []string `json:"usernames"`
+}
+
+// CreateConversationByUsernamesAPI handles POST /api/conversations/by-username.
+// It is CreateConversationAPI for clients that know usernames rather than ids;
+// any unknown username fails the request with 404.
+func CreateConversationByUsernamesAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Method not allowed"})
+		return
+	}
+
+	var req CreateConversationByUsernamesRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if len(req.Usernames) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "At least one username required"})
+		return
+	}
+
+	db, currentUserID, ok := openConversationSession(w, r, "CreateConversationByUsernamesAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	participants, err := database.GetUserIDsByUsernames(db, req.Usernames)
+	if errors.Is(err, database.ErrUnknownUsername) {
+		log.Printf("[WARN] CreateConversationByUsernamesAPI: User %d named unknown users: %v", currentUserID, err)
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Failed to look up users"})
+		return
+	}
+
+	writeNewConversation(w, db, currentUserID, participants, "CreateConversationByUsernamesAPI")
+}
+
+// openConversationSession opens the database and resolves the caller's
+// session, writing the error response itself when either fails
+func openConversationSession(w http.ResponseWriter, r *http.Request, handler string) (*sql.DB, int, bool) {
 	seshCok, err := r.Cookie("session_token")
 	if err != nil {
-		log.Printf("[WARN] CreateConversationAPI: No session cookie found from %s: %v", clientIP, err)
+		log.Printf("[WARN] %s: No session cookie found from %s: %v", handler, getClientIP(r), err)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Unauthorized"})
-		return
+		return nil, 0, false
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
-		log.Printf("[ERROR] CreateConversationAPI: Database connection failed: %v", err)
+		log.Printf("[ERROR] %s: Database connection failed: %v", handler, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Database connection failed"})
-		return
+		return nil, 0, false
 	}
-	defer db.Close()
 
 	var currentUserID int
 	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&currentUserID)
 	if err != nil {
-		log.Printf("[WARN] CreateConversationAPI: Invalid session: %v", err)
+		log.Printf("[WARN] %s: Invalid session: %v", handler, err)
 		w.WriteHeader(http.StatusUnauthorized)
 		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Invalid session"})
-		return
+		db.Close()
+		return nil, 0, false
 	}
+	return db, currentUserID, true
+}
 
+// writeNewConversation creates (or finds) the conversation between
+// currentUserID and participants and writes its detail
+func writeNewConversation(w http.ResponseWriter, db *sql.DB, currentUserID int, participants []int, handler string) {
 	// Ensure current user is included in participants
 	userIncluded := false
-	for _, participantID := range req.Participants {
+	for _, participantID := range participants {
 		if participantID == currentUserID {
 			userIncluded = true
 			break
 		}
 	}
 	if !userIncluded {
-		req.Participants = append(req.Participants, currentUserID)
+		participants = append(participants, currentUserID)
 	}
 
-	convID, err := database.CreateConversation(req.Participants)
+	convID, created, err := database.FindOrCreateConversation(db, currentUserID, participants)
+	if errors.Is(err, database.ErrDMsNotAllowed) {
+		log.Printf("[WARN] %s: User %d refused: %v", handler, currentUserID, err)
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if errors.Is(err, database.ErrInvalidParticipants) || errors.Is(err, database.ErrSelfConversation) ||
+		errors.Is(err, database.ErrTooManyParticipants) || errors.Is(err, database.ErrUnknownParticipant) {
+		log.Printf("[WARN] %s: Invalid participants from user %d: %v", handler, currentUserID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: err.Error()})
+		return
+	}
 	if err != nil {
-		log.Printf("[ERROR] CreateConversationAPI: Failed to create conversation: %v", err)
+		log.Printf("[ERROR] %s: Failed to create conversation: %v", handler, err)
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Failed to create conversation"})
 		return
 	}
 
-	log.Printf("[INFO] CreateConversationAPI: Successfully created conversation ID %d with %d participants", convID, len(req.Participants))
+	// The same detail is returned whether the conversation is new or already
+	// existed; Created tells the client which
+	detail, err := loadConversationDetail(db, convID)
+	if err != nil {
+		log.Printf("[ERROR] %s: Failed to load conversation %d: %v", handler, convID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CreateConversationResponse{Success: false, Error: "Failed to load conversation"})
+		return
+	}
+
+	log.Printf("[INFO] %s: Returning conversation ID %d with %d participants (created: %t)", handler, convID, len(detail.Participants), created)
 
 	json.NewEncoder(w).Encode(CreateConversationResponse{
 		Success:        true,
 		ConversationID: convID,
+		Created:        created,
+		Conversation:   detail,
+	})
+}
+
+// TypingUser is a participant who is currently typing in a conversation
+type TypingUser struct {
+	UserID int    `json:"user_id"`
+	Name   string `json:"name"`
+}
+
+// GetTypingUsersAPI handles GET /api/conversations/{id}/typing, a polling
+// fallback for clients that cannot hold a WebSocket open
+func GetTypingUsersAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	conversationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || conversationID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid conversation ID")
+		return
+	}
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] GetTypingUsersAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] GetTypingUsersAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	isParticipant, err := database.IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		log.Printf("[ERROR] GetTypingUsersAPI: Failed to check participation for user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load conversation")
+		return
+	}
+	if !isParticipant {
+		log.Printf("[WARN] GetTypingUsersAPI: User %d not authorized for conversation %d", userID, conversationID)
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant in this conversation")
+		return
+	}
+
+	typing := []TypingUser{}
+	if globalWSManager != nil {
+		for _, typistID := range globalWSManager.TypingUsers(conversationID) {
+			if typistID == userID {
+				continue
+			}
+			name, err := database.GetDisplayName(db, typistID)
+			if err != nil {
+				log.Printf("[WARN] GetTypingUsersAPI: Failed to get name for user %d: %v", typistID, err)
+				name = "Someone"
+			}
+			typing = append(typing, TypingUser{UserID: typistID, Name: name})
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":         true,
+		"conversation_id": conversationID,
+		"typing":          typing,
 	})
 }
+
+// ExportConversationAPI handles GET /api/conversations/{id}/export?format=csv,
+// sending a participant the conversation's transcript as a download. The
+// format defaults to JSON.
+func ExportConversationAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	conversationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || conversationID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid conversation ID")
+		return
+	}
+
+	format := strings.ToLower(r.URL.Query().Get("format"))
+	if format == "" {
+		format = database.ExportFormatJSON
+	}
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] ExportConversationAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] ExportConversationAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	transcript, err := database.ExportConversation(db, conversationID, userID, format)
+	switch {
+	case errors.Is(err, database.ErrUnsupportedFormat):
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Format must be json or csv")
+		return
+	case errors.Is(err, database.ErrNotParticipant):
+		log.Printf("[WARN] ExportConversationAPI: User %d not authorized for conversation %d", userID, conversationID)
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant in this conversation")
+		return
+	case err != nil:
+		log.Printf("[ERROR] ExportConversationAPI: Export of conversation %d failed: %v", conversationID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to export conversation")
+		return
+	}
+
+	if format == database.ExportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="conversation-%d.%s"`, conversationID, format))
+	w.Write(transcript)
+}
+
+// conversationRequest resolves the conversation id in the path and the session
+// user for the conversation membership endpoints. On failure it has already
+// written the error response.
+func conversationRequest(w http.ResponseWriter, r *http.Request, handler string) (*sql.DB, int, int, bool) {
+	conversationID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || conversationID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid conversation ID")
+		return nil, 0, 0, false
+	}
+
+	seshCok, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return nil, 0, 0, false
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] %s: Database connection failed: %v", handler, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return nil, 0, 0, false
+	}
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", seshCok.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] %s: Invalid session: %v", handler, err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		db.Close()
+		return nil, 0, 0, false
+	}
+	return db, conversationID, userID, true
+}
+
+// LeaveConversationAPI handles POST /api/conversations/{id}/leave. The
+// remaining participants are told over the WebSocket.
+func LeaveConversationAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	db, conversationID, userID, ok := conversationRequest(w, r, "LeaveConversationAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	remaining, err := database.LeaveConversation(db, conversationID, userID)
+	switch {
+	case errors.Is(err, database.ErrConversationNotFound):
+		WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		return
+	case errors.Is(err, database.ErrNotParticipant):
+		log.Printf("[WARN] LeaveConversationAPI: User %d not in conversation %d", userID, conversationID)
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant in this conversation")
+		return
+	case err != nil:
+		log.Printf("[ERROR] LeaveConversationAPI: User %d failed to leave conversation %d: %v", userID, conversationID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to leave conversation")
+		return
+	}
+
+	if globalWSManager != nil {
+		globalWSManager.AnnounceConversationLeft(conversationID, userID, remaining)
+	}
+
+	log.Printf("[INFO] LeaveConversationAPI: User %d left conversation %d", userID, conversationID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// GetConversationAPI handles GET /api/conversations/{id}, returning a
+// conversation's details with how many of its participants are online
+func GetConversationAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	db, conversationID, userID, ok := conversationRequest(w, r, "GetConversationAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	isParticipant, err := database.IsUserInConversation(db, userID, conversationID)
+	if err != nil {
+		log.Printf("[ERROR] GetConversationAPI: Failed to check membership of user %d in conversation %d: %v", userID, conversationID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load conversation")
+		return
+	}
+	if !isParticipant {
+		// Not revealing whether someone else's conversation exists
+		WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		return
+	}
+
+	conversations, err := database.GetConversationsWithIDs(db, []int{conversationID})
+	if err != nil {
+		log.Printf("[ERROR] GetConversationAPI: Failed to load conversation %d: %v", conversationID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load conversation")
+		return
+	}
+	if len(conversations) == 0 {
+		WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		return
+	}
+
+	conversation := conversations[0]
+	if globalWSManager != nil {
+		conversation.OnlineCount = globalWSManager.GetConversationOnlineCount(conversationID)
+	}
+	json.NewEncoder(w).Encode(conversation)
+}
+
+// DeleteConversationAPI handles DELETE /api/conversations/{id}, removing the
+// conversation for every participant. Only a participant may delete it, and
+// the others are told over the WebSocket.
+func DeleteConversationAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	db, conversationID, userID, ok := conversationRequest(w, r, "DeleteConversationAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	messageService := services.NewMessageService(db)
+	if globalWSManager != nil {
+		messageService.SetNotifier(globalWSManager)
+	}
+
+	err := messageService.DeleteConversation(conversationID, userID)
+	if errors.Is(err, database.ErrNotParticipant) || errors.Is(err, database.ErrConversationNotFound) {
+		// Not revealing whether someone else's conversation exists
+		WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "Conversation not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] DeleteConversationAPI: Failed to delete conversation %d: %v", conversationID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete conversation")
+		return
+	}
+
+	log.Printf("[INFO] DeleteConversationAPI: User %d deleted conversation %d", userID, conversationID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// SaveDraftRequest is the body of PUT /api/conversations/{id}/draft
+type SaveDraftRequest struct {
+	Content string `json:"content"`
+}
+
+// ConversationDraftAPI handles /api/conversations/{id}/draft: GET returns the
+// caller's unsent draft, PUT replaces it and DELETE clears it. Sending a
+// message clears the draft as well.
+func ConversationDraftAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" && r.Method != "PUT" && r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	db, conversationID, userID, ok := conversationRequest(w, r, "ConversationDraftAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	switch r.Method {
+	case "GET":
+		draft, err := database.GetDraftMessage(db, conversationID, userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			WriteAPIError(w, http.StatusNotFound, "NOT_FOUND", "No draft for this conversation")
+			return
+		}
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load draft")
+			return
+		}
+		json.NewEncoder(w).Encode(draft)
+
+	case "PUT":
+		var req SaveDraftRequest
+		if !decodeJSONBody(w, r, &req) {
+			return
+		}
+
+		err := database.SaveDraftMessage(db, conversationID, userID, req.Content)
+		switch {
+		case errors.Is(err, database.ErrTooLong):
+			WriteAPIError(w, http.StatusBadRequest, "MESSAGE_TOO_LONG", err.Error())
+			return
+		case errors.Is(err, database.ErrNotParticipant):
+			WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You are not a participant in this conversation")
+			return
+		case err != nil:
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to save draft")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+
+	case "DELETE":
+		if err := database.DeleteDraftMessage(db, conversationID, userID); err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete draft")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"connecthub/database"
 )
 
 func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -17,7 +19,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		log.Printf("[DEBUG] Auth check for request: %s %s from %s", r.Method, requestPath, clientIP)
 
 		log.Printf("[DEBUG] Attempting to connect to SQLite database for auth check")
-		db, err := sql.Open("sqlite3", "./database/main.db")
+		db, err := sql.Open("sqlite3", database.Path())
 		if err != nil {
 			log.Printf("[ERROR] Database connection failed during auth check: %v", err)
 			errData := NewErrorData("500", "Internal Server Error")
@@ -30,7 +32,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		sessionCookie, err := r.Cookie("session_token")
 		if err != nil {
 			log.Printf("[WARN] No session cookie found for request to %s from %s: %v", requestPath, clientIP, err)
-			errData := NewErrorData("401", "Authentication Required")
+			errData := NewErrorData("UNAUTHORIZED", "Authentication Required")
 			log.Printf("[INFO] Redirecting to authentication due to missing session cookie for %s from %s", requestPath, clientIP)
 			AutherrHandler(w, r, errData)
 			return
@@ -50,7 +52,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 				HttpOnly: true,
 				SameSite: http.SameSiteStrictMode,
 			})
-			errData := NewErrorData("401", "Invalid Session")
+			errData := NewErrorData("INVALID_SESSION", "Invalid Session")
 			log.Printf("[INFO] Redirecting to authentication due to empty session token for %s from %s", requestPath, clientIP)
 			AutherrHandler(w, r, errData)
 			return
@@ -73,7 +75,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 					HttpOnly: true,
 					SameSite: http.SameSiteStrictMode,
 				})
-				errData := NewErrorData("401", "Invalid Session")
+				errData := NewErrorData("INVALID_SESSION", "Invalid Session")
 				log.Printf("[INFO] Redirecting to authentication due to invalid session token %s for %s from %s", maskedToken, requestPath, clientIP)
 				AutherrHandler(w, r, errData)
 				return
@@ -98,6 +100,57 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	})
 }
 
+// AdminMiddleware lets through only users listed in the admins setting. It runs
+// after AuthMiddleware, so a missing or invalid session is still a 401 (or a
+// redirect for pages) and only a valid session without the role gets a 403.
+func AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		db, err := sql.Open("sqlite3", database.Path())
+		if err != nil {
+			log.Printf("[ERROR] Database connection failed during admin check: %v", err)
+			ErrHandler(w, r, NewErrorData("500", "Internal Server Error"))
+			return
+		}
+		defer db.Close()
+
+		userID, admin, err := isAdmin(db, r)
+		if err != nil {
+			log.Printf("[ERROR] Failed to load user for admin check: %v", err)
+			ErrHandler(w, r, NewErrorData("500", "Internal Server Error"))
+			return
+		}
+
+		if !admin {
+			log.Printf("[WARN] User %d is not an admin, denying %s %s", userID, r.Method, r.URL.Path)
+			ErrHandler(w, r, NewErrorDataWithType("FORBIDDEN", ErrAccessDenied, "authentication"))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// isAdmin resolves the request's session to its user and reports whether that
+// user is an admin. A missing or unknown session is sql.ErrNoRows.
+func isAdmin(db *sql.DB, r *http.Request) (int, bool, error) {
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		return 0, false, sql.ErrNoRows
+	}
+
+	var userID int
+	if err := db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID); err != nil {
+		return 0, false, err
+	}
+	return userID, admins[userID], nil
+}
+
+// wantsJSON reports whether a request expects an API response rather than a
+// page: anything under /api/ or asking for JSON in its Accept header
+func wantsJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/api/") || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
 func LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		startTime := time.Now()
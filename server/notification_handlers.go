@@ -0,0 +1,56 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"connecthub/database"
+	"connecthub/paging"
+	"connecthub/repository"
+	"connecthub/server/services"
+)
+
+// NotificationsAPI handles GET /api/notifications?limit=20&page=1
+func NotificationsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	limit, offset := paging.Parse(r)
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] NotificationsAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] NotificationsAPI: Invalid session %s: %v", maskSessionToken(sessionCookie.Value), err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	notificationService := services.NewNotificationService(repository.NewNotificationRepository(db))
+	notifications, err := notificationService.GetNotifications(userID, limit, offset)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load notifications")
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "notifications": notifications})
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"connecthub/database"
 	"log"
 	"net/http"
@@ -43,7 +44,7 @@ func NewPostPage(w http.ResponseWriter, r *http.Request) {
 	maskedToken := maskSessionToken(seshCok.Value)
 
 	log.Printf("[DEBUG] Attempting to connect to SQLite database for /newpost with session %s", maskedToken)
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed for /newpost with session %s: %v", maskedToken, err)
 		errData := NewErrorData("500", "Internal Server Error")
@@ -73,12 +74,7 @@ func NewPostPage(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		log.Printf("[INFO] Processing new post submission from user %s (ID: %d)", userName, userID)
 
-		err := r.ParseMultipartForm(20 << 20)
-		if err != nil {
-			log.Printf("[ERROR] Failed to parse form data: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Failed to parse form data"})
+		if !parseMultipartBody(w, r, 20<<20, "Failed to parse form data") {
 			return
 		}
 
@@ -93,9 +89,20 @@ func NewPostPage(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		userIDStr := strconv.Itoa(userID)
-
-		postID, err := database.InsertPost(db, content, title, userIDStr)
+		postID, err := database.CreatePost(db, userID, title, content, r.Form["categories"])
+		if errors.Is(err, database.ErrTooLong) || errors.Is(err, database.ErrUnknownCategory) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, database.ErrPostQuotaExceeded) {
+			log.Printf("[WARN] User %s (ID: %d) reached the daily post limit", userName, userID)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(map[string]string{"error": "You have reached the daily post limit, try again later"})
+			return
+		}
 		if err != nil {
 			log.Printf("[ERROR] Failed to create post: %v", err)
 			w.Header().Set("Content-Type", "application/json")
@@ -105,20 +112,8 @@ func NewPostPage(w http.ResponseWriter, r *http.Request) {
 		}
 		log.Printf("[INFO] Created post ID %d for user %s", postID, userName)
 
-		categories := r.Form["categories"]
-		categorySuccess := 0
-		for _, categoryIDStr := range categories {
-			categoryIDInt, err := strconv.Atoi(categoryIDStr)
-			if err != nil {
-				log.Printf("[WARN] Invalid category ID: %s", categoryIDStr)
-				continue
-			}
-			err = database.InsertPostCategory(db, postID, categoryIDInt)
-			if err != nil {
-				log.Printf("[ERROR] Failed to assign category %d to post %d: %v", categoryIDInt, postID, err)
-			} else {
-				categorySuccess++
-			}
+		if post, err := database.GetPostByID(db, postID); err == nil {
+			announceNewPost(post)
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"connecthub/database"
+	"connecthub/sanitize"
+)
+
+// Posts and comments are stored as their authors wrote them. The text is
+// cleaned with the configured sanitize policy only when it is written into a
+// response, since the client renders it as HTML.
+
+// renderPosts cleans the title and content of posts for output
+func renderPosts(posts []database.Post) {
+	for i := range posts {
+		renderPost(&posts[i])
+	}
+}
+
+func renderPost(post *database.Post) {
+	post.Title = sanitize.Clean(post.Title)
+	post.Content = sanitize.Clean(post.Content)
+}
+
+// renderComments cleans the content of comments for output
+func renderComments(comments []database.Comment) {
+	for i := range comments {
+		renderComment(&comments[i])
+	}
+}
+
+func renderComment(comment *database.Comment) {
+	comment.Content = sanitize.Clean(comment.Content)
+}
@@ -3,12 +3,21 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"connecthub/database"
+	"connecthub/paging"
+	"connecthub/repository"
+	"connecthub/sanitize"
+	"connecthub/websocket"
 )
 
 // Post-related request/response types
@@ -17,23 +26,34 @@ type Category struct {
 	Name string `json:"name"`
 }
 
+// UserPostsResponse is a page of posts related to a user
+type UserPostsResponse struct {
+	Posts  []database.Post `json:"posts"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
 type CreatePostRequest struct {
 	Title      string   `json:"title"`
 	Content    string   `json:"content"`
 	Categories []string `json:"categories"`
+	// PublishAt schedules the post; it stays out of feeds until this time
+	PublishAt *time.Time `json:"publish_at,omitempty"`
 }
 
 type CreatePostResponse struct {
-	Success bool   `json:"success"`
-	PostID  int    `json:"post_id,omitempty"`
-	Error   string `json:"error,omitempty"`
+	Success bool           `json:"success"`
+	PostID  int            `json:"post_id,omitempty"`
+	Post    *database.Post `json:"post,omitempty"`
+	Error   string         `json:"error,omitempty"`
 }
 
-// GetPosts handles GET /api/posts
+// GetPosts handles GET /api/posts. Every matching post is returned unless
+// limit, page or offset asks for a single page.
 func GetPosts(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetPosts: Database connection failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -42,13 +62,7 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
 	}
 	defer db.Close()
 
-	filter := r.URL.Query().Get("filter")
-	selectedTab := r.URL.Query().Get("tab")
-
-	selectedTab = strings.ReplaceAll(selectedTab, " ", "+")
-
-	log.Printf("[INFO] GetPosts: Raw tab parameter: '%s', filter: '%s'", selectedTab, filter)
-
+	// Resolve the viewer first so every listing can mark the posts they liked
 	var userID int
 	seshCok, err := r.Cookie("session_token")
 	if err == nil && seshCok.Value != "" {
@@ -60,6 +74,22 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
 		log.Printf("[INFO] GetPosts: No session token found, userID will be 0")
 	}
 
+	if r.URL.Query().Has("since") {
+		writePostsSince(w, r, db, userID)
+		return
+	}
+	if r.URL.Query().Has("category_id") {
+		writePostsByCategoryID(w, r, db, userID)
+		return
+	}
+
+	filter := r.URL.Query().Get("filter")
+	selectedTab := r.URL.Query().Get("tab")
+
+	selectedTab = strings.ReplaceAll(selectedTab, " ", "+")
+
+	log.Printf("[INFO] GetPosts: Raw tab parameter: '%s', filter: '%s'", selectedTab, filter)
+
 	log.Printf("[INFO] GetPosts: Selected tab: %s, filter: %s, userID: %d", selectedTab, filter, userID)
 
 	if selectedTab == "" {
@@ -127,17 +157,27 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		log.Printf("[DEBUG] GetPosts: Fetching posts by user ID %d", userID)
-		posts, fetchErr = database.GetPostsByUser(db, userID)
+		posts, fetchErr = database.GetOwnPosts(db, userID)
 
-	case "liked+posts", "your+replies":
+	case "liked+posts":
 		if userID == 0 {
-			log.Printf("[WARN] GetPosts: User not authenticated for 'your replies' tab")
+			log.Printf("[WARN] GetPosts: User not authenticated for 'liked posts' tab")
 			w.WriteHeader(http.StatusUnauthorized)
 			json.NewEncoder(w).Encode(map[string]string{"error": "Authentication required"})
 			return
 		}
 		log.Printf("[DEBUG] GetPosts: Fetching liked posts by user ID %d", userID)
-		posts, fetchErr = database.GetLikedPostsByUser(db, userID)
+		posts, fetchErr = database.GetLikedPostsByUser(db, userID, 0, 0)
+
+	case "your+replies":
+		if userID == 0 {
+			log.Printf("[WARN] GetPosts: User not authenticated for 'your replies' tab")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "Authentication required"})
+			return
+		}
+		log.Printf("[DEBUG] GetPosts: Fetching commented posts by user ID %d", userID)
+		posts, fetchErr = database.GetUserCommentedPosts(db, userID, "newest", 0, 0)
 
 	default:
 		log.Printf("[ERROR] Invalid tab '%s'", selectedTab)
@@ -153,10 +193,105 @@ func GetPosts(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if paging.Requested(r) {
+		limit, offset := paging.Parse(r)
+		posts = postsPage(posts, limit, offset)
+	}
+
+	if err := database.LoadPostImages(db, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading post images failed: %v", err)
+	}
+	if err := database.LoadLikedByMe(db, userID, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading likes of user %d failed: %v", userID, err)
+	}
+	if wantsInlineImages(r) {
+		inlinePostImages(posts)
+	}
+	renderPosts(posts)
+
 	log.Printf("[INFO] GetPosts: Retrieved %d posts for tab '%s' with filter '%s'", len(posts), selectedTab, filter)
 	json.NewEncoder(w).Encode(posts)
 }
 
+// writePostsByCategoryID answers GET /api/posts?category_id=<id> with the
+// posts filed under that category, newest first. userID is the viewer, or 0.
+func writePostsByCategoryID(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) {
+	categoryID, err := strconv.Atoi(r.URL.Query().Get("category_id"))
+	if err != nil || categoryID <= 0 {
+		log.Printf("[WARN] GetPosts: Invalid category_id parameter: %s", r.URL.Query().Get("category_id"))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "category_id must be a positive integer"})
+		return
+	}
+
+	limit, offset := 0, 0
+	if paging.Requested(r) {
+		limit, offset = paging.Parse(r)
+	}
+	posts, err := database.GetPostsByCategoryID(db, categoryID, limit, offset)
+	if errors.Is(err, database.ErrUnknownCategory) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Category not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetPosts: Fetching posts for category %d failed: %v", categoryID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch posts"})
+		return
+	}
+
+	if err := database.LoadPostImages(db, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading post images failed: %v", err)
+	}
+	if err := database.LoadLikedByMe(db, userID, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading likes of user %d failed: %v", userID, err)
+	}
+	if wantsInlineImages(r) {
+		inlinePostImages(posts)
+	}
+	renderPosts(posts)
+
+	log.Printf("[INFO] GetPosts: Retrieved %d posts for category %d", len(posts), categoryID)
+	json.NewEncoder(w).Encode(posts)
+}
+
+// writePostsSince answers GET /api/posts?since=<rfc3339> with the posts added
+// after that time, oldest first, for clients polling the feed. userID is the
+// viewer, or 0.
+func writePostsSince(w http.ResponseWriter, r *http.Request, db *sql.DB, userID int) {
+	since, err := time.Parse(time.RFC3339, r.URL.Query().Get("since"))
+	if err != nil {
+		log.Printf("[WARN] GetPosts: Invalid since parameter: %s", r.URL.Query().Get("since"))
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "since must be an RFC 3339 timestamp"})
+		return
+	}
+
+	limit, _ := paging.Parse(r)
+	posts, err := database.GetPostsSince(db, since, limit)
+	if err != nil {
+		log.Printf("[ERROR] GetPosts: Fetching posts since %s failed: %v", since, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch posts"})
+		return
+	}
+
+	if err := database.LoadPostImages(db, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading post images failed: %v", err)
+	}
+	if err := database.LoadLikedByMe(db, userID, posts); err != nil {
+		log.Printf("[WARN] GetPosts: Loading likes of user %d failed: %v", userID, err)
+	}
+	if wantsInlineImages(r) {
+		inlinePostImages(posts)
+	}
+	renderPosts(posts)
+
+	log.Printf("[INFO] GetPosts: Retrieved %d posts since %s", len(posts), since)
+	json.NewEncoder(w).Encode(posts)
+}
+
 // GetPostByID handles GET /api/post
 func GetPostByID(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -169,32 +304,91 @@ func GetPostByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	postIDInt, err := strconv.Atoi(postIDStr)
-	if err != nil {
+	if err != nil || postIDInt <= 0 {
 		log.Printf("[WARN] GetPostByID: Invalid post ID: %s", postIDStr)
-		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid post ID")
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Post ID must be a positive integer")
 		return
 	}
 
 	log.Printf("[INFO] GetPostByID: Fetching post with ID %d", postIDInt)
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetPostByID: Database connection failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Database connection failed"})
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
 		return
 	}
 	defer db.Close()
 
-	post, err := database.GetPostByID(db, postIDInt)
+	// Authors can open their own scheduled posts before they publish
+	post, err := database.GetPostByIDForViewer(db, postIDInt, sessionUserID(r))
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteAPIError(w, http.StatusNotFound, "POST_NOT_FOUND", "Post not found")
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] GetPostByID: Fetching post failed: %v", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch post"})
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch post")
+		return
+	}
+
+	if wantsInlineImages(r) {
+		inlinePostImage(&post)
+	}
+
+	writePostDetail(w, r, db, post)
+}
+
+// GetPostBySlugAPI handles GET /api/post/by-slug
+func GetPostBySlugAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	slug := strings.TrimSpace(r.URL.Query().Get("slug"))
+	if slug == "" {
+		log.Printf("[WARN] GetPostBySlugAPI: Missing slug parameter")
+		WriteAPIError(w, http.StatusBadRequest, "MISSING_PARAMETER", "Missing post slug")
 		return
 	}
 
-	comments, err := database.GetCommentsForPost(db, postIDInt)
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] GetPostBySlugAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	post, err := database.GetPostBySlug(db, slug)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteAPIError(w, http.StatusNotFound, "POST_NOT_FOUND", "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] GetPostBySlugAPI: Fetching post failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch post")
+		return
+	}
+
+	writePostDetail(w, r, db, post)
+}
+
+// postsPage returns the limit posts starting at offset
+func postsPage(posts []database.Post, limit, offset int) []database.Post {
+	if offset >= len(posts) {
+		return []database.Post{}
+	}
+	end := offset + limit
+	if end > len(posts) {
+		end = len(posts)
+	}
+	return posts[offset:end]
+}
+
+// writePostDetail writes a post with its categories and the page of comments
+// the request asks for, the first page by default
+func writePostDetail(w http.ResponseWriter, r *http.Request, db *sql.DB, post database.Post) {
+	limit, offset := paging.Parse(r)
+	comments, commentsTotal, err := database.GetCommentsForPostPaginated(db, post.PostID, limit, offset)
 	if err != nil {
 		log.Printf("[ERROR] GetPostByID: Fetching comments failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -202,20 +396,177 @@ func GetPostByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	categories, err := database.GetCategoriesForPost(db, post.PostID)
-	if err != nil {
-		log.Printf("[ERROR] GetPostByID: Fetching categories failed: %v", err)
+	// A tombstone keeps its comments but nothing else the author wrote
+	categories := []database.Category{}
+	if !post.IsDeleted {
+		categories, err = database.GetCategoriesForPost(db, post.PostID)
+		if err != nil {
+			log.Printf("[ERROR] GetPostByID: Fetching categories failed: %v", err)
+		}
 	}
 
+	renderPost(&post)
+	renderComments(comments)
+
 	response := map[string]interface{}{
-		"post":       post,
-		"comments":   comments,
-		"categories": categories,
+		"post":           post,
+		"comments":       comments,
+		"comments_total": commentsTotal,
+		"categories":     categories,
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// DeletePostAPI handles POST/DELETE /api/post/delete?id=N. Authors can only
+// soft-delete their own posts; the post is left behind as a tombstone.
+func DeletePostAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	clientIP := getClientIP(r)
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || postID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Post ID must be a positive integer")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] DeletePostAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] DeletePostAPI: Invalid session %s from %s: %v", maskSessionToken(sessionCookie.Value), clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	post, err := database.GetPostByIDForViewer(db, postID, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && post.IsDeleted) {
+		WriteAPIError(w, http.StatusNotFound, "POST_NOT_FOUND", "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] DeletePostAPI: Failed to load post %d: %v", postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load post")
+		return
+	}
+	if post.UserUserID != userID {
+		log.Printf("[WARN] DeletePostAPI: User %d tried to delete post %d owned by %d", userID, postID, post.UserUserID)
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You can only delete your own posts")
+		return
+	}
+
+	if err := database.DeletePost(db, postID); err != nil {
+		log.Printf("[ERROR] DeletePostAPI: Failed to delete post %d: %v", postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to delete post")
+		return
+	}
+
+	log.Printf("[INFO] DeletePostAPI: User %d deleted post %d", userID, postID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// PinPostAPI handles POST (pin) and DELETE (unpin) /api/post/pin?id=N&scope=S.
+// Scope "profile", the default, pins a post to the top of its author's profile
+// feed and is open to the author; scope "global" pins it to the top of the
+// main feed and is open to admins.
+func PinPostAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || postID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Post ID must be a positive integer")
+		return
+	}
+
+	scope := database.PinProfile
+	if s := r.URL.Query().Get("scope"); s != "" {
+		scope = database.PinScope(s)
+	}
+	if !database.ValidPinScope(scope) {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Scope must be \"profile\" or \"global\"")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] PinPostAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	userID, admin, err := isAdmin(db, r)
+	if err != nil {
+		log.Printf("[WARN] PinPostAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	post, err := database.GetPostByIDForViewer(db, postID, userID)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && post.IsDeleted) {
+		WriteAPIError(w, http.StatusNotFound, "POST_NOT_FOUND", "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] PinPostAPI: Failed to load post %d: %v", postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load post")
+		return
+	}
+
+	switch scope {
+	case database.PinGlobal:
+		if !admin {
+			log.Printf("[WARN] PinPostAPI: User %d is not allowed to pin posts globally", userID)
+			WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "Only admins can pin posts to the main feed")
+			return
+		}
+	case database.PinProfile:
+		if post.UserUserID != userID {
+			log.Printf("[WARN] PinPostAPI: User %d tried to pin post %d owned by %d", userID, postID, post.UserUserID)
+			WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You can only pin your own posts")
+			return
+		}
+	}
+
+	pin := r.Method == "POST"
+	if pin {
+		err = database.PinPost(db, postID, scope)
+	} else {
+		err = database.UnpinPost(db, postID, scope)
+	}
+	if err != nil {
+		log.Printf("[ERROR] PinPostAPI: Failed to update %s pin of post %d: %v", scope, postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to update pin")
+		return
+	}
+
+	log.Printf("[INFO] PinPostAPI: User %d set %s pin of post %d to %v", userID, scope, postID, pin)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "pinned": pin, "scope": scope})
+}
+
 // CreatePostAPI handles POST /api/post/create
 func CreatePostAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -230,10 +581,7 @@ func CreatePostAPI(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] CreatePostAPI: Processing create post request from %s", clientIP)
 
 	var req CreatePostRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[ERROR] CreatePostAPI: Failed to decode request: %v", err)
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(CreatePostResponse{Success: false, Error: "Invalid request format"})
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
@@ -244,7 +592,7 @@ func CreatePostAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] CreatePostAPI: Database connection failed: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -270,8 +618,25 @@ func CreatePostAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	var publishAt time.Time
+	if req.PublishAt != nil {
+		publishAt = *req.PublishAt
+	}
+
 	// Create post
-	postID, err := database.CreatePost(db, userID, req.Title, req.Content, req.Categories)
+	postID, err := database.CreateScheduledPost(db, userID, req.Title, req.Content, req.Categories, publishAt)
+	if errors.Is(err, database.ErrTooLong) || errors.Is(err, database.ErrUnknownCategory) {
+		log.Printf("[WARN] CreatePostAPI: Rejected post from user %d: %v", userID, err)
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(CreatePostResponse{Success: false, Error: err.Error()})
+		return
+	}
+	if errors.Is(err, database.ErrPostQuotaExceeded) {
+		log.Printf("[WARN] CreatePostAPI: User %d reached the daily post limit", userID)
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(CreatePostResponse{Success: false, Error: "You have reached the daily post limit, try again later"})
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] CreatePostAPI: Failed to create post: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -281,15 +646,54 @@ func CreatePostAPI(w http.ResponseWriter, r *http.Request) {
 
 	log.Printf("[INFO] CreatePostAPI: Post created successfully with ID %d by user %d", postID, userID)
 
+	// Return the hydrated post so the client can render it without a follow-up fetch
+	post, err := database.GetPostByIDForViewer(db, postID, userID)
+	if err != nil {
+		log.Printf("[ERROR] CreatePostAPI: Failed to load created post %d: %v", postID, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(CreatePostResponse{Success: false, PostID: postID, Error: "Failed to load created post"})
+		return
+	}
+
+	// Scheduled posts are not in feeds yet, so there is nothing to announce
+	if !publishAt.After(time.Now()) {
+		announceNewPost(post)
+	}
+
+	renderPost(&post)
 	json.NewEncoder(w).Encode(CreatePostResponse{
 		Success: true,
 		PostID:  postID,
+		Post:    &post,
+	})
+}
+
+// announceNewPost pushes a summary of a just-published post to connected feed readers
+func announceNewPost(post database.Post) {
+	if globalWSManager == nil {
+		return
+	}
+
+	author := database.User{Username: post.Username, FirstName: post.FirstName, LastName: post.LastName}
+	categories := make([]string, 0, len(post.Categories))
+	for _, category := range post.Categories {
+		categories = append(categories, category.Name)
+	}
+
+	globalWSManager.AnnounceNewPost(websocket.PostSummary{
+		ID:         post.PostID,
+		Title:      sanitize.Clean(post.Title),
+		Slug:       post.Slug,
+		AuthorID:   post.UserUserID,
+		Author:     author.DisplayName(),
+		Categories: categories,
+		PostedAt:   post.PostAt,
 	})
 }
 
 // CategoriesAPI handles GET /api/categories
 func CategoriesAPI(w http.ResponseWriter, r *http.Request) {
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] CategoriesAPI: Database connection failed: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -308,6 +712,119 @@ func CategoriesAPI(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(categories)
 }
 
+// CreateCategoryRequest names a category to add
+type CreateCategoryRequest struct {
+	Name string `json:"name"`
+}
+
+// CreateCategoryAPI handles POST /api/categories. Only admins may add
+// categories, which AdminMiddleware enforces on the route; everyone else files
+// posts under the existing ones.
+func CreateCategoryAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req CreateCategoryRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if database.NormalizeCategoryName(req.Name) == "" {
+		WriteAPIError(w, http.StatusBadRequest, "VALIDATION_ERROR", "Category name is required")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] CreateCategoryAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	category, err := database.CreateCategory(db, req.Name)
+	if errors.Is(err, database.ErrCategoryExists) {
+		WriteAPIError(w, http.StatusConflict, "CATEGORY_EXISTS", err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] CreateCategoryAPI: Failed to create category: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to create category")
+		return
+	}
+
+	log.Printf("[INFO] CreateCategoryAPI: Created category %d (%s)", category.ID, category.Name)
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(category)
+}
+
+// CategoryCountsAPI handles GET /api/categories/counts
+func CategoryCountsAPI(w http.ResponseWriter, r *http.Request) {
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] CategoryCountsAPI: Database connection failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer db.Close()
+
+	counts, err := database.GetCategoriesWithCounts(db)
+	if err != nil {
+		log.Printf("[ERROR] CategoryCountsAPI: Fetching category counts failed: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// Trending category window and list size used when the request does not set them
+const (
+	defaultTrendingDays  = 7
+	maxTrendingDays      = 365
+	defaultTrendingLimit = 10
+)
+
+// TrendingCategoriesAPI handles GET /api/categories/trending?days=7&limit=10
+func TrendingCategoriesAPI(w http.ResponseWriter, r *http.Request) {
+	days := defaultTrendingDays
+	if raw := r.URL.Query().Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 || parsed > maxTrendingDays {
+			WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", fmt.Sprintf("days must be between 1 and %d", maxTrendingDays))
+			return
+		}
+		days = parsed
+	}
+
+	limit := defaultTrendingLimit
+	if parsed, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && parsed > 0 {
+		limit = parsed
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] TrendingCategoriesAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	trending, err := database.GetTrendingCategories(db, time.Duration(days)*24*time.Hour, limit)
+	if err != nil {
+		log.Printf("[ERROR] TrendingCategoriesAPI: Fetching trending categories failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load trending categories")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trending)
+}
+
 // AddComment handles POST /addcomment
 func AddComment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -329,7 +846,7 @@ func AddComment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] AddComment: Database connection failed: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -353,16 +870,284 @@ func AddComment(w http.ResponseWriter, r *http.Request) {
 
 	// Add comment
 	err = database.AddComment(db, postID, userID, content)
+	if errors.Is(err, database.ErrTooLong) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, database.ErrPostNotFound) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, database.ErrPostDeleted) {
+		http.Error(w, "This post has been deleted", http.StatusGone)
+		return
+	}
+	if errors.Is(err, database.ErrDuplicateComment) {
+		http.Error(w, "You just posted that comment", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		log.Printf("[ERROR] AddComment: Failed to add comment: %v", err)
 		http.Error(w, "Failed to add comment", http.StatusInternalServerError)
 		return
 	}
 
+	notifyCommentAuthor(db, postID, userID)
+
 	// Redirect back to the post
 	http.Redirect(w, r, "/post?id="+postIDStr, http.StatusSeeOther)
 }
 
+// notifyCommentAuthor records a comment notification for the post's author and
+// pushes it only when it starts a new batch, so a busy thread is one alert
+func notifyCommentAuthor(db *sql.DB, postID, commenterID int) {
+	notification, created, err := database.NotifyComment(db, postID, commenterID)
+	if err != nil {
+		log.Printf("[WARN] AddComment: Failed to record notification for post %d: %v", postID, err)
+		return
+	}
+	if !created || globalWSManager == nil {
+		return
+	}
+
+	globalWSManager.SendToUser(notification.UserID, websocket.Message{
+		Type:      websocket.MessageTypeNotification,
+		UserID:    notification.UserID,
+		Content:   notification,
+		Timestamp: time.Now(),
+	})
+}
+
+// EditCommentRequest is the body of POST /api/comment/edit
+type EditCommentRequest struct {
+	CommentID int    `json:"comment_id"`
+	Content   string `json:"content"`
+}
+
+// GetCommentAPI handles GET /api/comment?id=, returning one comment and the
+// post it belongs to so the client can open the thread scrolled to it
+func GetCommentAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || commentID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Comment ID must be a positive integer")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] GetCommentAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	comment, err := database.GetCommentByID(db, commentID)
+	if errors.Is(err, sql.ErrNoRows) {
+		WriteAPIError(w, http.StatusNotFound, "COMMENT_NOT_FOUND", "Comment not found")
+		return
+	}
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch comment")
+		return
+	}
+
+	// A comment on a post that is not published yet is only shown to its author
+	visible, err := database.PostVisibleTo(db, comment.PostID, sessionUserID(r))
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch comment")
+		return
+	}
+	if !visible {
+		WriteAPIError(w, http.StatusNotFound, "COMMENT_NOT_FOUND", "Comment not found")
+		return
+	}
+
+	renderComment(&comment)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "comment": comment, "post_id": comment.PostID})
+}
+
+// PostCommentsAPI handles GET /api/post/comments?id=&page=, returning one page
+// of a post's comments, oldest first, so clients can load them separately from
+// the post itself
+func PostCommentsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || postID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Post ID must be a positive integer")
+		return
+	}
+	limit, offset := paging.Parse(r)
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] PostCommentsAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	visible, err := database.PostVisibleTo(db, postID, sessionUserID(r))
+	if err != nil {
+		log.Printf("[ERROR] PostCommentsAPI: Failed to look up post %d: %v", postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch comments")
+		return
+	}
+	if !visible {
+		WriteAPIError(w, http.StatusNotFound, "POST_NOT_FOUND", "Post not found")
+		return
+	}
+
+	// Ask for one extra row to learn whether another page follows; total
+	// leaves out deleted comments, so it cannot tell
+	comments, total, err := database.GetCommentsForPostPaginated(db, postID, limit+1, offset)
+	if err != nil {
+		log.Printf("[ERROR] PostCommentsAPI: Fetching comments for post %d failed: %v", postID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch comments")
+		return
+	}
+	hasMore := len(comments) > limit
+	if hasMore {
+		comments = comments[:limit]
+	}
+	if comments == nil {
+		comments = []database.Comment{}
+	}
+	renderComments(comments)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"comments": comments,
+		"total":    total,
+		"has_more": hasMore,
+	})
+}
+
+// EditCommentAPI handles POST /api/comment/edit
+func EditCommentAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req EditCommentRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.CommentID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Comment ID must be a positive integer")
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		WriteAPIError(w, http.StatusBadRequest, "MISSING_FIELD", "Comment content is required")
+		return
+	}
+
+	db, userID, ok := openCommentSession(w, r, "EditCommentAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	err := database.EditComment(db, req.CommentID, userID, req.Content)
+	if !writeCommentError(w, err, "EditCommentAPI", "edit") {
+		return
+	}
+
+	log.Printf("[INFO] EditCommentAPI: User %d edited comment %d", userID, req.CommentID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// DeleteCommentAPI handles POST or DELETE /api/comment/delete?id=
+func DeleteCommentAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" && r.Method != "DELETE" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || commentID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Comment ID must be a positive integer")
+		return
+	}
+
+	db, userID, ok := openCommentSession(w, r, "DeleteCommentAPI")
+	if !ok {
+		return
+	}
+	defer db.Close()
+
+	err = database.DeleteComment(db, commentID, userID)
+	if !writeCommentError(w, err, "DeleteCommentAPI", "delete") {
+		return
+	}
+
+	log.Printf("[INFO] DeleteCommentAPI: User %d deleted comment %d", userID, commentID)
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true})
+}
+
+// openCommentSession opens the database and resolves the caller's session,
+// writing an error response and returning false if either fails
+func openCommentSession(w http.ResponseWriter, r *http.Request, handler string) (*sql.DB, int, bool) {
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return nil, 0, false
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] %s: Database connection failed: %v", handler, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return nil, 0, false
+	}
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] %s: Invalid session %s from %s: %v", handler, maskSessionToken(sessionCookie.Value), getClientIP(r), err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		db.Close()
+		return nil, 0, false
+	}
+	return db, userID, true
+}
+
+// writeCommentError maps an EditComment or DeleteComment error to a response.
+// It returns true when err is nil and the handler should continue.
+func writeCommentError(w http.ResponseWriter, err error, handler, action string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, sql.ErrNoRows):
+		WriteAPIError(w, http.StatusNotFound, "COMMENT_NOT_FOUND", "Comment not found")
+	case errors.Is(err, database.ErrNotCommentOwner):
+		WriteAPIError(w, http.StatusForbidden, "FORBIDDEN", "You can only "+action+" your own comments")
+	case errors.Is(err, database.ErrTooLong):
+		WriteAPIError(w, http.StatusBadRequest, "TOO_LONG", err.Error())
+	default:
+		log.Printf("[ERROR] %s: Failed to %s comment: %v", handler, action, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to "+action+" comment")
+	}
+	return false
+}
+
 // CheckFilter checks if a filter is valid against a list of valid filters
 func CheckFilter(filter string, validFilters []string) bool {
 	for _, validFilter := range validFilters {
@@ -372,3 +1157,57 @@ func CheckFilter(filter string, validFilters []string) bool {
 	}
 	return false
 }
+
+// GetUserLikedPostsAPI handles GET /api/users/{id}/liked
+func GetUserLikedPostsAPI(w http.ResponseWriter, r *http.Request) {
+	writeUserPostsPage(w, r, "liked", repository.PostRepository.GetLikedPostsByUser)
+}
+
+// GetUserCommentedPostsAPI handles GET /api/users/{id}/commented
+func GetUserCommentedPostsAPI(w http.ResponseWriter, r *http.Request) {
+	writeUserPostsPage(w, r, "commented", repository.PostRepository.GetCommentedPostsByUser)
+}
+
+// writeUserPostsPage resolves the user and pagination parameters and writes one page from fetch
+func writeUserPostsPage(w http.ResponseWriter, r *http.Request, kind string,
+	fetch func(repo repository.PostRepository, userID, limit, offset int) ([]database.Post, error)) {
+	w.Header().Set("Content-Type", "application/json")
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil || userID <= 0 {
+		WriteAPIError(w, http.StatusBadRequest, "INVALID_PARAMETER", "Invalid user ID")
+		return
+	}
+
+	limit, offset := paging.Parse(r)
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] UserPostsAPI(%s): Database connection failed: %v", kind, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	if _, err := database.GetUserByID(db, userID); err == sql.ErrNoRows {
+		WriteAPIError(w, http.StatusNotFound, "USER_NOT_FOUND", "User not found")
+		return
+	} else if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch user")
+		return
+	}
+
+	posts, err := fetch(repository.NewPostRepository(db), userID, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] UserPostsAPI(%s): Fetching posts for user %d failed: %v", kind, userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to fetch posts")
+		return
+	}
+	if posts == nil {
+		posts = []database.Post{}
+	}
+	renderPosts(posts)
+
+	log.Printf("[INFO] UserPostsAPI(%s): Retrieved %d %s posts for user %d", kind, len(posts), kind, userID)
+	json.NewEncoder(w).Encode(UserPostsResponse{Posts: posts, Limit: limit, Offset: offset})
+}
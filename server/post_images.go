@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/base64"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"connecthub/database"
+	"connecthub/uploads"
+)
+
+// maxInlineImageSize caps the images embedded into post responses so they stay small
+const maxInlineImageSize = 100 << 10 // 100 KB
+
+// staticRoot is the directory served under the /static/ URL prefix
+const staticRoot = "./src/static"
+
+// wantsInlineImages reports whether the request asked for images to be embedded
+func wantsInlineImages(r *http.Request) bool {
+	return r.URL.Query().Get("inline") == "true"
+}
+
+// inlinePostImages embeds small post images as data URIs in ImageBase64.
+// Images that are missing, too large or not images are left as plain paths.
+func inlinePostImages(posts []database.Post) {
+	for i := range posts {
+		inlinePostImage(&posts[i])
+	}
+}
+
+func inlinePostImage(post *database.Post) {
+	if !post.Image.Valid || !strings.HasPrefix(post.Image.String, "/static/") {
+		return
+	}
+
+	// Uploaded images live in the configurable uploads directory; anything else
+	// is a bundled asset. Clean against a rooted path so the image can never
+	// escape the static directory.
+	path, ok := uploads.Path(post.Image.String)
+	if !ok {
+		rel := filepath.Clean("/" + strings.TrimPrefix(post.Image.String, "/static/"))
+		path = filepath.Join(staticRoot, rel)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		log.Printf("[WARN] Image for post ID %d not found at %s", post.PostID, path)
+		return
+	}
+	if info.Size() > maxInlineImageSize {
+		log.Printf("[DEBUG] Image for post ID %d is %d bytes, too large to inline", post.PostID, info.Size())
+		return
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("[WARN] Failed to read image for post ID %d: %v", post.PostID, err)
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !strings.HasPrefix(contentType, "image/") {
+		log.Printf("[WARN] File for post ID %d is %s, not an image", post.PostID, contentType)
+		return
+	}
+
+	post.ImageBase64 = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"connecthub/database"
+	"connecthub/ratelimit"
+)
+
+// RateLimitMiddleware rejects requests from a client IP that exceed the limiter's rate
+func RateLimitMiddleware(limiter *ratelimit.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := clientIPKey(r)
+		if ok, retryAfter := limiter.Allow(key); !ok {
+			log.Printf("[WARN] Rate limit exceeded for %s on %s", key, r.URL.Path)
+			writeRateLimited(w, retryAfter)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// UserRateLimitMiddleware rejects requests from a signed-in user who exceeds the
+// limiter's rate. Requests without a valid session are passed through so the
+// handler can answer them with its usual authentication error.
+func UserRateLimitMiddleware(limiter *ratelimit.Limiter, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := sessionUserID(r)
+		if userID == 0 {
+			next(w, r)
+			return
+		}
+
+		if ok, retryAfter := limiter.Allow("user:" + strconv.Itoa(userID)); !ok {
+			log.Printf("[WARN] Rate limit exceeded for user %d on %s", userID, r.URL.Path)
+			writeRateLimited(w, retryAfter)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// writeRateLimited sends a 429 telling the client how many whole seconds to wait
+func writeRateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	WriteAPIError(w, http.StatusTooManyRequests, "RATE_LIMITED", "Too many requests. Please slow down and try again shortly.")
+}
+
+// sessionUserID returns the user owning the request's session cookie, or 0 if
+// there is no session or it cannot be resolved
+func sessionUserID(r *http.Request) int {
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil || sessionCookie.Value == "" {
+		return 0
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] Database connection failed during rate limit check: %v", err)
+		return 0
+	}
+	defer db.Close()
+
+	var userID int
+	if err := db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID); err != nil {
+		return 0
+	}
+	return userID
+}
+
+// clientIPKey returns the connecting address without the port so all
+// connections from one host share a bucket. X-Forwarded-For is ignored: the
+// client controls it, and a new value per request would get a new bucket.
+func clientIPKey(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
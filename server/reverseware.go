@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 	"time"
+
+	"connecthub/database"
 )
 
 func ReverseMiddleware(next http.HandlerFunc) http.HandlerFunc {
@@ -16,7 +18,7 @@ func ReverseMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		log.Printf("[DEBUG] ReverseMiddleware checking authenticated state for %s %s from %s",
 			r.Method, requestPath, clientIP)
 
-		db, err := sql.Open("sqlite3", "./database/main.db")
+		db, err := sql.Open("sqlite3", database.Path())
 		if err != nil {
 			log.Printf("[ERROR] ReverseMiddleware: Database connection failed: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
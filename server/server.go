@@ -2,16 +2,24 @@ package server
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/mattn/go-sqlite3"
 
+	"connecthub/config"
+	"connecthub/database"
+	"connecthub/origin"
+	"connecthub/ratelimit"
+	"connecthub/server/services"
+	"connecthub/uploads"
 	"connecthub/websocket"
 )
 
@@ -19,14 +27,55 @@ import (
 type HTTPServer struct {
 	router    *mux.Router
 	wsManager *websocket.Manager
-	port      string
+	config    config.Config
 }
 
-// NewHTTPServer creates a new HTTP server instance
-func NewHTTPServer(port string) *HTTPServer {
+// sessionTTL is how long a login session cookie stays valid
+var sessionTTL = 24 * time.Hour
+
+// maxMessageLength caps chat message content, in characters
+var maxMessageLength = config.Default().MaxMessageLength
+
+// availabilityLimiter throttles availability checks per client to make account enumeration expensive
+var availabilityLimiter = ratelimit.New(20, time.Minute)
+
+// contentLimiter caps how fast each user can send messages, create posts and add comments
+var contentLimiter = ratelimit.New(config.Default().MessageRate, time.Minute)
+
+// admins holds the ids of the users allowed to manage categories; see SetAdmins
+var admins = map[int]bool{}
+
+// SetAdmins grants the admin role to the accounts with the given usernames,
+// matched ignoring case. Names are resolved to user ids here, once, so an
+// account registered later under a configured name does not become an admin;
+// the names are also reserved so signup refuses them. Admins are exempt from
+// the daily post cap.
+func SetAdmins(db *sql.DB, usernames []string) error {
+	services.ReserveUsernames(usernames)
+
+	admins = make(map[int]bool, len(usernames))
+	ids := make([]int, 0, len(usernames))
+	for _, name := range usernames {
+		resolved, err := database.GetUserIDsByUsernames(db, []string{name})
+		if errors.Is(err, database.ErrUnknownUsername) {
+			log.Printf("[WARN] Configured admin %q has no account and gets no admin rights", name)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		admins[resolved[0]] = true
+		ids = append(ids, resolved[0])
+	}
+	database.SetPostQuotaExempt(ids)
+	return nil
+}
+
+// NewHTTPServer creates a new HTTP server instance from cfg
+func NewHTTPServer(cfg config.Config) *HTTPServer {
 	return &HTTPServer{
 		router: mux.NewRouter(),
-		port:   port,
+		config: cfg,
 	}
 }
 
@@ -34,16 +83,29 @@ func NewHTTPServer(port string) *HTTPServer {
 func (s *HTTPServer) Initialize() error {
 	log.Printf("[INFO] Initializing server...")
 
+	sessionTTL = time.Duration(s.config.SessionTTL)
+	maxMessageLength = s.config.MaxMessageLength
+	database.SetMaxMessageLength(s.config.MaxMessageLength)
+	database.SetMaxPostsPerDay(s.config.MaxPostsPerDay)
+	contentLimiter = ratelimit.New(s.config.MessageRate, time.Minute)
+
 	// Initialize WebSocket manager
 	s.wsManager = websocket.NewManager()
+	s.wsManager.SetAllowedOrigins(s.config.AllowedOrigins)
+	s.wsManager.SetMaxMessageLength(s.config.MaxMessageLength)
+	s.wsManager.SetMessageRate(s.config.MessageRate)
+	s.wsManager.SetMaxConnectionsPerUser(s.config.MaxConnections)
 	log.Printf("[INFO] WebSocket manager initialized")
 
 	// Set global WebSocket manager for message handlers
 	SetWebSocketManager(s.wsManager)
 	log.Printf("[INFO] Global WebSocket manager set for message handlers")
 
+	// Report live connection status on messages sent through the REST API
+	database.SetPresenceChecker(s.wsManager.IsUserOnline)
+
 	// Set up database connection for WebSocket operations
-	dbConn, err := sql.Open("sqlite3", "./database/main.db")
+	dbConn, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] Failed to open database connection for WebSocket: %v", err)
 		return fmt.Errorf("failed to open database connection: %v", err)
@@ -51,6 +113,11 @@ func (s *HTTPServer) Initialize() error {
 	websocket.SetDB(dbConn)
 	log.Printf("[INFO] Database connection set for WebSocket operations")
 
+	if err := SetAdmins(dbConn, s.config.Admins); err != nil {
+		log.Printf("[ERROR] Failed to resolve configured admins: %v", err)
+		return fmt.Errorf("failed to resolve admins: %v", err)
+	}
+
 	// Configure static file servers
 	s.setupStaticRoutes()
 	log.Printf("[INFO] Static file servers configured")
@@ -88,11 +155,21 @@ func (s *HTTPServer) Initialize() error {
 	s.router.Use(LoggingMiddleware)
 	log.Printf("[INFO] Logging middleware applied to all routes")
 
+	s.router.Use(CORSMiddleware(origin.NewPolicy(s.config.AllowedOrigins)))
+	log.Printf("[INFO] CORS middleware applied with %d allowed cross-origin sites", len(s.config.AllowedOrigins))
+
+	s.router.Use(BodyLimitMiddleware(s.config.MaxBodySize, s.config.MaxUploadSize))
+	log.Printf("[INFO] Body limit middleware applied: %d bytes, %d for uploads", s.config.MaxBodySize, s.config.MaxUploadSize)
+
 	log.Printf("[INFO] Server initialization completed")
 	return nil
 }
 
 func (s *HTTPServer) setupStaticRoutes() {
+	// Uploads may live outside src/static, so serve them from their own directory
+	s.router.PathPrefix(uploads.URLPrefix).Handler(http.StripPrefix(uploads.URLPrefix,
+		secureFileServer(uploads.BaseDir())))
+
 	s.router.PathPrefix("/static/").Handler(http.StripPrefix("/static/",
 		secureFileServer("./src/static/")))
 
@@ -128,19 +205,48 @@ func secureFileServer(root string) http.Handler {
 
 // registerAPIRoutes sets up all API endpoints
 func (s *HTTPServer) registerAPIRoutes() {
+	s.router.HandleFunc("/api/version", VersionAPI)
+
 	// Post-related routes
 	s.router.HandleFunc("/api/posts", GetPosts)
 	s.router.HandleFunc("/api/post", GetPostByID)
-	s.router.HandleFunc("/api/categories", CategoriesAPI)
-	s.router.HandleFunc("/api/post/create", CreatePostAPI)
-	s.router.HandleFunc("/addcomment", AddComment)
+	s.router.HandleFunc("/api/post/by-slug", GetPostBySlugAPI)
+	s.router.HandleFunc("/api/post/comments", PostCommentsAPI)
+	s.router.HandleFunc("/api/categories", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			AdminMiddleware(CreateCategoryAPI)(w, r)
+		} else {
+			CategoriesAPI(w, r)
+		}
+	})
+	s.router.HandleFunc("/api/categories/counts", CategoryCountsAPI)
+	s.router.HandleFunc("/api/categories/trending", TrendingCategoriesAPI)
+	s.router.HandleFunc("/api/post/create", UserRateLimitMiddleware(contentLimiter, CreatePostAPI))
+	s.router.HandleFunc("/api/post/delete", AuthMiddleware(DeletePostAPI))
+	s.router.HandleFunc("/api/post/pin", AuthMiddleware(PinPostAPI))
+	s.router.HandleFunc("/addcomment", UserRateLimitMiddleware(contentLimiter, AddComment))
+	s.router.HandleFunc("/api/comment", GetCommentAPI)
+	s.router.HandleFunc("/api/comment/edit", AuthMiddleware(EditCommentAPI))
+	s.router.HandleFunc("/api/comment/delete", AuthMiddleware(DeleteCommentAPI))
 
 	// User-related routes
 	s.router.HandleFunc("/api/login", LoginAPI)
 	s.router.HandleFunc("/api/signup", SignupAPI)
 	s.router.HandleFunc("/api/logout", LogoutAPI)
+	s.router.HandleFunc("/api/logout-all", AuthMiddleware(LogoutAllAPI))
+	s.router.HandleFunc("/api/check-availability", RateLimitMiddleware(availabilityLimiter, CheckAvailabilityAPI))
 	s.router.HandleFunc("/api/users", AuthMiddleware(GetUsers))
+	s.router.HandleFunc("/api/users/search", AuthMiddleware(SearchUsersAPI))
+	s.router.HandleFunc("/api/users/batch", AuthMiddleware(GetUsersBatchAPI))
+	s.router.HandleFunc("/api/users/online", AuthMiddleware(GetOnlineUsersAPI))
+	s.router.HandleFunc("/api/notifications", AuthMiddleware(NotificationsAPI))
+	s.router.HandleFunc("/api/users/{id:[0-9]+}/liked", AuthMiddleware(GetUserLikedPostsAPI))
+	s.router.HandleFunc("/api/users/{id:[0-9]+}/commented", AuthMiddleware(GetUserCommentedPostsAPI))
+	s.router.HandleFunc("/api/users/{id:[0-9]+}/block", AuthMiddleware(BlockUserAPI))
 	s.router.HandleFunc("/api/user/current", AuthMiddleware(GetCurrentUser))
+	s.router.HandleFunc("/api/user/avatar", AuthMiddleware(UploadAvatarAPI))
+	s.router.HandleFunc("/api/user/export", AuthMiddleware(ExportUserDataAPI))
+	s.router.HandleFunc("/api/user/privacy", AuthMiddleware(UserPrivacyAPI))
 
 	// Message-related routes
 	s.router.HandleFunc("/api/conversations", AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
@@ -150,14 +256,30 @@ func (s *HTTPServer) registerAPIRoutes() {
 			GetConversations(w, r)
 		}
 	}))
+	s.router.HandleFunc("/api/conversations/search", AuthMiddleware(SearchConversationsAPI))
+	s.router.HandleFunc("/api/conversations/shared", AuthMiddleware(SharedConversationsAPI))
+	s.router.HandleFunc("/api/conversations/by-username", AuthMiddleware(CreateConversationByUsernamesAPI))
+	s.router.HandleFunc("/api/conversations/{id:[0-9]+}/typing", AuthMiddleware(GetTypingUsersAPI))
+	s.router.HandleFunc("/api/conversations/{id:[0-9]+}/export", AuthMiddleware(ExportConversationAPI))
+	s.router.HandleFunc("/api/conversations/{id:[0-9]+}/leave", AuthMiddleware(LeaveConversationAPI))
+	s.router.HandleFunc("/api/conversations/{id:[0-9]+}/draft", AuthMiddleware(ConversationDraftAPI))
+	s.router.HandleFunc("/api/conversations/{id:[0-9]+}", AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			GetConversationAPI(w, r)
+		} else {
+			DeleteConversationAPI(w, r)
+		}
+	}))
 	s.router.HandleFunc("/api/messages", AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "POST" {
-			SendMessageAPI(w, r)
+			UserRateLimitMiddleware(contentLimiter, SendMessageAPI)(w, r)
 		} else {
 			GetMessages(w, r)
 		}
 	}))
 	s.router.HandleFunc("/api/messages/read", AuthMiddleware(MarkMessagesAsReadAPI))
+	s.router.HandleFunc("/api/messages/read-all", AuthMiddleware(MarkAllReadAPI))
+	s.router.HandleFunc("/api/messages/upload", AuthMiddleware(UploadMessageAttachmentAPI))
 }
 
 // registerPageRoutes sets up all page endpoints
@@ -170,7 +292,13 @@ func (s *HTTPServer) registerPageRoutes() {
 
 	// Protected pages (require authentication)
 	s.router.HandleFunc("/home", AuthMiddleware(HomePage))
-	s.router.HandleFunc("/create-post", AuthMiddleware(NewPostPage))
+	s.router.HandleFunc("/create-post", AuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			UserRateLimitMiddleware(contentLimiter, NewPostPage)(w, r)
+		} else {
+			NewPostPage(w, r)
+		}
+	}))
 	s.router.HandleFunc("/chat", AuthMiddleware(ChatPage))
 
 	// WebSocket endpoint
@@ -181,7 +309,7 @@ func (s *HTTPServer) registerPageRoutes() {
 
 // Start starts the HTTP server
 func (s *HTTPServer) Start() error {
-	serverAddr := ":" + s.port
+	serverAddr := ":" + s.config.Port
 	log.Printf("[INFO] Server starting on http://localhost%s", serverAddr)
 	fmt.Printf("Server running on http://localhost%s\nTo stop the server press Ctrl+C\n", serverAddr)
 
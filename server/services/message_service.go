@@ -2,6 +2,7 @@ package services
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
@@ -9,9 +10,17 @@ import (
 	"connecthub/database"
 )
 
+// ConversationNotifier tells connected clients about changes to a
+// conversation. *websocket.Manager satisfies it.
+type ConversationNotifier interface {
+	AnnounceConversationLeft(conversationID, userID int, remaining []int)
+	AnnounceConversationDeleted(conversationID, deletedBy int, participants []int)
+}
+
 // MessageService handles message and conversation-related business logic
 type MessageService struct {
-	db *sql.DB
+	db       *sql.DB
+	notifier ConversationNotifier
 }
 
 // NewMessageService creates a new MessageService instance
@@ -19,6 +28,12 @@ func NewMessageService(db *sql.DB) *MessageService {
 	return &MessageService{db: db}
 }
 
+// SetNotifier sets where conversation changes are announced. Without one the
+// service still makes the changes but nobody is told live.
+func (s *MessageService) SetNotifier(notifier ConversationNotifier) {
+	s.notifier = notifier
+}
+
 // SendMessage sends a message to a conversation with validation
 func (s *MessageService) SendMessage(conversationID, senderID int, content string) (*database.Message, error) {
 	log.Printf("[DEBUG] MessageService: Sending message to conversation %d from user %d", conversationID, senderID)
@@ -72,18 +87,6 @@ func (s *MessageService) GetConversationMessages(conversationID, userID, limit,
 		return nil, fmt.Errorf("invalid user ID")
 	}
 
-	// Verify user is participant in conversation
-	isParticipant, err := s.isUserParticipant(conversationID, userID)
-	if err != nil {
-		log.Printf("[ERROR] MessageService: Failed to verify participant: %v", err)
-		return nil, fmt.Errorf("failed to verify conversation access")
-	}
-
-	if !isParticipant {
-		log.Printf("[WARN] MessageService: User %d not authorized for conversation %d", userID, conversationID)
-		return nil, fmt.Errorf("user not authorized for this conversation")
-	}
-
 	// Set default pagination values
 	if limit <= 0 {
 		limit = 50 // Increased default for better user experience
@@ -92,8 +95,12 @@ func (s *MessageService) GetConversationMessages(conversationID, userID, limit,
 		offset = 0
 	}
 
-	// Get messages
-	messages, err := database.GetConversationMessages(s.db, conversationID, limit, offset)
+	// Get messages; the database refuses users outside the conversation
+	messages, err := database.GetConversationMessagesFor(s.db, conversationID, userID, limit, offset, database.OrderNewestFirst)
+	if errors.Is(err, database.ErrNotParticipant) {
+		log.Printf("[WARN] MessageService: User %d not authorized for conversation %d", userID, conversationID)
+		return nil, fmt.Errorf("user not authorized for this conversation")
+	}
 	if err != nil {
 		log.Printf("[ERROR] MessageService: Failed to get messages: %v", err)
 		return nil, err
@@ -163,7 +170,7 @@ func (s *MessageService) CreateConversation(participants []int, currentUserID in
 	}
 
 	// Create conversation
-	conversationID, err := database.CreateConversation(participants)
+	conversationID, err := database.CreateConversationAs(s.db, currentUserID, participants)
 	if err != nil {
 		log.Printf("[ERROR] MessageService: Failed to create conversation: %v", err)
 		return 0, err
@@ -242,8 +249,63 @@ func (s *MessageService) MarkMessagesAsRead(conversationID, userID int) error {
 	return nil
 }
 
+// DeleteConversation deletes a conversation for every participant on behalf of
+// userID and announces it to the others. Only participants may delete it:
+// anyone else gets database.ErrNotParticipant, or database.ErrConversationNotFound
+// if there is no such conversation. In a group only the creator deletes it for
+// everyone; any other member leaves it instead, and the rest are told they
+// left. Administrative removal of content does not go through here.
+func (s *MessageService) DeleteConversation(conversationID, userID int) error {
+	log.Printf("[DEBUG] MessageService: User %d deleting conversation %d", userID, conversationID)
+
+	if conversationID <= 0 {
+		return fmt.Errorf("invalid conversation ID")
+	}
+
+	if userID <= 0 {
+		return fmt.Errorf("invalid user ID")
+	}
+
+	participants, err := database.DeleteConversation(s.db, conversationID, userID)
+	if errors.Is(err, database.ErrNotConversationCreator) {
+		return s.leaveConversation(conversationID, userID)
+	}
+	if errors.Is(err, database.ErrNotParticipant) {
+		log.Printf("[WARN] MessageService: User %d not authorized to delete conversation %d: %v", userID, conversationID, err)
+		return err
+	}
+	if err != nil {
+		log.Printf("[ERROR] MessageService: Failed to delete conversation %d: %v", conversationID, err)
+		return err
+	}
+
+	if s.notifier != nil {
+		s.notifier.AnnounceConversationDeleted(conversationID, userID, participants)
+	}
+
+	log.Printf("[INFO] MessageService: User %d deleted conversation %d", userID, conversationID)
+	return nil
+}
+
 // Helper methods
 
+// leaveConversation removes userID from a group they asked to delete but did
+// not create, and tells the remaining members
+func (s *MessageService) leaveConversation(conversationID, userID int) error {
+	remaining, err := database.LeaveConversation(s.db, conversationID, userID)
+	if err != nil {
+		log.Printf("[ERROR] MessageService: User %d failed to leave conversation %d: %v", userID, conversationID, err)
+		return err
+	}
+
+	if s.notifier != nil {
+		s.notifier.AnnounceConversationLeft(conversationID, userID, remaining)
+	}
+
+	log.Printf("[INFO] MessageService: User %d left group conversation %d instead of deleting it", userID, conversationID)
+	return nil
+}
+
 // isUserParticipant checks if a user is a participant in a conversation
 func (s *MessageService) isUserParticipant(conversationID, userID int) (bool, error) {
 	log.Printf("[DEBUG] MessageService: Checking if user %d is participant in conversation %d", userID, conversationID)
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"log"
+
+	"connecthub/database"
+	"connecthub/repository"
+)
+
+// NotificationService handles notification-related business logic
+type NotificationService struct {
+	notificationRepo repository.NotificationRepository
+}
+
+// NewNotificationService creates a new NotificationService instance
+func NewNotificationService(notificationRepo repository.NotificationRepository) *NotificationService {
+	return &NotificationService{notificationRepo: notificationRepo}
+}
+
+// Notify records a notification for userID. Users are never notified about
+// their own actions, so an actor notifying themselves is a no-op returning nil.
+func (s *NotificationService) Notify(userID int, notificationType string, postID, actorID int) (*database.Notification, error) {
+	if userID <= 0 {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	if notificationType == "" {
+		return nil, fmt.Errorf("notification type is required")
+	}
+	if actorID == userID {
+		log.Printf("[DEBUG] NotificationService: Skipping self-notification for user %d", userID)
+		return nil, nil
+	}
+
+	return s.notificationRepo.Create(userID, notificationType, postID, actorID)
+}
+
+// GetNotifications returns a page of the user's notifications
+func (s *NotificationService) GetNotifications(userID, limit, offset int) ([]database.Notification, error) {
+	if userID <= 0 {
+		return nil, fmt.Errorf("invalid user ID")
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	notifications, err := s.notificationRepo.List(userID, limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] NotificationService: Failed to list notifications for user %d: %v", userID, err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] NotificationService: Retrieved %d notifications for user %d", len(notifications), userID)
+	return notifications, nil
+}
+
+// MarkRead marks one of the user's notifications read. Returns sql.ErrNoRows
+// if the notification is not theirs.
+func (s *NotificationService) MarkRead(userID, notificationID int) error {
+	if userID <= 0 || notificationID <= 0 {
+		return fmt.Errorf("invalid user or notification ID")
+	}
+	return s.notificationRepo.MarkRead(userID, notificationID)
+}
+
+// UnreadCount counts the user's unread notifications
+func (s *NotificationService) UnreadCount(userID int) (int, error) {
+	if userID <= 0 {
+		return 0, fmt.Errorf("invalid user ID")
+	}
+	return s.notificationRepo.UnreadCount(userID)
+}
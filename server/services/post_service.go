@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"connecthub/database"
 )
@@ -107,11 +109,11 @@ func (s *PostService) GetPostsByUser(userID int) ([]database.Post, error) {
 	return posts, nil
 }
 
-// GetLikedPostsByUser retrieves posts liked by a specific user
-func (s *PostService) GetLikedPostsByUser(userID int) ([]database.Post, error) {
+// GetLikedPostsByUser retrieves a page of posts liked by a specific user
+func (s *PostService) GetLikedPostsByUser(userID, limit, offset int) ([]database.Post, error) {
 	log.Printf("[DEBUG] PostService: Getting liked posts by user ID: %d", userID)
 
-	posts, err := database.GetLikedPostsByUser(s.db, userID)
+	posts, err := database.GetLikedPostsByUser(s.db, userID, limit, offset)
 	if err != nil {
 		log.Printf("[ERROR] PostService: Failed to get liked posts by user: %v", err)
 		return nil, err
@@ -121,6 +123,20 @@ func (s *PostService) GetLikedPostsByUser(userID int) ([]database.Post, error) {
 	return posts, nil
 }
 
+// GetCommentedPostsByUser retrieves a page of posts a specific user has commented on
+func (s *PostService) GetCommentedPostsByUser(userID, limit, offset int) ([]database.Post, error) {
+	log.Printf("[DEBUG] PostService: Getting commented posts by user ID: %d", userID)
+
+	posts, err := database.GetUserCommentedPosts(s.db, userID, "newest", limit, offset)
+	if err != nil {
+		log.Printf("[ERROR] PostService: Failed to get commented posts by user: %v", err)
+		return nil, err
+	}
+
+	log.Printf("[INFO] PostService: Retrieved %d commented posts for user ID: %d", len(posts), userID)
+	return posts, nil
+}
+
 // GetPostByID retrieves a single post by its ID
 func (s *PostService) GetPostByID(postID int) (database.Post, error) {
 	log.Printf("[DEBUG] PostService: Getting post by ID: %d", postID)
@@ -187,9 +203,11 @@ func (s *PostService) CreatePost(userID int, title, content string, categories [
 			return 0, fmt.Errorf("failed to validate categories")
 		}
 
+		// Categories may be referenced by name or by ID
 		validCategoryNames := make(map[string]bool)
 		for _, cat := range validCategories {
 			validCategoryNames[cat.Name] = true
+			validCategoryNames[strconv.Itoa(cat.ID)] = true
 		}
 
 		for _, category := range categories {
@@ -220,12 +238,12 @@ func (s *PostService) AddComment(postID, userID int, content string) error {
 		return fmt.Errorf("comment content is required. Please write your comment")
 	}
 
-	if len(content) > 1000 {
-		return fmt.Errorf("comment is too long. Please keep it under 1,000 characters")
+	if utf8.RuneCountInString(content) > database.MaxCommentLength {
+		return fmt.Errorf("comment is too long. Please keep it under 2,000 characters")
 	}
 
-	// Verify post exists
-	_, err := database.GetPostByID(s.db, postID)
+	// Verify post exists and the commenter can see it
+	_, err := database.GetPostByIDForViewer(s.db, postID, userID)
 	if err != nil {
 		log.Printf("[ERROR] PostService: Post not found: %v", err)
 		return fmt.Errorf("the post you're trying to comment on was not found. It may have been deleted")
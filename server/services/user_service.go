@@ -1,9 +1,11 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"strings"
 
 	"connecthub/database"
 	"connecthub/repository"
@@ -15,6 +17,70 @@ type UserService struct {
 	userRepo repository.UserRepository
 }
 
+// ErrMissingCredentials is returned when a login request omits the identifier or password
+var ErrMissingCredentials = errors.New("missing credentials")
+
+// ErrInvalidUsername is returned when a username is malformed or reserved
+var ErrInvalidUsername = errors.New("invalid username")
+
+// usernamePattern limits usernames to 3-20 letters, digits and underscores so
+// they are safe in URLs and @mentions
+var usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_]{3,20}$`)
+
+// reservedUsernames cannot be registered because they name routes, roles or
+// placeholders. Matching ignores case.
+var reservedUsernames = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"moderator":     true,
+	"system":        true,
+	"support":       true,
+	"root":          true,
+	"me":            true,
+	"deleted":       true,
+	"anonymous":     true,
+}
+
+// configuredReservedUsernames holds names reserved by configuration on top of
+// reservedUsernames, such as the admin names; see ReserveUsernames
+var configuredReservedUsernames = map[string]bool{}
+
+// ReserveUsernames replaces the names reserved by configuration. Matching
+// ignores case.
+func ReserveUsernames(usernames []string) {
+	configuredReservedUsernames = make(map[string]bool, len(usernames))
+	for _, name := range usernames {
+		configuredReservedUsernames[strings.ToLower(name)] = true
+	}
+}
+
+// userError carries a user-facing message while still matching its sentinel via errors.Is
+type userError struct {
+	message string
+	kind    error
+}
+
+func (e *userError) Error() string { return e.message }
+func (e *userError) Unwrap() error { return e.kind }
+
+// ValidationErrors maps each invalid signup field, named as in the signup
+// request, to a user-facing message. It satisfies error, so callers that only
+// check err != nil keep working.
+type ValidationErrors map[string]string
+
+// validationFieldOrder fixes the order fields are reported in by Error
+var validationFieldOrder = []string{"firstName", "lastName", "username", "email", "password"}
+
+func (v ValidationErrors) Error() string {
+	messages := make([]string, 0, len(v))
+	for _, field := range validationFieldOrder {
+		if msg, ok := v[field]; ok {
+			messages = append(messages, msg)
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
 // NewUserService creates a new UserService instance
 func NewUserService(userRepo repository.UserRepository) *UserService {
 	return &UserService{userRepo: userRepo}
@@ -22,34 +88,39 @@ func NewUserService(userRepo repository.UserRepository) *UserService {
 
 // AuthenticateUser validates user credentials and returns user data
 func (s *UserService) AuthenticateUser(identifier, password string) (*database.User, error) {
+	identifier = strings.TrimSpace(identifier)
 	log.Printf("[DEBUG] UserService: Authenticating user with identifier: %s", maskIdentifier(identifier))
 
 	if identifier == "" {
-		return nil, fmt.Errorf("username or email is required. Please enter your username or email address")
+		return nil, &userError{"username or email is required. Please enter your username or email address", ErrMissingCredentials}
 	}
 	if password == "" {
-		return nil, fmt.Errorf("password is required. Please enter your password")
+		return nil, &userError{"password is required. Please enter your password", ErrMissingCredentials}
 	}
 
 	user, err := s.userRepo.AuthenticateUser(identifier, password)
 	if err != nil {
+		if !errors.Is(err, database.ErrInvalidCredentials) {
+			log.Printf("[ERROR] UserService: Authentication error for %s: %v", maskIdentifier(identifier), err)
+			return nil, fmt.Errorf("authentication failed: %w", err)
+		}
 		log.Printf("[WARN] UserService: Authentication failed for %s: %v", maskIdentifier(identifier), err)
 
 		// Check if user exists to provide more specific error message
 		if s.isValidEmail(identifier) {
 			emailExists, _ := s.userRepo.EmailExists(identifier)
 			if !emailExists {
-				return nil, fmt.Errorf("we couldn't find an account with that email address. Would you like to sign up instead?")
+				return nil, &userError{"we couldn't find an account with that email address. Would you like to sign up instead?", database.ErrInvalidCredentials}
 			}
 		} else {
 			usernameExists, _ := s.userRepo.UsernameExists(identifier)
 			if !usernameExists {
-				return nil, fmt.Errorf("we couldn't find an account with that username. Would you like to sign up instead?")
+				return nil, &userError{"we couldn't find an account with that username. Would you like to sign up instead?", database.ErrInvalidCredentials}
 			}
 		}
 
 		// If user exists but authentication failed, it's likely a password issue
-		return nil, fmt.Errorf("the password you entered is incorrect. Please try again or reset your password if you've forgotten it")
+		return nil, &userError{"the password you entered is incorrect. Please try again or reset your password if you've forgotten it", database.ErrInvalidCredentials}
 	}
 
 	log.Printf("[INFO] UserService: User authenticated successfully: %s (ID: %d)", user.Username, user.ID)
@@ -80,59 +151,60 @@ func (s *UserService) CreateUserSession(userID int) (string, error) {
 
 // RegisterUser creates a new user account with validation
 func (s *UserService) RegisterUser(firstName, lastName, username, email, gender, dateOfBirth, password string) (int, error) {
+	username = strings.TrimSpace(username)
+	email = strings.TrimSpace(email)
 	log.Printf("[DEBUG] UserService: Registering new user: %s (%s)", username, email)
 
-	// Validate required fields with specific error messages
+	// Collect every problem so the signup form can flag each field at once
+	errs := ValidationErrors{}
 	if firstName == "" {
-		return 0, fmt.Errorf("first name is required. Please enter your first name")
+		errs["firstName"] = "first name is required. Please enter your first name"
 	}
 	if lastName == "" {
-		return 0, fmt.Errorf("last name is required. Please enter your last name")
+		errs["lastName"] = "last name is required. Please enter your last name"
 	}
 	if username == "" {
-		return 0, fmt.Errorf("username is required. Please choose a username")
+		errs["username"] = "username is required. Please choose a username"
+	} else if err := ValidateUsername(username); err != nil {
+		log.Printf("[WARN] UserService: Rejected username %q: %v", username, err)
+		errs["username"] = err.Error()
 	}
 	if email == "" {
-		return 0, fmt.Errorf("email address is required. Please enter your email address")
-	}
-	if password == "" {
-		return 0, fmt.Errorf("password is required. Please enter your password")
-	}
-
-	// Validate email format
-	if !s.isValidEmail(email) {
+		errs["email"] = "email address is required. Please enter your email address"
+	} else if !s.isValidEmail(email) {
 		log.Printf("[WARN] UserService: Invalid email format: %s", email)
-		return 0, fmt.Errorf("please enter a valid email address (e.g., user@example.com)")
-	}
-
-	// Validate username format
-	if !s.isValidUsername(username) {
-		log.Printf("[WARN] UserService: Invalid username format: %s", username)
-		return 0, fmt.Errorf("username must be 3-20 characters long and contain only letters, numbers, and underscores")
+		errs["email"] = "please enter a valid email address (e.g., user@example.com)"
 	}
-
-	// Check if user already exists with specific error messages
-	exists, err := s.userRepo.UserExists(username, email)
-	if err != nil {
-		log.Printf("[ERROR] UserService: Failed to check user existence: %v", err)
-		return 0, fmt.Errorf("we're experiencing technical difficulties. Please try again in a moment")
+	if password == "" {
+		errs["password"] = "password is required. Please enter your password"
 	}
-	if exists {
-		// Check which field already exists for more specific error
-		emailExists, _ := s.userRepo.EmailExists(email)
-		usernameExists, _ := s.userRepo.UsernameExists(username)
 
-		if emailExists {
-			log.Printf("[WARN] UserService: Email already exists: %s", email)
-			return 0, fmt.Errorf("an account with this email already exists. Try logging in instead, or use a different email address")
+	// Only well-formed identifiers are worth checking for duplicates
+	if _, bad := errs["username"]; !bad {
+		taken, err := s.userRepo.UsernameExists(username)
+		if err != nil {
+			log.Printf("[ERROR] UserService: Failed to check username availability: %v", err)
+			return 0, fmt.Errorf("we're experiencing technical difficulties. Please try again in a moment")
 		}
-		if usernameExists {
+		if taken {
 			log.Printf("[WARN] UserService: Username already exists: %s", username)
-			return 0, fmt.Errorf("this username is already taken. Please choose a different username")
+			errs["username"] = "this username is already taken. Please choose a different username"
+		}
+	}
+	if _, bad := errs["email"]; !bad {
+		taken, err := s.userRepo.EmailExists(email)
+		if err != nil {
+			log.Printf("[ERROR] UserService: Failed to check email availability: %v", err)
+			return 0, fmt.Errorf("we're experiencing technical difficulties. Please try again in a moment")
+		}
+		if taken {
+			log.Printf("[WARN] UserService: Email already exists: %s", email)
+			errs["email"] = "an account with this email already exists. Try logging in instead, or use a different email address"
 		}
+	}
 
-		log.Printf("[WARN] UserService: User already exists: %s", username)
-		return 0, fmt.Errorf("an account with this information already exists. Please check your details")
+	if len(errs) > 0 {
+		return 0, errs
 	}
 
 	// Create user
@@ -178,10 +250,17 @@ func (s *UserService) isValidEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
-// isValidUsername validates username format using regex
-func (s *UserService) isValidUsername(username string) bool {
-	usernameRegex := regexp.MustCompile(`^[a-zA-Z0-9_]{3,20}$`)
-	return usernameRegex.MatchString(username)
+// ValidateUsername checks that a username is 3-20 letters, digits or
+// underscores and is not reserved. The returned error carries a user-facing
+// message and matches ErrInvalidUsername.
+func ValidateUsername(username string) error {
+	if !usernamePattern.MatchString(username) {
+		return &userError{"username must be 3-20 characters long and contain only letters, numbers, and underscores", ErrInvalidUsername}
+	}
+	if reservedUsernames[strings.ToLower(username)] || configuredReservedUsernames[strings.ToLower(username)] {
+		return &userError{"this username is reserved. Please choose a different username", ErrInvalidUsername}
+	}
+	return nil
 }
 
 // maskIdentifier masks an identifier for logging purposes
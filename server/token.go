@@ -1,6 +1,7 @@
 package server
 
 import (
+	"connecthub/database"
 	"database/sql"
 	UUID "connecthub/security"
 	"log"
@@ -13,7 +14,7 @@ func CreateSession(w http.ResponseWriter, r *http.Request, userID int) {
 	clientIP := getClientIP(r)
 	log.Printf("[DEBUG] Creating new session for user ID %d from %s", userID, clientIP)
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed during session creation for user %d: %v", userID, err)
 		errData := NewErrorData("500", "Internal Server Error")
@@ -50,7 +51,7 @@ func CreateSession(w http.ResponseWriter, r *http.Request, userID int) {
 		return
 	}
 
-	sessionExpiry := time.Now().Add(24 * time.Hour)
+	sessionExpiry := time.Now().Add(sessionTTL)
 
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_token",
@@ -133,7 +134,7 @@ func DeleteSession(w http.ResponseWriter, r *http.Request, sessionToken string)
 	maskedToken := maskSessionToken(sessionToken)
 	log.Printf("[DEBUG] Deleting session %s from %s", maskedToken, clientIP)
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed during session deletion: %v", err)
 		return
@@ -202,7 +203,7 @@ func ValidateSession(r *http.Request) (bool, int, string) {
 	sessionToken := sessionCookie.Value
 	maskedToken := maskSessionToken(sessionToken)
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] Database connection failed during session validation: %v", err)
 		return false, 0, ""
@@ -3,13 +3,18 @@ package server
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
 	"time"
 
+	"connecthub/database"
+	"connecthub/paging"
 	"connecthub/repository"
 	"connecthub/server/services"
+	"connecthub/websocket"
 )
 
 // User-related request/response types
@@ -19,16 +24,18 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Success     bool   `json:"success"`
-	UserID      int    `json:"user_id,omitempty"`
-	Username    string `json:"username,omitempty"`
-	Email       string `json:"email,omitempty"`
-	FirstName   string `json:"firstName,omitempty"`
-	LastName    string `json:"lastName,omitempty"`
-	Gender      string `json:"gender,omitempty"`
-	DateOfBirth string `json:"dateOfBirth,omitempty"`
-	Avatar      string `json:"avatar,omitempty"`
-	Error       string `json:"error,omitempty"`
+	Success             bool   `json:"success"`
+	UserID              int    `json:"user_id,omitempty"`
+	Username            string `json:"username,omitempty"`
+	Email               string `json:"email,omitempty"`
+	FirstName           string `json:"firstName,omitempty"`
+	LastName            string `json:"lastName,omitempty"`
+	Gender              string `json:"gender,omitempty"`
+	DateOfBirth         string `json:"dateOfBirth,omitempty"`
+	Avatar              string `json:"avatar,omitempty"`
+	UnreadMessages      int    `json:"unread_messages"`
+	UnreadNotifications int    `json:"unread_notifications"`
+	Error               string `json:"error,omitempty"`
 }
 
 type SignupRequest struct {
@@ -54,6 +61,12 @@ type SignupResponse struct {
 	Error       string `json:"error,omitempty"`
 }
 
+// AvailabilityResponse reports whether a username and/or email can still be registered
+type AvailabilityResponse struct {
+	UsernameAvailable *bool `json:"username_available,omitempty"`
+	EmailAvailable    *bool `json:"email_available,omitempty"`
+}
+
 // LoginAPI handles POST /api/login
 func LoginAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -68,14 +81,12 @@ func LoginAPI(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] LoginAPI: Processing login request from %s", clientIP)
 
 	var loginReq LoginRequest
-	if err := json.NewDecoder(r.Body).Decode(&loginReq); err != nil {
-		log.Printf("[ERROR] LoginAPI: Failed to decode login request from %s: %v", clientIP, err)
-		WriteAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+	if !decodeJSONBody(w, r, &loginReq) {
 		return
 	}
 
 	// Open database connection
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] LoginAPI: Database connection failed during login: %v", err)
 		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Internal server error")
@@ -90,6 +101,16 @@ func LoginAPI(w http.ResponseWriter, r *http.Request) {
 	// Authenticate user using service
 	user, err := userService.AuthenticateUser(loginReq.Identifier, loginReq.Password)
 	if err != nil {
+		if errors.Is(err, services.ErrMissingCredentials) {
+			log.Printf("[WARN] LoginAPI: Missing credentials from %s", clientIP)
+			WriteAPIError(w, http.StatusBadRequest, "MISSING_CREDENTIALS", err.Error())
+			return
+		}
+		if !errors.Is(err, database.ErrInvalidCredentials) {
+			log.Printf("[ERROR] LoginAPI: Authentication error for %s from %s: %v", loginReq.Identifier, clientIP, err)
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Internal server error")
+			return
+		}
 		log.Printf("[WARN] LoginAPI: Authentication failed for %s from %s: %v", loginReq.Identifier, clientIP, err)
 
 		// Use the enhanced error message from the service
@@ -117,7 +138,7 @@ func LoginAPI(w http.ResponseWriter, r *http.Request) {
 		Name:     "session_token",
 		Value:    sessionToken,
 		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(sessionTTL),
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
@@ -128,18 +149,30 @@ func LoginAPI(w http.ResponseWriter, r *http.Request) {
 		avatarStr = user.Avatar.String
 	}
 
+	// Badge counts are a convenience; failing to load them should not fail the login
+	unreadMessages, err := database.GetTotalUnreadCount(db, user.ID)
+	if err != nil {
+		log.Printf("[WARN] LoginAPI: Failed to count unread messages for user %d: %v", user.ID, err)
+	}
+	unreadNotifications, err := database.GetUnreadNotificationCount(db, user.ID)
+	if err != nil {
+		log.Printf("[WARN] LoginAPI: Failed to count unread notifications for user %d: %v", user.ID, err)
+	}
+
 	log.Printf("[INFO] LoginAPI: User logged in successfully: %s (ID: %d)", user.Username, user.ID)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(LoginResponse{
-		Success:     true,
-		UserID:      user.ID,
-		Username:    user.Username,
-		Email:       loginReq.Identifier,
-		FirstName:   user.FirstName,
-		LastName:    user.LastName,
-		Gender:      user.Gender,
-		DateOfBirth: user.DateOfBirth,
-		Avatar:      avatarStr,
+		Success:             true,
+		UserID:              user.ID,
+		Username:            user.Username,
+		Email:               user.Email,
+		FirstName:           user.FirstName,
+		LastName:            user.LastName,
+		Gender:              user.Gender,
+		DateOfBirth:         user.DateOfBirth,
+		Avatar:              avatarStr,
+		UnreadMessages:      unreadMessages,
+		UnreadNotifications: unreadNotifications,
 	})
 }
 
@@ -157,14 +190,12 @@ func SignupAPI(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[INFO] SignupAPI: Processing signup request from %s", clientIP)
 
 	var req SignupRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		log.Printf("[WARN] SignupAPI: Invalid JSON from %s: %v", clientIP, err)
-		WriteAPIError(w, http.StatusBadRequest, "INVALID_JSON", "Invalid request format")
+	if !decodeJSONBody(w, r, &req) {
 		return
 	}
 
 	// Open database connection
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] SignupAPI: Database connection failed: %v", err)
 		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
@@ -178,32 +209,32 @@ func SignupAPI(w http.ResponseWriter, r *http.Request) {
 
 	// Register user using service (includes validation)
 	userID, err := userService.RegisterUser(req.FirstName, req.LastName, req.Username, req.Email, req.Gender, req.DateOfBirth, req.Password)
-	if err != nil {
-		log.Printf("[WARN] SignupAPI: Registration failed from %s: %v", clientIP, err)
+	var fieldErrs services.ValidationErrors
+	if errors.As(err, &fieldErrs) {
+		log.Printf("[WARN] SignupAPI: Registration from %s failed validation: %v", clientIP, err)
 
-		// Determine appropriate status code and error code based on enhanced error messages
-		statusCode := http.StatusBadRequest
+		// The code describes the first problem so older clients still get a specific message
+		errorMessage := fieldErrs.Error()
+		first := strings.SplitN(errorMessage, "; ", 2)[0]
 		errorCode := "VALIDATION_ERROR"
-		errorMessage := err.Error()
-
-		if strings.Contains(errorMessage, "email already exists") {
-			statusCode = http.StatusConflict
+		if strings.Contains(first, "email already exists") {
 			errorCode = "EMAIL_EXISTS"
-		} else if strings.Contains(errorMessage, "username is already taken") {
-			statusCode = http.StatusConflict
+		} else if strings.Contains(first, "username is already taken") {
 			errorCode = "USERNAME_EXISTS"
-		} else if strings.Contains(errorMessage, "technical difficulties") {
-			statusCode = http.StatusInternalServerError
-			errorCode = "DATABASE_ERROR"
-		} else if strings.Contains(errorMessage, "required") {
+		} else if strings.Contains(first, "required") {
 			errorCode = "MISSING_FIELD"
-		} else if strings.Contains(errorMessage, "valid email") {
+		} else if strings.Contains(first, "valid email") {
 			errorCode = "INVALID_EMAIL"
-		} else if strings.Contains(errorMessage, "username must be") {
+		} else if strings.Contains(first, "username must be") {
 			errorCode = "INVALID_USERNAME"
 		}
 
-		WriteAPIError(w, statusCode, errorCode, errorMessage)
+		WriteValidationErrors(w, errorCode, fieldErrs, errorMessage)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] SignupAPI: Registration failed from %s: %v", clientIP, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", err.Error())
 		return
 	}
 
@@ -236,7 +267,7 @@ func SignupAPI(w http.ResponseWriter, r *http.Request) {
 		Name:     "session_token",
 		Value:    sessionToken,
 		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
+		Expires:  time.Now().Add(sessionTTL),
 		HttpOnly: true,
 		SameSite: http.SameSiteStrictMode,
 	})
@@ -296,7 +327,7 @@ func LogoutAPI(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Connect to database to clear session
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] LogoutAPI: Database connection failed: %v", err)
 		// Still clear cookie even if database fails
@@ -345,9 +376,68 @@ func LogoutAPI(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// LogoutAllAPI handles POST /api/logout-all, ending every session the user
+// holds and closing their open chat connections
+func LogoutAllAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] LogoutAllAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] LogoutAllAPI: Invalid session: %v", err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	if err := database.RevokeAllSessions(db, userID); err != nil {
+		log.Printf("[ERROR] LogoutAllAPI: Failed to revoke sessions of user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to log out")
+		return
+	}
+
+	disconnected := 0
+	if globalWSManager != nil {
+		disconnected = globalWSManager.DisconnectUser(userID)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "session_token",
+		Value:    "",
+		Path:     "/",
+		Expires:  time.Now().Add(-time.Hour),
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	log.Printf("[INFO] LogoutAllAPI: User %d logged out everywhere, %d connections closed", userID, disconnected)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": "Logged out of every session",
+	})
+}
+
 // GetUsers handles GET /api/users
 func GetUsers(w http.ResponseWriter, r *http.Request) {
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetUsers: Database connection failed: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -371,6 +461,164 @@ func GetUsers(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(users)
 }
 
+const (
+	userSearchPageSize    = 10
+	maxUserSearchPageSize = 50
+)
+
+// maxUserBatchSize caps how many distinct ids one /api/users/batch request may ask for
+const maxUserBatchSize = 200
+
+// UsersBatchRequest is the body of POST /api/users/batch
+type UsersBatchRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// UserSearchResult is one entry in the "start a chat with…" picker, and the
+// public summary returned by batch lookups
+type UserSearchResult struct {
+	ID        int    `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Avatar    string `json:"avatar"`
+}
+
+// SearchUsersAPI handles GET /api/users/search?q=
+func SearchUsersAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	limit, _ := paging.ParseWith(r, userSearchPageSize, maxUserSearchPageSize)
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] SearchUsersAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] SearchUsersAPI: Invalid session %s: %v", maskSessionToken(sessionCookie.Value), err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	users, err := database.SearchUsersFor(db, userID, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		log.Printf("[ERROR] SearchUsersAPI: Search failed for user %d: %v", userID, err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to search users")
+		return
+	}
+
+	results := make([]UserSearchResult, 0, len(users))
+	for _, user := range users {
+		results = append(results, UserSearchResult{
+			ID:        user.ID,
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Avatar:    user.Avatar.String,
+		})
+	}
+
+	json.NewEncoder(w).Encode(results)
+}
+
+// GetUsersBatchAPI handles POST /api/users/batch, returning the public details
+// of every listed user in one call. Repeated ids are returned once and unknown
+// ids are left out.
+func GetUsersBatchAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "POST" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	var req UsersBatchRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	seen := make(map[int]bool, len(req.IDs))
+	ids := make([]int, 0, len(req.IDs))
+	for _, id := range req.IDs {
+		if id > 0 && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > maxUserBatchSize {
+		WriteAPIError(w, http.StatusBadRequest, "VALIDATION_ERROR", fmt.Sprintf("At most %d users can be looked up at once", maxUserBatchSize))
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] GetUsersBatchAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	users, err := database.GetUsersByIDs(db, ids)
+	if err != nil {
+		log.Printf("[ERROR] GetUsersBatchAPI: Loading %d users failed: %v", len(ids), err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load users")
+		return
+	}
+
+	results := make([]UserSearchResult, 0, len(users))
+	for _, user := range users {
+		results = append(results, UserSearchResult{
+			ID:        user.ID,
+			Username:  user.Username,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Avatar:    user.Avatar.String,
+		})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "users": results})
+}
+
+// GetOnlineUsersAPI handles GET /api/users/online
+func GetOnlineUsersAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	users := []websocket.OnlineUser{}
+	if globalWSManager != nil {
+		online, err := globalWSManager.GetOnlineUsersDetailed()
+		if err != nil {
+			log.Printf("[ERROR] GetOnlineUsersAPI: Failed to load online users: %v", err)
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load online users")
+			return
+		}
+		users = online
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "users": users})
+}
+
 // GetCurrentUser handles GET /api/user/current
 func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	clientIP := getClientIP(r)
@@ -382,7 +630,7 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	db, err := sql.Open("sqlite3", "./database/main.db")
+	db, err := sql.Open("sqlite3", database.Path())
 	if err != nil {
 		log.Printf("[ERROR] GetCurrentUser: Database connection error: %v", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -420,5 +668,162 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 		"lastName":    user.LastName,
 		"gender":      user.Gender,
 		"dateOfBirth": user.DateOfBirth,
+		"createdAt":   user.CreatedAt,
 	})
 }
+
+// CheckAvailabilityAPI handles GET /api/check-availability
+func CheckAvailabilityAPI(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	username := strings.TrimSpace(r.URL.Query().Get("username"))
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	if username == "" && email == "" {
+		WriteAPIError(w, http.StatusBadRequest, "MISSING_PARAMETER", "Provide a username or email to check")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] CheckAvailabilityAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Internal server error")
+		return
+	}
+	defer db.Close()
+
+	userRepo := repository.NewUserRepository(db)
+	var response AvailabilityResponse
+
+	if username != "" {
+		taken, err := userRepo.UsernameExists(username)
+		if err != nil {
+			log.Printf("[ERROR] CheckAvailabilityAPI: Username check failed: %v", err)
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Internal server error")
+			return
+		}
+		available := !taken
+		response.UsernameAvailable = &available
+	}
+
+	if email != "" {
+		taken, err := userRepo.EmailExists(email)
+		if err != nil {
+			log.Printf("[ERROR] CheckAvailabilityAPI: Email check failed: %v", err)
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Internal server error")
+			return
+		}
+		available := !taken
+		response.EmailAvailable = &available
+	}
+
+	log.Printf("[INFO] CheckAvailabilityAPI: Availability checked from %s", clientIP)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// ExportUserDataAPI handles GET /api/user/export, streaming the signed-in
+// user's data as a downloadable JSON document
+func ExportUserDataAPI(w http.ResponseWriter, r *http.Request) {
+	clientIP := getClientIP(r)
+
+	if r.Method != "GET" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		log.Printf("[WARN] ExportUserDataAPI: No session cookie from %s: %v", clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] ExportUserDataAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] ExportUserDataAPI: Invalid session %s from %s: %v", maskSessionToken(sessionCookie.Value), clientIP, err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="connecthub-export.json"`)
+
+	// Once streaming starts the status is committed, so a failure can only be logged
+	if err := database.WriteUserData(db, userID, w); err != nil {
+		log.Printf("[ERROR] ExportUserDataAPI: Export for user %d failed: %v", userID, err)
+		return
+	}
+
+	log.Printf("[INFO] ExportUserDataAPI: Exported data for user %d to %s", userID, clientIP)
+}
+
+// UserPrivacyAPI handles GET and PUT /api/user/privacy. PUT accepts any subset
+// of the settings; fields left out keep their current value.
+func UserPrivacyAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if r.Method != "GET" && r.Method != "PUT" {
+		WriteAPIError(w, http.StatusMethodNotAllowed, "METHOD_NOT_ALLOWED", "Method not allowed")
+		return
+	}
+
+	sessionCookie, err := r.Cookie("session_token")
+	if err != nil {
+		WriteAPIError(w, http.StatusUnauthorized, "UNAUTHORIZED", "Unauthorized")
+		return
+	}
+
+	db, err := sql.Open("sqlite3", database.Path())
+	if err != nil {
+		log.Printf("[ERROR] UserPrivacyAPI: Database connection failed: %v", err)
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Database connection failed")
+		return
+	}
+	defer db.Close()
+
+	var userID int
+	err = db.QueryRow("SELECT userid FROM user WHERE current_session = ?", sessionCookie.Value).Scan(&userID)
+	if err != nil {
+		log.Printf("[WARN] UserPrivacyAPI: Invalid session %s: %v", maskSessionToken(sessionCookie.Value), err)
+		WriteAPIError(w, http.StatusUnauthorized, "INVALID_SESSION", "Invalid session")
+		return
+	}
+
+	privacy, err := database.GetUserPrivacy(db, userID)
+	if err != nil {
+		WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to load privacy settings")
+		return
+	}
+
+	if r.Method == "PUT" {
+		if !decodeJSONBody(w, r, &privacy) {
+			return
+		}
+
+		err := database.SetUserPrivacy(db, userID, privacy)
+		if errors.Is(err, database.ErrInvalidPrivacy) {
+			WriteAPIError(w, http.StatusBadRequest, "VALIDATION_ERROR", err.Error())
+			return
+		}
+		if err != nil {
+			WriteAPIError(w, http.StatusInternalServerError, "DATABASE_ERROR", "Failed to save privacy settings")
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "privacy": privacy})
+}
@@ -5,6 +5,9 @@ import (
 	"log"
 	"net/http"
 	"strings"
+
+	"connecthub/logutil"
+	"connecthub/version"
 )
 
 // maskSessionToken masks a session token for logging purposes to avoid exposing sensitive information.
@@ -25,19 +28,9 @@ func getClientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
-// truncateContent shortens content for logging to avoid overly long log entries.
-func truncateContent(content string) string {
-	if len(content) > 50 {
-		return content[:47] + "..."
-	}
-	return content
-}
-
 // sanitizeSearchQuery sanitizes a search query for safe logging and display.
 func sanitizeSearchQuery(query string) string {
-	if len(query) > 100 {
-		query = query[:97] + "..."
-	}
+	query = logutil.Truncate(query, 100)
 
 	query = strings.Replace(query, "\n", " ", -1)
 	query = strings.Replace(query, "\r", " ", -1)
@@ -50,6 +43,8 @@ type APIError struct {
 	Success bool   `json:"success"`
 	Error   string `json:"error"`
 	Code    string `json:"code,omitempty"`
+	// Fields maps form fields to their problems when a submission fails validation
+	Fields map[string]string `json:"fields,omitempty"`
 }
 
 // APISuccess represents a standardized API success response
@@ -78,6 +73,24 @@ func WriteAPIError(w http.ResponseWriter, statusCode int, errorCode, errorMessag
 	}
 }
 
+// WriteValidationErrors responds with 422 and a message for each invalid field
+func WriteValidationErrors(w http.ResponseWriter, errorCode string, fields map[string]string, summary string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+
+	log.Printf("[API_ERROR] %s (%s): %s", errorCode, http.StatusText(http.StatusUnprocessableEntity), summary)
+
+	response := APIError{
+		Success: false,
+		Error:   summary,
+		Code:    errorCode,
+		Fields:  fields,
+	}
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		log.Printf("[ERROR] Failed to encode API error response: %v", err)
+	}
+}
+
 // WriteAPISuccess writes a standardized success response to the client
 func WriteAPISuccess(w http.ResponseWriter, data interface{}, message string) {
 	w.Header().Set("Content-Type", "application/json")
@@ -94,3 +107,9 @@ func WriteAPISuccess(w http.ResponseWriter, data interface{}, message string) {
 		WriteAPIError(w, http.StatusInternalServerError, "ENCODING_ERROR", "Failed to encode response")
 	}
 }
+
+// VersionAPI handles GET /api/version, reporting which build is running
+func VersionAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
@@ -8,6 +8,9 @@ import { showEnhancedInlineError, showErrorToast } from './error.js';
 
 const defaultAvatarPath = "/static/assets/default-avatar.png";
 
+// Message envelope version this client speaks; must match the server's ProtocolVersion
+const PROTOCOL_VERSION = 1;
+
 let currentUser = null;
 let currentConversation = null;
 let conversations = [];
@@ -481,6 +484,7 @@ class WebSocketConnectionManager {
         if (message.type === 'status') {
           message.type = 'user_status';
         }
+        message.v = PROTOCOL_VERSION;
         this.socket.send(JSON.stringify(message));
         console.debug('[WSManager] Message sent:', message.type);
         return true;
@@ -1675,6 +1679,20 @@ function handleWebSocketMessage(data) {
         console.warn("[Chat] Malformed read status data:", data);
       }
       break;
+    case "delivery_receipt":
+      // Let the chat view switch the message to its delivered tick
+      window.dispatchEvent(new CustomEvent('delivery-receipt', {
+        detail: {
+          conversationId: data.conversation_id,
+          messageId: data.message_id,
+          deliveredAt: data.timestamp
+        }
+      }));
+      break;
+    case "new_post":
+      // Let the feed offer a "new posts available" banner
+      window.dispatchEvent(new CustomEvent('new-post', { detail: data.content }));
+      break;
     default:
       console.warn(`[Chat] Unhandled WebSocket message type: ${data.type}`);
   }
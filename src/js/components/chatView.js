@@ -98,6 +98,16 @@ export function initChatView() {
             console.debug('[ChatView] Updated message status indicators for current conversation');
         }
     });
+
+    // Switch a sent message to its delivered tick once the recipient has it
+    window.addEventListener('delivery-receipt', (event) => {
+        const { conversationId, messageId, deliveredAt } = event.detail;
+        console.debug('[ChatView] Received delivery-receipt event for message:', messageId);
+
+        if (conversationId === currentChatConversationId) {
+            updateMessageStatusToDelivered(messageId, deliveredAt);
+        }
+    });
     
     // Add event listeners for the chat view
     const closeButton = document.getElementById('chat-view-close');
@@ -953,6 +963,12 @@ function generateStatusIndicatorHTML(message) {
     </div>`;
   }
 
+  if (message.delivered_at) {
+    return `<div class="message-status" data-message-id="${message.id}">
+      <i class="fas fa-check-double unread" title="Delivered"></i>
+    </div>`;
+  }
+
   // Default: sent but not read
   return `<div class="message-status" data-message-id="${message.id}">
     <i class="fas fa-check unread" title="Sent"></i>
@@ -1808,7 +1824,7 @@ export function updateMessageStatusIndicators(conversationId, messageIds = []) {
 /**
  * ENHANCED: Update a single message status indicator with animation
  * @param {HTMLElement} statusElement - The status element to update
- * @param {string} newStatus - The new status ('pending', 'sent', 'read', 'error')
+ * @param {string} newStatus - The new status ('pending', 'sent', 'delivered', 'read', 'error')
  */
 function updateSingleMessageStatus(statusElement, newStatus) {
   const statusIcon = statusElement.querySelector('i');
@@ -1834,6 +1850,10 @@ function updateSingleMessageStatus(statusElement, newStatus) {
       statusIcon.className = 'fas fa-check unread';
       statusIcon.title = 'Sent';
       break;
+    case 'delivered':
+      statusIcon.className = 'fas fa-check-double unread';
+      statusIcon.title = 'Delivered';
+      break;
     case 'read':
       statusIcon.className = 'fas fa-check-double read';
       statusIcon.title = 'Read';
@@ -1888,6 +1908,26 @@ export function updateMessageStatusToSent(messageId) {
   }
 }
 
+/**
+ * Update a sent message to delivered, unless it has already been read
+ * @param {number} messageId - The message ID
+ * @param {string} deliveredAt - When the recipient received it
+ */
+export function updateMessageStatusToDelivered(messageId, deliveredAt) {
+  const message = messages.find(m => m.id === messageId);
+  if (message) {
+    message.delivered_at = deliveredAt;
+    if (message.is_read) {
+      return;
+    }
+  }
+
+  const statusElement = document.querySelector(`.message-status[data-message-id="${messageId}"]`);
+  if (statusElement && !statusElement.querySelector('.read')) {
+    updateSingleMessageStatus(statusElement, 'delivered');
+  }
+}
+
 /**
  * ENHANCED: Update message status to error state
  * @param {string} messageId - The message ID
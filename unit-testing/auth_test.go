@@ -1,10 +1,17 @@
 package unit_testing
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"connecthub/repository"
+	"connecthub/server"
 	"connecthub/server/services"
 )
 
@@ -556,3 +563,64 @@ func TestUserDataValidation(t *testing.T) {
 		AssertNoError(t, err, "Valid names should pass")
 	})
 }
+
+func TestRegisterUserValidationErrors(t *testing.T) {
+	db := AppTestSetup(t)
+	userService := services.NewUserService(repository.NewUserRepository(db))
+
+	_, err := userService.RegisterUser("Taken", "Name", "takenname", "taken@example.com", "male", "1990-01-01", "password123")
+	AssertNoError(t, err, "Seed registration should succeed")
+
+	fieldErrors := func(err error) services.ValidationErrors {
+		t.Helper()
+		var verrs services.ValidationErrors
+		if !errors.As(err, &verrs) {
+			t.Fatalf("Expected ValidationErrors, got %v", err)
+		}
+		return verrs
+	}
+
+	t.Run("InvalidEmail", func(t *testing.T) {
+		_, err := userService.RegisterUser("Test", "User", "emailcase", "not-an-email", "male", "1990-01-01", "password123")
+		verrs := fieldErrors(err)
+		AssertEqual(t, 1, len(verrs), "Only the email should be flagged")
+		AssertTrue(t, strings.Contains(verrs["email"], "valid email"), "Email field should explain the format problem")
+	})
+
+	t.Run("EmptyFirstName", func(t *testing.T) {
+		_, err := userService.RegisterUser("", "User", "namecase", "name@example.com", "male", "1990-01-01", "password123")
+		verrs := fieldErrors(err)
+		AssertEqual(t, 1, len(verrs), "Only the first name should be flagged")
+		AssertTrue(t, strings.Contains(verrs["firstName"], "first name is required"), "First name field should be reported as required")
+	})
+
+	t.Run("DuplicateUsername", func(t *testing.T) {
+		_, err := userService.RegisterUser("Test", "User", "TakenName", "fresh@example.com", "male", "1990-01-01", "password123")
+		verrs := fieldErrors(err)
+		AssertEqual(t, 1, len(verrs), "Only the username should be flagged")
+		AssertTrue(t, strings.Contains(verrs["username"], "already taken"), "Username field should report the duplicate")
+	})
+
+	t.Run("SeveralFieldsAtOnce", func(t *testing.T) {
+		_, err := userService.RegisterUser("", "", "takenname", "taken@example.com", "male", "1990-01-01", "password123")
+		verrs := fieldErrors(err)
+		AssertEqual(t, 4, len(verrs), "Every invalid field should be reported together")
+		AssertTrue(t, strings.HasPrefix(err.Error(), "first name is required"), "Error should still read as a single message")
+	})
+
+	t.Run("SignupAPIReturns422", func(t *testing.T) {
+		body, _ := json.Marshal(server.SignupRequest{
+			FirstName: "", LastName: "User", Username: "apicase", Email: "bad-email",
+			Gender: "male", DateOfBirth: "1990-01-01", Password: "password123",
+		})
+		w := httptest.NewRecorder()
+		server.SignupAPI(w, httptest.NewRequest("POST", "/api/signup", bytes.NewBuffer(body)))
+		AssertEqual(t, http.StatusUnprocessableEntity, w.Code, "Validation failures should return 422")
+
+		var response server.APIError
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal error response")
+		AssertEqual(t, "MISSING_FIELD", response.Code, "Code should describe the first problem")
+		AssertEqual(t, 2, len(response.Fields), "Each invalid field should be listed")
+		AssertTrue(t, response.Fields["firstName"] != "" && response.Fields["email"] != "", "First name and email should both be flagged")
+	})
+}
@@ -1,13 +1,24 @@
 package unit_testing
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"connecthub/database"
 	"connecthub/repository"
+	"connecthub/server"
 	"connecthub/server/services"
+	chat "connecthub/websocket"
 )
 
 func TestCommentCreation(t *testing.T) {
@@ -350,3 +361,306 @@ func TestCommentRepository(t *testing.T) {
 		AssertTrue(t, repoCommentCount >= 3, "Should have at least 3 repository comments")
 	})
 }
+
+func TestCommentPagination(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	postID, err := database.CreatePost(db, userID, "Popular Post", "Lots of replies", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	for i := 1; i <= 30; i++ {
+		err := database.AddComment(db, postID, userID, fmt.Sprintf("Comment %d", i))
+		AssertNoError(t, err, "Failed to add comment")
+	}
+
+	t.Run("FirstPage", func(t *testing.T) {
+		comments, total, err := database.GetCommentsForPostPaginated(db, postID, 20, 0)
+		AssertNoError(t, err, "Should retrieve first page")
+		AssertEqual(t, 30, total, "Total should count all comments")
+		AssertEqual(t, 20, len(comments), "First page should be full")
+		AssertEqual(t, "Comment 1", comments[0].Content, "Oldest comment should come first")
+		AssertEqual(t, "Comment 20", comments[19].Content, "First page should end at comment 20")
+	})
+
+	t.Run("LastPage", func(t *testing.T) {
+		comments, total, err := database.GetCommentsForPostPaginated(db, postID, 20, 20)
+		AssertNoError(t, err, "Should retrieve last page")
+		AssertEqual(t, 30, total, "Total should not depend on offset")
+		AssertEqual(t, 10, len(comments), "Last page should hold the remainder")
+		AssertEqual(t, "Comment 21", comments[0].Content, "Last page should start at comment 21")
+		AssertEqual(t, "Comment 30", comments[9].Content, "Last page should end at comment 30")
+	})
+
+	t.Run("PastEnd", func(t *testing.T) {
+		comments, total, err := database.GetCommentsForPostPaginated(db, postID, 20, 40)
+		AssertNoError(t, err, "Should handle offset past the end")
+		AssertEqual(t, 30, total, "Total should still be reported")
+		AssertEqual(t, 0, len(comments), "No comments past the end")
+	})
+
+	t.Run("DeletedNotCounted", func(t *testing.T) {
+		comments, _, err := database.GetCommentsForPostPaginated(db, postID, 20, 0)
+		AssertNoError(t, err, "Should retrieve first page")
+		AssertNoError(t, database.DeleteComment(db, comments[0].ID, userID), "Failed to delete comment")
+
+		comments, total, err := database.GetCommentsForPostPaginated(db, postID, 20, 0)
+		AssertNoError(t, err, "Should retrieve first page")
+		AssertEqual(t, 29, total, "Total should leave out deleted comments")
+		AssertEqual(t, 20, len(comments), "The page should keep the tombstone")
+		AssertTrue(t, comments[0].IsDeleted, "The deleted comment should come back as a tombstone")
+	})
+}
+
+func TestCommentEditAndDelete(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, other := userIDs[0], userIDs[1]
+
+	postID, err := database.CreatePost(db, author, "Discussion", "Share your thoughts", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	for _, content := range []string{"First thought", "Second thought"} {
+		AssertNoError(t, database.AddComment(db, postID, author, content), "Failed to add comment")
+	}
+	comments, err := database.GetCommentsForPost(db, postID)
+	AssertNoError(t, err, "Failed to load comments")
+	commentID := comments[0].ID
+
+	t.Run("OwnershipRejected", func(t *testing.T) {
+		err := database.EditComment(db, commentID, other, "Hijacked")
+		AssertTrue(t, errors.Is(err, database.ErrNotCommentOwner), "Editing someone else's comment should be rejected")
+
+		err = database.DeleteComment(db, commentID, other)
+		AssertTrue(t, errors.Is(err, database.ErrNotCommentOwner), "Deleting someone else's comment should be rejected")
+
+		body, _ := json.Marshal(server.EditCommentRequest{CommentID: commentID, Content: "Hijacked"})
+		req := httptest.NewRequest("POST", "/api/comment/edit", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, other)})
+		w := httptest.NewRecorder()
+		server.EditCommentAPI(w, req)
+		AssertEqual(t, http.StatusForbidden, w.Code, "Edit endpoint should refuse non-authors")
+	})
+
+	t.Run("EditStampsComment", func(t *testing.T) {
+		AssertNoError(t, database.EditComment(db, commentID, author, "First thought, revised"), "Author should be able to edit")
+
+		comments, err := database.GetCommentsForPost(db, postID)
+		AssertNoError(t, err, "Failed to load comments")
+		AssertEqual(t, "First thought, revised", comments[0].Content, "Content should be updated")
+		AssertTrue(t, comments[0].EditedAt != nil, "Edited comment should carry edited_at")
+		AssertTrue(t, comments[1].EditedAt == nil, "Untouched comment should not carry edited_at")
+	})
+
+	t.Run("DeleteUpdatesCount", func(t *testing.T) {
+		req := httptest.NewRequest("POST", fmt.Sprintf("/api/comment/delete?id=%d", commentID), nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, author)})
+		w := httptest.NewRecorder()
+		server.DeleteCommentAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Author should be able to delete")
+
+		post, err := database.GetPostByID(db, postID)
+		AssertNoError(t, err, "Failed to load post")
+		AssertEqual(t, 1, post.Comments, "Deleted comment should not count towards the post")
+
+		comments, err := database.GetCommentsForPost(db, postID)
+		AssertNoError(t, err, "Failed to load comments")
+		AssertEqual(t, 2, len(comments), "Deleted comment should remain as a tombstone")
+		AssertTrue(t, comments[0].IsDeleted, "Tombstone should be marked deleted")
+		AssertEqual(t, database.DeletedCommentPlaceholder, comments[0].Content, "Tombstone should hide the content")
+
+		err = database.EditComment(db, commentID, author, "Back again")
+		AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Deleted comments should not be editable")
+	})
+}
+
+func TestCommentNotificationBatching(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	postID, err := database.CreatePost(db, author, "Hot Topic", "Discuss", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	clock := time.Now()
+	database.SetClock(func() time.Time { return clock })
+	t.Cleanup(func() { database.SetClock(nil) })
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+	authorConn := hub.Connect(t, author)
+
+	comment := func(userID int, content string) {
+		form := url.Values{"post_id": {strconv.Itoa(postID)}, "content": {content}}
+		req := httptest.NewRequest("POST", "/addcomment", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.AddComment(w, req)
+		AssertEqual(t, http.StatusSeeOther, w.Code, "Commenting should succeed")
+	}
+
+	comment(userIDs[1], "First")
+	clock = clock.Add(30 * time.Second)
+	comment(userIDs[2], "Second")
+	clock = clock.Add(30 * time.Second)
+	comment(userIDs[3], "Third")
+	comment(author, "Thanks all")
+
+	pushes := CollectHubMessages(authorConn, chat.MessageTypeNotification, 500*time.Millisecond)
+	AssertEqual(t, 1, len(pushes), "A burst of comments should push a single notification")
+
+	notifications, err := database.GetNotifications(db, author, 0, 0)
+	AssertNoError(t, err, "Failed to load notifications")
+	AssertEqual(t, 1, len(notifications), "Comments within the window should share one notification")
+	AssertEqual(t, 3, notifications[0].Count, "The notification should count every comment but the author's own")
+	AssertEqual(t, userIDs[3], notifications[0].ActorID, "The latest commenter should be recorded")
+	AssertEqual(t, "3 new comments on your post", notifications[0].Message, "The message should report the count")
+
+	t.Run("AfterWindowStartsNewBatch", func(t *testing.T) {
+		// The first connection's read deadline has passed, so listen on a fresh one
+		freshConn := hub.Connect(t, author)
+		clock = clock.Add(database.CommentBatchWindow)
+		comment(userIDs[1], "Back again")
+
+		pushes := CollectHubMessages(freshConn, chat.MessageTypeNotification, 500*time.Millisecond)
+		AssertEqual(t, 1, len(pushes), "A comment after the window should push again")
+
+		notifications, err := database.GetNotifications(db, author, 0, 0)
+		AssertNoError(t, err, "Failed to load notifications")
+		AssertEqual(t, 2, len(notifications), "A comment after the window should start a new notification")
+		AssertEqual(t, 1, notifications[0].Count, "The new notification should start at one")
+		AssertEqual(t, 3, notifications[1].Count, "The earlier batch should be unchanged")
+	})
+
+	t.Run("ListedOverAPI", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/notifications", nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, author)})
+		w := httptest.NewRecorder()
+		server.NotificationsAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Listing notifications should succeed")
+
+		var response struct {
+			Notifications []database.Notification `json:"notifications"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal notifications")
+		AssertEqual(t, 2, len(response.Notifications), "Both batches should be listed")
+	})
+}
+
+func TestGetCommentByID(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, commenter := userIDs[0], userIDs[1]
+
+	postID, err := database.CreatePost(db, author, "Deep links", "Link to a comment", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+	AssertNoError(t, database.AddComment(db, postID, commenter, "Worth linking to"), "Failed to add comment")
+	comments, err := database.GetCommentsForPost(db, postID)
+	AssertNoError(t, err, "Failed to load comments")
+	commentID := comments[0].ID
+
+	t.Run("Database", func(t *testing.T) {
+		comment, err := database.GetCommentByID(db, commentID)
+		AssertNoError(t, err, "Comment should load")
+		AssertEqual(t, postID, comment.PostID, "Comment should carry its post id")
+		AssertEqual(t, "Worth linking to", comment.Content, "Content should match")
+		AssertEqual(t, UserFixtures[1].Username, comment.Username, "Author username should be populated")
+		AssertEqual(t, UserFixtures[1].FirstName, comment.FirstName, "Author first name should be populated")
+		AssertEqual(t, UserFixtures[1].Avatar, comment.Avatar.String, "Author avatar should be populated")
+
+		_, err = database.GetCommentByID(db, commentID+100)
+		AssertTrue(t, errors.Is(err, sql.ErrNoRows), "A missing comment should report sql.ErrNoRows")
+	})
+
+	get := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.GetCommentAPI(w, httptest.NewRequest("GET", "/api/comment?id="+id, nil))
+		return w
+	}
+
+	t.Run("Endpoint", func(t *testing.T) {
+		w := get(strconv.Itoa(commentID))
+		AssertEqual(t, http.StatusOK, w.Code, "Existing comment should be returned")
+
+		var response struct {
+			PostID  int                    `json:"post_id"`
+			Comment map[string]interface{} `json:"comment"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode response")
+		AssertEqual(t, postID, response.PostID, "Response should name the post")
+		AssertEqual(t, UserFixtures[1].Username, response.Comment["Username"], "Author should be included")
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		AssertEqual(t, http.StatusNotFound, get(strconv.Itoa(commentID+100)).Code, "Missing comment should be 404")
+		AssertEqual(t, http.StatusBadRequest, get("abc").Code, "Malformed id should be 400")
+	})
+}
+
+func TestCommentAvatarFallback(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, commenter := userIDs[0], userIDs[1]
+
+	_, err = db.Exec("UPDATE user SET Avatar = NULL WHERE userid = ?", commenter)
+	AssertNoError(t, err, "Failed to clear avatar")
+
+	postID, err := database.CreatePost(db, author, "Avatars", "Everyone gets one", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+	AssertNoError(t, database.AddComment(db, postID, commenter, "No picture here"), "Failed to add comment")
+
+	w := httptest.NewRecorder()
+	server.GetPostByID(w, httptest.NewRequest("GET", "/api/post?id="+strconv.Itoa(postID), nil))
+	AssertEqual(t, http.StatusOK, w.Code, "Post should load")
+
+	var response struct {
+		Comments []struct {
+			Avatar struct {
+				String string
+				Valid  bool
+			}
+		} `json:"comments"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode response")
+	AssertEqual(t, 1, len(response.Comments), "The comment should be listed")
+	AssertTrue(t, response.Comments[0].Avatar.Valid, "A missing avatar should be filled in")
+	AssertEqual(t, database.AvatarForGender(UserFixtures[1].Gender), response.Comments[0].Avatar.String,
+		"The commenter's default avatar should be used")
+}
+
+func TestDuplicateCommentDebounce(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	commenter := userIDs[1]
+
+	postID, err := database.CreatePost(db, userIDs[0], "Debounce", "Comment once", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	AssertNoError(t, database.AddComment(db, postID, commenter, "First!"), "The first comment should be added")
+
+	err = database.AddComment(db, postID, commenter, "First!")
+	AssertTrue(t, errors.Is(err, database.ErrDuplicateComment), "Repeating the comment straight away should be rejected")
+
+	AssertNoError(t, database.AddComment(db, postID, commenter, "Second thought"), "Different text should be allowed")
+	AssertNoError(t, database.AddComment(db, postID, userIDs[2], "First!"), "Another user may post the same text")
+
+	// Once the earlier comment is older than the window it may be repeated
+	earlier := time.Now().Add(-database.DuplicateCommentWindow - time.Second).Format("2006-01-02 15:04:05")
+	_, err = db.Exec("UPDATE comment SET comment_at = ? WHERE user_userid = ?", earlier, commenter)
+	AssertNoError(t, err, "Failed to backdate comments")
+	AssertNoError(t, database.AddComment(db, postID, commenter, "First!"), "The comment should be allowed after the window")
+}
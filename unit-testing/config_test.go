@@ -0,0 +1,97 @@
+package unit_testing
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connecthub/config"
+	"connecthub/server"
+)
+
+func TestConfigLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{
+		"port": "9000",
+		"db_path": "/var/lib/connecthub/main.db",
+		"session_ttl": "2h",
+		"max_message_length": 500,
+		"allowed_origins": ["https://file.example.com"]
+	}`), 0644)
+	AssertNoError(t, err, "Failed to write config file")
+
+	t.Run("Defaults", func(t *testing.T) {
+		cfg, err := config.Load("")
+		AssertNoError(t, err, "Loading without a file should succeed")
+		AssertEqual(t, config.Default().Port, cfg.Port, "Port should fall back to the default")
+		AssertEqual(t, "./database/main.db", cfg.DBPath, "DB path should fall back to the default")
+	})
+
+	t.Run("FileValues", func(t *testing.T) {
+		cfg, err := config.Load(path)
+		AssertNoError(t, err, "Loading the config file should succeed")
+		AssertEqual(t, "9000", cfg.Port, "Port should come from the file")
+		AssertEqual(t, 2*time.Hour, time.Duration(cfg.SessionTTL), "Session TTL should come from the file")
+		AssertEqual(t, config.Default().BcryptCost, cfg.BcryptCost, "Settings missing from the file keep their defaults")
+	})
+
+	t.Setenv("CONNECTHUB_PORT", "9100")
+	t.Setenv("CONNECTHUB_SESSION_TTL", "3h")
+	t.Setenv("CONNECTHUB_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := config.Load(path)
+	AssertNoError(t, err, "Loading with environment overrides should succeed")
+
+	t.Run("EnvOverridesFile", func(t *testing.T) {
+		AssertEqual(t, "9100", cfg.Port, "Environment should override the file port")
+		AssertEqual(t, 3*time.Hour, time.Duration(cfg.SessionTTL), "Environment should override the file session TTL")
+		AssertEqual(t, 2, len(cfg.AllowedOrigins), "Environment origins should replace the file list")
+		AssertEqual(t, 500, cfg.MaxMessageLength, "File values without an override should be kept")
+	})
+
+	t.Run("FlagsOverrideEnv", func(t *testing.T) {
+		fs := flag.NewFlagSet("connecthub", flag.ContinueOnError)
+		fs.String("port", "8080", "")
+		fs.Duration("session-ttl", 24*time.Hour, "")
+		AssertNoError(t, fs.Parse([]string{"-port", "9200"}), "Failed to parse flags")
+
+		flagged := cfg
+		AssertNoError(t, flagged.ApplyFlags(fs), "Applying flags should succeed")
+		AssertEqual(t, "9200", flagged.Port, "An explicit flag should override the environment")
+		AssertEqual(t, 3*time.Hour, time.Duration(flagged.SessionTTL), "An unset flag's default should not override the environment")
+	})
+
+	t.Run("InvalidValues", func(t *testing.T) {
+		t.Setenv("CONNECTHUB_BCRYPT_COST", "not-a-number")
+		_, err := config.Load(path)
+		AssertError(t, err, "A malformed environment value should be rejected")
+
+		t.Setenv("CONNECTHUB_BCRYPT_COST", "99")
+		_, err = config.Load(path)
+		AssertError(t, err, "An out-of-range bcrypt cost should be rejected")
+
+		_, err = config.Load(filepath.Join(t.TempDir(), "missing.json"))
+		AssertError(t, err, "A missing config file should be reported")
+	})
+}
+
+func TestVersionAPI(t *testing.T) {
+	req := httptest.NewRequest("GET", "/api/version", nil)
+	w := httptest.NewRecorder()
+	server.VersionAPI(w, req)
+
+	AssertEqual(t, http.StatusOK, w.Code, "Version should be served")
+	AssertEqual(t, "application/json", w.Header().Get("Content-Type"), "Version should be JSON")
+
+	var info map[string]string
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &info), "Failed to unmarshal version")
+	for _, key := range []string{"version", "commit", "go_version"} {
+		AssertTrue(t, info[key] != "", key+" should be set")
+	}
+	AssertEqual(t, "dev", info["version"], "Unstamped builds should report dev")
+}
@@ -7,6 +7,7 @@ import (
 
 	"connecthub/database"
 	"connecthub/repository"
+	"connecthub/server/services"
 )
 
 func TestDatabaseConnection(t *testing.T) {
@@ -282,7 +283,7 @@ func TestConversationDatabaseOperations(t *testing.T) {
 	t.Run("CreateConversation", func(t *testing.T) {
 		// Create conversation
 		participants := []int{userIDs[0], userIDs[1]}
-		conversationID, err := database.CreateConversation(participants)
+		conversationID, err := database.CreateConversation(testDB.DB, participants)
 		AssertNoError(t, err, "Conversation creation should succeed")
 		AssertTrue(t, conversationID > 0, "Conversation ID should be positive")
 
@@ -301,7 +302,7 @@ func TestConversationDatabaseOperations(t *testing.T) {
 	t.Run("AddMessageToConversation", func(t *testing.T) {
 		// Create conversation first
 		participants := []int{userIDs[0], userIDs[1]}
-		conversationID, err := database.CreateConversation(participants)
+		conversationID, err := database.CreateConversation(testDB.DB, participants)
 		AssertNoError(t, err, "Conversation creation should succeed")
 
 		// Add message
@@ -317,7 +318,7 @@ func TestConversationDatabaseOperations(t *testing.T) {
 	t.Run("GetConversationMessages", func(t *testing.T) {
 		// Create conversation and messages
 		participants := []int{userIDs[0], userIDs[1]}
-		conversationID, err := database.CreateConversation(participants)
+		conversationID, err := database.CreateConversation(testDB.DB, participants)
 		AssertNoError(t, err, "Conversation creation should succeed")
 
 		// Add multiple messages
@@ -344,11 +345,11 @@ func TestConversationDatabaseOperations(t *testing.T) {
 	t.Run("GetUserConversations", func(t *testing.T) {
 		// Create multiple conversations for a user
 		conv1Participants := []int{userIDs[0], userIDs[1]}
-		conv1ID, err := database.CreateConversation(conv1Participants)
+		conv1ID, err := database.CreateConversation(testDB.DB, conv1Participants)
 		AssertNoError(t, err, "First conversation creation should succeed")
 
 		conv2Participants := []int{userIDs[0], userIDs[2]}
-		conv2ID, err := database.CreateConversation(conv2Participants)
+		conv2ID, err := database.CreateConversation(testDB.DB, conv2Participants)
 		AssertNoError(t, err, "Second conversation creation should succeed")
 
 		// Get user conversations
@@ -576,28 +577,80 @@ func TestDataIntegrity(t *testing.T) {
 	})
 
 	t.Run("TransactionIntegrity", func(t *testing.T) {
+		// Category links live in post_has_categories, which only the app schema has
+		db := AppTestSetup(t)
+
+		// The categories below are created on the fly, which must be opted into
+		database.SetAllowAdHocCategories(true)
+		t.Cleanup(func() { database.SetAllowAdHocCategories(false) })
+
 		// Test that operations are atomic
-		userID, err := database.CreateUser(testDB.DB, "Transaction", "Test", "transactiontest", "transaction@example.com",
+		userID, err := database.CreateUser(db, "Transaction", "Test", "transactiontest", "transaction@example.com",
 			"male", "1990-01-01", "password123")
 		AssertNoError(t, err, "User creation should succeed")
 
 		// Create post with categories (this involves multiple table inserts)
-		postID, err := database.CreatePost(testDB.DB, userID, "Transaction Post", "Transaction test post",
+		postID, err := database.CreatePost(db, userID, "Transaction Post", "Transaction test post",
 			[]string{"Category1", "Category2", "Category3"})
 		AssertNoError(t, err, "Post creation with categories should succeed")
 
 		// Verify all categories were created and linked
 		var categoryCount int
-		err = testDB.DB.QueryRow("SELECT COUNT(*) FROM post_categories WHERE post_id = ?", postID).Scan(&categoryCount)
+		err = db.QueryRow("SELECT COUNT(*) FROM post_has_categories WHERE post_postid = ?", postID).Scan(&categoryCount)
 		AssertNoError(t, err, "Should be able to query post categories")
-		AssertEqual(t, categoryCount, 3, "Should have 3 category links")
+		AssertEqual(t, 3, categoryCount, "Should have 3 category links")
 
 		// Verify categories exist
 		for i := 1; i <= 3; i++ {
 			var count int
-			err = testDB.DB.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", fmt.Sprintf("Category%d", i)).Scan(&count)
+			err = db.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", fmt.Sprintf("Category%d", i)).Scan(&count)
 			AssertNoError(t, err, "Should be able to query category")
-			AssertEqual(t, count, 1, fmt.Sprintf("Category%d should exist", i))
+			AssertEqual(t, 1, count, fmt.Sprintf("Category%d should exist", i))
 		}
 	})
 }
+
+func TestSeedFixtures(t *testing.T) {
+	db := AppTestSetup(t)
+
+	AssertNoError(t, database.SeedFixtures(db), "Fixtures should seed an empty database")
+
+	t.Run("UsersHaveStableIDs", func(t *testing.T) {
+		for _, fixture := range database.FixtureUsers {
+			user, err := database.GetUserByID(db, fixture.ID)
+			AssertNoError(t, err, fmt.Sprintf("Fixture user %d should exist", fixture.ID))
+			AssertEqual(t, fixture.Username, user.Username, "Fixture user should have the expected username")
+		}
+	})
+
+	t.Run("PasswordsAuthenticate", func(t *testing.T) {
+		userService := services.NewUserService(repository.NewUserRepository(db))
+		for _, fixture := range UserFixtures {
+			user, err := userService.AuthenticateUser(fixture.Username, fixture.Password)
+			AssertNoError(t, err, "Fixture password should authenticate "+fixture.Username)
+			AssertEqual(t, fixture.Email, user.Email, "Authenticated user should match the fixture")
+		}
+	})
+
+	t.Run("ContentSeeded", func(t *testing.T) {
+		count := func(query string) int {
+			var n int
+			AssertNoError(t, db.QueryRow(query).Scan(&n), "Count should succeed")
+			return n
+		}
+		AssertEqual(t, len(database.FixturePosts), count("SELECT COUNT(*) FROM post"), "Every fixture post should exist")
+		AssertEqual(t, len(database.FixtureComments), count("SELECT COUNT(*) FROM comment"), "Every fixture comment should exist")
+		AssertEqual(t, len(database.FixtureConversations), count("SELECT COUNT(*) FROM conversation"), "Every fixture conversation should exist")
+
+		post, err := database.GetPostBySlug(db, database.Slugify(database.FixturePosts[0].Title))
+		AssertNoError(t, err, "Fixture posts should be reachable by slug")
+		AssertEqual(t, database.FixturePosts[0].ID, post.PostID, "Slug should resolve to the fixture post")
+	})
+
+	t.Run("SecondRunIsNoOp", func(t *testing.T) {
+		AssertNoError(t, database.SeedFixtures(db), "Seeding again should not fail")
+		var users int
+		db.QueryRow("SELECT COUNT(*) FROM user").Scan(&users)
+		AssertEqual(t, len(database.FixtureUsers), users, "Seeding again should not add users")
+	})
+}
@@ -58,121 +58,57 @@ type TestMessage struct {
 	IsRead         bool
 }
 
-// UserFixtures provides predefined test users
-var UserFixtures = []TestUser{
-	{
-		FirstName:   "John",
-		LastName:    "Doe",
-		Username:    "johndoe",
-		Email:       "john@example.com",
-		Password:    "password123",
-		Gender:      "male",
-		DateOfBirth: "1990-01-01",
-		Avatar:      "/static/assets/male-avatar-boy-face-man-user-7.svg",
-	},
-	{
-		FirstName:   "Jane",
-		LastName:    "Smith",
-		Username:    "janesmith",
-		Email:       "jane@example.com",
-		Password:    "password123",
-		Gender:      "female",
-		DateOfBirth: "1992-05-15",
-		Avatar:      "/static/assets/female-avatar-girl-face-woman-user-9.svg",
-	},
-	{
-		FirstName:   "Bob",
-		LastName:    "Johnson",
-		Username:    "bobjohnson",
-		Email:       "bob@example.com",
-		Password:    "password123",
-		Gender:      "male",
-		DateOfBirth: "1988-12-10",
-		Avatar:      "/static/assets/male-avatar-boy-face-man-user-7.svg",
-	},
-	{
-		FirstName:   "Alice",
-		LastName:    "Brown",
-		Username:    "alicebrown",
-		Email:       "alice@example.com",
-		Password:    "password123",
-		Gender:      "female",
-		DateOfBirth: "1995-03-20",
-		Avatar:      "/static/assets/female-avatar-girl-face-woman-user-9.svg",
-	},
-	{
-		FirstName:   "Charlie",
-		LastName:    "Wilson",
-		Username:    "charliewilson",
-		Email:       "charlie@example.com",
-		Password:    "password123",
-		Gender:      "male",
-		DateOfBirth: "1987-08-05",
-		Avatar:      "/static/assets/male-avatar-boy-face-man-user-7.svg",
-	},
+// UserFixtures provides predefined test users. They are database.FixtureUsers,
+// so the suite and the -test-data flag share usernames and passwords.
+var UserFixtures = fixtureUsers()
+
+// PostFixtures provides predefined test posts, taken from database.FixturePosts
+var PostFixtures = fixturePosts()
+
+// CommentFixtures provides predefined test comments, taken from database.FixtureComments
+var CommentFixtures = fixtureComments()
+
+func fixtureUsers() []TestUser {
+	users := make([]TestUser, len(database.FixtureUsers))
+	for i, u := range database.FixtureUsers {
+		users[i] = TestUser{
+			FirstName:   u.FirstName,
+			LastName:    u.LastName,
+			Username:    u.Username,
+			Email:       u.Email,
+			Password:    database.FixturePassword,
+			Gender:      u.Gender,
+			DateOfBirth: u.DateOfBirth,
+			Avatar:      u.Avatar,
+		}
+	}
+	return users
 }
 
-// PostFixtures provides predefined test posts
-var PostFixtures = []TestPost{
-	{
-		Title:      "Welcome to the Forum",
-		Content:    "This is the first post on our forum! Welcome everyone!",
-		UserID:     1,
-		Categories: []string{"General"},
-	},
-	{
-		Title:      "Technology Discussion",
-		Content:    "Let's talk about the latest tech trends and innovations.",
-		UserID:     2,
-		Categories: []string{"Technology"},
-	},
-	{
-		Title:      "Sports Update",
-		Content:    "Latest sports news and updates from around the world.",
-		UserID:     3,
-		Categories: []string{"Sports"},
-	},
-	{
-		Title:      "Entertainment News",
-		Content:    "What's happening in the world of entertainment?",
-		UserID:     4,
-		Categories: []string{"Entertainment"},
-	},
-	{
-		Title:      "Science Discoveries",
-		Content:    "Amazing scientific breakthroughs and discoveries.",
-		UserID:     5,
-		Categories: []string{"Science"},
-	},
+// fixturePosts leaves PostAt unset so test posts are dated when they are created
+func fixturePosts() []TestPost {
+	posts := make([]TestPost, len(database.FixturePosts))
+	for i, p := range database.FixturePosts {
+		posts[i] = TestPost{
+			Title:      p.Title,
+			Content:    p.Content,
+			UserID:     p.UserID,
+			Categories: p.Categories,
+		}
+	}
+	return posts
 }
 
-// CommentFixtures provides predefined test comments
-var CommentFixtures = []TestComment{
-	{
-		Content: "Great post! Thanks for sharing this information.",
-		PostID:  1,
-		UserID:  2,
-	},
-	{
-		Content: "I completely agree with your points here.",
-		PostID:  1,
-		UserID:  3,
-	},
-	{
-		Content: "Very interesting topic, looking forward to more discussions.",
-		PostID:  2,
-		UserID:  1,
-	},
-	{
-		Content: "Thanks for the update! This is very helpful.",
-		PostID:  3,
-		UserID:  4,
-	},
-	{
-		Content: "Excellent analysis and well-written post.",
-		PostID:  4,
-		UserID:  5,
-	},
+func fixtureComments() []TestComment {
+	comments := make([]TestComment, len(database.FixtureComments))
+	for i, c := range database.FixtureComments {
+		comments[i] = TestComment{
+			Content: c.Content,
+			PostID:  c.PostID,
+			UserID:  c.UserID,
+		}
+	}
+	return comments
 }
 
 // CreateTestUser creates a test user in the database and returns the user ID
@@ -9,6 +9,7 @@ import (
 	"testing"
 
 	"connecthub/repository"
+	"connecthub/server"
 	"connecthub/server/services"
 )
 
@@ -333,6 +334,34 @@ func TestMessagingWorkflow(t *testing.T) {
 	})
 }
 
+func TestMessagesAccessControl(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	a, b, c := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{a, b})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/messages", server.AuthMiddleware(server.GetMessages))
+	httpHelper := NewHTTPTestHelper(mux)
+	defer httpHelper.Close()
+
+	fetch := func(userID, conversationID int) int {
+		cookie := &http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)}
+		resp, err := httpHelper.AuthenticatedRequest("GET", fmt.Sprintf("/api/messages?conversation_id=%d", conversationID), nil, cookie)
+		AssertNoError(t, err, "Request should complete")
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	AssertEqual(t, http.StatusOK, fetch(a, conversationID), "A participant should read the conversation")
+	AssertEqual(t, http.StatusForbidden, fetch(c, conversationID), "A non-participant should be refused")
+	AssertEqual(t, http.StatusNotFound, fetch(c, conversationID+1000), "An unknown conversation should be reported missing")
+}
+
 func TestEndToEndUserJourney(t *testing.T) {
 	testDB := TestSetup(t)
 
@@ -0,0 +1,30 @@
+package unit_testing
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"connecthub/logutil"
+)
+
+func TestLogTruncate(t *testing.T) {
+	AssertEqual(t, "short", logutil.Truncate("short", 10), "Short strings should be left alone")
+	AssertEqual(t, "abcdefg...", logutil.Truncate("abcdefghijklmnop", 10), "Long strings should end in an ellipsis")
+	AssertEqual(t, "whole", logutil.Truncate("whole", 0), "A non-positive max should not truncate")
+
+	// Each of these takes several bytes, so cutting by byte would split one
+	for _, s := range []string{strings.Repeat("é", 60), strings.Repeat("日本語", 30), strings.Repeat("👋🏽", 40)} {
+		for _, max := range []int{2, 10, 47, 50} {
+			got := logutil.Truncate(s, max)
+			AssertTrue(t, utf8.ValidString(got), "Truncated text should stay valid UTF-8")
+			AssertLessThanOrEqual(t, utf8.RuneCountInString(got), max, "Truncated text should fit the limit in characters")
+		}
+	}
+
+	long := strings.Repeat("ü", 80)
+	AssertEqual(t, logutil.DefaultPreviewLength, utf8.RuneCountInString(logutil.Preview(long)), "Preview should use the default length")
+	logutil.SetPreviewLength(20)
+	t.Cleanup(func() { logutil.SetPreviewLength(0) })
+	AssertEqual(t, 20, utf8.RuneCountInString(logutil.Preview(long)), "Preview should use the configured length")
+}
@@ -2,15 +2,27 @@ package unit_testing
 
 import (
 	"bytes"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"connecthub/database"
+	"connecthub/ratelimit"
 	"connecthub/server"
 	"connecthub/websocket"
+
+	"github.com/gorilla/mux"
 )
 
 func TestSendMessage(t *testing.T) {
@@ -227,13 +239,7 @@ func TestGetMessages(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.GetMessages(w, req)
 
-		AssertEqual(t, w.Code, http.StatusOK, "Expected status OK")
-
-		var messages []database.Message
-		err := json.Unmarshal(w.Body.Bytes(), &messages)
-		AssertNoError(t, err, "Failed to unmarshal messages")
-
-		AssertEqual(t, len(messages), 0, "Should return empty array for non-existent conversation")
+		AssertEqual(t, w.Code, http.StatusNotFound, "Expected status Not Found for non-existent conversation")
 	})
 
 	t.Run("GetMessagesWithPagination", func(t *testing.T) {
@@ -430,3 +436,954 @@ func TestCreateConversation(t *testing.T) {
 		AssertNotEqual(t, response.Error, "", "Error message should be present")
 	})
 }
+
+func TestSendMessageClientMsgID(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+	otherConversationID, err := CreateTestConversation(db, []int{sender, userIDs[2]})
+	AssertNoError(t, err, "Failed to create second conversation")
+
+	sessionToken := CreateAppSession(t, db, sender)
+	server.SetWebSocketManager(websocket.NewManager())
+
+	const clientMsgID = "3f1c2a8e-5b7d-4c9a-9e21-6d0b8f4a7c13"
+
+	send := func(conversationID int, clientMsgID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.SendMessageRequest{
+			ConversationID: conversationID,
+			Content:        "Sent over a flaky connection",
+			ClientMsgID:    clientMsgID,
+		})
+		req := httptest.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.SendMessageAPI(w, req)
+		return w
+	}
+
+	messageID := func(w *httptest.ResponseRecorder) int {
+		var response struct {
+			Message database.Message `json:"message"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return response.Message.ID
+	}
+
+	t.Run("RetryReturnsOriginalMessage", func(t *testing.T) {
+		first := send(conversationID, clientMsgID)
+		AssertEqual(t, http.StatusOK, first.Code, "First send should succeed")
+		retry := send(conversationID, clientMsgID)
+		AssertEqual(t, http.StatusOK, retry.Code, "Retried send should succeed")
+
+		AssertEqual(t, messageID(first), messageID(retry), "Retry should return the original message id")
+
+		var stored int
+		err := db.QueryRow("SELECT COUNT(*) FROM message WHERE client_msg_id = ?", clientMsgID).Scan(&stored)
+		AssertNoError(t, err, "Failed to count stored messages")
+		AssertEqual(t, 1, stored, "Message should be stored once")
+	})
+
+	t.Run("WithoutClientMsgID", func(t *testing.T) {
+		first := messageID(send(conversationID, ""))
+		second := messageID(send(conversationID, ""))
+		AssertNotEqual(t, first, second, "Sends without a key should not be deduplicated")
+	})
+
+	t.Run("KeyReusedInAnotherConversation", func(t *testing.T) {
+		w := send(otherConversationID, clientMsgID)
+		AssertEqual(t, http.StatusConflict, w.Code, "Reusing a key in another conversation should conflict")
+	})
+
+	t.Run("MalformedClientMsgID", func(t *testing.T) {
+		w := send(conversationID, "not a uuid; DROP TABLE message")
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Malformed keys should be rejected")
+	})
+}
+
+func TestSendMessageRequiresParticipant(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	outsider := userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{userIDs[0], userIDs[1]})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	sessionToken := CreateAppSession(t, db, outsider)
+	server.SetWebSocketManager(websocket.NewManager())
+
+	send := func(conversationID int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.SendMessageRequest{
+			ConversationID: conversationID,
+			Content:        "Let me in",
+		})
+		req := httptest.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.SendMessageAPI(w, req)
+		return w
+	}
+
+	t.Run("NonParticipant", func(t *testing.T) {
+		w := send(conversationID)
+		AssertEqual(t, http.StatusForbidden, w.Code, "Non-participants should not post into a conversation")
+
+		var stored int
+		err := db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ? AND sender_id = ?", conversationID, outsider).Scan(&stored)
+		AssertNoError(t, err, "Failed to count stored messages")
+		AssertEqual(t, 0, stored, "No message should be stored for a non-participant")
+	})
+
+	t.Run("UnknownConversation", func(t *testing.T) {
+		w := send(99999)
+		AssertEqual(t, http.StatusNotFound, w.Code, "An unknown conversation should be not found")
+	})
+}
+
+func TestSendMessageRateLimit(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	sessionToken := CreateAppSession(t, db, sender)
+	server.SetWebSocketManager(websocket.NewManager())
+
+	now := time.Now()
+	limiter := ratelimit.New(3, time.Minute)
+	limiter.SetClock(func() time.Time { return now })
+	handler := server.UserRateLimitMiddleware(limiter, server.SendMessageAPI)
+
+	send := func() *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.SendMessageRequest{
+			ConversationID: conversationID,
+			Content:        "One of many",
+		})
+		req := httptest.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("BurstIsLimited", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			AssertEqual(t, http.StatusOK, send().Code, "Sends within the limit should succeed")
+		}
+
+		w := send()
+		AssertEqual(t, http.StatusTooManyRequests, w.Code, "Sends over the limit should be rejected")
+		AssertEqual(t, "20", w.Header().Get("Retry-After"), "Retry-After should say when the next send is allowed")
+
+		var stored int
+		err := db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&stored)
+		AssertNoError(t, err, "Failed to count stored messages")
+		AssertEqual(t, 3, stored, "Rejected sends should not be stored")
+	})
+
+	t.Run("RecoversAfterWindow", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		for i := 0; i < 3; i++ {
+			AssertEqual(t, http.StatusOK, send().Code, "Sends should succeed once the window has passed")
+		}
+		AssertEqual(t, http.StatusTooManyRequests, send().Code, "A refilled bucket should hold no more than the limit")
+	})
+}
+
+func TestCreateConversationReturnsDetail(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	creator, partner := userIDs[0], userIDs[1]
+	sessionToken := CreateAppSession(t, db, creator)
+
+	create := func(participants []int) server.CreateConversationResponse {
+		body, _ := json.Marshal(server.CreateConversationRequest{Participants: participants})
+		req := httptest.NewRequest("POST", "/api/conversations", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.CreateConversationAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Conversation creation should succeed")
+
+		var response server.CreateConversationResponse
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return response
+	}
+
+	assertDetail := func(t *testing.T, response server.CreateConversationResponse) {
+		detail := response.Conversation
+		AssertTrue(t, detail != nil, "Response should include the conversation")
+		AssertEqual(t, response.ConversationID, detail.ID, "Detail should describe the returned conversation")
+		AssertFalse(t, detail.IsGroup, "A two-person conversation is not a group")
+		AssertEqual(t, 2, len(detail.Participants), "Both participants should be listed")
+
+		profiles := map[string]string{}
+		for _, p := range detail.Participants {
+			profiles[p.Username] = p.Avatar
+		}
+		for _, fixture := range UserFixtures[:2] {
+			avatar, ok := profiles[fixture.Username]
+			AssertTrue(t, ok, "Participant "+fixture.Username+" should be listed")
+			AssertEqual(t, fixture.Avatar, avatar, "Participant avatar should be included")
+		}
+	}
+
+	var first server.CreateConversationResponse
+	t.Run("NewConversation", func(t *testing.T) {
+		first = create([]int{creator, partner})
+		assertDetail(t, first)
+	})
+
+	t.Run("ExistingConversation", func(t *testing.T) {
+		again := create([]int{partner, creator})
+		AssertEqual(t, first.ConversationID, again.ConversationID, "The existing conversation should be reused")
+		assertDetail(t, again)
+	})
+
+	t.Run("GroupConversation", func(t *testing.T) {
+		group := create([]int{creator, partner, userIDs[2]})
+		AssertTrue(t, group.Conversation.IsGroup, "Three participants make a group")
+		AssertEqual(t, 3, len(group.Conversation.Participants), "All group members should be listed")
+	})
+}
+
+func TestGetConversationsPagination(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	reader := userIDs[0]
+
+	// Conversation i was last active i minutes after base; every other one
+	// ends with a message the reader has not seen.
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	conversationIDs := make([]int, 25)
+	for i := range conversationIDs {
+		other := userIDs[1+i%3]
+		conversationID, err := CreateTestConversation(db, []int{reader, other})
+		AssertNoError(t, err, "Failed to create conversation")
+		sender := reader
+		if i%2 == 0 {
+			sender = other
+		}
+		_, err = db.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at) VALUES (?, ?, ?, ?)",
+			conversationID, sender, "Message "+strconv.Itoa(i), base.Add(time.Duration(i)*time.Minute).Format("2006-01-02 15:04:05"))
+		AssertNoError(t, err, "Failed to insert message")
+		conversationIDs[i] = conversationID
+	}
+
+	session := CreateAppSession(t, db, reader)
+	fetch := func(query string) []database.Conversation {
+		req := httptest.NewRequest("GET", "/api/conversations"+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		w := httptest.NewRecorder()
+		server.GetConversations(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Listing conversations should succeed for "+query)
+
+		var conversations []database.Conversation
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &conversations), "Failed to unmarshal conversations")
+		return conversations
+	}
+
+	t.Run("AllWithoutPage", func(t *testing.T) {
+		AssertEqual(t, 25, len(fetch("")), "Without a page every conversation should be listed")
+	})
+
+	t.Run("SecondPage", func(t *testing.T) {
+		AssertEqual(t, 20, len(fetch("?page=1")), "The first page should be full")
+
+		page := fetch("?page=2")
+		AssertEqual(t, 5, len(page), "The second page should hold the remainder")
+		for i, conv := range page {
+			AssertEqual(t, conversationIDs[4-i], conv.ID, "The second page should continue in last-activity order")
+		}
+
+		AssertEqual(t, 0, len(fetch("?page=3")), "A page past the end should be empty")
+	})
+
+	t.Run("UnreadOnly", func(t *testing.T) {
+		unread := fetch("?unread_only=true")
+		AssertEqual(t, 13, len(unread), "Only conversations with unread messages should be listed")
+		for i, conv := range unread {
+			AssertEqual(t, conversationIDs[24-2*i], conv.ID, "Unread conversations should be in last-activity order")
+			AssertTrue(t, conv.UnreadCount > 0, "Every listed conversation should have unread messages")
+		}
+
+		page := fetch("?unread_only=true&page=2&limit=5")
+		AssertEqual(t, 5, len(page), "The filter should combine with pagination")
+		AssertEqual(t, conversationIDs[14], page[0].ID, "The filtered second page should start after the first five")
+	})
+
+	t.Run("InvalidPageClamped", func(t *testing.T) {
+		page := fetch("?page=-1")
+		AssertEqual(t, 20, len(page), "Pages below one should be treated as the first page")
+		AssertEqual(t, conversationIDs[24], page[0].ID, "The clamped page should start with the most recent conversation")
+	})
+}
+
+func TestMarkAllConversationsRead(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	reader := userIDs[0]
+
+	var conversationIDs []int
+	for _, sender := range userIDs[1:4] {
+		conversationID, err := CreateTestConversation(db, []int{reader, sender})
+		AssertNoError(t, err, "Failed to create conversation")
+		_, err = database.AddMessageToConversation(db, conversationID, sender, "Catch up when you can")
+		AssertNoError(t, err, "Failed to send message")
+		conversationIDs = append(conversationIDs, conversationID)
+	}
+
+	totalUnread := func() int {
+		conversations, err := database.GetUserConversations(db, reader)
+		AssertNoError(t, err, "Failed to load conversations")
+		total := 0
+		for _, conv := range conversations {
+			total += conv.UnreadCount
+			count, err := database.GetUnreadMessageCount(db, conv.ID, reader)
+			AssertNoError(t, err, "Failed to count unread messages")
+			total += count
+		}
+		return total
+	}
+	AssertEqual(t, 6, totalUnread(), "Each conversation should start with one unread message")
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	senderConn := hub.Connect(t, userIDs[1])
+
+	req := httptest.NewRequest("POST", "/api/messages/read-all", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, reader)})
+	w := httptest.NewRecorder()
+	server.MarkAllReadAPI(w, req)
+	AssertEqual(t, http.StatusOK, w.Code, "Marking all read should succeed")
+
+	var response struct {
+		Success bool `json:"success"`
+		Marked  int  `json:"marked"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+	AssertEqual(t, 3, response.Marked, "One message per conversation should be marked")
+	AssertEqual(t, 0, totalUnread(), "No conversation should have unread messages left")
+
+	status := ReadHubMessage(t, senderConn, "read_status", 2*time.Second)
+	AssertEqual(t, conversationIDs[0], status.ConversationID, "The sender should learn their conversation was read")
+
+	marked, err := database.MarkAllConversationsRead(db, reader)
+	AssertNoError(t, err, "Marking an already read inbox should not fail")
+	AssertEqual(t, 0, marked, "Nothing should be left to mark")
+}
+
+func TestSendMessageWithAttachment(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	senderToken := CreateAppSession(t, db, sender)
+	recipientToken := CreateAppSession(t, db, recipient)
+	server.SetWebSocketManager(websocket.NewManager())
+
+	pngData := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+	upload := func(sessionToken string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("file", "photo.png")
+		AssertNoError(t, err, "Failed to create form file")
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/messages/upload", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.UploadMessageAttachmentAPI(w, req)
+		return w
+	}
+
+	send := func(sessionToken string, attachments []database.Attachment) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.SendMessageRequest{
+			ConversationID: conversationID,
+			Content:        "Look at this",
+			Attachments:    attachments,
+		})
+		req := httptest.NewRequest("POST", "/api/messages", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.SendMessageAPI(w, req)
+		return w
+	}
+
+	w := upload(senderToken, pngData)
+	AssertEqual(t, http.StatusOK, w.Code, "Image upload should succeed")
+	var uploaded server.AttachmentResponse
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded), "Failed to unmarshal upload response")
+	AssertTrue(t, strings.HasPrefix(uploaded.Attachment.URL, "/static/uploads/attachments/"), "Attachment URL should point at the uploads directory")
+	AssertEqual(t, "image/png", uploaded.Attachment.Mime, "Mime type should be sniffed from the file")
+	_, err = os.Stat(filepath.Join("src", uploaded.Attachment.URL))
+	AssertNoError(t, err, "Uploaded attachment should exist on disk")
+
+	t.Run("RejectsUnsupportedType", func(t *testing.T) {
+		w := upload(senderToken, []byte("#!/bin/sh\necho not an image\n"))
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Unsupported file types should be rejected")
+	})
+
+	t.Run("OnlyUploaderCanAttach", func(t *testing.T) {
+		w := send(recipientToken, []database.Attachment{{URL: uploaded.Attachment.URL}})
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Another user's upload should not be attachable")
+	})
+
+	t.Run("SendAndRetrieve", func(t *testing.T) {
+		w := send(senderToken, []database.Attachment{{URL: uploaded.Attachment.URL}})
+		AssertEqual(t, http.StatusOK, w.Code, "Send with attachment should succeed")
+
+		var response struct {
+			Message database.Message `json:"message"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal send response")
+		AssertEqual(t, 1, len(response.Message.Attachments), "Sent message should carry its attachment")
+
+		messages, err := database.GetConversationMessages(db, conversationID, 10, 0)
+		AssertNoError(t, err, "Failed to load conversation messages")
+		AssertEqual(t, 1, len(messages), "Only the successful send should be stored")
+		AssertEqual(t, 1, len(messages[0].Attachments), "Retrieved message should include its attachment")
+		attachment := messages[0].Attachments[0]
+		AssertEqual(t, uploaded.Attachment.URL, attachment.URL, "Attachment URL should round-trip")
+		AssertEqual(t, "image/png", attachment.Mime, "Attachment mime should round-trip")
+		AssertEqual(t, int64(len(pngData)), attachment.Size, "Attachment size should round-trip")
+	})
+
+	t.Run("CannotReuseSentAttachment", func(t *testing.T) {
+		w := send(senderToken, []database.Attachment{{URL: uploaded.Attachment.URL}})
+		AssertEqual(t, http.StatusBadRequest, w.Code, "An attachment can only be sent once")
+	})
+
+	t.Run("DeliveredOverWebSocket", func(t *testing.T) {
+		pending, err := database.CreateAttachment(db, sender, "/static/uploads/attachments/ws-photo.png", "image/png", 128)
+		AssertNoError(t, err, "Failed to store attachment")
+
+		hub := NewHubTestServer(t, db)
+		senderConn := hub.Connect(t, sender)
+		recipientConn := hub.Connect(t, recipient)
+
+		err = senderConn.WriteJSON(map[string]interface{}{
+			"type":            "private",
+			"conversation_id": conversationID,
+			"content":         "",
+			"attachments":     []map[string]string{{"url": pending.URL}},
+		})
+		AssertNoError(t, err, "Failed to send message")
+
+		delivered := ReadHubMessage(t, recipientConn, "private", 2*time.Second)
+		AssertEqual(t, 1, len(delivered.Attachments), "Delivered message should carry its attachment")
+		AssertEqual(t, pending.URL, delivered.Attachments[0].URL, "Delivered attachment should keep its URL")
+	})
+}
+
+func TestExportConversationAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	alice, bob, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{alice, bob})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	base := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	contents := []string{"Hi Bob", "Hey, \"quoted\", with commas", "Line one\nline two"}
+	for i, content := range contents {
+		sender := alice
+		if i%2 == 1 {
+			sender = bob
+		}
+		_, err := db.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at) VALUES (?, ?, ?, ?)",
+			conversationID, sender, content, base.Add(time.Duration(i)*time.Minute).Format("2006-01-02 15:04:05"))
+		AssertNoError(t, err, "Failed to insert message")
+	}
+
+	export := func(userID int, format string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/conversations/"+strconv.Itoa(conversationID)+"/export?format="+format, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.ExportConversationAPI(w, req)
+		return w
+	}
+
+	t.Run("JSON", func(t *testing.T) {
+		w := export(bob, "json")
+		AssertEqual(t, http.StatusOK, w.Code, "A participant should be able to export")
+		AssertTrue(t, strings.Contains(w.Header().Get("Content-Disposition"), "attachment"), "Export should download as a file")
+
+		var transcript database.ConversationTranscript
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &transcript), "Export should be valid JSON")
+		AssertEqual(t, conversationID, transcript.ConversationID, "Transcript should identify the conversation")
+		AssertEqual(t, 2, len(transcript.Participants), "Transcript should list both participants")
+		AssertEqual(t, len(contents), len(transcript.Messages), "Every message should be exported")
+		for i, m := range transcript.Messages {
+			AssertEqual(t, contents[i], m.Content, "Messages should be in order with their content")
+			AssertTrue(t, m.SenderName != "", "Each message should name its sender")
+			AssertTrue(t, m.SentAt != "", "Each message should carry its timestamp")
+		}
+		AssertEqual(t, "johndoe", transcript.Messages[0].SenderName, "Sender names should be resolved")
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		w := export(alice, "csv")
+		AssertEqual(t, http.StatusOK, w.Code, "A participant should be able to export")
+		AssertTrue(t, strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv"), "CSV export should be served as CSV")
+
+		records, err := csv.NewReader(w.Body).ReadAll()
+		AssertNoError(t, err, "Export should be valid CSV")
+		AssertEqual(t, len(contents)+1, len(records), "Export should hold a header and every message")
+		AssertEqual(t, "sender_name", records[0][3], "Header should name the columns")
+		for i, content := range contents {
+			AssertEqual(t, content, records[i+1][4], "Content should survive CSV quoting")
+		}
+		AssertEqual(t, "janesmith", records[2][3], "Sender names should be resolved")
+	})
+
+	t.Run("NonParticipantForbidden", func(t *testing.T) {
+		w := export(outsider, "json")
+		AssertEqual(t, http.StatusForbidden, w.Code, "Non-participants should get 403")
+		AssertTrue(t, !strings.Contains(w.Body.String(), "Hi Bob"), "No messages should leak")
+	})
+
+	t.Run("UnknownFormat", func(t *testing.T) {
+		AssertEqual(t, http.StatusBadRequest, export(alice, "xml").Code, "Unsupported formats should be rejected")
+	})
+}
+
+func TestSearchConversationsAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	me, jane, bob, alice := userIDs[0], userIDs[1], userIDs[2], userIDs[3]
+
+	withJane, err := CreateTestConversation(db, []int{me, jane})
+	AssertNoError(t, err, "Failed to create conversation")
+	withBob, err := CreateTestConversation(db, []int{me, bob})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = db.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at) VALUES (?, ?, ?, ?)",
+		withBob, bob, "Lunch on Friday?", "2024-03-01 12:00:00")
+	AssertNoError(t, err, "Failed to insert message")
+	// A conversation the searcher is not part of must never show up
+	_, err = CreateTestConversation(db, []int{jane, alice})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	session := CreateAppSession(t, db, me)
+	search := func(q string) []int {
+		req := httptest.NewRequest("GET", "/api/conversations/search?q="+url.QueryEscape(q), nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		w := httptest.NewRecorder()
+		server.SearchConversationsAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Search should succeed for "+q)
+
+		var conversations []database.Conversation
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &conversations), "Failed to unmarshal conversations")
+		ids := make([]int, 0, len(conversations))
+		for _, conversation := range conversations {
+			ids = append(ids, conversation.ID)
+		}
+		return ids
+	}
+
+	t.Run("ByUsername", func(t *testing.T) {
+		ids := search("JANE")
+		AssertEqual(t, 1, len(ids), "Only the conversation with janesmith should match")
+		AssertEqual(t, withJane, ids[0], "The conversation with janesmith should be returned")
+	})
+
+	t.Run("ByLastMessage", func(t *testing.T) {
+		ids := search("friday")
+		AssertEqual(t, 1, len(ids), "Only the conversation with the matching message should match")
+		AssertEqual(t, withBob, ids[0], "The conversation with bob should be returned")
+	})
+
+	t.Run("OwnNameMatchesNothing", func(t *testing.T) {
+		AssertEqual(t, 0, len(search("johndoe")), "The searcher's own name should not match every conversation")
+	})
+
+	t.Run("EmptyQuery", func(t *testing.T) {
+		AssertEqual(t, 0, len(search("  ")), "An empty query should match nothing")
+	})
+}
+
+func TestSharedConversationsAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	me, jane, bob := userIDs[0], userIDs[1], userIDs[2]
+
+	direct, err := CreateTestConversation(db, []int{me, jane})
+	AssertNoError(t, err, "Failed to create conversation")
+	group, err := CreateTestConversation(db, []int{me, jane, bob})
+	AssertNoError(t, err, "Failed to create conversation")
+	// Conversations jane is not in must be left out
+	_, err = CreateTestConversation(db, []int{me, bob})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	session := CreateAppSession(t, db, me)
+	shared := func(userID string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/conversations/shared?user_id="+userID, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		w := httptest.NewRecorder()
+		server.SharedConversationsAPI(w, req)
+		return w
+	}
+
+	w := shared(strconv.Itoa(jane))
+	AssertEqual(t, http.StatusOK, w.Code, "Listing shared conversations should succeed")
+	var conversations []database.Conversation
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &conversations), "Failed to unmarshal conversations")
+	found := make(map[int]bool)
+	for _, conversation := range conversations {
+		found[conversation.ID] = true
+	}
+	AssertEqual(t, 2, len(conversations), "Both conversations with jane should be returned")
+	AssertTrue(t, found[direct], "The one-to-one conversation should be returned")
+	AssertTrue(t, found[group], "The group conversation should be returned")
+
+	AssertEqual(t, http.StatusBadRequest, shared("abc").Code, "A malformed user ID should be rejected")
+}
+
+func TestCreateConversationRespectsDMPrivacy(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	stranger, closed, contactsOnly, contact := userIDs[0], userIDs[1], userIDs[2], userIDs[3]
+
+	setDMs := func(userID int, allow string) {
+		privacy := database.DefaultPrivacy()
+		privacy.AllowDMsFrom = allow
+		AssertNoError(t, database.SetUserPrivacy(db, userID, privacy), "Failed to save privacy settings")
+	}
+	setDMs(closed, database.DMsFromNone)
+	setDMs(contactsOnly, database.DMsFromFollowers)
+
+	_, err = CreateTestConversation(db, []int{contact, contactsOnly})
+	AssertNoError(t, err, "Failed to create existing conversation")
+
+	create := func(creator int, participants []int) (int, server.CreateConversationResponse) {
+		body, _ := json.Marshal(server.CreateConversationRequest{Participants: participants})
+		req := httptest.NewRequest("POST", "/api/conversations", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, creator)})
+		w := httptest.NewRecorder()
+		server.CreateConversationAPI(w, req)
+
+		var response server.CreateConversationResponse
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return w.Code, response
+	}
+
+	t.Run("NoneRefusesStranger", func(t *testing.T) {
+		code, response := create(stranger, []int{stranger, closed})
+		AssertEqual(t, http.StatusForbidden, code, "A user accepting no DMs cannot be messaged")
+		AssertFalse(t, response.Success, "Creation should fail")
+
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM conversation_participants WHERE user_id = ?", closed).Scan(&count)
+		AssertEqual(t, 0, count, "No conversation should have been created")
+	})
+
+	t.Run("NoneRefusesGroup", func(t *testing.T) {
+		code, _ := create(stranger, []int{stranger, contact, closed})
+		AssertEqual(t, http.StatusForbidden, code, "A user accepting no DMs cannot be added to a group")
+	})
+
+	t.Run("FollowersRefusesStranger", func(t *testing.T) {
+		code, _ := create(stranger, []int{stranger, contactsOnly})
+		AssertEqual(t, http.StatusForbidden, code, "Only existing contacts may start a conversation")
+	})
+
+	t.Run("FollowersAdmitsContact", func(t *testing.T) {
+		code, response := create(contact, []int{contact, contactsOnly, stranger})
+		AssertEqual(t, http.StatusOK, code, "An existing contact may start a conversation")
+		AssertTrue(t, response.Success, "Creation should succeed")
+	})
+
+	t.Run("EveryoneAdmitsStranger", func(t *testing.T) {
+		code, _ := create(closed, []int{closed, stranger})
+		AssertEqual(t, http.StatusOK, code, "Users accepting everyone can be messaged by anyone")
+	})
+
+	t.Run("InvalidSetting", func(t *testing.T) {
+		privacy := database.DefaultPrivacy()
+		privacy.AllowDMsFrom = "friends"
+		err := database.SetUserPrivacy(db, stranger, privacy)
+		AssertTrue(t, errors.Is(err, database.ErrInvalidPrivacy), "Unknown allow_dms_from should be rejected")
+	})
+}
+
+func TestCreateConversationByUsernames(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	creator, partner := userIDs[0], userIDs[1]
+	sessionToken := CreateAppSession(t, db, creator)
+
+	create := func(usernames ...string) (int, server.CreateConversationResponse) {
+		body, _ := json.Marshal(server.CreateConversationByUsernamesRequest{Usernames: usernames})
+		req := httptest.NewRequest("POST", "/api/conversations/by-username", bytes.NewBuffer(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.CreateConversationByUsernamesAPI(w, req)
+
+		var response server.CreateConversationResponse
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return w.Code, response
+	}
+
+	t.Run("OtherUsersUsername", func(t *testing.T) {
+		code, response := create(UserFixtures[1].Username)
+		AssertEqual(t, http.StatusOK, code, "Conversation creation should succeed")
+		AssertTrue(t, response.ConversationID > 0, "A conversation id should be returned")
+		AssertEqual(t, 2, len(response.Conversation.Participants), "Both users should take part")
+
+		ids := map[int]bool{}
+		for _, p := range response.Conversation.Participants {
+			ids[p.ID] = true
+		}
+		AssertTrue(t, ids[creator] && ids[partner], "Creator and the named user should be participants")
+	})
+
+	t.Run("MentionMatchesExisting", func(t *testing.T) {
+		first, _ := database.GetConversationBetweenUsers(db, creator, partner)
+		code, response := create("@" + strings.ToUpper(UserFixtures[1].Username))
+		AssertEqual(t, http.StatusOK, code, "A typed @mention should resolve")
+		AssertEqual(t, first, response.ConversationID, "The existing conversation should be reused")
+	})
+
+	t.Run("UnknownUsername", func(t *testing.T) {
+		code, response := create(UserFixtures[2].Username, "nobody_here")
+		AssertEqual(t, http.StatusNotFound, code, "Any unknown username should fail the request")
+		AssertTrue(t, strings.Contains(response.Error, "nobody_here"), "The unknown name should be reported")
+	})
+
+	t.Run("NoUsernames", func(t *testing.T) {
+		code, _ := create()
+		AssertEqual(t, http.StatusBadRequest, code, "An empty list should be rejected")
+	})
+}
+
+func TestLeaveAndDeleteConversationNotifyParticipants(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	leaver, stayer := userIDs[0], userIDs[1]
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+	stayerConn := hub.Connect(t, stayer)
+
+	call := func(handler http.HandlerFunc, method string, conversationID, userID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/conversations/"+strconv.Itoa(conversationID), nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("Leave", func(t *testing.T) {
+		conversationID, err := CreateTestConversation(db, []int{leaver, stayer, userIDs[2]})
+		AssertNoError(t, err, "Failed to create conversation")
+
+		w := call(server.LeaveConversationAPI, "POST", conversationID, leaver)
+		AssertEqual(t, http.StatusOK, w.Code, "A participant should be able to leave")
+
+		event := ReadHubMessage(t, stayerConn, websocket.MessageTypeConversationLeft, 2*time.Second)
+		AssertEqual(t, conversationID, event.ConversationID, "The event should name the conversation")
+		AssertEqual(t, leaver, event.UserID, "The event should name who left")
+
+		inConversation, err := database.IsUserInConversation(db, leaver, conversationID)
+		AssertNoError(t, err, "Failed to check membership")
+		AssertFalse(t, inConversation, "The user should no longer be a participant")
+
+		w = call(server.LeaveConversationAPI, "POST", conversationID, leaver)
+		AssertEqual(t, http.StatusForbidden, w.Code, "Leaving twice should be refused")
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		conversationID, err := CreateTestConversation(db, []int{leaver, stayer})
+		AssertNoError(t, err, "Failed to create conversation")
+		_, err = database.AddMessageToConversation(db, conversationID, stayer, "About to vanish")
+		AssertNoError(t, err, "Failed to add message")
+
+		w := call(server.DeleteConversationAPI, "DELETE", conversationID, userIDs[2])
+		AssertEqual(t, http.StatusNotFound, w.Code, "Outsiders should not be able to delete a conversation")
+
+		w = call(server.DeleteConversationAPI, "DELETE", conversationID, leaver)
+		AssertEqual(t, http.StatusOK, w.Code, "A participant should be able to delete the conversation")
+
+		event := ReadHubMessage(t, stayerConn, websocket.MessageTypeConversationDeleted, 2*time.Second)
+		AssertEqual(t, conversationID, event.ConversationID, "The event should name the conversation")
+
+		var messages int
+		err = db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&messages)
+		AssertNoError(t, err, "Failed to count messages")
+		AssertEqual(t, 0, messages, "The conversation's messages should be deleted")
+	})
+}
+
+func TestConversationDraftAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	writer, reader, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{writer, reader})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	call := func(method string, userID int, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/conversations/"+strconv.Itoa(conversationID)+"/draft", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.ConversationDraftAPI(w, req)
+		return w
+	}
+
+	w := call("GET", writer, "")
+	AssertEqual(t, http.StatusNotFound, w.Code, "There should be no draft before one is saved")
+
+	w = call("PUT", writer, `{"content": "Half a thought"}`)
+	AssertEqual(t, http.StatusOK, w.Code, "Saving a draft should succeed")
+	w = call("PUT", writer, `{"content": "Half a thought, and then some"}`)
+	AssertEqual(t, http.StatusOK, w.Code, "Replacing a draft should succeed")
+
+	w = call("GET", writer, "")
+	AssertEqual(t, http.StatusOK, w.Code, "The saved draft should be returned")
+	var draft database.DraftMessage
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &draft), "Draft should be JSON")
+	AssertEqual(t, "Half a thought, and then some", draft.Content, "The latest draft should be kept")
+	AssertEqual(t, conversationID, draft.ConversationID, "The draft should name its conversation")
+
+	w = call("GET", reader, "")
+	AssertEqual(t, http.StatusNotFound, w.Code, "Drafts should be private to their writer")
+
+	w = call("PUT", outsider, `{"content": "Let me in"}`)
+	AssertEqual(t, http.StatusForbidden, w.Code, "Non-participants should not save drafts")
+
+	_, err = database.AddMessageToConversation(db, conversationID, writer, "Half a thought, and then some")
+	AssertNoError(t, err, "Failed to send message")
+	w = call("GET", writer, "")
+	AssertEqual(t, http.StatusNotFound, w.Code, "Sending a message should clear the draft")
+
+	call("PUT", writer, `{"content": "Second thoughts"}`)
+	w = call("DELETE", writer, "")
+	AssertEqual(t, http.StatusOK, w.Code, "Deleting a draft should succeed")
+	w = call("GET", writer, "")
+	AssertEqual(t, http.StatusNotFound, w.Code, "A deleted draft should be gone")
+}
+
+func TestGetMessagesOrder(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	conversationID, err := CreateTestConversation(db, []int{userIDs[0], userIDs[1]})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	for i, sentAt := range []string{"2024-03-01 09:00:00", "2024-03-01 10:00:00", "2024-03-01 11:00:00"} {
+		_, err = db.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at) VALUES (?, ?, ?, ?)",
+			conversationID, userIDs[i%2], fmt.Sprintf("Message %d", i+1), sentAt)
+		AssertNoError(t, err, "Failed to insert message")
+	}
+
+	session := CreateAppSession(t, db, userIDs[0])
+	get := func(order string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/messages?conversation_id="+strconv.Itoa(conversationID)+"&order="+order, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		w := httptest.NewRecorder()
+		server.GetMessages(w, req)
+		return w
+	}
+	contents := func(w *httptest.ResponseRecorder) []string {
+		AssertEqual(t, http.StatusOK, w.Code, "Fetching messages should succeed")
+		var messages []database.Message
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &messages), "Failed to unmarshal messages")
+		var out []string
+		for _, msg := range messages {
+			out = append(out, msg.Content)
+		}
+		return out
+	}
+
+	AssertEqual(t, "Message 1,Message 2,Message 3", strings.Join(contents(get("asc")), ","), "order=asc should return messages oldest first")
+	AssertEqual(t, "Message 3,Message 2,Message 1", strings.Join(contents(get("")), ","), "Messages should default to newest first")
+	AssertEqual(t, http.StatusBadRequest, get("sideways").Code, "An unknown order should be rejected")
+}
+
+func TestBlockedUsersCannotMessage(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	blocker, blocked, contact := userIDs[0], userIDs[1], userIDs[2]
+
+	block := func(method string, userID, targetID int) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/users/"+strconv.Itoa(targetID)+"/block", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(targetID)})
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.BlockUserAPI(w, req)
+		return w
+	}
+
+	send := func(senderID, conversationID int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"conversation_id": conversationID, "content": "Hello?"})
+		req := httptest.NewRequest("POST", "/api/messages", bytes.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, senderID)})
+		w := httptest.NewRecorder()
+		server.SendMessageAPI(w, req)
+		return w
+	}
+
+	existing, err := CreateTestConversation(db, []int{blocker, contact})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	AssertEqual(t, http.StatusOK, block("POST", blocker, blocked).Code, "Blocking a user should succeed")
+	AssertEqual(t, http.StatusOK, block("POST", blocker, contact).Code, "Blocking a contact should succeed")
+	AssertEqual(t, http.StatusBadRequest, block("POST", blocker, blocker).Code, "Blocking yourself should be rejected")
+	AssertEqual(t, http.StatusNotFound, block("POST", blocker, 99999).Code, "Blocking an unknown user should be not found")
+
+	_, err = database.CreateConversationAs(db, blocked, []int{blocked, blocker})
+	AssertTrue(t, errors.Is(err, database.ErrDMsNotAllowed), "A blocked user should not start a conversation with the blocker")
+	_, err = database.CreateConversationAs(db, blocker, []int{blocker, blocked})
+	AssertTrue(t, errors.Is(err, database.ErrDMsNotAllowed), "The blocker should not start a conversation with the blocked user")
+
+	AssertEqual(t, http.StatusForbidden, send(contact, existing).Code, "A blocked user should not message an existing conversation")
+	AssertEqual(t, http.StatusForbidden, send(blocker, existing).Code, "The blocker should not message the blocked user either")
+
+	AssertEqual(t, http.StatusOK, block("DELETE", blocker, contact).Code, "Unblocking should succeed")
+	AssertEqual(t, http.StatusOK, send(contact, existing).Code, "Messages should flow again after unblocking")
+}
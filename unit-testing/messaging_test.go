@@ -1,10 +1,19 @@
 package unit_testing
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"connecthub/database"
 	"connecthub/repository"
 	"connecthub/server/services"
+	"connecthub/uploads"
 )
 
 func TestConversationCreation(t *testing.T) {
@@ -332,3 +341,804 @@ func TestConversationManagement(t *testing.T) {
 		}
 	})
 }
+
+func TestPruneOldMessages(t *testing.T) {
+	db := AppTestSetup(t)
+	uploads.SetBaseDir(filepath.Join(t.TempDir(), "uploads"))
+	t.Cleanup(func() { uploads.SetBaseDir("") })
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	activeConv, err := CreateTestConversation(db, []int{userIDs[0], userIDs[1]})
+	AssertNoError(t, err, "Failed to create active conversation")
+	staleConv, err := CreateTestConversation(db, []int{userIDs[0], userIDs[2]})
+	AssertNoError(t, err, "Failed to create stale conversation")
+
+	now := time.Now()
+	addMessage := func(conversationID int, content string, sentAt time.Time) int {
+		id, err := CreateTestMessage(db, TestMessage{ConversationID: conversationID, SenderID: userIDs[0], Content: content, SentAt: sentAt})
+		AssertNoError(t, err, "Failed to create message")
+		return id
+	}
+
+	oldActive1 := addMessage(activeConv, "old 1", now.Add(-60*24*time.Hour))
+	oldActive2 := addMessage(activeConv, "old 2", now.Add(-45*24*time.Hour))
+	recentActive := addMessage(activeConv, "recent", now.Add(-time.Hour))
+	oldStale := addMessage(staleConv, "stale 1", now.Add(-90*24*time.Hour))
+	lastStale := addMessage(staleConv, "stale last", now.Add(-80*24*time.Hour))
+
+	// Give a pruned message an attachment and an edit history
+	url, err := uploads.Save("attachments", "photo.png", strings.NewReader("png"))
+	AssertNoError(t, err, "Failed to save upload")
+	attachment, err := database.CreateAttachment(db, userIDs[0], url, "image/png", 3)
+	AssertNoError(t, err, "Failed to store attachment")
+	_, err = db.Exec("UPDATE attachments SET message_id = ? WHERE attachment_id = ?", oldActive1, attachment.ID)
+	AssertNoError(t, err, "Failed to attach file to old message")
+	AssertNoError(t, database.EditMessage(db, oldActive1, userIDs[0], "old 1, edited"), "Failed to edit old message")
+
+	pruned, err := database.PruneOldMessages(db, 30*24*time.Hour)
+	AssertNoError(t, err, "Pruning should succeed")
+	AssertEqual(t, 3, pruned, "Should prune only messages past the retention window")
+
+	exists := func(messageID int) bool {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM message WHERE message_id = ?", messageID).Scan(&count)
+		AssertNoError(t, err, "Failed to check message")
+		return count > 0
+	}
+
+	AssertFalse(t, exists(oldActive1), "Old message should be pruned")
+	AssertFalse(t, exists(oldActive2), "Old message should be pruned")
+	AssertFalse(t, exists(oldStale), "Old message should be pruned")
+	AssertTrue(t, exists(recentActive), "Recent message should be kept")
+	AssertTrue(t, exists(lastStale), "Last message of a conversation should be kept")
+
+	var attachments, edits int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM attachments WHERE message_id = ?", oldActive1).Scan(&attachments), "Failed to count attachments")
+	AssertEqual(t, 0, attachments, "A pruned message should leave no attachment rows behind")
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM message_edits WHERE message_id = ?", oldActive1).Scan(&edits), "Failed to count edits")
+	AssertEqual(t, 0, edits, "A pruned message should leave no edit history behind")
+	path, _ := uploads.Path(url)
+	_, err = os.Stat(path)
+	AssertTrue(t, os.IsNotExist(err), "The attachment file of a pruned message should be removed")
+
+	_, err = database.PruneOldMessages(db, 0)
+	AssertError(t, err, "Zero retention should be rejected")
+}
+
+func TestMessageRecipientOnline(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, onlineUser, offlineUser := userIDs[0], userIDs[1], userIDs[2]
+
+	onlineConversation, err := CreateTestConversation(db, []int{sender, onlineUser})
+	AssertNoError(t, err, "Failed to create conversation with online user")
+	offlineConversation, err := CreateTestConversation(db, []int{sender, offlineUser})
+	AssertNoError(t, err, "Failed to create conversation with offline user")
+	groupConversation, err := CreateTestConversation(db, []int{sender, onlineUser, offlineUser})
+	AssertNoError(t, err, "Failed to create group conversation")
+
+	hub := NewHubTestServer(t, db)
+	hub.Connect(t, onlineUser)
+
+	t.Run("RecipientConnected", func(t *testing.T) {
+		msg, err := database.AddMessageToConversation(db, onlineConversation, sender, "Are you there?")
+		AssertNoError(t, err, "Message should be stored")
+		AssertTrue(t, msg.RecipientOnline, "Recipient with an active connection should be reported online")
+		AssertEqual(t, 0, msg.OnlineParticipants, "Direct messages should not report a participant count")
+	})
+
+	t.Run("RecipientDisconnected", func(t *testing.T) {
+		msg, err := database.AddMessageToConversation(db, offlineConversation, sender, "Read this later")
+		AssertNoError(t, err, "Message to an offline user should still be stored")
+		AssertFalse(t, msg.RecipientOnline, "Recipient without a connection should be reported offline")
+	})
+
+	t.Run("GroupConversation", func(t *testing.T) {
+		msg, err := database.AddMessageToConversation(db, groupConversation, sender, "Hello everyone")
+		AssertNoError(t, err, "Group message should be stored")
+		AssertEqual(t, 1, msg.OnlineParticipants, "Only the connected member should be counted")
+		AssertTrue(t, msg.RecipientOnline, "Group should be reported online when any member is connected")
+	})
+}
+
+func TestConversationReadPointer(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, reader := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, reader})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	unread := func() int {
+		count, err := database.GetUnreadCountSinceLastRead(db, conversationID, reader)
+		AssertNoError(t, err, "Failed to count unread messages")
+		return count
+	}
+
+	var lastID int
+	for _, content := range []string{"one", "two", "three"} {
+		msg, err := database.AddMessageToConversation(db, conversationID, sender, content)
+		AssertNoError(t, err, "Failed to add message")
+		lastID = msg.ID
+	}
+	AssertEqual(t, 3, unread(), "All messages should start unread")
+
+	pointer, err := database.GetLastRead(db, conversationID, reader)
+	AssertNoError(t, err, "Failed to get read pointer")
+	AssertEqual(t, 0, pointer, "Pointer should start at zero")
+
+	AssertNoError(t, database.SetLastRead(db, conversationID, reader, lastID), "Failed to advance pointer")
+	AssertEqual(t, 0, unread(), "Advancing the pointer to the latest message should zero the unread count")
+
+	AssertNoError(t, database.SetLastRead(db, conversationID, reader, lastID-2), "Stale pointer update should succeed")
+	pointer, err = database.GetLastRead(db, conversationID, reader)
+	AssertNoError(t, err, "Failed to get read pointer")
+	AssertEqual(t, lastID, pointer, "Pointer should never move backwards")
+
+	_, err = database.AddMessageToConversation(db, conversationID, sender, "four")
+	AssertNoError(t, err, "Failed to add message")
+	AssertEqual(t, 1, unread(), "A new message should re-increment the unread count")
+
+	_, err = database.AddMessageToConversation(db, conversationID, reader, "my own reply")
+	AssertNoError(t, err, "Failed to add reply")
+	AssertEqual(t, 1, unread(), "The reader's own messages should not count as unread")
+}
+
+func TestGroupUnreadCountPerMember(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, firstReader, secondReader := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, firstReader, secondReader})
+	AssertNoError(t, err, "Failed to create group conversation")
+	for _, content := range []string{"one", "two"} {
+		_, err := database.AddMessageToConversation(db, conversationID, sender, content)
+		AssertNoError(t, err, "Failed to add message")
+	}
+
+	AssertNoError(t, database.MarkMessagesAsRead(db, conversationID, firstReader), "Failed to mark messages read")
+
+	messageService := services.NewMessageService(db)
+	count, err := messageService.GetUnreadMessageCount(conversationID, firstReader)
+	AssertNoError(t, err, "Failed to count unread messages")
+	AssertEqual(t, 0, count, "The member who read the group should have nothing unread")
+
+	count, err = messageService.GetUnreadMessageCount(conversationID, secondReader)
+	AssertNoError(t, err, "Failed to count unread messages")
+	AssertEqual(t, 2, count, "Another member reading the group should not clear this member's count")
+
+	total, err := database.GetTotalUnreadCount(db, secondReader)
+	AssertNoError(t, err, "Failed to count total unread messages")
+	AssertEqual(t, total, count, "The service and the totals should agree")
+}
+
+// seedConversations gives the first user one conversation with each partner, every one holding two messages
+func seedConversations(t testing.TB, db *sql.DB, userID int, partners []int) []int {
+	var conversationIDs []int
+	for _, partner := range partners {
+		conversationID, err := CreateTestConversation(db, []int{userID, partner})
+		if err != nil {
+			t.Fatalf("Failed to create conversation: %v", err)
+		}
+		for _, sender := range []int{userID, partner} {
+			if _, err := database.AddMessageToConversation(db, conversationID, sender, fmt.Sprintf("hello from %d", sender)); err != nil {
+				t.Fatalf("Failed to add message: %v", err)
+			}
+		}
+		conversationIDs = append(conversationIDs, conversationID)
+	}
+	return conversationIDs
+}
+
+func TestConversationLoadingBatchesQueries(t *testing.T) {
+	db := AppTestSetup(t)
+
+	var userIDs []int
+	for i := 0; i < 21; i++ {
+		userID, err := CreateTestUser(db, TestUser{
+			Username:  fmt.Sprintf("batchuser%d", i),
+			Email:     fmt.Sprintf("batchuser%d@example.com", i),
+			Password:  "password123",
+			FirstName: "Batch",
+			LastName:  "User",
+		})
+		AssertNoError(t, err, "Failed to create user")
+		userIDs = append(userIDs, userID)
+	}
+	owner := userIDs[0]
+	conversationIDs := seedConversations(t, db, owner, userIDs[1:])
+
+	countingDB := OpenCountingDB(t, "./database/main.db")
+
+	ResetQueryCount()
+	conversations, err := database.GetUserConversations(countingDB, owner)
+	AssertNoError(t, err, "Failed to load conversations")
+	queries := QueryCount()
+
+	AssertEqual(t, 20, len(conversations), "All conversations should be returned")
+	AssertLessThanOrEqual(t, int(queries), 3, "Loading conversations should not issue per-conversation queries")
+
+	for _, conv := range conversations {
+		AssertEqual(t, 2, len(conv.Participants), "Each conversation should have both participants")
+		AssertTrue(t, conv.LastMessage != nil, "Each conversation should have a last message")
+		AssertEqual(t, conv.ID, conv.LastMessage.ConversationID, "Last message should belong to its conversation")
+		AssertNotEqual(t, owner, conv.LastMessage.SenderID, "Last message should be the partner's reply")
+	}
+
+	ResetQueryCount()
+	byID, err := database.GetConversationsWithIDs(countingDB, conversationIDs[:5])
+	AssertNoError(t, err, "Failed to load conversations by id")
+	AssertEqual(t, 5, len(byID), "Requested conversations should be returned")
+	AssertLessThanOrEqual(t, int(QueryCount()), 3, "Loading by id should batch participant and message lookups")
+}
+
+func TestCreateConversationValidation(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	participantCount := func(conversationID int) int {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM conversation_participants WHERE conversation_id = ?", conversationID).Scan(&count)
+		AssertNoError(t, err, "Failed to count participants")
+		return count
+	}
+
+	t.Run("ValidGroup", func(t *testing.T) {
+		conversationID, err := database.CreateConversation(db, []int{userIDs[0], userIDs[1], userIDs[2]})
+		AssertNoError(t, err, "A three-person conversation should be created")
+		AssertEqual(t, 3, participantCount(conversationID), "All three participants should be added")
+	})
+
+	t.Run("SelfConversation", func(t *testing.T) {
+		_, err := database.CreateConversation(db, []int{userIDs[0]})
+		AssertTrue(t, errors.Is(err, database.ErrSelfConversation), "A conversation with only the creator should be rejected")
+
+		_, err = database.CreateConversation(db, []int{userIDs[0], userIDs[0]})
+		AssertTrue(t, errors.Is(err, database.ErrSelfConversation), "A conversation with only the creator listed twice should be rejected")
+	})
+
+	t.Run("NoParticipants", func(t *testing.T) {
+		_, err := database.CreateConversation(db, nil)
+		AssertTrue(t, errors.Is(err, database.ErrInvalidParticipants), "A conversation without participants should be rejected")
+	})
+
+	t.Run("DuplicatesAreCollapsed", func(t *testing.T) {
+		conversationID, err := database.CreateConversation(db, []int{userIDs[1], userIDs[2], userIDs[1], userIDs[3]})
+		AssertNoError(t, err, "Repeated ids alongside distinct users should be deduplicated")
+		AssertEqual(t, 3, participantCount(conversationID), "Each user should be added once")
+	})
+
+	t.Run("NonexistentUser", func(t *testing.T) {
+		_, err := database.CreateConversation(db, []int{userIDs[0], 99999})
+		AssertTrue(t, errors.Is(err, database.ErrUnknownParticipant), "An unknown user id should be rejected")
+	})
+
+	t.Run("GroupTooLarge", func(t *testing.T) {
+		participants := make([]int, 0, database.MaxConversationParticipants+1)
+		for i := 0; i <= database.MaxConversationParticipants; i++ {
+			participants = append(participants, userIDs[0]+1000+i)
+		}
+		participants[0] = userIDs[0]
+		_, err := database.CreateConversation(db, participants)
+		AssertTrue(t, errors.Is(err, database.ErrTooManyParticipants), "Groups over the size cap should be rejected")
+	})
+
+	var conversations int
+	err = db.QueryRow("SELECT COUNT(*) FROM conversation").Scan(&conversations)
+	AssertNoError(t, err, "Failed to count conversations")
+	AssertEqual(t, 2, conversations, "Rejected requests should not create conversations")
+}
+
+func TestConversationUnreadCount(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	for _, content := range []string{"Are you there?", "Ping me when you are back"} {
+		_, err := database.AddMessageToConversation(db, conversationID, sender, content)
+		AssertNoError(t, err, "Failed to send message")
+	}
+
+	unreadFor := func(userID int) int {
+		conversations, err := database.GetUserConversations(db, userID)
+		AssertNoError(t, err, "Failed to load conversations")
+		AssertEqual(t, 1, len(conversations), "User should see the conversation")
+		return conversations[0].UnreadCount
+	}
+
+	AssertEqual(t, 2, unreadFor(recipient), "Recipient should have both incoming messages unread")
+	AssertEqual(t, 0, unreadFor(sender), "Sender's own messages should not count as unread")
+
+	AssertNoError(t, database.MarkMessagesAsRead(db, conversationID, recipient), "Failed to mark messages as read")
+	AssertEqual(t, 0, unreadFor(recipient), "Reading the conversation should clear the unread count")
+}
+
+func TestGetUnreadConversationIDs(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	reader := userIDs[0]
+
+	unreadID, err := CreateTestConversation(db, []int{reader, userIDs[1]})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = database.AddMessageToConversation(db, unreadID, userIDs[1], "Are you there?")
+	AssertNoError(t, err, "Failed to add message")
+
+	outgoingID, err := CreateTestConversation(db, []int{reader, userIDs[2]})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = database.AddMessageToConversation(db, outgoingID, reader, "Only my own message here")
+	AssertNoError(t, err, "Failed to add message")
+
+	readID, err := CreateTestConversation(db, []int{reader, userIDs[3]})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = database.AddMessageToConversation(db, readID, userIDs[3], "Already seen")
+	AssertNoError(t, err, "Failed to add message")
+	AssertNoError(t, database.MarkMessagesAsRead(db, readID, reader), "Failed to mark messages as read")
+
+	ids, err := database.GetUnreadConversationIDs(db, reader)
+	AssertNoError(t, err, "Failed to list unread conversations")
+	AssertEqual(t, 1, len(ids), "Only one conversation should have unread incoming messages")
+	AssertEqual(t, unreadID, ids[0], "The conversation with the unread message should be returned")
+
+	ids, err = database.GetUnreadConversationIDs(db, userIDs[1])
+	AssertNoError(t, err, "Failed to list unread conversations")
+	AssertEqual(t, 0, len(ids), "The sender should have nothing unread")
+
+	// The query is backed by these rather than scanning messages
+	for _, index := range []string{"idx_conversation_participants_user", "idx_message_conversation"} {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='index' AND name=?", index).Scan(&count)
+		AssertNoError(t, err, "Should be able to query index existence")
+		AssertEqual(t, 1, count, fmt.Sprintf("Index %s should exist", index))
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	db := TestSetup(t).DB
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	viewer, offlineUser, onlineUser := userIDs[0], userIDs[1], userIDs[2]
+
+	seenAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	_, err = db.Exec("INSERT INTO online_status (user_id, status, last_seen) VALUES (?, 'offline', ?), (?, 'online', ?)",
+		offlineUser, seenAt.Format("2006-01-02 15:04:05"), onlineUser, seenAt.Format("2006-01-02 15:04:05"))
+	AssertNoError(t, err, "Failed to record online status")
+
+	conversationID, err := CreateTestConversation(db, []int{viewer, offlineUser, onlineUser})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	participantLastSeen := func(t *testing.T, userID int) *time.Time {
+		participants, err := database.GetConversationParticipantsDetails(db, conversationID)
+		AssertNoError(t, err, "Participants should load")
+		for _, p := range participants {
+			if p.ID == userID {
+				return p.LastSeen
+			}
+		}
+		t.Fatalf("User %d is not a participant", userID)
+		return nil
+	}
+
+	t.Run("OfflineUserReturned", func(t *testing.T) {
+		lastSeen, status, err := database.GetLastSeen(db, offlineUser)
+		AssertNoError(t, err, "Last seen should load")
+		AssertEqual(t, "offline", status, "Status should be reported")
+		AssertTrue(t, lastSeen.Equal(seenAt), fmt.Sprintf("Expected %v, got %v", seenAt, lastSeen))
+
+		header := participantLastSeen(t, offlineUser)
+		AssertTrue(t, header != nil && header.Equal(seenAt), "Conversation header should carry last_seen for offline users")
+	})
+
+	t.Run("OnlineUserOmitted", func(t *testing.T) {
+		_, status, err := database.GetLastSeen(db, onlineUser)
+		AssertNoError(t, err, "Last seen should load")
+		AssertEqual(t, "online", status, "Status should be reported")
+		AssertTrue(t, participantLastSeen(t, onlineUser) == nil, "Online users should not carry last_seen")
+	})
+
+	t.Run("NeverConnected", func(t *testing.T) {
+		lastSeen, status, err := database.GetLastSeen(db, viewer)
+		AssertNoError(t, err, "Missing status should not be an error")
+		AssertEqual(t, "offline", status, "Users never seen should be offline")
+		AssertTrue(t, lastSeen.IsZero(), "Users never seen should have no last_seen")
+	})
+
+	t.Run("PrivacyFlagHidesIt", func(t *testing.T) {
+		privacy := database.DefaultPrivacy()
+		privacy.ShowLastSeen = false
+		AssertNoError(t, database.SetUserPrivacy(db, offlineUser, privacy), "Privacy should save")
+
+		privacy, err := database.GetUserPrivacy(db, offlineUser)
+		AssertNoError(t, err, "Privacy should load")
+		AssertFalse(t, privacy.ShowLastSeen, "Flag should be stored")
+
+		lastSeen, status, err := database.GetLastSeen(db, offlineUser)
+		AssertNoError(t, err, "Last seen should load")
+		AssertEqual(t, "offline", status, "Status is still reported")
+		AssertTrue(t, lastSeen.IsZero(), "Hidden last_seen should be zero")
+		AssertTrue(t, participantLastSeen(t, offlineUser) == nil, "Hidden last_seen should be null in the conversation header")
+
+		users, err := database.GetAllUsers(db)
+		AssertNoError(t, err, "Users should load")
+		for _, u := range users {
+			if u.ID == offlineUser {
+				AssertTrue(t, u.LastSeen == nil, "Hidden last_seen should be null in the user list")
+			}
+		}
+	})
+
+	t.Run("HiddenOnlineLooksTheSameConnected", func(t *testing.T) {
+		privacy := database.DefaultPrivacy()
+		privacy.ShowOnline = false
+		AssertNoError(t, database.SetUserPrivacy(db, onlineUser, privacy), "Privacy should save")
+
+		setStatus := func(status string) {
+			_, err := db.Exec("UPDATE online_status SET status = ? WHERE user_id = ?", status, onlineUser)
+			AssertNoError(t, err, "Failed to update online status")
+		}
+
+		setStatus("offline")
+		disconnected := participantLastSeen(t, onlineUser)
+		setStatus("online")
+		connected := participantLastSeen(t, onlineUser)
+
+		AssertTrue(t, disconnected != nil && disconnected.Equal(seenAt), "Last seen should show while disconnected")
+		AssertTrue(t, connected != nil && connected.Equal(*disconnected), "Connecting should not blank last_seen when online status is hidden")
+
+		users, err := database.GetAllUsers(db)
+		AssertNoError(t, err, "Users should load")
+		for _, u := range users {
+			if u.ID == onlineUser {
+				AssertTrue(t, u.LastSeen != nil && u.LastSeen.Equal(seenAt), "The user list should not reveal presence either")
+			}
+		}
+	})
+}
+
+func TestConversationBetweenUsersSkipsGroups(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	a, b, c := userIDs[0], userIDs[1], userIDs[2]
+
+	// The group is created first so it has the lower id
+	groupID, err := CreateTestConversation(db, []int{a, b, c})
+	AssertNoError(t, err, "Failed to create group conversation")
+	directID, err := CreateTestConversation(db, []int{a, b})
+	AssertNoError(t, err, "Failed to create direct conversation")
+
+	found, err := database.GetConversationBetweenUsers(db, a, b)
+	AssertNoError(t, err, "Failed to look up conversation")
+	AssertEqual(t, directID, found, "The 1:1 conversation should be returned, not the group")
+
+	found, err = database.GetConversationBetweenUsers(db, a, c)
+	AssertNoError(t, err, "Failed to look up conversation")
+	AssertEqual(t, 0, found, "Sharing only a group should not count as a 1:1 conversation")
+
+	created, err := database.CreateConversation(db, []int{a, b})
+	AssertNoError(t, err, "Failed to create conversation")
+	AssertEqual(t, directID, created, "Creating a 1:1 conversation should reuse the existing one")
+	AssertTrue(t, created != groupID, "The group should not be reused")
+}
+
+func TestFindOrCreateConversationReportsCreated(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	a, b := userIDs[0], userIDs[1]
+
+	firstID, created, err := database.FindOrCreateConversation(db, a, []int{a, b})
+	AssertNoError(t, err, "Failed to create conversation")
+	AssertTrue(t, created, "The first conversation between a pair should be reported as created")
+
+	secondID, created, err := database.FindOrCreateConversation(db, b, []int{b, a})
+	AssertNoError(t, err, "Failed to find conversation")
+	AssertFalse(t, created, "The existing conversation should be reported as reused")
+	AssertEqual(t, firstID, secondID, "The same conversation should be returned for the pair")
+}
+
+func TestCreateConversationUsesGivenConnection(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	// Point the configured path somewhere else: opening it would create the file
+	otherPath := filepath.Join(t.TempDir(), "other.db")
+	previous := database.Path()
+	database.SetPath(otherPath)
+	defer database.SetPath(previous)
+
+	conversationID, err := database.CreateConversation(db, []int{userIDs[0], userIDs[1]})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	inConversation, err := database.IsUserInConversation(db, userIDs[0], conversationID)
+	AssertNoError(t, err, "Failed to check membership")
+	AssertTrue(t, inConversation, "The conversation should be stored through the given connection")
+
+	_, err = os.Stat(otherPath)
+	AssertTrue(t, os.IsNotExist(err), "No second database handle should be opened")
+}
+
+func TestConversationMessageCount(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	a, b, c := userIDs[0], userIDs[1], userIDs[2]
+
+	directID, err := CreateTestConversation(db, []int{a, b})
+	AssertNoError(t, err, "Failed to create conversation")
+	for i := 0; i < 5; i++ {
+		sender := []int{a, b}[i%2]
+		_, err := database.AddMessageToConversation(db, directID, sender, fmt.Sprintf("Message %d", i+1))
+		AssertNoError(t, err, "Failed to send message")
+	}
+
+	groupID, err := CreateTestConversation(db, []int{a, b, c})
+	AssertNoError(t, err, "Failed to create group conversation")
+
+	conversations, err := database.GetUserConversations(db, a)
+	AssertNoError(t, err, "Failed to load conversations")
+	byID := map[int]database.Conversation{}
+	for _, conv := range conversations {
+		byID[conv.ID] = conv
+	}
+
+	AssertEqual(t, 5, byID[directID].MessageCount, "Every message should be counted")
+	AssertEqual(t, 2, byID[directID].ParticipantCount, "A direct conversation has two participants")
+	AssertEqual(t, 0, byID[groupID].MessageCount, "An empty conversation has no messages")
+	AssertEqual(t, 3, byID[groupID].ParticipantCount, "All group members should be counted")
+}
+
+func TestConversationMessagesForParticipantsOnly(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	a, b, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{a, b})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = database.AddMessageToConversation(db, conversationID, a, "Just between us")
+	AssertNoError(t, err, "Failed to send message")
+
+	messages, err := database.GetConversationMessagesFor(db, conversationID, b, 10, 0, database.OrderNewestFirst)
+	AssertNoError(t, err, "A participant should read the conversation")
+	AssertEqual(t, 1, len(messages), "The participant should see the message")
+
+	messages, err = database.GetConversationMessagesFor(db, conversationID, outsider, 10, 0, database.OrderNewestFirst)
+	AssertTrue(t, errors.Is(err, database.ErrNotParticipant), "A non-participant should be rejected")
+	AssertEqual(t, 0, len(messages), "No messages should leak to a non-participant")
+}
+
+func TestEditMessageRecordsHistory(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := database.CreateConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+	msg, err := database.AddMessageToConversation(db, conversationID, sender, "first draft")
+	AssertNoError(t, err, "Failed to send message")
+
+	AssertEqual(t, database.ErrNotMessageOwner, database.EditMessage(db, msg.ID, recipient, "hijacked"), "Only the sender may edit a message")
+
+	AssertNoError(t, database.EditMessage(db, msg.ID, sender, "second draft"), "Failed to edit message")
+	AssertNoError(t, database.EditMessage(db, msg.ID, sender, "final"), "Failed to edit message again")
+
+	history, err := database.GetMessageHistory(db, msg.ID, recipient)
+	AssertNoError(t, err, "Failed to load message history")
+	AssertEqual(t, 2, len(history), "Each edit should record one history entry")
+	AssertEqual(t, "first draft", history[0].Content, "The oldest version should come first")
+	AssertEqual(t, "second draft", history[1].Content, "The intermediate version should come second")
+	AssertTrue(t, history[0].ID < history[1].ID, "History should be in edit order")
+
+	messages, err := database.GetConversationMessages(db, conversationID, 10, 0)
+	AssertNoError(t, err, "Failed to load messages")
+	AssertEqual(t, "final", messages[0].Content, "The message should show its latest content")
+	AssertTrue(t, messages[0].EditedAt != nil, "An edited message should carry its edit time")
+
+	_, err = database.GetMessageHistory(db, msg.ID, outsider)
+	AssertEqual(t, database.ErrNotParticipant, err, "Non-participants should not see message history")
+}
+
+func TestReplyToMessage(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	alice, bob, carol := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := database.CreateConversation(db, []int{alice, bob})
+	AssertNoError(t, err, "Failed to create conversation")
+	otherConversationID, err := database.CreateConversation(db, []int{alice, carol})
+	AssertNoError(t, err, "Failed to create second conversation")
+
+	question, err := database.AddMessageToConversation(db, conversationID, alice, "Lunch at noon?")
+	AssertNoError(t, err, "Failed to send message")
+	elsewhere, err := database.AddMessageToConversation(db, otherConversationID, alice, "Not for Bob")
+	AssertNoError(t, err, "Failed to send message in other conversation")
+
+	reply, err := database.AddReplyToConversation(db, conversationID, bob, question.ID, "Sounds good")
+	AssertNoError(t, err, "Failed to send reply")
+	AssertEqual(t, question.ID, reply.ReplyToID, "Reply should reference the quoted message")
+	AssertTrue(t, reply.ReplyTo != nil, "Reply should carry a preview of the quoted message")
+	AssertEqual(t, "Lunch at noon?", reply.ReplyTo.Content, "Preview should quote the message content")
+	AssertEqual(t, alice, reply.ReplyTo.SenderID, "Preview should name the quoted sender")
+
+	messages, err := database.GetConversationMessages(db, conversationID, 10, 0)
+	AssertNoError(t, err, "Failed to load messages")
+	AssertEqual(t, 2, len(messages), "Both messages should be listed")
+	for _, msg := range messages {
+		if msg.ID == reply.ID {
+			AssertTrue(t, msg.ReplyTo != nil, "Listed reply should carry its preview")
+			AssertEqual(t, question.ID, msg.ReplyTo.ID, "Listed reply should quote the right message")
+		} else {
+			AssertTrue(t, msg.ReplyTo == nil, "A plain message should have no preview")
+		}
+	}
+
+	_, err = database.AddReplyToConversation(db, conversationID, bob, elsewhere.ID, "Peeking")
+	AssertEqual(t, database.ErrInvalidReply, err, "Replies must quote a message in the same conversation")
+	_, err = database.AddReplyToConversation(db, conversationID, bob, elsewhere.ID+100, "Into the void")
+	AssertEqual(t, database.ErrInvalidReply, err, "Replies must quote an existing message")
+
+	var stored int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&stored), "Failed to count messages")
+	AssertEqual(t, 2, stored, "Rejected replies should not be stored")
+}
+
+// recordingNotifier captures conversation announcements made by a service
+type recordingNotifier struct {
+	deleted      []int
+	deletedBy    int
+	participants []int
+	left         []int
+	leftBy       int
+}
+
+func (n *recordingNotifier) AnnounceConversationLeft(conversationID, userID int, remaining []int) {
+	n.left = append(n.left, conversationID)
+	n.leftBy = userID
+}
+
+func (n *recordingNotifier) AnnounceConversationDeleted(conversationID, deletedBy int, participants []int) {
+	n.deleted = append(n.deleted, conversationID)
+	n.deletedBy = deletedBy
+	n.participants = participants
+}
+
+func TestMessageServiceDeleteConversation(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	owner, other, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{owner, other})
+	AssertNoError(t, err, "Failed to create conversation")
+	_, err = database.AddMessageToConversation(db, conversationID, other, "Delete me")
+	AssertNoError(t, err, "Failed to send message")
+
+	notifier := &recordingNotifier{}
+	messageService := services.NewMessageService(db)
+	messageService.SetNotifier(notifier)
+
+	t.Run("NonParticipantCannotDelete", func(t *testing.T) {
+		err := messageService.DeleteConversation(conversationID, outsider)
+		AssertTrue(t, errors.Is(err, database.ErrNotParticipant), "Non-participants should be refused")
+		AssertEqual(t, 0, len(notifier.deleted), "Nothing should be announced")
+
+		isParticipant, err := database.IsUserInConversation(db, owner, conversationID)
+		AssertNoError(t, err, "Failed to check membership")
+		AssertTrue(t, isParticipant, "The conversation should still exist")
+	})
+
+	t.Run("ParticipantDeletes", func(t *testing.T) {
+		AssertNoError(t, messageService.DeleteConversation(conversationID, owner), "Participants should be able to delete")
+
+		var remaining int
+		err := db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&remaining)
+		AssertNoError(t, err, "Failed to count messages")
+		AssertEqual(t, 0, remaining, "The conversation's messages should be gone")
+
+		AssertEqual(t, 1, len(notifier.deleted), "The deletion should be announced once")
+		AssertEqual(t, owner, notifier.deletedBy, "The announcement should name who deleted it")
+		AssertEqual(t, 2, len(notifier.participants), "Every former participant should be told")
+	})
+
+	t.Run("UnknownConversation", func(t *testing.T) {
+		err := messageService.DeleteConversation(conversationID, owner)
+		AssertTrue(t, errors.Is(err, database.ErrConversationNotFound), "A deleted conversation should not be found")
+	})
+
+	t.Run("GroupMemberLeavesInstead", func(t *testing.T) {
+		groupID, err := database.CreateConversationAs(db, owner, []int{owner, other, outsider})
+		AssertNoError(t, err, "Failed to create group")
+		deletions := len(notifier.deleted)
+
+		AssertNoError(t, messageService.DeleteConversation(groupID, other), "A group member's delete should succeed as a leave")
+
+		isParticipant, err := database.IsUserInConversation(db, other, groupID)
+		AssertNoError(t, err, "Failed to check membership")
+		AssertFalse(t, isParticipant, "The member should have left the group")
+		isParticipant, err = database.IsUserInConversation(db, owner, groupID)
+		AssertNoError(t, err, "Failed to check membership")
+		AssertTrue(t, isParticipant, "The group should still exist for the others")
+
+		AssertEqual(t, deletions, len(notifier.deleted), "Nothing should be announced as deleted")
+		AssertEqual(t, 1, len(notifier.left), "The leave should be announced once")
+		AssertEqual(t, other, notifier.leftBy, "The announcement should name who left")
+	})
+}
+
+func TestDeleteConversationPermissions(t *testing.T) {
+	db := AppTestSetup(t)
+	uploads.SetBaseDir(filepath.Join(t.TempDir(), "uploads"))
+	t.Cleanup(func() { uploads.SetBaseDir("") })
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	creator, member, other := userIDs[0], userIDs[1], userIDs[2]
+
+	t.Run("GroupMemberCannotDelete", func(t *testing.T) {
+		conversationID, err := database.CreateConversationAs(db, creator, []int{creator, member, other})
+		AssertNoError(t, err, "Failed to create group")
+
+		_, err = database.DeleteConversation(db, conversationID, member)
+		AssertTrue(t, errors.Is(err, database.ErrNotConversationCreator), "Only the creator should delete a group")
+
+		participants, err := database.DeleteConversation(db, conversationID, creator)
+		AssertNoError(t, err, "The creator should be able to delete the group")
+		AssertEqual(t, 3, len(participants), "Every former participant should be returned")
+	})
+
+	t.Run("EitherSideDeletesDirectChat", func(t *testing.T) {
+		conversationID, err := database.CreateConversationAs(db, creator, []int{creator, member})
+		AssertNoError(t, err, "Failed to create conversation")
+
+		_, err = database.DeleteConversation(db, conversationID, member)
+		AssertNoError(t, err, "Either participant should be able to delete a 1:1 chat")
+	})
+
+	t.Run("AttachmentFilesRemoved", func(t *testing.T) {
+		conversationID, err := database.CreateConversationAs(db, creator, []int{creator, member})
+		AssertNoError(t, err, "Failed to create conversation")
+
+		url, err := uploads.Save("attachments", "photo.png", strings.NewReader("png"))
+		AssertNoError(t, err, "Failed to save upload")
+		attachment, err := database.CreateAttachment(db, creator, url, "image/png", 3)
+		AssertNoError(t, err, "Failed to store attachment")
+		_, err = database.AddMessageToConversation(db, conversationID, creator, "", *attachment)
+		AssertNoError(t, err, "Failed to send attachment")
+
+		_, err = database.DeleteConversation(db, conversationID, creator)
+		AssertNoError(t, err, "Deleting should succeed")
+
+		path, _ := uploads.Path(url)
+		_, err = os.Stat(path)
+		AssertTrue(t, os.IsNotExist(err), "The attachment file should be removed with the conversation")
+	})
+}
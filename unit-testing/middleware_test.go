@@ -1,11 +1,15 @@
 package unit_testing
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"connecthub/database"
+	"connecthub/origin"
 	"connecthub/server"
 )
 
@@ -437,3 +441,165 @@ func TestSecurityFeatures(t *testing.T) {
 		// Content is stored as-is, sanitization should happen during rendering
 	})
 }
+
+func TestCORSMiddleware(t *testing.T) {
+	reached := false
+	handler := server.CORSMiddleware(origin.NewPolicy([]string{"https://app.example.com"}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reached = true
+			w.WriteHeader(http.StatusOK)
+		}))
+
+	preflight := func(requestOrigin string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "http://forum.example.com/api/posts", nil)
+		req.Header.Set("Origin", requestOrigin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("AllowedPreflight", func(t *testing.T) {
+		reached = false
+		w := preflight("https://app.example.com")
+		AssertEqual(t, http.StatusNoContent, w.Code, "Allowed preflight should succeed")
+		AssertEqual(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"), "Allowed origin should be echoed")
+		AssertEqual(t, "Content-Type", w.Header().Get("Access-Control-Allow-Headers"), "Requested headers should be allowed")
+		AssertFalse(t, reached, "Preflight should not reach the handler")
+	})
+
+	t.Run("DisallowedPreflight", func(t *testing.T) {
+		w := preflight("https://evil.example.com")
+		AssertEqual(t, http.StatusForbidden, w.Code, "Disallowed preflight should be rejected")
+		AssertEqual(t, "", w.Header().Get("Access-Control-Allow-Origin"), "Disallowed origin should not be echoed")
+	})
+
+	t.Run("DisallowedRequest", func(t *testing.T) {
+		reached = false
+		req := httptest.NewRequest("POST", "http://forum.example.com/api/post/create", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		AssertEqual(t, http.StatusForbidden, w.Code, "Disallowed cross-origin request should be rejected")
+		AssertFalse(t, reached, "Rejected request should not reach the handler")
+	})
+
+	t.Run("SameOriginByDefault", func(t *testing.T) {
+		sameOrigin := server.CORSMiddleware(origin.NewPolicy(nil))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+		req := httptest.NewRequest("GET", "http://forum.example.com/api/posts", nil)
+		req.Header.Set("Origin", "http://forum.example.com")
+		w := httptest.NewRecorder()
+		sameOrigin.ServeHTTP(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Same-origin request should pass with no configured origins")
+
+		req = httptest.NewRequest("GET", "http://forum.example.com/api/posts", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w = httptest.NewRecorder()
+		sameOrigin.ServeHTTP(w, req)
+		AssertEqual(t, http.StatusForbidden, w.Code, "Cross-origin request should be rejected with no configured origins")
+	})
+
+	t.Run("WildcardWithoutCredentials", func(t *testing.T) {
+		anyOrigin := server.CORSMiddleware(origin.NewPolicy([]string{origin.Wildcard, "https://app.example.com"}))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }))
+
+		req := httptest.NewRequest("GET", "http://forum.example.com/api/posts", nil)
+		req.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+		anyOrigin.ServeHTTP(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "The wildcard should allow any origin")
+		AssertEqual(t, "*", w.Header().Get("Access-Control-Allow-Origin"), "An origin allowed only by the wildcard should not be echoed")
+		AssertEqual(t, "", w.Header().Get("Access-Control-Allow-Credentials"), "An origin allowed only by the wildcard should not get credentials")
+
+		req = httptest.NewRequest("GET", "http://forum.example.com/api/posts", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		w = httptest.NewRecorder()
+		anyOrigin.ServeHTTP(w, req)
+		AssertEqual(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"), "A listed origin should still be echoed")
+		AssertEqual(t, "true", w.Header().Get("Access-Control-Allow-Credentials"), "A listed origin should still get credentials")
+	})
+}
+
+func TestAuthMiddlewareAPIVersusPage(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	admin, member := userIDs[0], userIDs[1]
+
+	AssertNoError(t, server.SetAdmins(db, []string{UserFixtures[0].Username}), "Failed to set admins")
+	t.Cleanup(func() { server.SetAdmins(nil, nil) })
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+
+	serve := func(handler http.HandlerFunc, path, accept, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		if session != "" {
+			req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		}
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+
+	apiCode := func(rr *httptest.ResponseRecorder) string {
+		var apiErr server.APIError
+		AssertNoError(t, json.Unmarshal(rr.Body.Bytes(), &apiErr), "API errors should be JSON")
+		return apiErr.Code
+	}
+
+	t.Run("UnauthenticatedAPICall", func(t *testing.T) {
+		rr := serve(server.AuthMiddleware(ok), "/api/conversations", "", "")
+		AssertEqual(t, http.StatusUnauthorized, rr.Code, "API calls without a session should get 401")
+		AssertEqual(t, "application/json", rr.Header().Get("Content-Type"), "API calls should get JSON")
+		AssertEqual(t, "UNAUTHORIZED", apiCode(rr), "Missing sessions should be reported as such")
+
+		rr = serve(server.AuthMiddleware(ok), "/api/conversations", "", "no-such-session")
+		AssertEqual(t, http.StatusUnauthorized, rr.Code, "API calls with a bad session should get 401")
+		AssertEqual(t, "INVALID_SESSION", apiCode(rr), "Invalid sessions should be reported as such")
+	})
+
+	t.Run("UnauthenticatedPage", func(t *testing.T) {
+		rr := serve(server.AuthMiddleware(ok), "/home", "text/html", "")
+		AssertEqual(t, http.StatusFound, rr.Code, "Pages without a session should redirect")
+		AssertEqual(t, "/", rr.Header().Get("Location"), "Pages should redirect to the login page")
+
+		rr = serve(server.AuthMiddleware(ok), "/home", "application/json", "")
+		AssertEqual(t, http.StatusUnauthorized, rr.Code, "Clients asking for JSON should get 401 off the API path too")
+	})
+
+	t.Run("AdminRole", func(t *testing.T) {
+		rr := serve(server.AdminMiddleware(ok), "/api/categories", "", "")
+		AssertEqual(t, http.StatusUnauthorized, rr.Code, "Admin routes still need a session first")
+
+		rr = serve(server.AdminMiddleware(ok), "/api/categories", "", CreateAppSession(t, db, member))
+		AssertEqual(t, http.StatusForbidden, rr.Code, "A valid session without the role should get 403")
+		AssertEqual(t, "FORBIDDEN", apiCode(rr), "Missing roles should be reported as forbidden")
+
+		rr = serve(server.AdminMiddleware(ok), "/api/categories", "", CreateAppSession(t, db, admin))
+		AssertEqual(t, http.StatusOK, rr.Code, "Admins should get through")
+	})
+
+	t.Run("UnclaimedAdminName", func(t *testing.T) {
+		AssertNoError(t, server.SetAdmins(db, []string{UserFixtures[0].Username, "SysOp"}), "Failed to set admins")
+
+		body := `{"firstName":"Sys","lastName":"Op","username":"sysop","email":"sysop@example.com","gender":"other","dateOfBirth":"1990-01-01","password":"password123"}`
+		req := httptest.NewRequest("POST", "/api/signup", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		server.SignupAPI(rr, req)
+		AssertEqual(t, http.StatusUnprocessableEntity, rr.Code, "Signing up under a configured admin name should be refused")
+		AssertTrue(t, strings.Contains(rr.Body.String(), "reserved"), "The refusal should say the name is reserved")
+
+		// An account that appears after startup does not pick up the role
+		latecomer, err := database.CreateUser(db, "Sys", "Op", "sysop", "sysop@example.com", "other", "1990-01-01", "password123")
+		AssertNoError(t, err, "Failed to create account directly")
+		rr = serve(server.AdminMiddleware(ok), "/api/categories", "", CreateAppSession(t, db, latecomer))
+		AssertEqual(t, http.StatusForbidden, rr.Code, "Admin names are resolved to accounts once, at startup")
+	})
+}
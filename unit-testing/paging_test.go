@@ -0,0 +1,51 @@
+package unit_testing
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"connecthub/paging"
+)
+
+func TestPagingParse(t *testing.T) {
+	parse := func(query string) (int, int) {
+		return paging.Parse(httptest.NewRequest("GET", "/api/posts"+query, nil))
+	}
+
+	cases := []struct {
+		query         string
+		limit, offset int
+		what          string
+	}{
+		{"", 20, 0, "No parameters should give the first default page"},
+		{"?limit=9999", 100, 0, "Oversized limits should be capped"},
+		{"?page=-1", 20, 0, "Negative pages should be clamped to page 1"},
+		{"?page=0&limit=10", 10, 0, "Page zero should be clamped to page 1"},
+		{"?page=3&limit=10", 10, 20, "Pages should skip the earlier pages"},
+		{"?limit=-5&page=2", 20, 20, "Negative limits should fall back to the default"},
+		{"?limit=abc&page=xyz", 20, 0, "Malformed values should fall back to the defaults"},
+		{"?offset=-10", 20, 0, "Negative offsets should be clamped to zero"},
+		{"?offset=7&page=5", 20, 7, "An explicit offset should win over page"},
+	}
+	for _, c := range cases {
+		limit, offset := parse(c.query)
+		AssertEqual(t, c.limit, limit, fmt.Sprintf("%s (limit for %q)", c.what, c.query))
+		AssertEqual(t, c.offset, offset, fmt.Sprintf("%s (offset for %q)", c.what, c.query))
+	}
+
+	t.Run("ConfiguredLimits", func(t *testing.T) {
+		paging.SetLimits(5, 50)
+		t.Cleanup(func() { paging.SetLimits(paging.DefaultLimit, paging.DefaultMaxLimit) })
+
+		limit, _ := parse("")
+		AssertEqual(t, 5, limit, "The configured default should apply")
+		limit, _ = parse("?limit=9999")
+		AssertEqual(t, 50, limit, "The configured maximum should apply")
+	})
+
+	t.Run("Requested", func(t *testing.T) {
+		AssertFalse(t, paging.Requested(httptest.NewRequest("GET", "/api/posts?tab=posts", nil)), "Other parameters do not ask for a page")
+		AssertTrue(t, paging.Requested(httptest.NewRequest("GET", "/api/posts?page=2", nil)), "page asks for a page")
+	})
+}
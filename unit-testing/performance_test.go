@@ -13,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"connecthub/database"
 	"connecthub/server"
 )
 
@@ -396,6 +397,40 @@ func BenchmarkDatabaseOperations(b *testing.B) {
 	})
 }
 
+// BenchmarkUserConversations loads a user's 20 conversations and reports the statements issued per load
+func BenchmarkUserConversations(b *testing.B) {
+	db := AppTestSetup(b)
+
+	var userIDs []int
+	for i := 0; i < 21; i++ {
+		userID, err := CreateTestUser(db, TestUser{
+			Username:  fmt.Sprintf("benchuser%d", i),
+			Email:     fmt.Sprintf("benchuser%d@example.com", i),
+			Password:  "password123",
+			FirstName: "Bench",
+			LastName:  "User",
+		})
+		if err != nil {
+			b.Fatalf("Failed to create user: %v", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	seedConversations(b, db, userIDs[0], userIDs[1:])
+
+	countingDB := OpenCountingDB(b, "./database/main.db")
+
+	ResetQueryCount()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := database.GetUserConversations(countingDB, userIDs[0]); err != nil {
+			b.Fatalf("Failed to load conversations: %v", err)
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(QueryCount())/float64(b.N), "queries/op")
+}
+
 // TestLoadTestUserRegistration performs load testing on user registration
 func TestLoadTestUserRegistration(t *testing.T) {
 	if testing.Short() {
@@ -3,12 +3,18 @@ package unit_testing
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
 
 	"connecthub/database"
 	"connecthub/server"
@@ -436,3 +442,608 @@ func TestCategoriesAPI(t *testing.T) {
 		}
 	})
 }
+
+func TestCreatePostAPIReturnsHydratedPost(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+	sessionToken := CreateAppSession(t, db, userID)
+
+	createReq := server.CreatePostRequest{
+		Title:      "Hydrated Post",
+		Content:    "Response should carry the full post",
+		Categories: []string{"2", "5"},
+	}
+
+	body, _ := json.Marshal(createReq)
+	req := httptest.NewRequest("POST", "/api/post/create", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+
+	w := httptest.NewRecorder()
+	server.CreatePostAPI(w, req)
+
+	AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+	var response server.CreatePostResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	AssertNoError(t, err, "Failed to unmarshal response")
+
+	AssertTrue(t, response.Success, "Post creation should succeed")
+	AssertTrue(t, response.Post != nil, "Response should include the created post")
+	AssertEqual(t, response.PostID, response.Post.PostID, "Post ID should match the embedded post")
+	AssertEqual(t, "Hydrated Post", response.Post.Title, "Title should match")
+	AssertEqual(t, UserFixtures[0].Username, response.Post.Username, "Author username should be set")
+	AssertEqual(t, UserFixtures[0].FirstName, response.Post.FirstName, "Author first name should be set")
+
+	AssertEqual(t, len(createReq.Categories), len(response.Post.Categories), "Category count should match")
+	for i, category := range response.Post.Categories {
+		AssertEqual(t, createReq.Categories[i], strconv.Itoa(category.ID), "Category should match submitted ID")
+	}
+}
+
+func TestPostSlugs(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	firstID, err := database.CreatePost(db, userID, "Hello, World!", "First", []string{"Go"})
+	AssertNoError(t, err, "First post creation should succeed")
+	secondID, err := database.CreatePost(db, userID, "Hello World", "Second", []string{"Go"})
+	AssertNoError(t, err, "Second post creation should succeed")
+	untitledID, err := database.CreatePost(db, userID, "!!!", "Third", []string{"Go"})
+	AssertNoError(t, err, "Untitled post creation should succeed")
+
+	first, err := database.GetPostByID(db, firstID)
+	AssertNoError(t, err, "Failed to load first post")
+	second, err := database.GetPostByID(db, secondID)
+	AssertNoError(t, err, "Failed to load second post")
+	untitled, err := database.GetPostByID(db, untitledID)
+	AssertNoError(t, err, "Failed to load untitled post")
+
+	AssertEqual(t, "hello-world", first.Slug, "First slug should be derived from the title")
+	AssertEqual(t, "hello-world-2", second.Slug, "Duplicate title should get a numeric suffix")
+	AssertEqual(t, strconv.Itoa(untitledID), untitled.Slug, "Empty slug should fall back to the post ID")
+
+	t.Run("LookupBySlug", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/post/by-slug?slug=hello-world-2", nil)
+		w := httptest.NewRecorder()
+		server.GetPostBySlugAPI(w, req)
+
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		var response struct {
+			Post database.Post `json:"post"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		AssertNoError(t, err, "Failed to unmarshal response")
+		AssertEqual(t, secondID, response.Post.PostID, "Slug should resolve to the second post")
+	})
+
+	t.Run("UnknownSlug", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/post/by-slug?slug=missing", nil)
+		w := httptest.NewRecorder()
+		server.GetPostBySlugAPI(w, req)
+
+		AssertEqual(t, http.StatusNotFound, w.Code, "Unknown slug should return 404")
+	})
+
+	t.Run("MissingSlug", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/post/by-slug", nil)
+		w := httptest.NewRecorder()
+		server.GetPostBySlugAPI(w, req)
+
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Missing slug should return 400")
+	})
+}
+
+func TestUserLikedAndCommentedPosts(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, reader := userIDs[0], userIDs[1]
+
+	commentedID, err := database.CreatePost(db, author, "Commented Post", "Reader replies here", []string{"Go"})
+	AssertNoError(t, err, "Failed to create commented post")
+	likedID, err := database.CreatePost(db, author, "Liked Post", "Reader likes this", []string{"Go"})
+	AssertNoError(t, err, "Failed to create liked post")
+
+	AssertNoError(t, database.AddComment(db, commentedID, reader, "Nice write-up"), "Failed to add comment")
+	AssertNoError(t, database.LikePost(db, reader, likedID), "Failed to like post")
+
+	fetch := func(handler http.HandlerFunc, path string, userID int) server.UserPostsResponse {
+		req := httptest.NewRequest("GET", path, nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(userID)})
+		w := httptest.NewRecorder()
+		handler(w, req)
+
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+		var response server.UserPostsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		AssertNoError(t, err, "Failed to unmarshal response")
+		return response
+	}
+
+	postIDs := func(posts []database.Post) map[int]bool {
+		ids := make(map[int]bool)
+		for _, post := range posts {
+			ids[post.PostID] = true
+		}
+		return ids
+	}
+
+	t.Run("Liked", func(t *testing.T) {
+		response := fetch(server.GetUserLikedPostsAPI, "/api/users/x/liked", reader)
+		ids := postIDs(response.Posts)
+		AssertTrue(t, ids[likedID], "Liked post should be listed")
+		AssertFalse(t, ids[commentedID], "Post the user only commented on should not be listed as liked")
+	})
+
+	t.Run("Commented", func(t *testing.T) {
+		response := fetch(server.GetUserCommentedPostsAPI, "/api/users/x/commented", reader)
+		ids := postIDs(response.Posts)
+		AssertTrue(t, ids[commentedID], "Commented post should be listed")
+		AssertFalse(t, ids[likedID], "Post the user only liked should not be listed as commented")
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		AssertNoError(t, database.LikePost(db, reader, commentedID), "Failed to like second post")
+
+		first := fetch(server.GetUserLikedPostsAPI, "/api/users/x/liked?limit=1", reader)
+		second := fetch(server.GetUserLikedPostsAPI, "/api/users/x/liked?limit=1&offset=1", reader)
+		AssertEqual(t, 1, len(first.Posts), "First page should hold one post")
+		AssertEqual(t, 1, len(second.Posts), "Second page should hold one post")
+		AssertNotEqual(t, first.Posts[0].PostID, second.Posts[0].PostID, "Pages should not overlap")
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/users/9999/liked", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": "9999"})
+		w := httptest.NewRecorder()
+		server.GetUserLikedPostsAPI(w, req)
+		AssertEqual(t, http.StatusNotFound, w.Code, "Unknown user should return 404")
+	})
+}
+
+func TestGetPostByIDStatusCodes(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+	postID, err := database.CreatePost(db, userID, "Existing Post", "Content", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/post?"+query, nil)
+		w := httptest.NewRecorder()
+		server.GetPostByID(w, req)
+		return w
+	}
+
+	errorCode := func(w *httptest.ResponseRecorder) string {
+		var apiErr server.APIError
+		err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+		AssertNoError(t, err, "Error body should be JSON")
+		return apiErr.Code
+	}
+
+	t.Run("ExistingPost", func(t *testing.T) {
+		w := get("id=" + strconv.Itoa(postID))
+		AssertEqual(t, http.StatusOK, w.Code, "Existing post should return 200")
+	})
+
+	t.Run("NonexistentPost", func(t *testing.T) {
+		w := get("id=99999")
+		AssertEqual(t, http.StatusNotFound, w.Code, "Unknown post should return 404")
+		AssertEqual(t, "POST_NOT_FOUND", errorCode(w), "Error code should identify a missing post")
+	})
+
+	t.Run("MalformedID", func(t *testing.T) {
+		for _, id := range []string{"abc", "0", "-4", "1.5"} {
+			w := get("id=" + id)
+			AssertEqual(t, http.StatusBadRequest, w.Code, "Malformed id "+id+" should return 400")
+		}
+	})
+
+	t.Run("DatabaseError", func(t *testing.T) {
+		_, err := db.Exec("ALTER TABLE post RENAME TO post_unavailable")
+		AssertNoError(t, err, "Failed to break post table")
+
+		w := get("id=" + strconv.Itoa(postID))
+		AssertEqual(t, http.StatusInternalServerError, w.Code, "Database failure should return 500")
+		AssertEqual(t, "DATABASE_ERROR", errorCode(w), "Error code should identify a database failure")
+	})
+}
+
+func TestInlinePostImages(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	imageDir := filepath.Join("src", "static", "uploads", "posts")
+	AssertNoError(t, os.MkdirAll(imageDir, 0755), "Failed to create image directory")
+
+	pngHeader := []byte("\x89PNG\r\n\x1a\n")
+	writeImage := func(name string, size int) string {
+		data := append(append([]byte{}, pngHeader...), make([]byte, size)...)
+		AssertNoError(t, os.WriteFile(filepath.Join(imageDir, name), data, 0644), "Failed to write image")
+		return "/static/uploads/posts/" + name
+	}
+
+	smallID, err := database.CreatePost(db, userID, "Small Image", "Content", []string{"Go"})
+	AssertNoError(t, err, "Failed to create small image post")
+	AssertNoError(t, database.SetPostImage(db, smallID, writeImage("small.png", 1024)), "Failed to set small image")
+
+	largeID, err := database.CreatePost(db, userID, "Large Image", "Content", []string{"Go"})
+	AssertNoError(t, err, "Failed to create large image post")
+	AssertNoError(t, database.SetPostImage(db, largeID, writeImage("large.png", 200<<10)), "Failed to set large image")
+
+	fetchPost := func(postID int, inline bool) database.Post {
+		url := "/api/post?id=" + strconv.Itoa(postID)
+		if inline {
+			url += "&inline=true"
+		}
+		req := httptest.NewRequest("GET", url, nil)
+		w := httptest.NewRecorder()
+		server.GetPostByID(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		var response struct {
+			Post database.Post `json:"post"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return response.Post
+	}
+
+	t.Run("SmallImageInlined", func(t *testing.T) {
+		post := fetchPost(smallID, true)
+		AssertTrue(t, strings.HasPrefix(post.ImageBase64, "data:image/png;base64,"), "Small image should be inlined as a PNG data URI")
+	})
+
+	t.Run("LargeImageNotInlined", func(t *testing.T) {
+		post := fetchPost(largeID, true)
+		AssertEqual(t, "", post.ImageBase64, "Images over the size cap should not be inlined")
+		AssertEqual(t, "/static/uploads/posts/large.png", post.Image.String, "Large image should still expose its path")
+	})
+
+	t.Run("InlineIsOptIn", func(t *testing.T) {
+		post := fetchPost(smallID, false)
+		AssertEqual(t, "", post.ImageBase64, "Images should not be inlined unless requested")
+	})
+
+	t.Run("FeedInline", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/posts?inline=true", nil)
+		w := httptest.NewRecorder()
+		server.GetPosts(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		var posts []database.Post
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &posts), "Failed to unmarshal posts")
+		for _, post := range posts {
+			switch post.PostID {
+			case smallID:
+				AssertTrue(t, strings.HasPrefix(post.ImageBase64, "data:image/png;base64,"), "Small image should be inlined in the feed")
+			case largeID:
+				AssertEqual(t, "", post.ImageBase64, "Large image should not be inlined in the feed")
+			}
+		}
+	})
+}
+
+func TestCreatePostAPIBodyLimit(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	_, err = database.CreateCategory(db, "Technology")
+	AssertNoError(t, err, "Failed to create category")
+	sessionToken := CreateAppSession(t, db, userIDs[0])
+
+	const limit = 4 << 10
+	handler := server.BodyLimitMiddleware(limit, 4*limit)(http.HandlerFunc(server.CreatePostAPI))
+
+	countPosts := func() int {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM post").Scan(&n)
+		return n
+	}
+
+	post := func(content string, streamed bool) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.CreatePostRequest{
+			Title:      "Body limit",
+			Content:    content,
+			Categories: []string{"Technology"},
+		})
+		req := httptest.NewRequest("POST", "/api/post/create", bytes.NewBuffer(body))
+		if streamed {
+			// Hide the length so the limit is enforced while decoding
+			req.ContentLength = -1
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("DeclaredLengthOverLimit", func(t *testing.T) {
+		before := countPosts()
+		w := post(strings.Repeat("a", 2*limit), false)
+		AssertEqual(t, http.StatusRequestEntityTooLarge, w.Code, "Oversized body should be rejected with 413")
+		AssertEqual(t, before, countPosts(), "No post should be created")
+	})
+
+	t.Run("StreamedOverLimit", func(t *testing.T) {
+		before := countPosts()
+		w := post(strings.Repeat("a", 2*limit), true)
+		AssertEqual(t, http.StatusRequestEntityTooLarge, w.Code, "Oversized streamed body should be rejected with 413")
+		AssertEqual(t, before, countPosts(), "No post should be created")
+	})
+
+	t.Run("UnderLimit", func(t *testing.T) {
+		w := post("A post that fits comfortably", false)
+		AssertEqual(t, http.StatusOK, w.Code, "Small bodies should pass the limit")
+	})
+}
+
+func TestCreatePostUnknownCategory(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	admin, member := userIDs[0], userIDs[1]
+
+	AssertNoError(t, server.SetAdmins(db, []string{UserFixtures[0].Username}), "Failed to set admins")
+	t.Cleanup(func() { server.SetAdmins(nil, nil) })
+
+	countPosts := func() int {
+		var n int
+		db.QueryRow("SELECT COUNT(*) FROM post").Scan(&n)
+		return n
+	}
+
+	createPost := func(userID int, categories []string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.CreatePostRequest{Title: "Taxonomy", Content: "Filed carefully", Categories: categories})
+		req := httptest.NewRequest("POST", "/api/post/create", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.CreatePostAPI(w, req)
+		return w
+	}
+
+	createCategory := func(userID int, name string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.CreateCategoryRequest{Name: name})
+		req := httptest.NewRequest("POST", "/api/categories", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.AdminMiddleware(server.CreateCategoryAPI)(w, req)
+		return w
+	}
+
+	t.Run("UnknownNameRejected", func(t *testing.T) {
+		before := countPosts()
+		w := createPost(member, []string{"Go", "Underwater Basket Weaving"})
+		AssertEqual(t, http.StatusBadRequest, w.Code, "An unknown category should be rejected")
+		AssertEqual(t, before, countPosts(), "No post should be created")
+
+		var exists int
+		db.QueryRow("SELECT COUNT(*) FROM categories WHERE name = ?", "Underwater Basket Weaving").Scan(&exists)
+		AssertEqual(t, 0, exists, "The category should not be created")
+	})
+
+	t.Run("OnlyAdminsCreateCategories", func(t *testing.T) {
+		w := createCategory(member, "Underwater Basket Weaving")
+		AssertEqual(t, http.StatusForbidden, w.Code, "Members should not create categories")
+
+		w = createCategory(admin, "Underwater Basket Weaving")
+		AssertEqual(t, http.StatusCreated, w.Code, "Admins should create categories")
+
+		w = createCategory(admin, "underwater basket weaving")
+		AssertEqual(t, http.StatusConflict, w.Code, "Duplicate names should be refused")
+
+		w = createPost(member, []string{"Underwater Basket Weaving"})
+		AssertEqual(t, http.StatusOK, w.Code, "Posts should accept the new category")
+	})
+}
+
+func TestPinnedPostsSortFirst(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	admin, author := userIDs[0], userIDs[1]
+
+	AssertNoError(t, server.SetAdmins(db, []string{UserFixtures[0].Username}), "Failed to set admins")
+	t.Cleanup(func() { server.SetAdmins(nil, nil) })
+
+	olderID, err := database.CreatePost(db, author, "Older post", "Written first", []string{"Go"})
+	AssertNoError(t, err, "Failed to create older post")
+	_, err = db.Exec("UPDATE post SET post_at = ? WHERE postid = ?", time.Now().Add(-time.Hour).Format("2006-01-02 15:04:05"), olderID)
+	AssertNoError(t, err, "Failed to backdate post")
+	newerID, err := database.CreatePost(db, author, "Newer post", "Written later", []string{"Go"})
+	AssertNoError(t, err, "Failed to create newer post")
+
+	pin := func(userID, postID int, scope string) int {
+		req := httptest.NewRequest("POST", "/api/post/pin?id="+strconv.Itoa(postID)+"&scope="+scope, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userID)})
+		w := httptest.NewRecorder()
+		server.PinPostAPI(w, req)
+		return w.Code
+	}
+
+	posts, err := database.GetAllPosts(db)
+	AssertNoError(t, err, "Failed to load feed")
+	AssertEqual(t, newerID, posts[0].PostID, "Without pins the newest post should lead the feed")
+
+	AssertEqual(t, http.StatusForbidden, pin(author, olderID, "global"), "Authors should not pin to the main feed")
+	AssertEqual(t, http.StatusForbidden, pin(admin, olderID, "profile"), "Only the author should pin to their profile")
+	AssertEqual(t, http.StatusBadRequest, pin(admin, olderID, "sideways"), "Unknown scopes should be rejected")
+
+	AssertEqual(t, http.StatusOK, pin(admin, olderID, "global"), "Admins should pin to the main feed")
+	posts, err = database.GetAllPosts(db)
+	AssertNoError(t, err, "Failed to load feed")
+	AssertEqual(t, olderID, posts[0].PostID, "A pinned post should appear before a newer unpinned post")
+	AssertTrue(t, posts[0].IsPinned, "The pinned post should be flagged")
+
+	profile, err := database.GetPostsByUser(db, author)
+	AssertNoError(t, err, "Failed to load profile feed")
+	AssertEqual(t, newerID, profile[0].PostID, "A global pin should not reorder the profile feed")
+
+	AssertEqual(t, http.StatusOK, pin(author, olderID, "profile"), "Authors should pin to their own profile")
+	profile, err = database.GetPostsByUser(db, author)
+	AssertNoError(t, err, "Failed to load profile feed")
+	AssertEqual(t, olderID, profile[0].PostID, "A profile pin should lead the author's feed")
+
+	AssertNoError(t, database.UnpinPost(db, olderID, database.PinGlobal), "Failed to unpin post")
+	posts, err = database.GetAllPosts(db)
+	AssertNoError(t, err, "Failed to load feed")
+	AssertEqual(t, newerID, posts[0].PostID, "An unpinned post should return to date order")
+}
+
+func TestPostsByCategoryID(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	zig, err := database.CreateCategory(db, "Zig")
+	AssertNoError(t, err, "Failed to create category Zig")
+	zigpp, err := database.CreateCategory(db, "Zig++")
+	AssertNoError(t, err, "Failed to create category Zig++")
+
+	zigPostID, err := database.CreatePost(db, userIDs[0], "Pointers", "Manual memory", []string{zig.Name})
+	AssertNoError(t, err, "Failed to create Zig post")
+	for i := 0; i < 2; i++ {
+		_, err := database.CreatePost(db, userIDs[0], "Templates "+strconv.Itoa(i), "Compile time", []string{zigpp.Name})
+		AssertNoError(t, err, "Failed to create Zig++ post")
+	}
+
+	posts, err := database.GetPostsByCategoryID(db, zig.ID, 0, 0)
+	AssertNoError(t, err, "Failed to fetch posts by category id")
+	AssertEqual(t, 1, len(posts), "Only the Zig post should be returned")
+	AssertEqual(t, zigPostID, posts[0].PostID, "The Zig post should be returned")
+
+	posts, err = database.GetPostsByCategoryID(db, zigpp.ID, 1, 1)
+	AssertNoError(t, err, "Failed to fetch a page of posts by category id")
+	AssertEqual(t, 1, len(posts), "The page should hold one post")
+
+	_, err = database.GetPostsByCategoryID(db, zigpp.ID+100, 0, 0)
+	AssertEqual(t, database.ErrUnknownCategory, err, "An unknown category id should be reported")
+
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		server.GetPosts(w, httptest.NewRequest("GET", "/api/posts?"+query, nil))
+		return w
+	}
+
+	w := get("category_id=" + strconv.Itoa(zigpp.ID))
+	AssertEqual(t, http.StatusOK, w.Code, "Fetching by category id should succeed")
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &posts), "Failed to decode posts")
+	AssertEqual(t, 2, len(posts), "Both Zig++ posts should be returned")
+	for _, post := range posts {
+		AssertEqual(t, "Zig++", post.Categories[0].Name, "Only Zig++ posts should be returned")
+	}
+
+	AssertEqual(t, http.StatusNotFound, get("category_id="+strconv.Itoa(zigpp.ID+100)).Code, "Unknown category ids should be not found")
+	AssertEqual(t, http.StatusBadRequest, get("category_id=abc").Code, "Malformed category ids should be rejected")
+}
+
+func TestFeedMarksPostsLikedByMe(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	viewer, other := userIDs[0], userIDs[1]
+
+	likedID, err := database.CreatePost(db, other, "Post A", "Worth a like", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post A")
+	unlikedID, err := database.CreatePost(db, other, "Post B", "Not for everyone", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post B")
+
+	AssertNoError(t, database.LikePost(db, viewer, likedID), "Failed to like post A")
+	AssertNoError(t, database.DislikePost(db, viewer, unlikedID), "Failed to dislike post B")
+	AssertNoError(t, database.LikePost(db, other, unlikedID), "Failed to like post B as another user")
+
+	feed := func(query string, cookies ...*http.Cookie) map[int]bool {
+		req := httptest.NewRequest("GET", "/api/posts"+query, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		server.GetPosts(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Feed should load")
+
+		var posts []database.Post
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &posts), "Failed to decode feed")
+		liked := map[int]bool{}
+		for _, post := range posts {
+			liked[post.PostID] = post.LikedByMe
+		}
+		AssertEqual(t, 2, len(liked), "Both posts should be in the feed")
+		return liked
+	}
+
+	session := &http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, viewer)}
+	liked := feed("", session)
+	AssertTrue(t, liked[likedID], "Post A should be marked liked by the viewer")
+	AssertFalse(t, liked[unlikedID], "Post B should not be marked liked by the viewer")
+
+	liked = feed("")
+	AssertFalse(t, liked[likedID] || liked[unlikedID], "Anonymous viewers should see nothing marked liked")
+
+	var goID int
+	AssertNoError(t, db.QueryRow("SELECT idcategories FROM categories WHERE name = 'Go'").Scan(&goID), "Failed to look up category")
+	since := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	for _, query := range []string{"?category_id=" + strconv.Itoa(goID), "?since=" + url.QueryEscape(since)} {
+		liked = feed(query, session)
+		AssertTrue(t, liked[likedID], "Post A should be marked liked for "+query)
+		AssertFalse(t, liked[unlikedID], "Post B should not be marked liked for "+query)
+	}
+}
+
+func TestPostCommentsAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	postID, err := database.CreatePost(db, userIDs[0], "Lazy comments", "Comments load separately", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+	for i := 1; i <= 5; i++ {
+		err := database.AddComment(db, postID, userIDs[i%2], fmt.Sprintf("Comment %d", i))
+		AssertNoError(t, err, "Failed to add comment")
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/post/comments?"+query, nil)
+		w := httptest.NewRecorder()
+		server.PostCommentsAPI(w, req)
+		return w
+	}
+
+	w := get(fmt.Sprintf("id=%d&page=2&limit=2", postID))
+	AssertEqual(t, http.StatusOK, w.Code, "Fetching comments should succeed")
+
+	var response struct {
+		Comments []database.Comment `json:"comments"`
+		Total    int                `json:"total"`
+		HasMore  bool               `json:"has_more"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode comments")
+	AssertEqual(t, 5, response.Total, "Total should count every comment")
+	AssertEqual(t, 2, len(response.Comments), "The page should hold two comments")
+	AssertEqual(t, "Comment 3", response.Comments[0].Content, "The second page should start at the third comment")
+	AssertEqual(t, "Comment 4", response.Comments[1].Content, "Comments should be oldest first")
+	AssertEqual(t, UserFixtures[1].Username, response.Comments[0].Username, "Comments should carry their author's username")
+	AssertEqual(t, UserFixtures[0].Username, response.Comments[1].Username, "Comments should carry their author's username")
+	AssertTrue(t, response.HasMore, "A third page should follow")
+
+	AssertEqual(t, http.StatusNotFound, get("id=99999").Code, "Unknown posts should get a 404")
+	AssertEqual(t, http.StatusBadRequest, get("id=abc").Code, "Malformed ids should be rejected")
+}
@@ -1,10 +1,17 @@
 package unit_testing
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
+	"connecthub/database"
 	"connecthub/repository"
+	"connecthub/server"
 	"connecthub/server/services"
 )
 
@@ -350,3 +357,741 @@ func TestPostTestRepository(t *testing.T) {
 		}
 	})
 }
+
+func TestCreatePostCategoryResolution(t *testing.T) {
+	db := AppTestSetup(t)
+
+	// New names are created on the fly only when ad-hoc categories are allowed
+	database.SetAllowAdHocCategories(true)
+	t.Cleanup(func() { database.SetAllowAdHocCategories(false) })
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	// Seeded categories: 1 = Git, 2 = Go, 3 = JS
+	categoryNames := func(postID int) map[string]bool {
+		categories, err := database.GetCategoriesForPost(db, postID)
+		AssertNoError(t, err, "Failed to fetch post categories")
+		names := make(map[string]bool)
+		for _, category := range categories {
+			names[category.Name] = true
+		}
+		return names
+	}
+
+	t.Run("PureNames", func(t *testing.T) {
+		postID, err := database.CreatePost(db, userID, "Names", "Content", []string{"Go", "JS"})
+		AssertNoError(t, err, "Post creation should succeed")
+
+		names := categoryNames(postID)
+		AssertEqual(t, 2, len(names), "Should link two categories")
+		AssertTrue(t, names["Go"] && names["JS"], "Should link Go and JS")
+	})
+
+	t.Run("PureIDs", func(t *testing.T) {
+		postID, err := database.CreatePost(db, userID, "IDs", "Content", []string{"1", "2"})
+		AssertNoError(t, err, "Post creation should succeed")
+
+		names := categoryNames(postID)
+		AssertEqual(t, 2, len(names), "Should link two categories")
+		AssertTrue(t, names["Git"] && names["Go"], "Should link Git and Go")
+	})
+
+	t.Run("MixedNamesAndIDs", func(t *testing.T) {
+		postID, err := database.CreatePost(db, userID, "Mixed", "Content", []string{"1", "JS", "Brand New Topic"})
+		AssertNoError(t, err, "Post creation should succeed")
+
+		names := categoryNames(postID)
+		AssertEqual(t, 3, len(names), "Should link three categories")
+		AssertTrue(t, names["Git"] && names["JS"] && names["Brand New Topic"], "Should link Git, JS and the new category")
+	})
+
+	t.Run("UnknownIDRejected", func(t *testing.T) {
+		_, err := database.CreatePost(db, userID, "Unknown", "Content", []string{"99999", "Go"})
+		AssertTrue(t, errors.Is(err, database.ErrUnknownCategory), "An unknown category ID should reject the post")
+
+		var stored int
+		AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM post WHERE title = ?", "Unknown").Scan(&stored), "Failed to count posts")
+		AssertEqual(t, 0, stored, "A rejected post should not be stored")
+	})
+
+	t.Run("NamesNormalized", func(t *testing.T) {
+		var before int
+		db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&before)
+
+		postID, err := database.CreatePost(db, userID, "Normalized", "Content", []string{"go", "  GO ", "Brand   new topic"})
+		AssertNoError(t, err, "Post creation should succeed")
+
+		names := categoryNames(postID)
+		AssertEqual(t, 2, len(names), "Case and spacing variants should resolve to existing categories")
+		AssertTrue(t, names["Go"] && names["Brand New Topic"], "Should link the existing Go and Brand New Topic")
+
+		var after int
+		db.QueryRow("SELECT COUNT(*) FROM categories").Scan(&after)
+		AssertEqual(t, before, after, "No duplicate categories should be created")
+	})
+}
+
+func TestMergeCategories(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	// Duplicates that predate normalization
+	res, err := db.Exec("INSERT INTO categories (name) VALUES ('General')")
+	AssertNoError(t, err, "Failed to insert category")
+	keepID, _ := res.LastInsertId()
+	res, err = db.Exec("INSERT INTO categories (name) VALUES ('general ')")
+	AssertNoError(t, err, "Failed to insert category")
+	mergeID, _ := res.LastInsertId()
+
+	link := func(postID int, categoryID int64) {
+		AssertNoError(t, database.InsertPostCategory(db, postID, int(categoryID)), "Failed to link category")
+	}
+	onlyMerged, err := database.CreatePost(db, userID, "Only merged", "Content", nil)
+	AssertNoError(t, err, "Post creation should succeed")
+	link(onlyMerged, mergeID)
+	both, err := database.CreatePost(db, userID, "Both", "Content", nil)
+	AssertNoError(t, err, "Post creation should succeed")
+	link(both, keepID)
+	link(both, mergeID)
+	onlyKept, err := database.CreatePost(db, userID, "Only kept", "Content", nil)
+	AssertNoError(t, err, "Post creation should succeed")
+	link(onlyKept, keepID)
+
+	duplicates, err := database.GetDuplicateCategories(db)
+	AssertNoError(t, err, "Detecting duplicates should succeed")
+	AssertEqual(t, 1, len(duplicates), "One duplicate group should be found")
+	AssertEqual(t, int(keepID), duplicates[0][0].ID, "The oldest category should come first")
+
+	AssertNoError(t, database.MergeCategories(db, int(keepID), int(mergeID)), "Merge should succeed")
+
+	count := func(query string, args ...interface{}) int {
+		var n int
+		AssertNoError(t, db.QueryRow(query, args...).Scan(&n), "Count query failed")
+		return n
+	}
+	AssertEqual(t, 0, count("SELECT COUNT(*) FROM categories WHERE idcategories = ?", mergeID), "The duplicate should be deleted")
+	AssertEqual(t, 0, count("SELECT COUNT(*) FROM post_has_categories WHERE categories_idcategories = ?", mergeID), "No links should point at the duplicate")
+	AssertEqual(t, 0, count(`SELECT COUNT(*) FROM post_has_categories
+		WHERE categories_idcategories NOT IN (SELECT idcategories FROM categories)`), "No orphaned links should remain")
+	AssertEqual(t, 3, count("SELECT COUNT(*) FROM post_has_categories WHERE categories_idcategories = ?", keepID), "Every post should be filed under the kept category")
+	AssertEqual(t, 1, count("SELECT COUNT(*) FROM post_has_categories WHERE post_postid = ?", both), "A post in both should keep a single link")
+
+	duplicates, err = database.GetDuplicateCategories(db)
+	AssertNoError(t, err, "Detecting duplicates should succeed")
+	AssertEqual(t, 0, len(duplicates), "No duplicates should remain")
+
+	AssertError(t, database.MergeCategories(db, int(keepID), int(mergeID)), "Merging a missing category should fail")
+	AssertError(t, database.MergeCategories(db, int(keepID), int(keepID)), "Merging a category into itself should fail")
+}
+
+func TestPostReactions(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, voter, other := userIDs[0], userIDs[1], userIDs[2]
+
+	postID, err := database.CreatePost(db, author, "Reacted Post", "Content", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	reactionRows := func() int {
+		var count int
+		err := db.QueryRow("SELECT COUNT(*) FROM post_reaction WHERE post_id = ? AND user_id = ?", postID, voter).Scan(&count)
+		AssertNoError(t, err, "Failed to count reaction rows")
+		return count
+	}
+
+	t.Run("SwitchLikeToDislike", func(t *testing.T) {
+		AssertNoError(t, database.LikePost(db, voter, postID), "Like should succeed")
+		likes, dislikes, err := database.GetReactionCounts(db, postID)
+		AssertNoError(t, err, "Failed to get reaction counts")
+		AssertEqual(t, 1, likes, "Like should be counted")
+		AssertEqual(t, 0, dislikes, "No dislikes yet")
+
+		AssertNoError(t, database.DislikePost(db, voter, postID), "Dislike should succeed")
+		AssertEqual(t, 1, reactionRows(), "Switching reaction should keep exactly one row")
+
+		likes, dislikes, err = database.GetReactionCounts(db, postID)
+		AssertNoError(t, err, "Failed to get reaction counts")
+		AssertEqual(t, 0, likes, "Like should move to dislike")
+		AssertEqual(t, 1, dislikes, "Dislike should be counted")
+	})
+
+	t.Run("RepeatedReactionIsIdempotent", func(t *testing.T) {
+		AssertNoError(t, database.DislikePost(db, voter, postID), "Repeated dislike should succeed")
+		AssertEqual(t, 1, reactionRows(), "Repeating a reaction should not add rows")
+	})
+
+	t.Run("TopRatedUsesNetScore", func(t *testing.T) {
+		popularID, err := database.CreatePost(db, author, "Popular Post", "Content", []string{"Go"})
+		AssertNoError(t, err, "Failed to create popular post")
+		AssertNoError(t, database.LikePost(db, voter, popularID), "Like should succeed")
+		AssertNoError(t, database.LikePost(db, other, popularID), "Like should succeed")
+
+		posts, err := database.GetFilteredPosts(db, "top-rated")
+		AssertNoError(t, err, "Failed to get top-rated posts")
+		AssertTrue(t, len(posts) >= 2, "Both posts should be listed")
+		AssertEqual(t, popularID, posts[0].PostID, "Highest net score should come first")
+		AssertEqual(t, 2, posts[0].Score, "Popular post should have a net score of 2")
+		AssertEqual(t, postID, posts[len(posts)-1].PostID, "Disliked post should come last")
+		AssertEqual(t, -1, posts[len(posts)-1].Score, "Disliked post should have a net score of -1")
+
+		post, err := database.GetPostByID(db, popularID)
+		AssertNoError(t, err, "Failed to load post")
+		AssertEqual(t, 2, post.Likes, "Post detail should carry like count")
+		AssertEqual(t, 2, post.Score, "Post detail should carry net score")
+	})
+}
+
+func TestSoftDeletePost(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, commenter := userIDs[0], userIDs[1]
+
+	keptID, err := database.CreatePost(db, author, "Kept Post", "Still here", []string{"Go"})
+	AssertNoError(t, err, "Failed to create kept post")
+	deletedID, err := database.CreatePost(db, author, "Deleted Post", "Regrettable content", []string{"Git"})
+	AssertNoError(t, err, "Failed to create post to delete")
+	AssertNoError(t, database.AddComment(db, deletedID, commenter, "A reply worth keeping"), "Failed to add comment")
+
+	AssertNoError(t, database.DeletePost(db, deletedID), "Soft delete should succeed")
+
+	feedContains := func(posts []database.Post, postID int) bool {
+		for _, post := range posts {
+			if post.PostID == postID {
+				return true
+			}
+		}
+		return false
+	}
+
+	t.Run("HiddenFromFeeds", func(t *testing.T) {
+		all, err := database.GetAllPosts(db)
+		AssertNoError(t, err, "GetAllPosts should succeed")
+		AssertFalse(t, feedContains(all, deletedID), "Soft-deleted post should not appear in GetAllPosts")
+		AssertTrue(t, feedContains(all, keptID), "Other posts should still appear in GetAllPosts")
+
+		for _, filter := range []string{"all", "oldest", "top-rated"} {
+			filtered, err := database.GetFilteredPosts(db, filter)
+			AssertNoError(t, err, "GetFilteredPosts should succeed")
+			AssertFalse(t, feedContains(filtered, deletedID), "Soft-deleted post should not appear in the "+filter+" feed")
+		}
+
+		byCategory, err := database.GetPostsByCategory(db, "Git")
+		AssertNoError(t, err, "GetPostsByCategory should succeed")
+		AssertFalse(t, feedContains(byCategory, deletedID), "Soft-deleted post should not appear in category feeds")
+	})
+
+	t.Run("ResolvesToTombstone", func(t *testing.T) {
+		post, err := database.GetPostByID(db, deletedID)
+		AssertNoError(t, err, "Soft-deleted post id should still resolve")
+		AssertTrue(t, post.IsDeleted, "Post should be marked deleted")
+		AssertEqual(t, database.DeletedPostPlaceholder, post.Title, "Title should be replaced by the placeholder")
+		AssertEqual(t, database.DeletedPostPlaceholder, post.Content, "Content should be replaced by the placeholder")
+		AssertEqual(t, 0, len(post.Categories), "Tombstone should not expose categories")
+
+		comments, err := database.GetCommentsForPost(db, deletedID)
+		AssertNoError(t, err, "Comments should still load")
+		AssertEqual(t, 1, len(comments), "Comments on a soft-deleted post should remain viewable")
+	})
+
+	t.Run("RejectsNewComments", func(t *testing.T) {
+		err := database.AddComment(db, deletedID, commenter, "Too late")
+		AssertTrue(t, errors.Is(err, database.ErrPostDeleted), "Commenting on a soft-deleted post should be rejected")
+		err = database.AddComment(db, deletedID+1000, commenter, "Nowhere")
+		AssertTrue(t, errors.Is(err, database.ErrPostNotFound), "Commenting on a missing post should be rejected")
+
+		var comments int
+		AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM comment WHERE post_postid = ?", deletedID).Scan(&comments), "Failed to count comments")
+		AssertEqual(t, 1, comments, "A rejected comment should not be stored")
+	})
+
+	t.Run("DeleteTwice", func(t *testing.T) {
+		err := database.DeletePost(db, deletedID)
+		AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Deleting an already deleted post should report no rows")
+	})
+
+	t.Run("HardDelete", func(t *testing.T) {
+		AssertNoError(t, database.HardDeletePost(db, deletedID), "Hard delete should succeed")
+
+		_, err := database.GetPostByID(db, deletedID)
+		AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Hard-deleted post should no longer resolve")
+
+		var comments int
+		err = db.QueryRow("SELECT COUNT(*) FROM comment WHERE post_postid = ?", deletedID).Scan(&comments)
+		AssertNoError(t, err, "Failed to count comments")
+		AssertEqual(t, 0, comments, "Hard delete should remove the post's comments")
+	})
+}
+
+func TestCategoriesWithCounts(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	for i := 0; i < 3; i++ {
+		_, err := database.CreatePost(db, author, fmt.Sprintf("Go Post %d", i), "About Go", []string{"Go"})
+		AssertNoError(t, err, "Failed to create Go post")
+	}
+	_, err = database.CreatePost(db, author, "Mixed Post", "About Go and SQL", []string{"Go", "SQL"})
+	AssertNoError(t, err, "Failed to create mixed post")
+	deletedID, err := database.CreatePost(db, author, "Deleted SQL Post", "Gone", []string{"SQL"})
+	AssertNoError(t, err, "Failed to create post to delete")
+	AssertNoError(t, database.DeletePost(db, deletedID), "Failed to delete post")
+
+	counts, err := database.GetCategoriesWithCounts(db)
+	AssertNoError(t, err, "GetCategoriesWithCounts should succeed")
+
+	byName := map[string]int{}
+	for _, cc := range counts {
+		byName[cc.Name] = cc.PostCount
+	}
+	AssertEqual(t, 4, byName["Go"], "Go should count every post filed under it")
+	AssertEqual(t, 1, byName["SQL"], "Deleted posts should not be counted")
+	count, ok := byName["Rust"]
+	AssertTrue(t, ok, "Categories without posts should still be listed")
+	AssertEqual(t, 0, count, "Categories without posts should have a zero count")
+	AssertEqual(t, "Go", counts[0].Name, "The busiest category should come first")
+}
+
+func TestTrendingCategories(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	post := func(category string, age time.Duration) {
+		postID, err := database.CreatePost(db, author, category+" post", "Content", []string{category})
+		AssertNoError(t, err, "Failed to create post")
+		_, err = db.Exec("UPDATE post SET post_at = ? WHERE postid = ?", time.Now().Add(-age).Format("2006-01-02 15:04:05"), postID)
+		AssertNoError(t, err, "Failed to backdate post")
+	}
+
+	day := 24 * time.Hour
+	post("Go", day)
+	post("SQL", 2*day)
+	post("SQL", 3*day)
+	post("CSS", 4*day)
+	post("Docker", 5*day)
+	// Old posts must not count, however many there are
+	for i := 0; i < 3; i++ {
+		post("Rust", 30*day)
+	}
+
+	trending, err := database.GetTrendingCategories(db, 7*day, 0)
+	AssertNoError(t, err, "GetTrendingCategories should succeed")
+
+	names := make([]string, len(trending))
+	for i, cc := range trending {
+		names[i] = cc.Name
+	}
+	AssertEqual(t, "SQL,CSS,Docker,Go", strings.Join(names, ","), "Categories should rank by recent posts, then alphabetically")
+	AssertEqual(t, 2, trending[0].PostCount, "Only posts inside the window should be counted")
+
+	limited, err := database.GetTrendingCategories(db, 7*day, 2)
+	AssertNoError(t, err, "GetTrendingCategories with a limit should succeed")
+	AssertEqual(t, 2, len(limited), "The limit should cap the result")
+
+	month, err := database.GetTrendingCategories(db, 60*day, 1)
+	AssertNoError(t, err, "GetTrendingCategories over a longer window should succeed")
+	AssertEqual(t, "Rust", month[0].Name, "Older posts should count once the window covers them")
+}
+
+func TestScheduledPostPublishing(t *testing.T) {
+	db := AppTestSetup(t)
+	t.Cleanup(func() { database.SetClock(nil) })
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	publishAt := time.Now().Add(time.Hour)
+	scheduledID, err := database.CreateScheduledPost(db, author, "Coming soon", "Scheduled content", []string{"Go"}, publishAt)
+	AssertNoError(t, err, "Failed to create scheduled post")
+	liveID, err := database.CreatePost(db, author, "Already out", "Live content", []string{"Go"})
+	AssertNoError(t, err, "Failed to create live post")
+
+	visible := func() map[int]bool {
+		ids := make(map[int]bool)
+		all, err := database.GetAllPosts(db)
+		AssertNoError(t, err, "GetAllPosts should succeed")
+		for _, p := range all {
+			ids[p.PostID] = true
+		}
+		filtered, err := database.GetFilteredPosts(db, "all")
+		AssertNoError(t, err, "GetFilteredPosts should succeed")
+		AssertEqual(t, len(all), len(filtered), "Both feeds should agree on visible posts")
+		return ids
+	}
+
+	goCount := func() int {
+		counts, err := database.GetCategoriesWithCounts(db)
+		AssertNoError(t, err, "GetCategoriesWithCounts should succeed")
+		for _, c := range counts {
+			if c.Name == "Go" {
+				return c.PostCount
+			}
+		}
+		return 0
+	}
+
+	before := visible()
+	AssertTrue(t, before[liveID], "Unscheduled posts should be visible immediately")
+	AssertFalse(t, before[scheduledID], "A post scheduled an hour ahead should be hidden now")
+	AssertEqual(t, 1, goCount(), "Category counts should skip the scheduled post")
+
+	_, err = database.GetPostByID(db, scheduledID)
+	AssertTrue(t, errors.Is(err, sql.ErrNoRows), "Others should not find a scheduled post by ID")
+	own, err := database.GetPostByIDForViewer(db, scheduledID, author)
+	AssertNoError(t, err, "The author should find their own scheduled post")
+	AssertEqual(t, scheduledID, own.PostID, "The author should get the scheduled post")
+
+	profile, err := database.GetUserPosts(db, author, "newest")
+	AssertNoError(t, err, "GetUserPosts should succeed")
+	AssertEqual(t, 1, len(profile), "The public profile should skip the scheduled post")
+	mine, err := database.GetOwnPosts(db, author)
+	AssertNoError(t, err, "GetOwnPosts should succeed")
+	AssertEqual(t, 2, len(mine), "The author's own view should include the scheduled post")
+
+	err = database.AddComment(db, scheduledID, userIDs[1], "First!")
+	AssertTrue(t, errors.Is(err, database.ErrPostNotFound), "Others should not comment on a scheduled post")
+	AssertNoError(t, database.AddComment(db, scheduledID, author, "Note to self"), "The author should comment on their own scheduled post")
+	seen, err := database.PostVisibleTo(db, scheduledID, userIDs[1])
+	AssertNoError(t, err, "PostVisibleTo should succeed")
+	AssertFalse(t, seen, "A scheduled post should not be visible to others")
+
+	database.SetClock(func() time.Time { return publishAt.Add(time.Minute) })
+	after := visible()
+	AssertTrue(t, after[scheduledID], "The post should appear once its publish time has passed")
+	AssertTrue(t, after[liveID], "Unscheduled posts should stay visible")
+	AssertEqual(t, 2, goCount(), "Category counts should include the published post")
+}
+
+func TestContentLengthLimits(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, recipient := userIDs[0], userIDs[1]
+
+	rejectedField := func(err error) string {
+		var lengthErr *database.LengthError
+		if !errors.As(err, &lengthErr) {
+			return ""
+		}
+		return lengthErr.Field
+	}
+
+	t.Run("TitleTooLong", func(t *testing.T) {
+		_, err := database.CreatePost(db, author, strings.Repeat("a", 201), "Body", []string{"Go"})
+		AssertTrue(t, errors.Is(err, database.ErrTooLong), "201-character title should be rejected")
+		AssertEqual(t, "title", rejectedField(err), "Error should name the title")
+	})
+
+	t.Run("ContentTooLong", func(t *testing.T) {
+		_, err := database.CreatePost(db, author, "Title", strings.Repeat("a", 10001), []string{"Go"})
+		AssertTrue(t, errors.Is(err, database.ErrTooLong), "10001-character body should be rejected")
+		AssertEqual(t, "content", rejectedField(err), "Error should name the content")
+
+		_, err = database.CreatePost(db, author, "Title", strings.Repeat("a", 10000), []string{"Go"})
+		AssertNoError(t, err, "Body at the limit should be accepted")
+	})
+
+	t.Run("MultibyteCountedByRune", func(t *testing.T) {
+		title := strings.Repeat("你好世界", 50)
+		AssertTrue(t, len(title) > database.MaxTitleLength, "Title should be longer than the limit in bytes")
+		_, err := database.CreatePost(db, author, title, "你好世界", []string{"Go"})
+		AssertNoError(t, err, "200 multibyte characters should fit in a title")
+
+		_, err = database.CreatePost(db, author, title+"你", "你好世界", []string{"Go"})
+		AssertTrue(t, errors.Is(err, database.ErrTooLong), "201 multibyte characters should be rejected")
+	})
+
+	t.Run("MarkupCountedAsTyped", func(t *testing.T) {
+		_, err := database.CreatePost(db, author, strings.Repeat("<&>", 66), "Body", []string{"Go"})
+		AssertNoError(t, err, "Markup characters should count once each, as typed")
+	})
+
+	t.Run("CommentAndMessageLimits", func(t *testing.T) {
+		postID, err := database.CreatePost(db, author, "Discussion", "Body", []string{"Go"})
+		AssertNoError(t, err, "Failed to create post")
+
+		err = database.AddComment(db, postID, author, strings.Repeat("好", 2001))
+		AssertTrue(t, errors.Is(err, database.ErrTooLong), "2001-character comment should be rejected")
+		AssertNoError(t, database.AddComment(db, postID, author, strings.Repeat("好", 2000)), "Comment at the limit should be accepted")
+
+		conversationID, err := CreateTestConversation(db, []int{author, recipient})
+		AssertNoError(t, err, "Failed to create conversation")
+		_, err = database.AddMessageToConversation(db, conversationID, author, strings.Repeat("a", 4001))
+		AssertTrue(t, errors.Is(err, database.ErrTooLong), "4001-character message should be rejected")
+		_, err = database.AddMessageToConversation(db, conversationID, author, strings.Repeat("a", 4000))
+		AssertNoError(t, err, "Message at the limit should be accepted")
+	})
+}
+
+func TestPostListingsAgree(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	_, err = db.Exec("UPDATE user SET Avatar = ? WHERE userid = ?", "/static/uploads/avatars/author.png", author)
+	AssertNoError(t, err, "Failed to set avatar")
+
+	postID, err := database.CreatePost(db, author, "Shared Fields", "Every listing should agree", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+	AssertNoError(t, database.AddComment(db, postID, userIDs[1], "First!"), "Failed to add comment")
+
+	find := func(posts []database.Post, source string) database.Post {
+		for _, post := range posts {
+			if post.PostID == postID {
+				return post
+			}
+		}
+		t.Fatalf("%s did not return post %d", source, postID)
+		return database.Post{}
+	}
+
+	all, err := database.GetAllPosts(db)
+	AssertNoError(t, err, "GetAllPosts should succeed")
+	mine, err := database.GetUserPosts(db, author, "newest")
+	AssertNoError(t, err, "GetUserPosts should succeed")
+	byCategory, err := database.GetPostsByCategory(db, "Go")
+	AssertNoError(t, err, "GetPostsByCategory should succeed")
+	commented, err := database.GetUserCommentedPosts(db, userIDs[1], "newest", 0, 0)
+	AssertNoError(t, err, "GetUserCommentedPosts should succeed")
+	single, err := database.GetPostByID(db, postID)
+	AssertNoError(t, err, "GetPostByID should succeed")
+
+	want := find(all, "GetAllPosts")
+	AssertEqual(t, author, want.UserUserID, "Author ID should be set")
+	AssertEqual(t, "/static/uploads/avatars/author.png", want.Avatar.String, "Author avatar should be set")
+	AssertEqual(t, "johndoe", want.Username, "Author username should be set")
+	AssertEqual(t, 1, want.Comments, "Comment count should be set")
+
+	for source, got := range map[string]database.Post{
+		"GetUserPosts":          find(mine, "GetUserPosts"),
+		"GetPostsByCategory":    find(byCategory, "GetPostsByCategory"),
+		"GetUserCommentedPosts": find(commented, "GetUserCommentedPosts"),
+		"GetPostByID":           single,
+	} {
+		AssertEqual(t, want.Title, got.Title, source+" title should match GetAllPosts")
+		AssertEqual(t, want.Content, got.Content, source+" content should match GetAllPosts")
+		AssertEqual(t, want.PostAt, got.PostAt, source+" timestamp should match GetAllPosts")
+		AssertEqual(t, want.UserUserID, got.UserUserID, source+" author ID should match GetAllPosts")
+		AssertEqual(t, want.Username, got.Username, source+" username should match GetAllPosts")
+		AssertEqual(t, want.FirstName, got.FirstName, source+" first name should match GetAllPosts")
+		AssertEqual(t, want.LastName, got.LastName, source+" last name should match GetAllPosts")
+		AssertEqual(t, want.Avatar, got.Avatar, source+" avatar should match GetAllPosts")
+		AssertEqual(t, want.Comments, got.Comments, source+" comment count should match GetAllPosts")
+	}
+}
+
+func TestTimestampsSerializeAsRFC3339(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	postID, err := database.CreatePost(db, userIDs[0], "Broken Clock", "Stored time cannot be parsed", []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	t.Run("UnparseablePostTimeIsNull", func(t *testing.T) {
+		_, err := db.Exec("UPDATE post SET post_at = ? WHERE postid = ?", "2024-01-01 25:61:00", postID)
+		AssertNoError(t, err, "Failed to corrupt post_at")
+
+		post, err := database.GetPostByID(db, postID)
+		AssertNoError(t, err, "Fetching the post should succeed")
+
+		data, err := json.Marshal(post)
+		AssertNoError(t, err, "Post should serialize")
+		AssertTrue(t, strings.Contains(string(data), `"PostAt":null`), "Zero time should serialize as null: "+string(data))
+		AssertTrue(t, !strings.Contains(string(data), "0001-01-01"), "The year-1 sentinel should never appear")
+	})
+
+	t.Run("ValidTimesAreUTC", func(t *testing.T) {
+		local := time.Date(2024, 5, 6, 9, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+
+		data, err := json.Marshal(database.Post{PostID: postID, PostAt: local})
+		AssertNoError(t, err, "Post should serialize")
+		AssertTrue(t, strings.Contains(string(data), `"PostAt":"2024-05-06T07:30:00Z"`), "Post time should be RFC 3339 UTC: "+string(data))
+
+		data, err = json.Marshal(database.Comment{CreatedAt: local})
+		AssertNoError(t, err, "Comment should serialize")
+		AssertTrue(t, strings.Contains(string(data), `"CreatedAt":"2024-05-06T07:30:00Z"`), "Comment time should be RFC 3339 UTC: "+string(data))
+
+		data, err = json.Marshal(database.Message{SentAt: local})
+		AssertNoError(t, err, "Message should serialize")
+		AssertTrue(t, strings.Contains(string(data), `"sent_at":"2024-05-06T07:30:00Z"`), "Message time should be RFC 3339 UTC: "+string(data))
+
+		data, err = json.Marshal(database.Message{})
+		AssertNoError(t, err, "Message should serialize")
+		AssertTrue(t, strings.Contains(string(data), `"sent_at":null`), "A zero message time should be null: "+string(data))
+	})
+}
+
+func TestGetPostsSince(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author := userIDs[0]
+
+	post := func(title string, age time.Duration) int {
+		postID, err := database.CreatePost(db, author, title, "Content", []string{"Go"})
+		AssertNoError(t, err, "Failed to create post")
+		_, err = db.Exec("UPDATE post SET post_at = ? WHERE postid = ?", time.Now().Add(-age).Format("2006-01-02 15:04:05"), postID)
+		AssertNoError(t, err, "Failed to backdate post")
+		return postID
+	}
+
+	post("Old one", 3*time.Hour)
+	post("Old two", 2*time.Hour)
+	newer := post("New one", 30*time.Minute)
+	newest := post("New two", 10*time.Minute)
+	since := time.Now().Add(-time.Hour).UTC()
+
+	posts, err := database.GetPostsSince(db, since, 0)
+	AssertNoError(t, err, "GetPostsSince should succeed")
+	AssertEqual(t, 2, len(posts), "Only posts after since should be returned")
+	AssertEqual(t, newer, posts[0].PostID, "Posts should come oldest first")
+	AssertEqual(t, newest, posts[1].PostID, "The newest post should come last")
+
+	limited, err := database.GetPostsSince(db, since, 1)
+	AssertNoError(t, err, "GetPostsSince with a limit should succeed")
+	AssertEqual(t, 1, len(limited), "The limit should cap the result")
+	AssertEqual(t, newer, limited[0].PostID, "A limited poll should start from the oldest new post")
+
+	none, err := database.GetPostsSince(db, time.Now().UTC(), 0)
+	AssertNoError(t, err, "GetPostsSince should succeed")
+	AssertEqual(t, 0, len(none), "Nothing should be newer than now")
+}
+
+func TestFeedCategoriesComeFromCache(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	for i := 0; i < 10; i++ {
+		_, err := database.CreatePost(db, userIDs[0], fmt.Sprintf("Post %d", i), "Filed twice", []string{"Go", "SQL"})
+		AssertNoError(t, err, "Failed to create post")
+	}
+
+	countingDB := OpenCountingDB(t, "./database/main.db")
+
+	// The first feed loads the category cache
+	_, err = database.GetAllPosts(countingDB)
+	AssertNoError(t, err, "Failed to load feed")
+
+	ResetQueryCount()
+	posts, err := database.GetAllPosts(countingDB)
+	AssertNoError(t, err, "Failed to load feed")
+	AssertEqual(t, 10, len(posts), "Every post should be in the feed")
+	AssertLessThanOrEqual(t, int(QueryCount()), 2, "Naming categories should not query once per post")
+	for _, post := range posts {
+		AssertEqual(t, 2, len(post.Categories), "Each post should carry both categories")
+		AssertEqual(t, "Go", post.Categories[0].Name, "Categories should be named from the cache")
+		AssertEqual(t, "SQL", post.Categories[1].Name, "Categories should be named from the cache")
+	}
+
+	_, err = database.CreateCategory(countingDB, "Zig")
+	AssertNoError(t, err, "Failed to create category")
+	postID, err := database.CreatePost(countingDB, userIDs[0], "New topic", "Filed under the new category", []string{"Zig"})
+	AssertNoError(t, err, "Failed to create post in new category")
+
+	categories, err := database.GetCategoriesForPost(countingDB, postID)
+	AssertNoError(t, err, "Failed to load categories for post")
+	AssertEqual(t, 1, len(categories), "The post should have its one category")
+	AssertEqual(t, "Zig", categories[0].Name, "The cache should reflect a newly created category")
+
+	// Categories added behind the cache's back are picked up on first sight
+	_, err = db.Exec("INSERT INTO categories (name) VALUES ('Elixir')")
+	AssertNoError(t, err, "Failed to insert category directly")
+	postID, err = database.CreatePost(db, userIDs[0], "Another topic", "Filed directly", []string{"Elixir"})
+	AssertNoError(t, err, "Failed to create post")
+	categories, err = database.GetCategoriesForPost(db, postID)
+	AssertNoError(t, err, "Failed to load categories for post")
+	AssertEqual(t, "Elixir", categories[0].Name, "An unknown category id should refresh the cache")
+}
+
+func TestPostReadingTime(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	// 400 words, half of them wrapped in markup that must not be counted
+	var body strings.Builder
+	body.WriteString("# Heading\n\n")
+	for i := 0; i < 99; i++ {
+		body.WriteString("<p>plain words <strong>in bold</strong></p>\n")
+	}
+	body.WriteString("- see [the docs](https://example.com/docs) <script>var ignored = true;</script>\n")
+
+	AssertEqual(t, 400, database.CountWords(body.String()), "Markup should not count as words")
+
+	postID, err := database.CreatePost(db, userIDs[0], "Long read", body.String(), []string{"Go"})
+	AssertNoError(t, err, "Failed to create post")
+
+	post, err := database.GetPostByID(db, postID)
+	AssertNoError(t, err, "Failed to fetch post")
+	AssertEqual(t, 400, post.WordCount, "Post should carry its word count")
+	AssertEqual(t, 120, post.ReadingTimeSeconds, "400 words should take two minutes to read")
+
+	posts, err := database.GetAllPosts(db)
+	AssertNoError(t, err, "Failed to load feed")
+	AssertEqual(t, 1, len(posts), "Feed should contain the post")
+	AssertEqual(t, 400, posts[0].WordCount, "Feed posts should carry their word count")
+
+	AssertEqual(t, 1, database.ReadingTimeSeconds(1), "Reading time should round up to a whole second")
+	AssertEqual(t, 0, database.ReadingTimeSeconds(0), "An empty post takes no time to read")
+}
+
+func TestDailyPostQuota(t *testing.T) {
+	db := AppTestSetup(t)
+
+	database.SetMaxPostsPerDay(2)
+	t.Cleanup(func() { database.SetMaxPostsPerDay(0) })
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, admin := userIDs[1], userIDs[0]
+
+	for i := 1; i <= 2; i++ {
+		_, err := database.CreatePost(db, author, fmt.Sprintf("Post %d", i), "Within the daily limit", []string{"Go"})
+		AssertNoError(t, err, "Posts under the cap should be created")
+	}
+
+	_, err = database.CreatePost(db, author, "Post 3", "One too many", []string{"Go"})
+	AssertTrue(t, errors.Is(err, database.ErrPostQuotaExceeded), "The third post in a day should be rejected")
+	_, err = database.InsertPost(db, "Through the form", "Post 3", fmt.Sprint(author))
+	AssertTrue(t, errors.Is(err, database.ErrPostQuotaExceeded), "The form route should be capped too")
+
+	var stored int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM post WHERE user_userid = ?", author).Scan(&stored), "Failed to count posts")
+	AssertEqual(t, 2, stored, "Rejected posts should not be stored")
+
+	// Once the earlier posts are older than the window, posting resumes
+	earlier := time.Now().Add(-database.PostQuotaWindow - time.Hour).Format("2006-01-02 15:04:05")
+	_, err = db.Exec("UPDATE post SET post_at = ? WHERE user_userid = ?", earlier, author)
+	AssertNoError(t, err, "Failed to backdate posts")
+	_, err = database.CreatePost(db, author, "Post 3", "The next day", []string{"Go"})
+	AssertNoError(t, err, "Posting should resume after the window")
+
+	AssertNoError(t, server.SetAdmins(db, []string{UserFixtures[0].Username}), "Failed to set admins")
+	t.Cleanup(func() { server.SetAdmins(nil, nil) })
+	for i := 1; i <= 3; i++ {
+		_, err := database.CreatePost(db, admin, fmt.Sprintf("Announcement %d", i), "Admins are not capped", []string{"Go"})
+		AssertNoError(t, err, "Admins should be exempt from the cap")
+	}
+}
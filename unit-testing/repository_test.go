@@ -1,10 +1,12 @@
 package unit_testing
 
 import (
+	"database/sql"
 	"testing"
 
 	"connecthub/database"
 	"connecthub/repository"
+	"connecthub/server/services"
 )
 
 func TestUserRepository(t *testing.T) {
@@ -362,3 +364,65 @@ func TestMessageRepository(t *testing.T) {
 		})
 	})
 }
+
+func TestNotificationRepository(t *testing.T) {
+	testDB := TestSetup(t)
+	defer testDB.Cleanup()
+
+	userIDs, err := SetupTestUsers(testDB.DB)
+	AssertNoError(t, err, "Failed to setup test users")
+	recipient, actor := userIDs[0], userIDs[1]
+
+	// Exercise the implementation through the interface the service depends on
+	var notificationRepo repository.NotificationRepository = repository.NewNotificationRepository(testDB.DB)
+	notificationService := services.NewNotificationService(notificationRepo)
+
+	t.Run("Create", func(t *testing.T) {
+		notification, err := notificationRepo.Create(recipient, "mention", 0, actor)
+		AssertNoError(t, err, "Repository Create should work")
+		AssertTrue(t, notification.ID > 0, "Notification ID should be positive")
+		AssertEqual(t, recipient, notification.UserID, "Notification should belong to the recipient")
+		AssertEqual(t, actor, notification.ActorID, "Notification should record the actor")
+		AssertFalse(t, notification.IsRead, "New notifications should be unread")
+	})
+
+	t.Run("ListAndUnreadCount", func(t *testing.T) {
+		_, err := notificationRepo.Create(recipient, "mention", 0, actor)
+		AssertNoError(t, err, "Repository Create should work")
+
+		notifications, err := notificationRepo.List(recipient, 10, 0)
+		AssertNoError(t, err, "Repository List should work")
+		AssertEqual(t, 2, len(notifications), "Both notifications should be listed")
+
+		count, err := notificationRepo.UnreadCount(recipient)
+		AssertNoError(t, err, "Repository UnreadCount should work")
+		AssertEqual(t, 2, count, "Both notifications should be unread")
+
+		others, err := notificationRepo.List(actor, 10, 0)
+		AssertNoError(t, err, "Repository List should work")
+		AssertEqual(t, 0, len(others), "Other users should not see the notifications")
+	})
+
+	t.Run("MarkRead", func(t *testing.T) {
+		notifications, err := notificationRepo.List(recipient, 1, 0)
+		AssertNoError(t, err, "Repository List should work")
+
+		err = notificationRepo.MarkRead(actor, notifications[0].ID)
+		AssertEqual(t, sql.ErrNoRows, err, "Users cannot mark someone else's notification read")
+
+		AssertNoError(t, notificationRepo.MarkRead(recipient, notifications[0].ID), "Repository MarkRead should work")
+		count, err := notificationService.UnreadCount(recipient)
+		AssertNoError(t, err, "Service UnreadCount should work")
+		AssertEqual(t, 1, count, "One notification should remain unread")
+	})
+
+	t.Run("ServiceSkipsSelfNotification", func(t *testing.T) {
+		notification, err := notificationService.Notify(recipient, "mention", 0, recipient)
+		AssertNoError(t, err, "Notifying yourself should not fail")
+		AssertTrue(t, notification == nil, "Users should not be notified about their own actions")
+
+		notifications, err := notificationService.GetNotifications(recipient, 10, 0)
+		AssertNoError(t, err, "Service GetNotifications should work")
+		AssertEqual(t, 2, len(notifications), "No notification should have been added")
+	})
+}
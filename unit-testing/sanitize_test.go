@@ -0,0 +1,112 @@
+package unit_testing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"connecthub/database"
+	"connecthub/sanitize"
+	"connecthub/server"
+	"connecthub/server/services"
+)
+
+var xssPayloads = []string{
+	"<script>alert('xss')</script>",
+	"javascript:alert('xss')",
+	"<img src=x onerror=alert('xss')>",
+	"<svg onload=alert('xss')>",
+	"'><script>alert('xss')</script>",
+	"<a href=\"javascript:alert('xss')\">click</a>",
+	"<a href=\" jAvAsCrIpT:alert('xss')\">click</a>",
+}
+
+var (
+	dangerousTagRe = regexp.MustCompile(`(?i)<\s*(script|img|svg|iframe)`)
+	eventHandlerRe = regexp.MustCompile(`(?i)<[^>]*\bon[a-z]+\s*=`)
+	scriptedHrefRe = regexp.MustCompile(`(?i)href\s*=\s*["']?\s*javascript:`)
+)
+
+// assertNeutralized checks that no executable markup survives sanitization
+func assertNeutralized(t *testing.T, input, output string) {
+	t.Helper()
+	for _, re := range []*regexp.Regexp{dangerousTagRe, eventHandlerRe, scriptedHrefRe} {
+		if re.MatchString(output) {
+			t.Fatalf("Sanitized output of %q still matches %s: %q", input, re, output)
+		}
+	}
+}
+
+func TestSanitizeClean(t *testing.T) {
+	t.Run("EscapePolicy", func(t *testing.T) {
+		for _, payload := range xssPayloads {
+			assertNeutralized(t, payload, sanitize.CleanWithPolicy(payload, sanitize.PolicyEscape))
+		}
+		AssertEqual(t, "&lt;b&gt;bold&lt;/b&gt;", sanitize.CleanWithPolicy("<b>bold</b>", sanitize.PolicyEscape), "Escape should render tags as text")
+	})
+
+	t.Run("StripPolicy", func(t *testing.T) {
+		for _, payload := range xssPayloads {
+			assertNeutralized(t, payload, sanitize.CleanWithPolicy(payload, sanitize.PolicyStrip))
+		}
+		AssertEqual(t, "<b>bold</b> text", sanitize.CleanWithPolicy("<b onclick=\"x()\">bold</b> text", sanitize.PolicyStrip), "Strip should keep safe tags without attributes")
+		AssertEqual(t, "", sanitize.CleanWithPolicy("<script>alert('xss')</script>", sanitize.PolicyStrip), "Strip should drop script contents")
+		AssertEqual(t, `<a href="https://example.com" rel="nofollow noopener">link</a>`,
+			sanitize.CleanWithPolicy(`<a href="https://example.com" onclick="x()">link</a>`, sanitize.PolicyStrip), "Strip should keep safe links")
+		AssertEqual(t, "<a>click</a>", sanitize.CleanWithPolicy(xssPayloads[5], sanitize.PolicyStrip), "Strip should drop javascript: hrefs")
+	})
+
+	t.Run("ParsePolicy", func(t *testing.T) {
+		AssertEqual(t, sanitize.PolicyStrip, sanitize.ParsePolicy("STRIP"), "Should parse strip")
+		AssertEqual(t, sanitize.PolicyEscape, sanitize.ParsePolicy("unknown"), "Unknown policies should fall back to escape")
+	})
+}
+
+func TestSanitizedContentStorage(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	postService := services.NewPostService(db)
+
+	for _, policy := range []sanitize.Policy{sanitize.PolicyEscape, sanitize.PolicyStrip} {
+		sanitize.SetPolicy(policy)
+
+		for _, payload := range xssPayloads {
+			postID, err := postService.CreatePost(userID, "XSS "+payload, payload, []string{"Go"})
+			AssertNoError(t, err, "Post creation should succeed")
+			AssertNoError(t, postService.AddComment(postID, userID, payload), "Comment creation should succeed")
+
+			// The text is stored as written so exports and word counts see it unchanged
+			post, err := database.GetPostByID(db, postID)
+			AssertNoError(t, err, "Should retrieve stored post")
+			AssertEqual(t, payload, post.Content, "Post content should be stored as written")
+
+			comments, err := database.GetCommentsForPost(db, postID)
+			AssertNoError(t, err, "Should retrieve stored comments")
+			AssertEqual(t, 1, len(comments), "Should have one comment")
+			AssertEqual(t, payload, comments[0].Content, "Comment content should be stored as written")
+
+			// and cleaned when it is served
+			w := httptest.NewRecorder()
+			server.GetPostByID(w, httptest.NewRequest("GET", "/api/post?id="+strconv.Itoa(postID), nil))
+			AssertEqual(t, http.StatusOK, w.Code, "Post should load")
+
+			var response struct {
+				Post     database.Post      `json:"post"`
+				Comments []database.Comment `json:"comments"`
+			}
+			AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode response")
+			assertNeutralized(t, payload, response.Post.Title)
+			assertNeutralized(t, payload, response.Post.Content)
+			AssertEqual(t, 1, len(response.Comments), "The comment should be served")
+			assertNeutralized(t, payload, response.Comments[0].Content)
+		}
+	}
+
+	sanitize.SetPolicy(sanitize.PolicyEscape)
+}
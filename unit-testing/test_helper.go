@@ -2,14 +2,19 @@ package unit_testing
 
 import (
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
+	"connecthub/database"
+
+	"github.com/mattn/go-sqlite3"
 )
 
 // TestConfig holds configuration for test execution
@@ -103,7 +108,9 @@ func (tdb *TestDatabase) InitializeSchema() error {
 			current_session TEXT,
 			Avatar TEXT,
 			gender TEXT,
-			date_of_birth DATE
+			date_of_birth DATE,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
 		);`,
 
 		`CREATE TABLE IF NOT EXISTS post (
@@ -112,6 +119,12 @@ func (tdb *TestDatabase) InitializeSchema() error {
 			title TEXT NULL,
 			post_at DATETIME NOT NULL,
 			user_userid INTEGER NOT NULL,
+			slug TEXT,
+			image TEXT,
+			is_deleted INTEGER NOT NULL DEFAULT 0,
+			publish_at DATETIME,
+			is_pinned INTEGER NOT NULL DEFAULT 0,
+			is_profile_pinned INTEGER NOT NULL DEFAULT 0,
 			FOREIGN KEY (user_userid) REFERENCES user(userid)
 		);`,
 
@@ -119,6 +132,8 @@ func (tdb *TestDatabase) InitializeSchema() error {
 			commentid INTEGER PRIMARY KEY AUTOINCREMENT,
 			content TEXT NULL,
 			comment_at DATETIME NULL,
+			edited_at DATETIME,
+			is_deleted INTEGER NOT NULL DEFAULT 0,
 			post_postid INTEGER NOT NULL,
 			user_userid INTEGER NOT NULL,
 			FOREIGN KEY (post_postid) REFERENCES post(postid),
@@ -135,6 +150,7 @@ func (tdb *TestDatabase) InitializeSchema() error {
 
 		`CREATE TABLE IF NOT EXISTS conversation (
 			conversation_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_by INTEGER,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
 		);`,
 
@@ -154,10 +170,32 @@ func (tdb *TestDatabase) InitializeSchema() error {
 			content TEXT NOT NULL,
 			sent_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
 			is_read BOOLEAN NOT NULL DEFAULT 0,
+			client_msg_id TEXT,
+			delivered_at DATETIME,
+			edited_at DATETIME,
+			reply_to_message_id INTEGER,
 			FOREIGN KEY (conversation_id) REFERENCES conversation(conversation_id),
 			FOREIGN KEY (sender_id) REFERENCES user(userid)
 		);`,
 
+		`CREATE TABLE IF NOT EXISTS message_edits (
+			edit_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			edited_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES message(message_id)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS message_drafts (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			content TEXT NOT NULL,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversation(conversation_id),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
 		`CREATE TABLE IF NOT EXISTS online_status (
 			user_id INTEGER PRIMARY KEY,
 			status TEXT NOT NULL DEFAULT 'offline',
@@ -165,9 +203,74 @@ func (tdb *TestDatabase) InitializeSchema() error {
 			FOREIGN KEY (user_id) REFERENCES user(userid)
 		);`,
 
+		`CREATE TABLE IF NOT EXISTS post_reaction (
+			post_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			reaction TEXT NOT NULL DEFAULT 'like',
+			reacted_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (post_id, user_id),
+			FOREIGN KEY (post_id) REFERENCES post(postid),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS conversation_read_state (
+			conversation_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_read_message_id INTEGER NOT NULL DEFAULT 0,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (conversation_id, user_id),
+			FOREIGN KEY (conversation_id) REFERENCES conversation(conversation_id),
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS attachments (
+			attachment_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER,
+			uploader_id INTEGER NOT NULL,
+			url TEXT NOT NULL UNIQUE,
+			mime TEXT NOT NULL,
+			size INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (message_id) REFERENCES message(message_id),
+			FOREIGN KEY (uploader_id) REFERENCES user(userid)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS user_block (
+			blocker_id INTEGER NOT NULL,
+			blocked_id INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (blocker_id, blocked_id),
+			FOREIGN KEY (blocker_id) REFERENCES user(userid),
+			FOREIGN KEY (blocked_id) REFERENCES user(userid)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS notification (
+			notification_id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			type TEXT NOT NULL,
+			post_id INTEGER,
+			actor_id INTEGER,
+			count INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			is_read INTEGER NOT NULL DEFAULT 0,
+			FOREIGN KEY (user_id) REFERENCES user(userid),
+			FOREIGN KEY (post_id) REFERENCES post(postid),
+			FOREIGN KEY (actor_id) REFERENCES user(userid)
+		);`,
+
+		`CREATE TABLE IF NOT EXISTS user_privacy (
+			user_id INTEGER PRIMARY KEY,
+			show_last_seen INTEGER NOT NULL DEFAULT 1,
+			show_online INTEGER NOT NULL DEFAULT 1,
+			allow_dms_from TEXT NOT NULL DEFAULT 'everyone',
+			FOREIGN KEY (user_id) REFERENCES user(userid)
+		);`,
+
 		// Indexes for performance
 		`CREATE INDEX IF NOT EXISTS idx_message_conversation ON message(conversation_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_message_sender ON message(sender_id);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_message_client_msg_id ON message(sender_id, client_msg_id) WHERE client_msg_id IS NOT NULL;`,
 		`CREATE INDEX IF NOT EXISTS idx_conversation_participants_user ON conversation_participants(user_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_conversation_participants_conv ON conversation_participants(conversation_id);`,
 		`CREATE INDEX IF NOT EXISTS idx_online_status_user ON online_status(user_id);`,
@@ -182,23 +285,28 @@ func (tdb *TestDatabase) InitializeSchema() error {
 		}
 	}
 
+	// Posts cannot create categories of their own, so every category the
+	// tests file posts under is seeded with the schema
+	for _, category := range testCategories {
+		if _, err := tdb.DB.Exec("INSERT INTO categories (name) VALUES (?)", category); err != nil {
+			return fmt.Errorf("failed to insert category %s: %v", category, err)
+		}
+	}
+	// Categories cached from another test's database would carry the wrong names
+	database.InvalidateCategoryCache()
+
 	log.Printf("[TEST] Test database schema initialized successfully")
 	return nil
 }
 
+// testCategories are the categories every test database starts with
+var testCategories = []string{"General", "Technology", "Sports", "Entertainment", "Science", "Politics",
+	"Introduction", "Testing", "Programming", "Discussion", "Journey"}
+
 // LoadTestData loads test data into the database
 func (tdb *TestDatabase) LoadTestData() error {
 	log.Printf("[TEST] Loading test data into test database")
 
-	// Insert default categories
-	categories := []string{"General", "Technology", "Sports", "Entertainment", "Science", "Politics"}
-	for _, category := range categories {
-		_, err := tdb.DB.Exec("INSERT INTO categories (name) VALUES (?)", category)
-		if err != nil {
-			return fmt.Errorf("failed to insert category %s: %v", category, err)
-		}
-	}
-
 	// Insert test users
 	testUsers := []struct {
 		FirstName, LastName, Username, Email, Gender, DateOfBirth, Password string
@@ -211,12 +319,7 @@ func (tdb *TestDatabase) LoadTestData() error {
 	}
 
 	for _, user := range testUsers {
-		avatar := "/static/assets/default-avatar.png"
-		if user.Gender == "male" {
-			avatar = "/static/assets/male-avatar-boy-face-man-user-7.svg"
-		} else if user.Gender == "female" {
-			avatar = "/static/assets/female-avatar-girl-face-woman-user-9.svg"
-		}
+		avatar := database.AvatarForGender(user.Gender)
 
 		_, err := tdb.DB.Exec(`
 			INSERT INTO user (F_name, L_name, Username, Email, gender, date_of_birth, password, Avatar)
@@ -321,6 +424,38 @@ func TestSetup(t *testing.T) *TestDatabase {
 	return testDB
 }
 
+// AppTestSetup creates the production schema in a temporary working directory
+// so handlers that open ./database/main.db operate on an isolated database.
+func AppTestSetup(t testing.TB) *sql.DB {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "database"), 0755); err != nil {
+		t.Fatalf("Failed to create database directory: %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Failed to change working directory: %v", err)
+	}
+
+	database.DataBase()
+
+	db, err := sql.Open("sqlite3", "./database/main.db")
+	if err != nil {
+		os.Chdir(wd)
+		t.Fatalf("Failed to open app database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		db.Close()
+		os.Chdir(wd)
+	})
+
+	return db
+}
+
 // AssertNoError is a helper function to check for errors in tests
 func AssertNoError(t *testing.T, err error, message string) {
 	if err != nil {
@@ -401,6 +536,11 @@ func CreateTestSession(t *testing.T, db *TestDatabase, userID int) string {
 	return sessionToken
 }
 
+// CreateAppSession assigns a session token to a user in a database created by AppTestSetup
+func CreateAppSession(t *testing.T, db *sql.DB, userID int) string {
+	return CreateTestSession(t, &TestDatabase{DB: db}, userID)
+}
+
 // SetupTestConversations creates test conversations between users
 func SetupTestConversations(db *sql.DB, userIDs []int) ([]int, error) {
 	var conversationIDs []int
@@ -467,3 +607,59 @@ func SetupTestMessages(db *sql.DB, conversationIDs, userIDs []int) ([]int, error
 
 	return messageIDs, nil
 }
+
+// countingDriverName is a sqlite3 driver that counts every statement prepared through it
+const countingDriverName = "sqlite3_counting"
+
+var registerCountingDriver sync.Once
+
+// queryCounter tallies statements issued through connections opened by OpenCountingDB
+var queryCounter int64
+
+type countingDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+func (d *countingDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &countingConn{Conn: conn}, nil
+}
+
+// countingConn only exposes the basic driver.Conn methods, so database/sql
+// routes every query and exec through Prepare where it is counted
+type countingConn struct {
+	driver.Conn
+}
+
+func (c *countingConn) Prepare(query string) (driver.Stmt, error) {
+	atomic.AddInt64(&queryCounter, 1)
+	return c.Conn.Prepare(query)
+}
+
+// OpenCountingDB opens the database at path through a driver that counts statements.
+// Reset the count with ResetQueryCount and read it with QueryCount.
+func OpenCountingDB(t testing.TB, path string) *sql.DB {
+	registerCountingDriver.Do(func() {
+		sql.Register(countingDriverName, &countingDriver{})
+	})
+
+	db, err := sql.Open(countingDriverName, path)
+	if err != nil {
+		t.Fatalf("Failed to open counting database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// ResetQueryCount zeroes the statement counter shared by counting databases
+func ResetQueryCount() {
+	atomic.StoreInt64(&queryCounter, 0)
+}
+
+// QueryCount returns the statements issued through counting databases since the last reset
+func QueryCount() int64 {
+	return atomic.LoadInt64(&queryCounter)
+}
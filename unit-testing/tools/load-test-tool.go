@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"os"
 	"sort"
 	"strconv"
 	"strings"
@@ -24,6 +25,8 @@ type LoadTestConfig struct {
 	Duration        time.Duration `json:"duration"`
 	RequestsPerUser int           `json:"requests_per_user"`
 	RampUpTime      time.Duration `json:"ramp_up_time"`
+	PlateauTime     time.Duration `json:"plateau_time"`
+	RampDownTime    time.Duration `json:"ramp_down_time"`
 	ThinkTime       time.Duration `json:"think_time"`
 	TestScenarios   []string      `json:"test_scenarios"`
 	OutputFormat    string        `json:"output_format"`
@@ -78,6 +81,45 @@ type Metrics struct {
 	ErrorRate      float64       `json:"error_rate"`
 }
 
+// HistogramBucket counts the requests whose latency fell at or below
+// UpperBound and above the previous bucket's bound. The last bucket has no
+// upper bound and catches everything slower.
+type HistogramBucket struct {
+	UpperBound time.Duration `json:"upper_bound"`
+	Count      int           `json:"count"`
+}
+
+// latencyBucketBounds are the histogram bucket edges. They grow roughly
+// geometrically so fast and slow requests both get useful resolution.
+var latencyBucketBounds = []time.Duration{
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	2500 * time.Millisecond,
+	5 * time.Second,
+}
+
+// Thresholds are the limits a load test run must stay within for CI to pass.
+// Limits left out of the thresholds file are not checked. Durations are in
+// nanoseconds, as in the configuration file.
+type Thresholds struct {
+	MaxP95Latency     *time.Duration `json:"max_p95_latency,omitempty"`
+	MaxErrorRate      *float64       `json:"max_error_rate,omitempty"`
+	MinRequestsPerSec *float64       `json:"min_requests_per_second,omitempty"`
+}
+
+// ThresholdCheck is the outcome of comparing one metric against its limit
+type ThresholdCheck struct {
+	Metric string
+	Limit  string
+	Actual string
+	Passed bool
+}
+
 // TestScenario defines a test scenario
 type TestScenario struct {
 	Name        string
@@ -91,12 +133,15 @@ var (
 	duration        = flag.Duration("duration", 30*time.Second, "Test duration")
 	requestsPerUser = flag.Int("requests", 100, "Requests per user")
 	rampUpTime      = flag.Duration("rampup", 5*time.Second, "Ramp up time")
+	plateauTime     = flag.Duration("plateau", 0, "Time to hold all users after ramp up (overrides duration when set)")
+	rampDownTime    = flag.Duration("rampdown", 0, "Time over which users stop after the plateau (overrides duration when set)")
 	thinkTime       = flag.Duration("think", 100*time.Millisecond, "Think time between requests")
 	scenarios       = flag.String("scenarios", "all", "Test scenarios (comma-separated or 'all')")
 	outputFormat    = flag.String("format", "json", "Output format (json, csv, html)")
 	reportFile      = flag.String("output", "", "Output file (default: stdout)")
 	verbose         = flag.Bool("verbose", false, "Verbose output")
 	configFile      = flag.String("config", "", "Load test configuration file")
+	thresholdsFile  = flag.String("thresholds", "", "JSON file of limits to enforce; exits non-zero on any breach")
 )
 
 func main() {
@@ -117,6 +162,8 @@ func main() {
 			Duration:        *duration,
 			RequestsPerUser: *requestsPerUser,
 			RampUpTime:      *rampUpTime,
+			PlateauTime:     *plateauTime,
+			RampDownTime:    *rampDownTime,
 			ThinkTime:       *thinkTime,
 			TestScenarios:   strings.Split(*scenarios, ","),
 			OutputFormat:    *outputFormat,
@@ -124,6 +171,15 @@ func main() {
 		}
 	}
 
+	// Load thresholds up front so a bad file fails before the test runs
+	var thresholds *Thresholds
+	if *thresholdsFile != "" {
+		thresholds = &Thresholds{}
+		if err := loadThresholds(*thresholdsFile, thresholds); err != nil {
+			log.Fatalf("Failed to load thresholds: %v", err)
+		}
+	}
+
 	// Run load test
 	results := runLoadTest(config)
 
@@ -134,6 +190,14 @@ func main() {
 
 	// Print summary to console
 	printSummary(results)
+
+	if thresholds != nil {
+		checks := checkThresholds(results, *thresholds)
+		printThresholdChecks(checks)
+		if code := thresholdExitCode(checks); code != 0 {
+			os.Exit(code)
+		}
+	}
 }
 
 func loadConfig(filename string, config *LoadTestConfig) error {
@@ -144,6 +208,14 @@ func loadConfig(filename string, config *LoadTestConfig) error {
 	return json.Unmarshal(data, config)
 }
 
+func loadThresholds(filename string, thresholds *Thresholds) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, thresholds)
+}
+
 func runLoadTest(config LoadTestConfig) LoadTestResults {
 	fmt.Printf("Starting load test with %d concurrent users for %v\n", config.ConcurrentUsers, config.Duration)
 	fmt.Printf("Base URL: %s\n", config.BaseURL)
@@ -162,6 +234,10 @@ func runLoadTest(config LoadTestConfig) LoadTestResults {
 	// Start users with ramp-up
 	userDelay := config.RampUpTime / time.Duration(config.ConcurrentUsers)
 
+	if config.PlateauTime > 0 || config.RampDownTime > 0 {
+		fmt.Printf("Phases: ramp-up %v, plateau %v, ramp-down %v\n", config.RampUpTime, config.PlateauTime, config.RampDownTime)
+	}
+
 	for i := 0; i < config.ConcurrentUsers; i++ {
 		wg.Add(1)
 
@@ -179,10 +255,11 @@ func runLoadTest(config LoadTestConfig) LoadTestResults {
 			// Execute requests
 			userStartTime := time.Now()
 			requestCount := 0
+			stopAfter := userStopTime(config, userID)
 
 			for {
-				// Check if duration exceeded
-				if time.Since(startTime) > config.Duration {
+				// Check if this user's share of the test is over
+				if time.Since(startTime) > stopAfter {
 					break
 				}
 
@@ -229,6 +306,21 @@ func runLoadTest(config LoadTestConfig) LoadTestResults {
 	return analyzeResults(config, startTime, endTime, allResults)
 }
 
+// userStopTime returns how long after the start of the test a user keeps
+// sending requests. Without a plateau or ramp-down every user runs for the
+// whole Duration; with them the users stop one by one, spread evenly across
+// the ramp-down that follows the plateau, so the load tapers instead of
+// dropping off at once.
+func userStopTime(config LoadTestConfig, userID int) time.Duration {
+	if config.PlateauTime <= 0 && config.RampDownTime <= 0 {
+		return config.Duration
+	}
+
+	rampDownStart := config.RampUpTime + config.PlateauTime
+	userDelay := config.RampDownTime / time.Duration(config.ConcurrentUsers)
+	return rampDownStart + time.Duration(userID+1)*userDelay
+}
+
 func getTestScenarios(scenarioNames []string) []TestScenario {
 	allScenarios := map[string]TestScenario{
 		"homepage":      {Name: "Homepage", Weight: 20, ExecuteFunc: testHomepage},
@@ -286,7 +378,7 @@ func testHomepage(client *http.Client, baseURL string) TestResult {
 func testLogin(client *http.Client, baseURL string) TestResult {
 	loginData := map[string]string{
 		"identifier": "johndoe",
-		"password":   "Aa123456",
+		"password":   "password123",
 	}
 
 	jsonData, _ := json.Marshal(loginData)
@@ -641,6 +733,38 @@ func calculateScenarioMetrics(results []TestResult) Metrics {
 	}
 }
 
+// latencyHistogram buckets the results' latencies by latencyBucketBounds,
+// with a final unbounded bucket for anything slower
+func latencyHistogram(results []TestResult) []HistogramBucket {
+	buckets := make([]HistogramBucket, len(latencyBucketBounds)+1)
+	for i, bound := range latencyBucketBounds {
+		buckets[i].UpperBound = bound
+	}
+
+	for _, result := range results {
+		i := sort.Search(len(latencyBucketBounds), func(i int) bool {
+			return result.Latency <= latencyBucketBounds[i]
+		})
+		buckets[i].Count++
+	}
+	return buckets
+}
+
+// scenarioHistograms builds a latency histogram for each scenario in the
+// detailed results
+func scenarioHistograms(results []TestResult) map[string][]HistogramBucket {
+	byScenario := make(map[string][]TestResult)
+	for _, result := range results {
+		byScenario[result.Scenario] = append(byScenario[result.Scenario], result)
+	}
+
+	histograms := make(map[string][]HistogramBucket, len(byScenario))
+	for scenario, scenarioResults := range byScenario {
+		histograms[scenario] = latencyHistogram(scenarioResults)
+	}
+	return histograms
+}
+
 func outputResults(results LoadTestResults, format, filename string) error {
 	var output []byte
 	var err error
@@ -707,6 +831,9 @@ func generateHTMLReport(results LoadTestResults) string {
         th { background-color: #f2f2f2; }
         .success { color: green; }
         .error { color: red; }
+        .histogram { width: auto; margin-bottom: 20px; }
+        .histogram td.bar { width: 400px; }
+        .histogram .fill { background: #4a90d9; height: 14px; }
     </style>
 </head>
 <body>
@@ -772,12 +899,74 @@ func generateHTMLReport(results LoadTestResults) string {
 
 	html += `
     </table>
+`
+
+	html += generateHistogramHTML(scenarioHistograms(results.DetailedResults))
+
+	html += `
 </body>
 </html>`
 
 	return html
 }
 
+// generateHistogramHTML renders one latency histogram table per scenario, in
+// scenario order, with each bucket's share of the requests drawn as a bar
+func generateHistogramHTML(histograms map[string][]HistogramBucket) string {
+	if len(histograms) == 0 {
+		return ""
+	}
+
+	scenarios := make([]string, 0, len(histograms))
+	for scenario := range histograms {
+		scenarios = append(scenarios, scenario)
+	}
+	sort.Strings(scenarios)
+
+	var html strings.Builder
+	html.WriteString(`
+    <h2>Latency Distribution</h2>`)
+
+	for _, scenario := range scenarios {
+		buckets := histograms[scenario]
+		total := 0
+		for _, bucket := range buckets {
+			total += bucket.Count
+		}
+
+		html.WriteString(fmt.Sprintf(`
+    <h3>%s</h3>
+    <table class="histogram">
+        <tr>
+            <th>Latency</th>
+            <th>Requests</th>
+            <th></th>
+        </tr>`, scenario))
+
+		for i, bucket := range buckets {
+			label := fmt.Sprintf("&le; %v", bucket.UpperBound)
+			if i == len(buckets)-1 {
+				label = fmt.Sprintf("&gt; %v", buckets[i-1].UpperBound)
+			}
+			share := 0.0
+			if total > 0 {
+				share = float64(bucket.Count) / float64(total) * 100
+			}
+			html.WriteString(fmt.Sprintf(`
+        <tr class="bucket">
+            <td>%s</td>
+            <td>%d</td>
+            <td class="bar"><div class="fill" style="width: %.1f%%"></div></td>
+        </tr>`, label, bucket.Count, share))
+		}
+
+		html.WriteString(`
+    </table>`)
+	}
+
+	return html.String()
+}
+
 func printSummary(results LoadTestResults) {
 	fmt.Printf("\n=== Load Test Summary ===\n")
 	fmt.Printf("Duration: %v\n", results.TotalDuration)
@@ -808,3 +997,59 @@ func printSummary(results LoadTestResults) {
 			metrics.AverageLatency)
 	}
 }
+
+// checkThresholds compares the results against every limit that is set
+func checkThresholds(results LoadTestResults, thresholds Thresholds) []ThresholdCheck {
+	var checks []ThresholdCheck
+
+	if thresholds.MaxP95Latency != nil {
+		checks = append(checks, ThresholdCheck{
+			Metric: "P95 latency",
+			Limit:  fmt.Sprintf("<= %v", *thresholds.MaxP95Latency),
+			Actual: results.P95Latency.String(),
+			Passed: results.P95Latency <= *thresholds.MaxP95Latency,
+		})
+	}
+
+	if thresholds.MaxErrorRate != nil {
+		checks = append(checks, ThresholdCheck{
+			Metric: "Error rate",
+			Limit:  fmt.Sprintf("<= %.2f%%", *thresholds.MaxErrorRate*100),
+			Actual: fmt.Sprintf("%.2f%%", results.ErrorRate*100),
+			Passed: results.ErrorRate <= *thresholds.MaxErrorRate,
+		})
+	}
+
+	if thresholds.MinRequestsPerSec != nil {
+		checks = append(checks, ThresholdCheck{
+			Metric: "Requests/second",
+			Limit:  fmt.Sprintf(">= %.2f", *thresholds.MinRequestsPerSec),
+			Actual: fmt.Sprintf("%.2f", results.RequestsPerSec),
+			Passed: results.RequestsPerSec >= *thresholds.MinRequestsPerSec,
+		})
+	}
+
+	return checks
+}
+
+func printThresholdChecks(checks []ThresholdCheck) {
+	fmt.Printf("\n=== Thresholds ===\n")
+	for _, check := range checks {
+		status := "PASS"
+		if !check.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("[%s] %s: %s (limit %s)\n", status, check.Metric, check.Actual, check.Limit)
+	}
+}
+
+// thresholdExitCode is the process exit status for a set of checks: 1 if any
+// limit was breached, 0 otherwise
+func thresholdExitCode(checks []ThresholdCheck) int {
+	for _, check := range checks {
+		if !check.Passed {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTMLReportLatencyHistogram(t *testing.T) {
+	// A bimodal scenario: most requests are fast, a few hit a slow path
+	var detailed []TestResult
+	for _, latency := range []time.Duration{
+		5 * time.Millisecond, 6 * time.Millisecond, 8 * time.Millisecond,
+		700 * time.Millisecond, 900 * time.Millisecond,
+		7 * time.Second,
+	} {
+		detailed = append(detailed, TestResult{Scenario: "view_posts", Latency: latency, Success: true})
+	}
+
+	buckets := latencyHistogram(detailed)
+	if len(buckets) != len(latencyBucketBounds)+1 {
+		t.Fatalf("expected %d buckets, got %d", len(latencyBucketBounds)+1, len(buckets))
+	}
+	counts := map[time.Duration]int{}
+	for _, bucket := range buckets[:len(buckets)-1] {
+		counts[bucket.UpperBound] = bucket.Count
+	}
+	if counts[10*time.Millisecond] != 3 {
+		t.Errorf("expected 3 requests at or under 10ms, got %d", counts[10*time.Millisecond])
+	}
+	if counts[time.Second] != 2 {
+		t.Errorf("expected 2 requests between 500ms and 1s, got %d", counts[time.Second])
+	}
+	if counts[100*time.Millisecond] != 0 {
+		t.Errorf("expected the gap between the modes to stay empty, got %d", counts[100*time.Millisecond])
+	}
+	if last := buckets[len(buckets)-1].Count; last != 1 {
+		t.Errorf("expected 1 request in the unbounded bucket, got %d", last)
+	}
+
+	results := LoadTestResults{
+		TotalRequests:   len(detailed),
+		ScenarioResults: map[string]Metrics{"view_posts": calculateScenarioMetrics(detailed)},
+		DetailedResults: detailed,
+	}
+	html := generateHTMLReport(results)
+
+	for _, want := range []string{"Latency Distribution", "<h3>view_posts</h3>", "&le; 10ms", "&le; 1s", "&gt; 5s"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected report to contain %q", want)
+		}
+	}
+	if n := strings.Count(html, `<tr class="bucket">`); n != len(buckets) {
+		t.Errorf("expected %d bucket rows, got %d", len(buckets), n)
+	}
+	if !strings.Contains(html, `style="width: 50.0%"`) {
+		t.Error("expected the fast bucket to fill half the bar")
+	}
+}
+
+func TestRunLoadTestPlateauAndRampDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	config := LoadTestConfig{
+		BaseURL:         server.URL,
+		ConcurrentUsers: 4,
+		Duration:        time.Hour, // ignored once phases are set
+		RequestsPerUser: 10000,
+		RampUpTime:      200 * time.Millisecond,
+		PlateauTime:     400 * time.Millisecond,
+		RampDownTime:    400 * time.Millisecond,
+		ThinkTime:       10 * time.Millisecond,
+		TestScenarios:   []string{"homepage"},
+	}
+
+	start := time.Now()
+	results := runLoadTest(config)
+	elapsed := time.Since(start)
+
+	if elapsed > 5*time.Second {
+		t.Fatalf("expected the test to end after its ramp-down, ran for %v", elapsed)
+	}
+
+	// Count requests per 100ms window relative to the start of the run
+	windows := make([]int, 10)
+	for _, result := range results.DetailedResults {
+		i := int(result.Timestamp.Sub(start) / (100 * time.Millisecond))
+		if i >= 0 && i < len(windows) {
+			windows[i]++
+		}
+	}
+
+	// The last plateau window still runs all users, the last ramp-down
+	// window only the final one
+	plateau, tail := windows[5], windows[9]
+	if plateau == 0 {
+		t.Fatal("expected requests to continue to the end of the plateau")
+	}
+	if tail == 0 {
+		t.Error("expected the last user to keep going until the end of the ramp-down")
+	}
+	if tail*2 > plateau {
+		t.Errorf("expected load to taper during ramp-down, plateau window had %d requests and final window %d", plateau, tail)
+	}
+}
+
+func TestUserStopTime(t *testing.T) {
+	config := LoadTestConfig{ConcurrentUsers: 4, Duration: 30 * time.Second, RampUpTime: time.Second}
+	if got := userStopTime(config, 3); got != 30*time.Second {
+		t.Errorf("expected users to run for the whole duration without phases, got %v", got)
+	}
+
+	config.PlateauTime = 10 * time.Second
+	config.RampDownTime = 4 * time.Second
+	for userID, want := range []time.Duration{12 * time.Second, 13 * time.Second, 14 * time.Second, 15 * time.Second} {
+		if got := userStopTime(config, userID); got != want {
+			t.Errorf("user %d: expected to stop at %v, got %v", userID, want, got)
+		}
+	}
+}
+
+func TestThresholdsFailOnP95Regression(t *testing.T) {
+	var thresholds Thresholds
+	data := `{"max_p95_latency": 500000000, "max_error_rate": 0.05, "min_requests_per_second": 10}`
+	if err := json.Unmarshal([]byte(data), &thresholds); err != nil {
+		t.Fatalf("failed to parse thresholds: %v", err)
+	}
+
+	results := LoadTestResults{
+		P95Latency:     800 * time.Millisecond,
+		ErrorRate:      0.01,
+		RequestsPerSec: 50,
+	}
+
+	checks := checkThresholds(results, thresholds)
+	if len(checks) != 3 {
+		t.Fatalf("expected 3 checks, got %d", len(checks))
+	}
+	for _, check := range checks {
+		if check.Passed != (check.Metric != "P95 latency") {
+			t.Errorf("unexpected outcome for %s: passed=%v (actual %s, limit %s)", check.Metric, check.Passed, check.Actual, check.Limit)
+		}
+	}
+	if code := thresholdExitCode(checks); code == 0 {
+		t.Error("expected a non-zero exit code when P95 latency exceeds its threshold")
+	}
+
+	results.P95Latency = 200 * time.Millisecond
+	if code := thresholdExitCode(checkThresholds(results, thresholds)); code != 0 {
+		t.Errorf("expected exit code 0 when every threshold is met, got %d", code)
+	}
+
+	// Limits missing from the file are not checked
+	if checks := checkThresholds(results, Thresholds{}); len(checks) != 0 {
+		t.Errorf("expected no checks without thresholds, got %d", len(checks))
+	}
+}
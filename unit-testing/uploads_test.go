@@ -0,0 +1,75 @@
+package unit_testing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"connecthub/uploads"
+)
+
+func TestUploadsSave(t *testing.T) {
+	root := t.TempDir()
+	base := filepath.Join(root, "uploads")
+	uploads.SetBaseDir(base)
+	t.Cleanup(func() { uploads.SetBaseDir("") })
+
+	t.Run("TraversalConfined", func(t *testing.T) {
+		for _, name := range []string{"../../etc/passwd", "..\\..\\etc\\passwd", "/etc/passwd", ".."} {
+			url, err := uploads.Save("avatars", name, strings.NewReader("root:x:0:0"))
+			AssertNoError(t, err, "Saving should succeed for "+name)
+			AssertTrue(t, strings.HasPrefix(url, uploads.URLPrefix+"avatars/"), "URL should stay under the avatars prefix")
+
+			path, ok := uploads.Path(url)
+			AssertTrue(t, ok, "The returned URL should map back to a file")
+			AssertEqual(t, filepath.Join(base, "avatars"), filepath.Dir(path), "File should be written inside the category directory")
+
+			data, err := os.ReadFile(path)
+			AssertNoError(t, err, "Saved file should exist")
+			AssertEqual(t, "root:x:0:0", string(data), "Saved file should hold the upload")
+		}
+
+		_, err := os.Stat(filepath.Join(root, "etc", "passwd"))
+		AssertTrue(t, os.IsNotExist(err), "Nothing should be written outside the uploads directory")
+	})
+
+	t.Run("NameSanitized", func(t *testing.T) {
+		url, err := uploads.Save("attachments", "my <holiday> photo.png", strings.NewReader("png"))
+		AssertNoError(t, err, "Saving should succeed")
+		AssertTrue(t, strings.HasSuffix(url, "-my_holiday_photo.png"), "Unsafe characters should be replaced: "+url)
+
+		other, err := uploads.Save("attachments", "my <holiday> photo.png", strings.NewReader("png"))
+		AssertNoError(t, err, "Saving the same name again should succeed")
+		AssertTrue(t, url != other, "Each upload should get its own random prefix")
+	})
+
+	t.Run("CategoryRejected", func(t *testing.T) {
+		for _, category := range []string{"", "..", "../avatars", "avatars/../..", "Avatars"} {
+			_, err := uploads.Save(category, "photo.png", strings.NewReader("png"))
+			AssertTrue(t, errors.Is(err, uploads.ErrInvalidCategory), "Category "+category+" should be rejected")
+		}
+	})
+
+	t.Run("PathConfined", func(t *testing.T) {
+		path, ok := uploads.Path(uploads.URLPrefix + "../../main.go")
+		AssertTrue(t, ok, "Upload URLs should resolve")
+		AssertTrue(t, strings.HasPrefix(path, base+string(filepath.Separator)), "Dot segments should not climb out of the base directory")
+
+		_, ok = uploads.Path("/static/css/style.css")
+		AssertTrue(t, !ok, "URLs outside the uploads prefix should not resolve")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		url, err := uploads.Save("avatars", "old.png", strings.NewReader("png"))
+		AssertNoError(t, err, "Saving should succeed")
+		path, _ := uploads.Path(url)
+
+		AssertNoError(t, uploads.Remove(url), "Removing an upload should succeed")
+		_, err = os.Stat(path)
+		AssertTrue(t, os.IsNotExist(err), "The file should be gone")
+		AssertNoError(t, uploads.Remove(url), "Removing a missing upload should be harmless")
+		AssertNoError(t, uploads.Remove("/static/img/default.png"), "Non-upload URLs should be ignored")
+	})
+}
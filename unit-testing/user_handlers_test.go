@@ -3,20 +3,26 @@ package unit_testing
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"connecthub/database"
+	"connecthub/ratelimit"
 	"connecthub/server"
 )
 
 func TestLoginAPI(t *testing.T) {
-	testDB := TestSetup(t)
-	defer testDB.Cleanup()
+	db := AppTestSetup(t)
 
 	// Setup test users
-	_, err := SetupTestUsers(testDB.DB)
+	_, err := SetupTestUsers(db)
 	AssertNoError(t, err, "Failed to setup test users")
 
 	t.Run("ValidLogin", func(t *testing.T) {
@@ -152,8 +158,7 @@ func TestLoginAPI(t *testing.T) {
 }
 
 func TestSignupAPI(t *testing.T) {
-	testDB := TestSetup(t)
-	defer testDB.Cleanup()
+	db := AppTestSetup(t)
 
 	t.Run("ValidSignup", func(t *testing.T) {
 		signupReq := server.SignupRequest{
@@ -198,7 +203,7 @@ func TestSignupAPI(t *testing.T) {
 
 	t.Run("DuplicateUsername", func(t *testing.T) {
 		// Setup existing user
-		_, err := SetupTestUsers(testDB.DB)
+		_, err := SetupTestUsers(db)
 		AssertNoError(t, err, "Failed to setup test users")
 
 		signupReq := server.SignupRequest{
@@ -218,7 +223,7 @@ func TestSignupAPI(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.SignupAPI(w, req)
 
-		AssertEqual(t, w.Code, http.StatusConflict, "Expected status Conflict")
+		AssertEqual(t, w.Code, http.StatusUnprocessableEntity, "Expected status Unprocessable Entity")
 
 		var response server.SignupResponse
 		err = json.Unmarshal(w.Body.Bytes(), &response)
@@ -246,7 +251,7 @@ func TestSignupAPI(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.SignupAPI(w, req)
 
-		AssertEqual(t, w.Code, http.StatusConflict, "Expected status Conflict")
+		AssertEqual(t, w.Code, http.StatusUnprocessableEntity, "Expected status Unprocessable Entity")
 
 		var response server.SignupResponse
 		err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -274,14 +279,15 @@ func TestSignupAPI(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.SignupAPI(w, req)
 
-		AssertEqual(t, w.Code, http.StatusBadRequest, "Expected status Bad Request")
+		AssertEqual(t, w.Code, http.StatusUnprocessableEntity, "Expected status Unprocessable Entity")
 
-		var response server.SignupResponse
+		var response server.APIError
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		AssertNoError(t, err, "Failed to unmarshal response")
 
 		AssertEqual(t, response.Success, false, "Signup should fail")
-		AssertNotEqual(t, response.Error, "", "Error message should be present")
+		AssertEqual(t, "INVALID_EMAIL", response.Code, "Error code should name the problem")
+		AssertNotEqual(t, response.Fields["email"], "", "The email field should be flagged")
 	})
 
 	t.Run("MissingRequiredFields", func(t *testing.T) {
@@ -302,14 +308,15 @@ func TestSignupAPI(t *testing.T) {
 		w := httptest.NewRecorder()
 		server.SignupAPI(w, req)
 
-		AssertEqual(t, w.Code, http.StatusBadRequest, "Expected status Bad Request")
+		AssertEqual(t, w.Code, http.StatusUnprocessableEntity, "Expected status Unprocessable Entity")
 
-		var response server.SignupResponse
+		var response server.APIError
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		AssertNoError(t, err, "Failed to unmarshal response")
 
 		AssertEqual(t, response.Success, false, "Signup should fail")
-		AssertNotEqual(t, response.Error, "", "Error message should be present")
+		AssertEqual(t, "MISSING_FIELD", response.Code, "Error code should name the problem")
+		AssertNotEqual(t, response.Fields["lastName"], "", "The lastName field should be flagged")
 	})
 }
 
@@ -358,3 +365,445 @@ func TestLogoutAPI(t *testing.T) {
 		AssertEqual(t, w.Code, http.StatusOK, "Expected status OK")
 	})
 }
+
+func TestLogoutAllAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	userID, other := userIDs[0], userIDs[1]
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+	hub.Connect(t, userID)
+	hub.Connect(t, other)
+
+	// A real session, issued the way login does
+	login := httptest.NewRecorder()
+	server.CreateSession(login, httptest.NewRequest("POST", "/api/login", nil), userID)
+	var session *http.Cookie
+	for _, cookie := range login.Result().Cookies() {
+		if cookie.Name == "session_token" {
+			session = cookie
+		}
+	}
+	AssertTrue(t, session != nil, "Login should set a session cookie")
+
+	withSession := func(method, target string) *http.Request {
+		req := httptest.NewRequest(method, target, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session.Value})
+		return req
+	}
+
+	valid, _, _ := server.ValidateSession(withSession("GET", "/"))
+	AssertTrue(t, valid, "The session should be valid before logging out")
+
+	w := httptest.NewRecorder()
+	server.LogoutAllAPI(w, withSession("POST", "/api/logout-all"))
+	AssertEqual(t, http.StatusOK, w.Code, "Logout-all should succeed")
+
+	valid, _, _ = server.ValidateSession(withSession("GET", "/"))
+	AssertFalse(t, valid, "The old token should no longer validate")
+
+	var sessions int
+	AssertNoError(t, db.QueryRow("SELECT COUNT(*) FROM session WHERE userid = ?", userID).Scan(&sessions), "Failed to count sessions")
+	AssertEqual(t, 0, sessions, "Every session row should be deleted")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hub.Manager.IsUserOnline(userID) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	AssertFalse(t, hub.Manager.IsUserOnline(userID), "The user's chat connections should be closed")
+	AssertTrue(t, hub.Manager.IsUserOnline(other), "Other users should stay connected")
+
+	w = httptest.NewRecorder()
+	server.LogoutAllAPI(w, withSession("POST", "/api/logout-all"))
+	AssertEqual(t, http.StatusUnauthorized, w.Code, "A revoked token cannot log out again")
+}
+
+func TestLoginAPIUnreadTotals(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	conversationID, err := CreateTestConversation(db, []int{userIDs[0], userIDs[1]})
+	AssertNoError(t, err, "Failed to create conversation")
+	for _, content := range []string{"Are you there?", "Ping me when you are back"} {
+		_, err := database.AddMessageToConversation(db, conversationID, userIDs[1], content)
+		AssertNoError(t, err, "Failed to add message")
+	}
+
+	body, _ := json.Marshal(server.LoginRequest{Identifier: UserFixtures[0].Username, Password: UserFixtures[0].Password})
+	req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	server.LoginAPI(w, req)
+	AssertEqual(t, http.StatusOK, w.Code, "Login should succeed")
+
+	var response map[string]interface{}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+	AssertEqual(t, float64(2), response["unread_messages"], "Both incoming messages should be unread")
+	AssertEqual(t, float64(0), response["unread_notifications"], "There should be no notifications")
+}
+
+func TestLoginAPIErrorClassification(t *testing.T) {
+	db := AppTestSetup(t)
+
+	_, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	login := func(identifier, password string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.LoginRequest{Identifier: identifier, Password: password})
+		req := httptest.NewRequest("POST", "/api/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		server.LoginAPI(w, req)
+		return w
+	}
+
+	t.Run("WrongPasswordIsUnauthorized", func(t *testing.T) {
+		w := login(UserFixtures[0].Username, "wrongpassword")
+		AssertEqual(t, http.StatusUnauthorized, w.Code, "Wrong password should yield 401")
+
+		var response server.APIError
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		AssertEqual(t, "INCORRECT_PASSWORD", response.Code, "Error code should identify the password")
+	})
+
+	t.Run("DatabaseErrorIsServerError", func(t *testing.T) {
+		_, err := db.Exec("ALTER TABLE user RENAME TO user_unavailable")
+		AssertNoError(t, err, "Failed to break user table")
+
+		w := login(UserFixtures[0].Username, UserFixtures[0].Password)
+		AssertEqual(t, http.StatusInternalServerError, w.Code, "Database failure should yield 500")
+	})
+}
+
+func TestCheckAvailabilityAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	_, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+
+	check := func(query string) server.AvailabilityResponse {
+		req := httptest.NewRequest("GET", "/api/check-availability?"+query, nil)
+		w := httptest.NewRecorder()
+		server.CheckAvailabilityAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		var response server.AvailabilityResponse
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return response
+	}
+
+	t.Run("TakenUsername", func(t *testing.T) {
+		response := check("username=" + UserFixtures[0].Username + "&email=free@example.com")
+		AssertFalse(t, *response.UsernameAvailable, "Taken username should be unavailable")
+		AssertTrue(t, *response.EmailAvailable, "Unused email should be available")
+	})
+
+	t.Run("TakenEmail", func(t *testing.T) {
+		response := check("username=freename&email=" + UserFixtures[0].Email)
+		AssertTrue(t, *response.UsernameAvailable, "Unused username should be available")
+		AssertFalse(t, *response.EmailAvailable, "Taken email should be unavailable")
+	})
+
+	t.Run("BothFree", func(t *testing.T) {
+		response := check("username=freename&email=free@example.com")
+		AssertTrue(t, *response.UsernameAvailable, "Unused username should be available")
+		AssertTrue(t, *response.EmailAvailable, "Unused email should be available")
+	})
+
+	t.Run("MissingParameters", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/api/check-availability", nil)
+		w := httptest.NewRecorder()
+		server.CheckAvailabilityAPI(w, req)
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Expected status Bad Request")
+	})
+
+	t.Run("RateLimited", func(t *testing.T) {
+		handler := server.RateLimitMiddleware(ratelimit.New(3, time.Minute), server.CheckAvailabilityAPI)
+
+		for i := 0; i < 3; i++ {
+			req := httptest.NewRequest("GET", "/api/check-availability?username=freename", nil)
+			w := httptest.NewRecorder()
+			handler(w, req)
+			AssertEqual(t, http.StatusOK, w.Code, "Requests within the limit should pass")
+		}
+
+		req := httptest.NewRequest("GET", "/api/check-availability?username=freename", nil)
+		w := httptest.NewRecorder()
+		handler(w, req)
+		AssertEqual(t, http.StatusTooManyRequests, w.Code, "Requests over the limit should be rejected")
+		AssertNotEqual(t, "", w.Header().Get("Retry-After"), "Retry-After header should be set")
+	})
+
+	t.Run("ForwardedForDoesNotResetLimit", func(t *testing.T) {
+		handler := server.RateLimitMiddleware(ratelimit.New(3, time.Minute), server.CheckAvailabilityAPI)
+
+		for i := 0; i < 5; i++ {
+			req := httptest.NewRequest("GET", "/api/check-availability?username=freename", nil)
+			req.Header.Set("X-Forwarded-For", fmt.Sprintf("10.0.0.%d", i))
+			w := httptest.NewRecorder()
+			handler(w, req)
+			if i < 3 {
+				AssertEqual(t, http.StatusOK, w.Code, "Requests within the limit should pass")
+			} else {
+				AssertEqual(t, http.StatusTooManyRequests, w.Code, "A new X-Forwarded-For value should not get a fresh bucket")
+			}
+		}
+	})
+}
+
+func TestUploadAvatarAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+	sessionToken := CreateAppSession(t, db, userID)
+
+	pngData := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 64)...)
+
+	upload := func(filename string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		writer := multipart.NewWriter(&body)
+		part, err := writer.CreateFormFile("avatar", filename)
+		AssertNoError(t, err, "Failed to create form file")
+		part.Write(content)
+		writer.Close()
+
+		req := httptest.NewRequest("POST", "/api/user/avatar", &body)
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+
+		w := httptest.NewRecorder()
+		server.UploadAvatarAPI(w, req)
+		return w
+	}
+
+	storedAvatar := func() string {
+		user, err := database.GetUserByID(db, userID)
+		AssertNoError(t, err, "Failed to load user")
+		return user.Avatar.String
+	}
+
+	defaultAvatar := storedAvatar()
+
+	var firstAvatar string
+	t.Run("SuccessfulUpload", func(t *testing.T) {
+		w := upload("me.png", pngData)
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		var response server.AvatarResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		AssertNoError(t, err, "Failed to unmarshal response")
+		AssertTrue(t, response.Success, "Upload should succeed")
+		AssertTrue(t, strings.HasPrefix(response.Avatar, "/static/uploads/avatars/"), "Avatar URL should point at the uploads directory")
+		AssertEqual(t, response.Avatar, storedAvatar(), "User avatar should be updated in the database")
+
+		_, err = os.Stat(filepath.Join("src", response.Avatar))
+		AssertNoError(t, err, "Uploaded avatar should exist on disk")
+		firstAvatar = response.Avatar
+	})
+
+	t.Run("ReplacementRemovesOldFile", func(t *testing.T) {
+		w := upload("again.png", pngData)
+		AssertEqual(t, http.StatusOK, w.Code, "Expected status OK")
+
+		_, err := os.Stat(filepath.Join("src", firstAvatar))
+		AssertTrue(t, os.IsNotExist(err), "Previous upload should be removed from disk")
+		AssertNotEqual(t, firstAvatar, storedAvatar(), "Avatar should point at the new upload")
+	})
+
+	t.Run("RejectsNonImage", func(t *testing.T) {
+		before := storedAvatar()
+		w := upload("notes.png", []byte("just some text pretending to be an image"))
+		AssertEqual(t, http.StatusBadRequest, w.Code, "Non-image upload should be rejected")
+		AssertEqual(t, before, storedAvatar(), "Avatar should be unchanged after a rejected upload")
+	})
+
+	AssertTrue(t, strings.HasPrefix(defaultAvatar, "/static/assets/"), "Users start with a built-in default avatar")
+}
+
+func TestExportUserData(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	owner, friend, stranger := userIDs[0], userIDs[1], userIDs[2]
+
+	ownPost, err := database.CreatePost(db, owner, "Owner post", "Written by the exporting user", []string{"Go"})
+	AssertNoError(t, err, "Failed to create owner post")
+	friendPost, err := database.CreatePost(db, friend, "Friend post", "Written by someone else", []string{"Git"})
+	AssertNoError(t, err, "Failed to create friend post")
+	AssertNoError(t, database.AddComment(db, friendPost, owner, "Owner comment"), "Failed to add owner comment")
+	AssertNoError(t, database.AddComment(db, ownPost, friend, "Friend comment"), "Failed to add friend comment")
+
+	sharedConversation, err := CreateTestConversation(db, []int{owner, friend})
+	AssertNoError(t, err, "Failed to create shared conversation")
+	privateConversation, err := CreateTestConversation(db, []int{friend, stranger})
+	AssertNoError(t, err, "Failed to create conversation without the owner")
+
+	_, err = database.AddMessageToConversation(db, sharedConversation, owner, "Owner message")
+	AssertNoError(t, err, "Failed to add owner message")
+	_, err = database.AddMessageToConversation(db, sharedConversation, friend, "Reply to owner")
+	AssertNoError(t, err, "Failed to add reply")
+	_, err = database.AddMessageToConversation(db, privateConversation, friend, "Not for the owner")
+	AssertNoError(t, err, "Failed to add unrelated message")
+
+	sessionToken := CreateAppSession(t, db, owner)
+	req := httptest.NewRequest("GET", "/api/user/export", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+	w := httptest.NewRecorder()
+	server.ExportUserDataAPI(w, req)
+
+	AssertEqual(t, http.StatusOK, w.Code, "Export should succeed")
+
+	var export struct {
+		Profile       database.ExportProfile          `json:"profile"`
+		Posts         []database.ExportPost           `json:"posts"`
+		Comments      []database.ExportComment        `json:"comments"`
+		Conversations []database.ExportedConversation `json:"conversations"`
+		Messages      []database.ExportMessage        `json:"messages"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &export), "Export should be valid JSON")
+
+	AssertEqual(t, owner, export.Profile.ID, "Profile should belong to the exporting user")
+	AssertFalse(t, strings.Contains(w.Body.String(), "password"), "Export should not contain the password hash")
+
+	AssertEqual(t, 1, len(export.Posts), "Only the user's own posts should be exported")
+	AssertEqual(t, ownPost, export.Posts[0].ID, "Exported post should be the user's")
+	AssertEqual(t, "Go", strings.Join(export.Posts[0].Categories, ","), "Post categories should be exported")
+
+	AssertEqual(t, 1, len(export.Comments), "Only the user's own comments should be exported")
+	AssertEqual(t, "Owner comment", export.Comments[0].Content, "Exported comment should be the user's")
+
+	AssertEqual(t, 1, len(export.Conversations), "Only conversations the user is in should be exported")
+	AssertEqual(t, sharedConversation, export.Conversations[0].ID, "Exported conversation should be the shared one")
+	AssertEqual(t, 2, len(export.Conversations[0].Participants), "Conversation should list its participants")
+
+	AssertEqual(t, 2, len(export.Messages), "Both sides of the shared conversation should be exported")
+	for _, message := range export.Messages {
+		AssertEqual(t, sharedConversation, message.ConversationID, "Messages from other conversations should not leak")
+	}
+}
+
+func TestSearchUsersAPI(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	viewer, jane, bob, alice := userIDs[0], userIDs[1], userIDs[2], userIDs[3]
+	sessionToken := CreateAppSession(t, db, viewer)
+
+	search := func(query string) []server.UserSearchResult {
+		req := httptest.NewRequest("GET", "/api/users/search?q="+query, nil)
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.SearchUsersAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Search should succeed")
+
+		var results []server.UserSearchResult
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &results), "Failed to unmarshal search results")
+		return results
+	}
+
+	t.Run("PartialUsernameMatches", func(t *testing.T) {
+		results := search("SMI")
+		AssertEqual(t, 1, len(results), "Partial username should match regardless of case")
+		AssertEqual(t, jane, results[0].ID, "janesmith should match")
+	})
+
+	t.Run("ExcludesRequester", func(t *testing.T) {
+		results := search("john")
+		AssertEqual(t, 1, len(results), "Only other users should match")
+		AssertEqual(t, bob, results[0].ID, "Last name Johnson should match")
+	})
+
+	t.Run("BlockedUserOmitted", func(t *testing.T) {
+		AssertEqual(t, 1, len(search("alice")), "Alice should be found before the block")
+
+		AssertNoError(t, database.BlockUser(db, viewer, alice), "Failed to block user")
+		AssertEqual(t, 0, len(search("alice")), "Blocked user should be omitted")
+
+		AssertNoError(t, database.BlockUser(db, jane, viewer), "Failed to block user")
+		AssertEqual(t, 0, len(search("jane")), "Users who blocked the requester should be omitted")
+	})
+}
+
+func TestUserCreatedAt(t *testing.T) {
+	db := AppTestSetup(t)
+
+	before := time.Now().Add(-time.Minute)
+	userID, err := database.CreateUser(db, "New", "Member", "newmember", "new@example.com",
+		"female", "1999-09-09", "password123")
+	AssertNoError(t, err, "Failed to create user")
+
+	user, err := database.GetUserByID(db, userID)
+	AssertNoError(t, err, "Failed to get user")
+	AssertTrue(t, user.CreatedAt != nil, "A new user should have created_at")
+	AssertTrue(t, user.CreatedAt.After(before) && user.CreatedAt.Before(time.Now().Add(time.Minute)),
+		"created_at should be recent")
+
+	sessionToken := CreateAppSession(t, db, userID)
+	req := httptest.NewRequest("GET", "/api/user/current", nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+	w := httptest.NewRecorder()
+	server.GetCurrentUser(w, req)
+
+	AssertEqual(t, http.StatusOK, w.Code, "Profile should load")
+	var profile struct {
+		CreatedAt *time.Time `json:"createdAt"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &profile), "Failed to unmarshal profile")
+	AssertTrue(t, profile.CreatedAt != nil, "Profile should include createdAt")
+	AssertTrue(t, profile.CreatedAt.Equal(*user.CreatedAt), "Profile createdAt should match the stored value")
+}
+
+func TestGetUsersBatch(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	requested := []int{userIDs[0], userIDs[2], userIDs[4]}
+
+	t.Run("SingleQuery", func(t *testing.T) {
+		countingDB := OpenCountingDB(t, "./database/main.db")
+		ResetQueryCount()
+		users, err := database.GetUsersByIDs(countingDB, append(requested, userIDs[0]))
+		AssertNoError(t, err, "GetUsersByIDs should succeed")
+		AssertEqual(t, 3, len(users), "Each requested user should be returned once")
+		AssertEqual(t, int64(1), QueryCount(), "Users should be loaded in one query")
+	})
+
+	post := func(ids []int) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(server.UsersBatchRequest{IDs: ids})
+		w := httptest.NewRecorder()
+		server.GetUsersBatchAPI(w, httptest.NewRequest("POST", "/api/users/batch", bytes.NewBuffer(body)))
+		return w
+	}
+
+	t.Run("Endpoint", func(t *testing.T) {
+		w := post(append(requested, userIDs[2], 99999))
+		AssertEqual(t, http.StatusOK, w.Code, "Batch lookup should succeed")
+
+		var response struct {
+			Users []server.UserSearchResult `json:"users"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode response")
+		AssertEqual(t, 3, len(response.Users), "Duplicates and unknown ids should be dropped")
+		for _, user := range response.Users {
+			AssertTrue(t, user.Username != "", "Each user should carry their username")
+		}
+	})
+
+	t.Run("TooMany", func(t *testing.T) {
+		ids := make([]int, 201)
+		for i := range ids {
+			ids[i] = i + 1
+		}
+		AssertEqual(t, http.StatusBadRequest, post(ids).Code, "Oversized batches should be rejected")
+	})
+}
@@ -1,6 +1,7 @@
 package unit_testing
 
 import (
+	"errors"
 	"testing"
 
 	"connecthub/database"
@@ -295,3 +296,69 @@ func TestUserService(t *testing.T) {
 		AssertEqual(t, user, (*database.User)(nil), "User should not be returned")
 	})
 }
+
+func TestCaseInsensitiveIdentifiers(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userService := services.NewUserService(repository.NewUserRepository(db))
+
+	userID, err := userService.RegisterUser("John", "Doe", "JohnDoe", " John.Doe@Example.com ", "male", "1990-01-01", "password123")
+	AssertNoError(t, err, "First registration should succeed")
+
+	t.Run("UsernameCollisionRejected", func(t *testing.T) {
+		_, err := userService.RegisterUser("Other", "Person", "johndoe", "other@example.com", "male", "1990-01-01", "password123")
+		AssertError(t, err, "Registration differing only in username case should be rejected")
+	})
+
+	t.Run("EmailCollisionRejected", func(t *testing.T) {
+		_, err := userService.RegisterUser("Other", "Person", "otherperson", "JOHN.DOE@example.com", "male", "1990-01-01", "password123")
+		AssertError(t, err, "Registration differing only in email case should be rejected")
+	})
+
+	t.Run("EmailStoredNormalized", func(t *testing.T) {
+		user, err := database.GetUserByID(db, userID)
+		AssertNoError(t, err, "Should retrieve user")
+		AssertEqual(t, "john.doe@example.com", user.Email, "Email should be trimmed and lowercased")
+		AssertEqual(t, "JohnDoe", user.Username, "Username should keep its display casing")
+	})
+
+	t.Run("LoginIgnoresCase", func(t *testing.T) {
+		for _, identifier := range []string{"johndoe", "JOHNDOE", "  JohnDoe ", "JOHN.DOE@EXAMPLE.COM"} {
+			user, err := userService.AuthenticateUser(identifier, "password123")
+			AssertNoError(t, err, "Login should succeed for "+identifier)
+			AssertEqual(t, userID, user.ID, "Should authenticate the same user")
+		}
+	})
+}
+
+func TestValidateUsername(t *testing.T) {
+	db := AppTestSetup(t)
+	userService := services.NewUserService(repository.NewUserRepository(db))
+
+	rejected := map[string]string{
+		"john doe":              "Usernames with spaces should be rejected",
+		"jo":                    "Usernames under three characters should be rejected",
+		"a_very_long_username1": "Usernames over twenty characters should be rejected",
+		"jane@home":             "Usernames with @ should be rejected",
+		"tab\tname":             "Usernames with control characters should be rejected",
+		"admin":                 "Reserved usernames should be rejected",
+		"Deleted":               "Reserved usernames should be rejected regardless of case",
+	}
+	for username, msg := range rejected {
+		err := services.ValidateUsername(username)
+		AssertTrue(t, errors.Is(err, services.ErrInvalidUsername), msg)
+	}
+
+	AssertNoError(t, services.ValidateUsername("jane_doe42"), "A well-formed username should pass")
+
+	t.Run("RegisterUserApplies", func(t *testing.T) {
+		_, err := userService.RegisterUser("Ada", "Admin", "admin", "ada@example.com", "female", "1990-01-01", "password123")
+		var fields services.ValidationErrors
+		AssertTrue(t, errors.As(err, &fields), "Rejection should be reported per field")
+		AssertTrue(t, fields["username"] != "", "The username field should be flagged")
+
+		userID, err := userService.RegisterUser("Ada", "Lovelace", "ada_l", "ada@example.com", "female", "1990-01-01", "password123")
+		AssertNoError(t, err, "A valid username should register")
+		AssertTrue(t, userID > 0, "The new user should have an ID")
+	})
+}
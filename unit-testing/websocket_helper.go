@@ -1,6 +1,7 @@
 package unit_testing
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -12,6 +13,9 @@ import (
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"connecthub/database"
+	chat "connecthub/websocket"
 )
 
 // WebSocketMessage represents a WebSocket message for testing
@@ -377,3 +381,80 @@ func (h *WebSocketTestHelper) SimulateOnlineStatusChange(userID int, status stri
 
 	return h.BroadcastMessage(message)
 }
+
+// HubTestServer serves the real chat WebSocket manager against a database created by AppTestSetup
+type HubTestServer struct {
+	Server  *httptest.Server
+	Manager *chat.Manager
+	DB      *sql.DB
+}
+
+// NewHubTestServer starts the chat manager behind an httptest server
+func NewHubTestServer(t *testing.T, db *sql.DB) *HubTestServer {
+	chat.SetDB(db)
+	manager := chat.NewManager()
+	database.SetPresenceChecker(manager.IsUserOnline)
+	server := httptest.NewServer(http.HandlerFunc(manager.HandleConnection))
+
+	t.Cleanup(func() {
+		server.Close()
+		chat.SetDB(nil)
+		database.SetPresenceChecker(nil)
+	})
+
+	return &HubTestServer{Server: server, Manager: manager, DB: db}
+}
+
+// Connect opens an authenticated WebSocket connection for a user and waits until the hub registers it
+func (s *HubTestServer) Connect(t *testing.T, userID int) *websocket.Conn {
+	sessionToken := CreateAppSession(t, s.DB, userID)
+
+	wsURL := strings.Replace(s.Server.URL, "http://", "ws://", 1) + fmt.Sprintf("/ws?user_id=%d", userID)
+	header := http.Header{}
+	header.Set("Cookie", "session_token="+sessionToken)
+
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		t.Fatalf("Failed to connect user %d: %v", userID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	// The hub greets each registered client with the online users list
+	ReadHubMessage(t, conn, chat.MessageTypeOnlineUsers, 2*time.Second)
+	return conn
+}
+
+// ReadHubMessage reads from conn until a message of the given type arrives, skipping others
+func ReadHubMessage(t *testing.T, conn *websocket.Conn, messageType string, timeout time.Duration) chat.Message {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	conn.SetReadDeadline(deadline)
+	defer conn.SetReadDeadline(time.Time{})
+
+	for {
+		var message chat.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("Did not receive %s message: %v", messageType, err)
+		}
+		if message.Type == messageType {
+			return message
+		}
+	}
+}
+
+// CollectHubMessages reads all messages of the given type that arrive within the window
+func CollectHubMessages(conn *websocket.Conn, messageType string, window time.Duration) []chat.Message {
+	conn.SetReadDeadline(time.Now().Add(window))
+	defer conn.SetReadDeadline(time.Time{})
+
+	var messages []chat.Message
+	for {
+		var message chat.Message
+		if err := conn.ReadJSON(&message); err != nil {
+			return messages
+		}
+		if message.Type == messageType {
+			messages = append(messages, message)
+		}
+	}
+}
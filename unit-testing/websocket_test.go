@@ -1,10 +1,23 @@
 package unit_testing
 
 import (
+	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+
+	"connecthub/database"
+	"connecthub/server"
+	chat "connecthub/websocket"
+
+	"github.com/gorilla/mux"
+	gorillaws "github.com/gorilla/websocket"
 )
 
 func TestWebSocketConnections(t *testing.T) {
@@ -405,3 +418,749 @@ func TestWebSocketConnectionManagement(t *testing.T) {
 		AssertEqual(t, len(sentMessages), 0, "Should have no messages after clear")
 	})
 }
+
+func TestGroupConversationDelivery(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, memberA, memberB := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, memberA, memberB})
+	AssertNoError(t, err, "Failed to create group conversation")
+
+	hub := NewHubTestServer(t, db)
+	senderConn := hub.Connect(t, sender)
+	memberAConn := hub.Connect(t, memberA)
+	memberBConn := hub.Connect(t, memberB)
+
+	err = senderConn.WriteJSON(map[string]interface{}{
+		"type":            "private",
+		"conversation_id": conversationID,
+		"content":         "Hello group",
+	})
+	AssertNoError(t, err, "Failed to send group message")
+
+	for _, conn := range []*gorillaws.Conn{memberAConn, memberBConn} {
+		message := ReadHubMessage(t, conn, "private", 2*time.Second)
+		AssertEqual(t, "Hello group", message.Content, "Members should receive the message content")
+		AssertEqual(t, conversationID, message.ConversationID, "Message should reference the group conversation")
+		AssertEqual(t, sender, message.SenderID, "Message should identify the sender")
+	}
+
+	confirmations := CollectHubMessages(senderConn, "private", 500*time.Millisecond)
+	AssertEqual(t, 1, len(confirmations), "Sender should receive exactly one confirmation")
+
+	var stored int
+	err = db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&stored)
+	AssertNoError(t, err, "Failed to count stored messages")
+	AssertEqual(t, 1, stored, "Message should be persisted once")
+}
+
+func TestWebSocketClientMsgID(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	senderConn := hub.Connect(t, sender)
+
+	const clientMsgID = "9b2e7f40-1c3d-4a5e-8f60-7a1b2c3d4e5f"
+	var ids []int
+	for i := 0; i < 2; i++ {
+		err = senderConn.WriteJSON(map[string]interface{}{
+			"type":            "private",
+			"conversation_id": conversationID,
+			"recipient_id":    recipient,
+			"content":         "Only once, please",
+			"client_msg_id":   clientMsgID,
+		})
+		AssertNoError(t, err, "Failed to send message")
+
+		confirmation := ReadHubMessage(t, senderConn, "private", 2*time.Second)
+		AssertEqual(t, clientMsgID, confirmation.ClientMsgID, "Confirmation should echo the client_msg_id")
+		ids = append(ids, confirmation.ID)
+	}
+
+	AssertEqual(t, ids[0], ids[1], "Resending should confirm the original message id")
+
+	var stored int
+	err = db.QueryRow("SELECT COUNT(*) FROM message WHERE conversation_id = ?", conversationID).Scan(&stored)
+	AssertNoError(t, err, "Failed to count stored messages")
+	AssertEqual(t, 1, stored, "Message should be persisted once")
+}
+
+func TestWebSocketSyncAfterReconnect(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	reader, sender := userIDs[0], userIDs[1]
+
+	conversationID, err := CreateTestConversation(db, []int{reader, sender})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	readerConn := hub.Connect(t, reader)
+	senderConn := hub.Connect(t, sender)
+
+	err = senderConn.WriteJSON(map[string]interface{}{
+		"type":            "private",
+		"conversation_id": conversationID,
+		"content":         "Seen before the drop",
+	})
+	AssertNoError(t, err, "Failed to send message")
+	lastSeen := ReadHubMessage(t, readerConn, "private", 2*time.Second)
+
+	// Drop the reader's connection and let messages pile up while they are away
+	readerConn.Close()
+	var missedIDs []int
+	for _, content := range []string{"Missed one", "Missed two"} {
+		msg, err := database.AddMessageToConversation(db, conversationID, sender, content)
+		AssertNoError(t, err, "Failed to store message during disconnect")
+		missedIDs = append(missedIDs, msg.ID)
+	}
+
+	readerConn = hub.Connect(t, reader)
+	err = readerConn.WriteJSON(map[string]interface{}{
+		"type":                 "sync",
+		"conversation_id":      conversationID,
+		"last_seen_message_id": lastSeen.ID,
+	})
+	AssertNoError(t, err, "Failed to send sync request")
+
+	var replayed []int
+	readerConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var frame struct {
+			Type    string      `json:"type"`
+			ID      int         `json:"id"`
+			Content interface{} `json:"content"`
+		}
+		AssertNoError(t, readerConn.ReadJSON(&frame), "Failed to read sync response")
+		if frame.Type == "private" {
+			replayed = append(replayed, frame.ID)
+		}
+		if frame.Type == "sync_complete" {
+			completion, _ := frame.Content.(map[string]interface{})
+			AssertEqual(t, float64(len(missedIDs)), completion["count"], "Completion frame should report the replay count")
+			AssertEqual(t, false, completion["has_more"], "Nothing should be left to sync")
+			break
+		}
+	}
+
+	AssertEqual(t, fmt.Sprint(missedIDs), fmt.Sprint(replayed), "Sync should replay exactly the messages missed while disconnected")
+}
+
+func TestWebSocketAllowedOrigins(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userID, err := CreateTestUser(db, UserFixtures[0])
+	AssertNoError(t, err, "Failed to create test user")
+	sessionToken := CreateAppSession(t, db, userID)
+
+	hub := NewHubTestServer(t, db)
+	hub.Manager.SetAllowedOrigins([]string{"https://app.example.com"})
+
+	dial := func(requestOrigin string) (*gorillaws.Conn, *http.Response, error) {
+		wsURL := strings.Replace(hub.Server.URL, "http://", "ws://", 1) + fmt.Sprintf("/ws?user_id=%d", userID)
+		header := http.Header{}
+		header.Set("Cookie", "session_token="+sessionToken)
+		header.Set("Origin", requestOrigin)
+		return gorillaws.DefaultDialer.Dial(wsURL, header)
+	}
+
+	t.Run("DisallowedOrigin", func(t *testing.T) {
+		conn, resp, err := dial("https://evil.example.com")
+		if conn != nil {
+			conn.Close()
+		}
+		AssertError(t, err, "Upgrade from a disallowed origin should fail")
+		AssertTrue(t, resp != nil && resp.StatusCode == http.StatusForbidden, "Disallowed origin should be answered with 403")
+	})
+
+	t.Run("AllowedOrigin", func(t *testing.T) {
+		conn, _, err := dial("https://app.example.com")
+		AssertNoError(t, err, "Upgrade from an allowed origin should succeed")
+		conn.Close()
+	})
+
+	t.Run("WildcardOrigin", func(t *testing.T) {
+		hub.Manager.SetAllowedOrigins([]string{"*"})
+		conn, resp, err := dial("https://evil.example.com")
+		if conn != nil {
+			conn.Close()
+		}
+		AssertError(t, err, "The wildcard should not let other sites open a session's WebSocket")
+		AssertTrue(t, resp != nil && resp.StatusCode == http.StatusForbidden, "Wildcard-only origin should be answered with 403")
+	})
+}
+
+func TestDisplayNameConsistency(t *testing.T) {
+	db := AppTestSetup(t)
+
+	AssertNoError(t, database.SetDisplayNameFormat(database.DisplayNameFullName), "Full-name format should be accepted")
+	t.Cleanup(func() { database.SetDisplayNameFormat(database.DisplayNameUsername) })
+	AssertError(t, database.SetDisplayNameFormat("nickname"), "Unknown formats should be rejected")
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient, newcomer := userIDs[0], userIDs[1], userIDs[2]
+	want := UserFixtures[0].FirstName + " " + UserFixtures[0].LastName
+
+	name, err := database.GetDisplayName(db, sender)
+	AssertNoError(t, err, "Failed to look up display name")
+	AssertEqual(t, want, name, "GetDisplayName should use the full name")
+	user, err := database.GetUserByID(db, sender)
+	AssertNoError(t, err, "Failed to load user")
+	AssertEqual(t, want, user.DisplayName(), "User.DisplayName should agree with GetDisplayName")
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	t.Run("DatabasePaths", func(t *testing.T) {
+		stored, err := database.AddMessageToConversation(db, conversationID, sender, "Stored directly")
+		AssertNoError(t, err, "Failed to add message")
+		AssertEqual(t, want, stored.SenderName, "Added message should carry the display name")
+
+		messages, err := database.GetConversationMessages(db, conversationID, 10, 0)
+		AssertNoError(t, err, "Failed to load messages")
+		AssertEqual(t, want, messages[0].SenderName, "Message history should carry the display name")
+
+		conversations, err := database.GetUserConversations(db, recipient)
+		AssertNoError(t, err, "Failed to load conversations")
+		AssertEqual(t, want, conversations[0].LastMessage.SenderName, "Last message preview should carry the display name")
+	})
+
+	t.Run("HubPaths", func(t *testing.T) {
+		hub := NewHubTestServer(t, db)
+		senderConn := hub.Connect(t, sender)
+		recipientConn := hub.Connect(t, recipient)
+		newcomerConn := hub.Connect(t, newcomer)
+
+		err := senderConn.WriteJSON(map[string]interface{}{
+			"type":            "typing",
+			"conversation_id": conversationID,
+			"recipient_id":    recipient,
+			"action":          "start",
+		})
+		AssertNoError(t, err, "Failed to send typing indicator")
+		AssertEqual(t, want, ReadHubMessage(t, recipientConn, "typing", 2*time.Second).SenderName, "Typing indicator should carry the display name")
+
+		err = senderConn.WriteJSON(map[string]interface{}{
+			"type":            "private",
+			"conversation_id": conversationID,
+			"content":         "Sent over the socket",
+		})
+		AssertNoError(t, err, "Failed to send message")
+		AssertEqual(t, want, ReadHubMessage(t, recipientConn, "private", 2*time.Second).SenderName, "Delivered message should carry the display name")
+
+		err = senderConn.WriteJSON(map[string]interface{}{
+			"type":                "private",
+			"recipient_id":        newcomer,
+			"is_new_conversation": true,
+			"content":             "Starting fresh",
+		})
+		AssertNoError(t, err, "Failed to start conversation")
+		AssertEqual(t, want, ReadHubMessage(t, newcomerConn, "new_conversation", 2*time.Second).SenderName, "New conversation notification should carry the display name")
+	})
+}
+
+func TestPerUserConnectionLimit(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	user := userIDs[0]
+
+	hub := NewHubTestServer(t, db)
+	var conns []*gorillaws.Conn
+	for i := 0; i < 4; i++ {
+		conns = append(conns, hub.Connect(t, user))
+	}
+
+	AssertEqual(t, 3, hub.Manager.ConnectionCount(user), "Only the three newest connections should remain")
+	AssertTrue(t, hub.Manager.IsUserOnline(user), "User should stay online after the oldest connection is closed")
+
+	// The oldest connection is closed by the server rather than timing out
+	conns[0].SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conns[0].ReadMessage(); err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				t.Fatalf("Oldest connection should have been closed by the server")
+			}
+			break
+		}
+	}
+
+	delivered := hub.Manager.SendToUser(user, chat.Message{Type: "notification", Content: "to every device"})
+	AssertTrue(t, delivered, "Message should reach the remaining connections")
+	for _, conn := range conns[1:] {
+		AssertEqual(t, "to every device", ReadHubMessage(t, conn, "notification", 2*time.Second).Content, "Each remaining connection should receive the message")
+	}
+}
+
+func TestTypingPresencePolling(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	typist, reader, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{typist, reader})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	hub.Manager.SetTypingTTL(300 * time.Millisecond)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+
+	readerToken := CreateAppSession(t, db, reader)
+	outsiderToken := CreateAppSession(t, db, outsider)
+
+	poll := func(sessionToken string) (int, []server.TypingUser) {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/api/conversations/%d/typing", conversationID), nil)
+		req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: sessionToken})
+		w := httptest.NewRecorder()
+		server.GetTypingUsersAPI(w, req)
+
+		var response struct {
+			Typing []server.TypingUser `json:"typing"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Typing
+	}
+
+	// The reader polls instead of holding a WebSocket open
+	conn := hub.Connect(t, typist)
+	err = conn.WriteJSON(chat.Message{
+		Type:           chat.MessageTypeTyping,
+		RecipientID:    reader,
+		ConversationID: conversationID,
+		Action:         chat.TypingActionStart,
+	})
+	AssertNoError(t, err, "Failed to send typing start")
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if len(hub.Manager.TypingUsers(conversationID)) > 0 {
+			break
+		}
+	}
+	code, typing := poll(readerToken)
+	AssertEqual(t, http.StatusOK, code, "Participant should be able to poll typing state")
+	AssertEqual(t, 1, len(typing), "Typist should be listed")
+	AssertEqual(t, typist, typing[0].UserID, "Listed user should be the typist")
+
+	code, _ = poll(outsiderToken)
+	AssertEqual(t, http.StatusForbidden, code, "Non-participants should not see typing state")
+
+	time.Sleep(400 * time.Millisecond)
+	code, typing = poll(readerToken)
+	AssertEqual(t, http.StatusOK, code, "Polling after expiry should succeed")
+	AssertEqual(t, 0, len(typing), "Typing state should expire after the TTL")
+}
+
+func TestOnlineUsersIncludeProfiles(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+
+	hub.Connect(t, userIDs[0])
+	conn := hub.Connect(t, userIDs[1])
+
+	AssertNoError(t, conn.WriteJSON(chat.Message{Type: "get_online_users"}), "Failed to request online users")
+	message := ReadHubMessage(t, conn, chat.MessageTypeOnlineUsers, 2*time.Second)
+
+	var payload struct {
+		Users   []int             `json:"users"`
+		Details []chat.OnlineUser `json:"details"`
+	}
+	raw, _ := json.Marshal(message.Content)
+	AssertNoError(t, json.Unmarshal(raw, &payload), "Failed to decode online users payload")
+	AssertEqual(t, 2, len(payload.Users), "Plain id list should still be sent")
+	AssertEqual(t, 2, len(payload.Details), "Details should list every connected user")
+	usernames := map[int]string{}
+	for _, user := range payload.Details {
+		usernames[user.ID] = user.Username
+	}
+	AssertEqual(t, UserFixtures[0].Username, usernames[userIDs[0]], "First user should be listed by username")
+	AssertEqual(t, UserFixtures[1].Username, usernames[userIDs[1]], "Second user should be listed by username")
+
+	req := httptest.NewRequest("GET", "/api/users/online", nil)
+	w := httptest.NewRecorder()
+	server.GetOnlineUsersAPI(w, req)
+	AssertEqual(t, http.StatusOK, w.Code, "Online users endpoint should succeed")
+
+	var response struct {
+		Users []chat.OnlineUser `json:"users"`
+	}
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode endpoint response")
+	AssertEqual(t, 2, len(response.Users), "Endpoint should list both connected users")
+	AssertEqual(t, UserFixtures[1].Username, response.Users[0].Username, "Users should be ordered by username")
+}
+
+func TestDeliveryReceipt(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient, offline := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+	offlineConversationID, err := CreateTestConversation(db, []int{sender, offline})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	senderConn := hub.Connect(t, sender)
+	recipientConn := hub.Connect(t, recipient)
+
+	err = senderConn.WriteJSON(map[string]interface{}{
+		"type":            "private",
+		"conversation_id": conversationID,
+		"content":         "Did this arrive?",
+	})
+	AssertNoError(t, err, "Failed to send message")
+
+	delivered := ReadHubMessage(t, recipientConn, "private", 2*time.Second)
+	receipt := ReadHubMessage(t, senderConn, chat.MessageTypeDeliveryReceipt, 2*time.Second)
+	AssertEqual(t, delivered.ID, receipt.MessageID, "Receipt should reference the delivered message")
+	AssertEqual(t, conversationID, receipt.ConversationID, "Receipt should reference the conversation")
+
+	var deliveredAt sql.NullTime
+	err = db.QueryRow("SELECT delivered_at FROM message WHERE message_id = ?", delivered.ID).Scan(&deliveredAt)
+	AssertNoError(t, err, "Failed to read delivered_at")
+	AssertTrue(t, deliveredAt.Valid, "delivered_at should be stamped")
+
+	messages, err := database.GetConversationMessages(db, conversationID, 10, 0)
+	AssertNoError(t, err, "Failed to load messages")
+	AssertEqual(t, database.MessageStatusDelivered, messages[0].Status, "Stored message should report delivered")
+
+	t.Run("OfflineRecipientStaysSent", func(t *testing.T) {
+		err := senderConn.WriteJSON(map[string]interface{}{
+			"type":            "private",
+			"conversation_id": offlineConversationID,
+			"content":         "Are you there?",
+		})
+		AssertNoError(t, err, "Failed to send message")
+
+		receipts := CollectHubMessages(senderConn, chat.MessageTypeDeliveryReceipt, 500*time.Millisecond)
+		AssertEqual(t, 0, len(receipts), "No receipt should be sent while the recipient is offline")
+
+		messages, err := database.GetConversationMessages(db, offlineConversationID, 10, 0)
+		AssertNoError(t, err, "Failed to load messages")
+		AssertEqual(t, database.MessageStatusSent, messages[0].Status, "Undelivered message should report sent")
+	})
+}
+
+func TestNewPostAnnouncement(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	author, reader := userIDs[0], userIDs[1]
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+	hub.Manager.SetNewPostRate(1)
+
+	authorConn := hub.Connect(t, author)
+	readerConn := hub.Connect(t, reader)
+	session := CreateAppSession(t, db, author)
+
+	createPost := func(title string) int {
+		body := `{"title":"` + title + `","content":"Fresh off the press","categories":["Go"]}`
+		req := httptest.NewRequest("POST", "/api/post/create", strings.NewReader(body))
+		req.AddCookie(&http.Cookie{Name: "session_token", Value: session})
+		w := httptest.NewRecorder()
+		server.CreatePostAPI(w, req)
+		AssertEqual(t, http.StatusOK, w.Code, "Creating a post should succeed")
+
+		var response server.CreatePostResponse
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to unmarshal response")
+		return response.PostID
+	}
+
+	postID := createPost("Breaking News")
+
+	announcement := ReadHubMessage(t, readerConn, chat.MessageTypeNewPost, 2*time.Second)
+	summary, ok := announcement.Content.(map[string]interface{})
+	AssertTrue(t, ok, "Announcement should carry a post summary")
+	AssertEqual(t, float64(postID), summary["id"], "Summary should identify the post")
+	AssertEqual(t, "Breaking News", summary["title"], "Summary should carry the title")
+	AssertEqual(t, float64(author), summary["author_id"], "Summary should identify the author")
+	AssertEqual(t, "johndoe", summary["author"], "Summary should name the author")
+
+	AssertEqual(t, 0, len(CollectHubMessages(authorConn, chat.MessageTypeNewPost, 300*time.Millisecond)),
+		"The author should not be told about their own post")
+
+	t.Run("RateCapped", func(t *testing.T) {
+		createPost("Second Story")
+		AssertEqual(t, 0, len(CollectHubMessages(readerConn, chat.MessageTypeNewPost, 300*time.Millisecond)),
+			"Announcements beyond the cap should be dropped")
+	})
+}
+
+func TestUnknownMessageTypeDropped(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+
+	hub := NewHubTestServer(t, db)
+	conn := hub.Connect(t, userIDs[0])
+
+	send := func(raw string) {
+		AssertNoError(t, conn.WriteMessage(gorillaws.TextMessage, []byte(raw)), "Failed to write message")
+	}
+	// readUntil returns the first message of messageType and every message read before it
+	readUntil := func(messageType string) (chat.Message, []chat.Message) {
+		var skipped []chat.Message
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		defer conn.SetReadDeadline(time.Time{})
+		for {
+			var msg chat.Message
+			AssertNoError(t, conn.ReadJSON(&msg), "Did not receive "+messageType)
+			if msg.Type == messageType {
+				return msg, skipped
+			}
+			skipped = append(skipped, msg)
+		}
+	}
+
+	send(`{"type":"teleport","content":"beam me up"}`)
+	send(`{"type":"ping"}`)
+
+	pong, skipped := readUntil("pong")
+	for _, msg := range skipped {
+		AssertTrue(t, msg.Type != "error", "An unknown type should be dropped without an error reply")
+	}
+	AssertEqual(t, chat.ProtocolVersion, pong.Version, "Outgoing messages should carry the protocol version")
+	AssertEqual(t, uint64(1), hub.Manager.GetStats()["messagesDropped"], "The dropped message should be counted")
+
+	send(`{"v":99,"type":"ping"}`)
+	refused, _ := readUntil("error")
+	AssertEqual(t, "UNSUPPORTED_VERSION", refused.Code, "An unsupported version should be refused")
+
+	send(`{"v":1,"type":"ping"}`)
+	readUntil("pong")
+	AssertTrue(t, hub.Manager.IsUserOnline(userIDs[0]), "The user should still be connected")
+}
+
+func TestHiddenUserNotShownOnline(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	observer, hidden, visible := userIDs[0], userIDs[1], userIDs[2]
+
+	privacy := database.DefaultPrivacy()
+	privacy.ShowOnline = false
+	AssertNoError(t, database.SetUserPrivacy(db, hidden, privacy), "Failed to hide online status")
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+
+	observerConn := hub.Connect(t, observer)
+	hub.Connect(t, hidden)
+	hub.Connect(t, visible)
+
+	t.Run("NoStatusBroadcast", func(t *testing.T) {
+		seen := map[int]bool{}
+		for _, message := range CollectHubMessages(observerConn, chat.MessageTypeUserStatus, 500*time.Millisecond) {
+			seen[message.UserID] = true
+		}
+		AssertTrue(t, seen[visible], "Visible users should be announced")
+		AssertFalse(t, seen[hidden], "Hidden users should not be announced")
+	})
+
+	t.Run("NotInOnlineList", func(t *testing.T) {
+		conn := hub.Connect(t, observer)
+		AssertNoError(t, conn.WriteJSON(chat.Message{Type: "get_online_users"}), "Failed to request online users")
+		message := ReadHubMessage(t, conn, chat.MessageTypeOnlineUsers, 2*time.Second)
+
+		var payload struct {
+			Users   []int             `json:"users"`
+			Details []chat.OnlineUser `json:"details"`
+		}
+		raw, _ := json.Marshal(message.Content)
+		AssertNoError(t, json.Unmarshal(raw, &payload), "Failed to decode online users payload")
+		for _, id := range payload.Users {
+			AssertTrue(t, id != hidden, "Hidden user should not be in the id list")
+		}
+		for _, user := range payload.Details {
+			AssertTrue(t, user.ID != hidden, "Hidden user should not be in the details")
+		}
+		AssertEqual(t, 2, len(payload.Users), "Observer and visible user should be listed")
+		AssertTrue(t, hub.Manager.IsUserOnline(hidden), "Hidden user is still connected")
+	})
+
+	t.Run("NotInOnlineEndpoint", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.GetOnlineUsersAPI(w, httptest.NewRequest("GET", "/api/users/online", nil))
+
+		var response struct {
+			Users []chat.OnlineUser `json:"users"`
+		}
+		AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response), "Failed to decode endpoint response")
+		for _, user := range response.Users {
+			AssertTrue(t, user.ID != hidden, "Hidden user should not be listed by the endpoint")
+		}
+	})
+}
+
+func TestHubNewConversationReusesExistingPair(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	sender, recipient := userIDs[0], userIDs[1]
+
+	existingID, err := database.CreateConversation(db, []int{sender, recipient})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	senderConn := hub.Connect(t, sender)
+	recipientConn := hub.Connect(t, recipient)
+
+	err = senderConn.WriteJSON(map[string]interface{}{
+		"type":                "private",
+		"recipient_id":        recipient,
+		"is_new_conversation": true,
+		"content":             "Hello again",
+	})
+	AssertNoError(t, err, "Failed to send message")
+
+	message := ReadHubMessage(t, recipientConn, chat.MessageTypePrivate, 2*time.Second)
+	AssertEqual(t, existingID, message.ConversationID, "The message should land in the existing conversation")
+
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM conversation_participants WHERE user_id = ?", sender).Scan(&count)
+	AssertNoError(t, err, "Failed to count conversations")
+	AssertEqual(t, 1, count, "No duplicate conversation should be created")
+}
+
+func TestConversationOnlineCount(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	viewer, online, offline := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{viewer, online, offline})
+	AssertNoError(t, err, "Failed to create group conversation")
+
+	hub := NewHubTestServer(t, db)
+	server.SetWebSocketManager(hub.Manager)
+	t.Cleanup(func() { server.SetWebSocketManager(nil) })
+
+	hub.Connect(t, viewer)
+	hub.Connect(t, online)
+	// A connected user outside the conversation does not count
+	hub.Connect(t, userIDs[3])
+
+	AssertEqual(t, 2, hub.Manager.GetConversationOnlineCount(conversationID), "Two of the three participants are connected")
+
+	req := httptest.NewRequest("GET", "/api/conversations/"+strconv.Itoa(conversationID), nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, viewer)})
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+	w := httptest.NewRecorder()
+	server.GetConversationAPI(w, req)
+	AssertEqual(t, http.StatusOK, w.Code, "Participant should get the conversation details")
+
+	var conversation database.Conversation
+	AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &conversation), "Failed to decode conversation")
+	AssertEqual(t, conversationID, conversation.ID, "Details should be for the requested conversation")
+	AssertEqual(t, 3, len(conversation.Participants), "Details should list every participant")
+	AssertEqual(t, 2, conversation.OnlineCount, "Details should carry the online count")
+
+	req = httptest.NewRequest("GET", "/api/conversations/"+strconv.Itoa(conversationID), nil)
+	req.AddCookie(&http.Cookie{Name: "session_token", Value: CreateAppSession(t, db, userIDs[3])})
+	req = mux.SetURLVars(req, map[string]string{"id": strconv.Itoa(conversationID)})
+	w = httptest.NewRecorder()
+	server.GetConversationAPI(w, req)
+	AssertEqual(t, http.StatusNotFound, w.Code, "Outsiders should not see the conversation")
+}
+
+func TestBroadcastBackpressureStats(t *testing.T) {
+	config := chat.DefaultHubConfig()
+	config.BroadcastBufferSize = 2
+	// The hub is not running, so nothing drains the broadcast channel
+	hub := chat.NewHubWithConfig(config)
+
+	stats := hub.GetStats()
+	AssertEqual(t, 2, stats["broadcastCapacity"], "The broadcast buffer should use the configured size")
+	AssertEqual(t, 0, stats["broadcastQueued"], "Nothing should be queued yet")
+
+	for i := 0; i < 3; i++ {
+		hub.BroadcastToAll(chat.Message{Type: chat.MessageTypeNewPost, Content: fmt.Sprintf("post %d", i)})
+	}
+
+	stats = hub.GetStats()
+	AssertEqual(t, 2, stats["broadcastQueued"], "The buffer should be full")
+	AssertEqual(t, uint64(1), stats["broadcastDropped"], "The broadcast past capacity should be counted as dropped")
+}
+
+func TestTypingIgnoresNonParticipants(t *testing.T) {
+	db := AppTestSetup(t)
+
+	userIDs, err := SetupTestUsers(db)
+	AssertNoError(t, err, "Failed to setup test users")
+	typist, reader, outsider := userIDs[0], userIDs[1], userIDs[2]
+
+	conversationID, err := CreateTestConversation(db, []int{typist, reader})
+	AssertNoError(t, err, "Failed to create conversation")
+
+	hub := NewHubTestServer(t, db)
+	hub.Manager.SetTypingTTL(200 * time.Millisecond)
+	readerConn := hub.Connect(t, reader)
+
+	// An outsider claiming the conversation is neither recorded nor forwarded
+	outsiderConn := hub.Connect(t, outsider)
+	err = outsiderConn.WriteJSON(chat.Message{
+		Type:           chat.MessageTypeTyping,
+		RecipientID:    reader,
+		ConversationID: conversationID,
+		Action:         chat.TypingActionStart,
+	})
+	AssertNoError(t, err, "Failed to send typing start")
+
+	typistConn := hub.Connect(t, typist)
+	err = typistConn.WriteJSON(chat.Message{
+		Type:           chat.MessageTypeTyping,
+		RecipientID:    reader,
+		ConversationID: conversationID,
+		Action:         chat.TypingActionStart,
+	})
+	AssertNoError(t, err, "Failed to send typing start")
+
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if len(hub.Manager.TypingUsers(conversationID)) > 0 {
+			break
+		}
+	}
+	typing := hub.Manager.TypingUsers(conversationID)
+	AssertEqual(t, 1, len(typing), "Only the participant should be recorded as typing")
+	AssertEqual(t, typist, typing[0], "Recorded user should be the participant")
+
+	msg := ReadHubMessage(t, readerConn, chat.MessageTypeTyping, 2*time.Second)
+	AssertEqual(t, typist, msg.UserID, "Forwarded typing event should come from the participant")
+
+	// Expired entries go away without anyone polling the conversation
+	time.Sleep(300 * time.Millisecond)
+	AssertEqual(t, 1, hub.Manager.PruneTyping(), "Sweep should drop the expired entry")
+	AssertEqual(t, 0, hub.Manager.GetStats()["typingConversations"], "Registry should be empty after the sweep")
+}
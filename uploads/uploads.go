@@ -0,0 +1,134 @@
+package uploads
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// URLPrefix is the public URL path uploaded files are served under
+const URLPrefix = "/static/uploads/"
+
+// DefaultBaseDir is where uploads are stored unless SetBaseDir says otherwise
+const DefaultBaseDir = "./src/static/uploads"
+
+// maxNameLength caps the sanitized part of a stored filename
+const maxNameLength = 64
+
+// ErrInvalidCategory is returned when a category is empty or could leave the base directory
+var ErrInvalidCategory = errors.New("invalid upload category")
+
+// categoryPattern limits categories to a single lowercase directory name
+var categoryPattern = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// unsafeNameChars matches everything a sanitized filename may not contain
+var unsafeNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// baseDir is the directory every category is stored beneath
+var baseDir = DefaultBaseDir
+
+// SetBaseDir changes the directory uploads are written to. An empty dir restores
+// DefaultBaseDir. Call before serving.
+func SetBaseDir(dir string) {
+	if dir == "" {
+		dir = DefaultBaseDir
+	}
+	baseDir = dir
+}
+
+// BaseDir returns the directory uploads are written to
+func BaseDir() string {
+	return baseDir
+}
+
+// Save writes data to a new file in the category's directory and returns its
+// public URL. The client-supplied filename is reduced to a safe base name and
+// given a random prefix, so it can neither escape the directory nor overwrite
+// another upload.
+func Save(category, filename string, data io.Reader) (string, error) {
+	if !categoryPattern.MatchString(category) {
+		return "", ErrInvalidCategory
+	}
+
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", err
+	}
+	name := hex.EncodeToString(prefix) + "-" + SanitizeFilename(filename)
+
+	dir := filepath.Join(baseDir, category)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	dst, err := os.OpenFile(filepath.Join(dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, data); err != nil {
+		dst.Close()
+		os.Remove(dst.Name())
+		return "", err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(dst.Name())
+		return "", err
+	}
+	return URLPrefix + category + "/" + name, nil
+}
+
+// SanitizeFilename keeps only the final path element of filename and replaces
+// anything other than letters, digits, dots, dashes and underscores. Leading
+// dots are dropped so the result is never hidden or a relative directory.
+func SanitizeFilename(filename string) string {
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	if i := strings.LastIndex(filename, "/"); i >= 0 {
+		filename = filename[i+1:]
+	}
+
+	name := strings.TrimLeft(unsafeNameChars.ReplaceAllString(filename, "_"), ".")
+	if len(name) > maxNameLength {
+		ext := filepath.Ext(name)
+		if len(ext) > 10 {
+			ext = ""
+		}
+		name = name[:maxNameLength-len(ext)] + ext
+	}
+	if name == "" || strings.Trim(name, "_") == "" {
+		return "file"
+	}
+	return name
+}
+
+// Path maps a public upload URL back to its file on disk. It reports false for
+// URLs outside URLPrefix or ones that would resolve outside the base directory.
+func Path(url string) (string, bool) {
+	if !strings.HasPrefix(url, URLPrefix) {
+		return "", false
+	}
+
+	// Clean against a rooted path so nothing can climb above the base directory
+	rel := filepath.Clean("/" + strings.TrimPrefix(url, URLPrefix))
+	if rel == "/" {
+		return "", false
+	}
+	return filepath.Join(baseDir, rel), true
+}
+
+// Remove deletes the file behind a public upload URL. URLs outside the uploads
+// directory and files that are already gone are ignored.
+func Remove(url string) error {
+	path, ok := Path(url)
+	if !ok {
+		return nil
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package version
+
+import "runtime"
+
+// Version and Commit identify the build. Release builds set them with
+// -ldflags "-X connecthub/version.Version=v1.2.0 -X connecthub/version.Commit=$(git rev-parse --short HEAD)";
+// a plain go build or go run reports "dev".
+var (
+	Version = "dev"
+	Commit  = "dev"
+)
+
+// Info describes the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the build info of the running binary
+func Get() Info {
+	return Info{Version: Version, Commit: Commit, GoVersion: runtime.Version()}
+}
@@ -5,8 +5,14 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
+
+	"connecthub/database"
 
 	"github.com/gorilla/websocket"
 )
@@ -30,6 +36,11 @@ type Client struct {
 	// Closed flag to prevent duplicate closes
 	closed   bool
 	closeMux sync.Mutex
+
+	// sendClosed is set once the hub has closed send; sendMux guards it so
+	// goroutines other than the hub never send on a closed channel
+	sendClosed bool
+	sendMux    sync.Mutex
 }
 
 func NewClient(hub *Hub, conn *websocket.Conn, userID int) *Client {
@@ -80,6 +91,10 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
+		if !c.acceptEnvelope(&msg) {
+			continue
+		}
+
 		// Validate message
 		if err := c.validateMessage(&msg); err != nil {
 			c.hub.logger.Error("Invalid message: %v", err)
@@ -90,15 +105,61 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
+		if msg.Type == MessageTypePrivate {
+			if ok, retryAfter := c.hub.limiter.Allow(strconv.Itoa(c.UserID)); !ok {
+				c.hub.logger.Error("Rate limit exceeded for user %d", c.UserID)
+				c.send <- Message{
+					Type:    "error",
+					Content: fmt.Sprintf("Too many messages. Please wait %d seconds and try again.", int(math.Ceil(retryAfter.Seconds()))),
+					Code:    "RATE_LIMITED",
+				}
+				continue
+			}
+		}
+
 		msg.UserID = c.UserID
 		msg.Timestamp = time.Now()
 
+		// Catch-up requests are answered directly and never broadcast
+		if msg.Type == MessageTypeSync {
+			c.hub.syncConversation(c, msg)
+			continue
+		}
+
 		c.hub.logger.Debug("Received message from user %d of type %s", c.UserID, msg.Type)
 		c.hub.broadcast <- msg
 	}
 }
 
 // close safely closes the client connection
+// trySend queues message without blocking, for goroutines other than the hub.
+// It reports false when the buffer is full or the hub has closed send.
+func (c *Client) trySend(message Message) bool {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes the outbound channel. Only the hub calls it.
+func (c *Client) closeSend() {
+	c.sendMux.Lock()
+	defer c.sendMux.Unlock()
+
+	if !c.sendClosed {
+		close(c.send)
+		c.sendClosed = true
+	}
+}
+
 func (c *Client) close() {
 	c.closeMux.Lock()
 	defer c.closeMux.Unlock()
@@ -111,6 +172,51 @@ func (c *Client) close() {
 	}
 }
 
+// inboundTypes lists, per envelope version, the message types a client may send
+var inboundTypes = map[int]map[string]bool{
+	1: {
+		MessageTypePrivate:      true,
+		MessageTypeBroadcast:    true,
+		MessageTypeUserStatus:   true,
+		MessageTypeNotification: true,
+		MessageTypeOnlineUsers:  true,
+		MessageTypeTyping:       true,
+		MessageTypeSync:         true,
+		"get_online_users":      true,
+		"ping":                  true,
+	},
+}
+
+// acceptEnvelope checks an inbound message's version and type before it is
+// validated. A version the server does not speak is refused with an error; a
+// type the version does not define is logged and dropped, so newer clients
+// cannot trip up the hub. Reports whether the message should be processed.
+func (c *Client) acceptEnvelope(msg *Message) bool {
+	if msg.Version == 0 {
+		// Clients predating versioning speak the first version
+		msg.Version = ProtocolVersion
+	}
+
+	types, ok := inboundTypes[msg.Version]
+	if !ok {
+		c.hub.logger.Info("Dropped message from user %d with unsupported protocol version %d", c.UserID, msg.Version)
+		atomic.AddUint64(&c.hub.stats.dropped, 1)
+		c.send <- Message{
+			Type:    "error",
+			Content: fmt.Sprintf("Unsupported protocol version %d", msg.Version),
+			Code:    "UNSUPPORTED_VERSION",
+		}
+		return false
+	}
+
+	if !types[msg.Type] {
+		c.hub.logger.Info("Dropped message of unknown type %q from user %d", msg.Type, c.UserID)
+		atomic.AddUint64(&c.hub.stats.dropped, 1)
+		return false
+	}
+	return true
+}
+
 // validateMessage checks if a message is valid based on its type
 func (c *Client) validateMessage(msg *Message) error {
 	if msg == nil {
@@ -119,15 +225,23 @@ func (c *Client) validateMessage(msg *Message) error {
 
 	switch msg.Type {
 	case MessageTypePrivate:
-		if msg.RecipientID <= 0 {
+		// Messages in an existing conversation go to all of its participants, so only new
+		// conversations need an explicit recipient
+		if msg.IsNewConversation && msg.RecipientID <= 0 {
 			return fmt.Errorf("private message requires valid recipient ID, got %d", msg.RecipientID)
 		}
-		if msg.Content == nil || msg.Content == "" {
+		if msg.IsNewConversation && msg.RecipientID == c.UserID {
+			return errors.New("cannot start a conversation with yourself")
+		}
+		// A message may consist of attachments alone
+		if msg.Content == nil || (msg.Content == "" && len(msg.Attachments) == 0) {
 			return errors.New("message content cannot be empty")
 		}
-		// Check if recipient is online
-		if !c.hub.IsUserOnline(msg.RecipientID) {
-			return errors.New("cannot send message: recipient is offline")
+		if content, ok := msg.Content.(string); ok && utf8.RuneCountInString(content) > c.hub.config.MaxMessageLength {
+			return fmt.Errorf("message is too long (max %d characters)", c.hub.config.MaxMessageLength)
+		}
+		if len(msg.Attachments) > database.MaxMessageAttachments {
+			return fmt.Errorf("a message can carry at most %d attachments", database.MaxMessageAttachments)
 		}
 
 		// For new conversations, check if both users are online
@@ -153,15 +267,7 @@ func (c *Client) validateMessage(msg *Message) error {
 		}
 	case "get_online_users":
 		// Handle get_online_users request without broadcasting
-		onlineUsers := c.hub.GetOnlineUsers()
-		c.send <- Message{
-			Type: MessageTypeOnlineUsers,
-			Content: map[string]interface{}{
-				"users": onlineUsers,
-			},
-			Timestamp: time.Now(),
-			UserID:    c.UserID,
-		}
+		c.send <- c.hub.onlineUsersMessage(c.UserID)
 		// Return nil to silently handle request without error
 		return nil
 	case "ping":
@@ -174,6 +280,13 @@ func (c *Client) validateMessage(msg *Message) error {
 		}
 		// Return nil to silently handle ping without error
 		return nil
+	case MessageTypeSync:
+		if msg.ConversationID <= 0 {
+			return errors.New("sync requires a conversation ID")
+		}
+		if msg.LastSeenMessageID < 0 {
+			return fmt.Errorf("sync requires a non-negative last_seen_message_id, got %d", msg.LastSeenMessageID)
+		}
 	case MessageTypeOnlineUsers:
 		return errors.New("online_users updates are handled automatically")
 	case MessageTypeTyping:
@@ -184,10 +297,6 @@ func (c *Client) validateMessage(msg *Message) error {
 		if msg.Action != TypingActionStart && msg.Action != TypingActionStop {
 			return fmt.Errorf("typing indicator requires valid action (start/stop), got %s", msg.Action)
 		}
-		// Check if recipient is online
-		if !c.hub.IsUserOnline(msg.RecipientID) {
-			return errors.New("cannot send typing indicator: recipient is offline")
-		}
 	default:
 		return fmt.Errorf("unknown message type: %s", msg.Type)
 	}
@@ -211,6 +320,10 @@ func (c *Client) WritePump() {
 				return
 			}
 
+			if message.Version == 0 {
+				message.Version = ProtocolVersion
+			}
+
 			// Send each message individually instead of batching
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
 			messageBytes, err := json.Marshal(message)
@@ -4,42 +4,97 @@ import (
 	"database/sql"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/websocket"
-)
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  readBufferSize,
-	WriteBufferSize: writeBufferSize,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: In production, implement proper origin checking
-		return true
-	},
-}
+	"connecthub/origin"
+	"connecthub/ratelimit"
+)
 
 type Manager struct {
-	hub    *Hub
-	logger *Logger
+	hub      *Hub
+	logger   *Logger
+	upgrader websocket.Upgrader
+	origins  *origin.Policy
 }
 
 func NewManager() *Manager {
-	hub := NewHub()
+	return NewManagerWithDebug(false)
+}
+
+func NewManagerWithDebug(debug bool) *Manager {
+	config := DefaultHubConfig()
+	config.Debug = debug
+	return NewManagerWithConfig(config)
+}
+
+// NewManagerWithConfig starts a hub with the given settings, for tuning the
+// channel buffer sizes that cannot be changed once the hub is running
+func NewManagerWithConfig(config HubConfig) *Manager {
+	hub := NewHubWithConfig(config)
 	go hub.Run()
 
-	return &Manager{
-		hub:    hub,
-		logger: NewLogger(false),
+	m := &Manager{
+		hub:     hub,
+		logger:  NewLogger(config.Debug),
+		origins: origin.NewPolicy(nil),
 	}
+	m.upgrader = websocket.Upgrader{
+		ReadBufferSize:  readBufferSize,
+		WriteBufferSize: writeBufferSize,
+		CheckOrigin:     m.checkOrigin,
+	}
+	return m
 }
 
-func NewManagerWithDebug(debug bool) *Manager {
-	hub := NewHubWithLogging(debug)
-	go hub.Run()
+// SetAllowedOrigins replaces the origins allowed to open connections.
+// Same-origin connections are always accepted. Call before serving.
+func (m *Manager) SetAllowedOrigins(origins []string) {
+	m.origins = origin.NewPolicy(origins)
+}
+
+// SetMaxMessageLength caps the number of characters in a private message.
+// Call before serving.
+func (m *Manager) SetMaxMessageLength(n int) {
+	m.hub.config.MaxMessageLength = n
+}
+
+// SetMessageRate caps how many private messages each user may send per rate
+// limit period. Call before serving.
+func (m *Manager) SetMessageRate(n int) {
+	m.hub.config.MessageRate = n
+	m.hub.limiter = ratelimit.New(n, m.hub.config.RateLimitPeriod)
+}
+
+// SetMaxConnectionsPerUser caps how many connections one user may hold open
+// at once. Call before serving.
+func (m *Manager) SetMaxConnectionsPerUser(n int) {
+	m.hub.config.MaxConnectionsPerUser = n
+}
+
+// SetTypingTTL sets how long a typing indicator stays active without a refresh
+// or stop. Call before serving.
+func (m *Manager) SetTypingTTL(ttl time.Duration) {
+	m.hub.config.TypingTTL = ttl
+}
 
-	return &Manager{
-		hub:    hub,
-		logger: NewLogger(debug),
+// SetNewPostRate caps how many new_post announcements go out per rate limit
+// period across all authors. Call before serving.
+func (m *Manager) SetNewPostRate(n int) {
+	m.hub.config.NewPostRate = n
+	m.hub.postLimiter = ratelimit.New(n, m.hub.config.RateLimitPeriod)
+}
+
+// checkOrigin accepts upgrades only from trusted origins. The handshake always
+// carries the session cookie, so the wildcard does not extend to WebSockets.
+func (m *Manager) checkOrigin(r *http.Request) bool {
+	requestOrigin := r.Header.Get("Origin")
+	if requestOrigin == "" || m.origins.Trusts(requestOrigin, r.Host) {
+		return true
 	}
+	m.logger.Error("Rejected WebSocket upgrade from origin %s at %s", requestOrigin, r.RemoteAddr)
+	return false
 }
 
 func (m *Manager) HandleConnection(w http.ResponseWriter, r *http.Request) {
@@ -66,7 +121,7 @@ func (m *Manager) HandleConnection(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Upgrade connection to WebSocket
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := m.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		m.logger.Error("Error upgrading connection for user %d: %v", userID, err)
 		return
@@ -131,6 +186,51 @@ func (m *Manager) GetOnlineUsers() []int {
 	return m.hub.GetOnlineUsers()
 }
 
+// GetOnlineUsersDetailed returns the connected users with their profile details
+func (m *Manager) GetOnlineUsersDetailed() ([]OnlineUser, error) {
+	return m.hub.GetOnlineUsersDetailed()
+}
+
+// ConnectionCount returns how many connections userID currently has open
+func (m *Manager) ConnectionCount(userID int) int {
+	return m.hub.ConnectionCount(userID)
+}
+
+// AnnounceNewPost tells connected clients other than the author about a new post
+func (m *Manager) AnnounceNewPost(post PostSummary) bool {
+	return m.hub.AnnounceNewPost(post)
+}
+
+// AnnounceConversationLeft tells the remaining participants that userID left
+func (m *Manager) AnnounceConversationLeft(conversationID, userID int, remaining []int) {
+	m.hub.AnnounceConversationLeft(conversationID, userID, remaining)
+}
+
+// AnnounceConversationDeleted tells former participants a conversation is gone
+func (m *Manager) AnnounceConversationDeleted(conversationID, deletedBy int, participants []int) {
+	m.hub.AnnounceConversationDeleted(conversationID, deletedBy, participants)
+}
+
+// DisconnectUser closes every connection a user has open
+func (m *Manager) DisconnectUser(userID int) int {
+	return m.hub.DisconnectUser(userID)
+}
+
+// GetConversationOnlineCount returns how many participants of a conversation are online
+func (m *Manager) GetConversationOnlineCount(conversationID int) int {
+	return m.hub.GetConversationOnlineCount(conversationID)
+}
+
+// PruneTyping drops expired typing entries and returns how many it removed
+func (m *Manager) PruneTyping() int {
+	return m.hub.PruneTyping()
+}
+
+// TypingUsers returns the users currently typing in a conversation
+func (m *Manager) TypingUsers(conversationID int) []int {
+	return m.hub.TypingUsers(conversationID)
+}
+
 func (m *Manager) SetDebugMode(debug bool) {
 	m.logger.debug = debug
 	m.hub.SetDebugMode(debug)
@@ -0,0 +1,100 @@
+package websocket
+
+import (
+	"time"
+
+	"connecthub/database"
+)
+
+// AnnounceConversationLeft tells the remaining participants that userID left
+// the conversation, so open chat windows can say who went
+func (h *Hub) AnnounceConversationLeft(conversationID, userID int, remaining []int) {
+	name := h.displayName(userID)
+	message := Message{
+		Type:           MessageTypeConversationLeft,
+		UserID:         userID,
+		ConversationID: conversationID,
+		Timestamp:      time.Now(),
+		Content: map[string]interface{}{
+			"conversation_id": conversationID,
+			"user_id":         userID,
+			"user_name":       name,
+			"message":         name + " left the conversation",
+		},
+	}
+
+	for _, participantID := range remaining {
+		if participantID != userID {
+			h.SendToUser(participantID, message)
+		}
+	}
+	h.logger.Info("Conversation left event for user %d in conversation %d sent to %d participants", userID, conversationID, len(remaining))
+}
+
+// AnnounceConversationDeleted tells the conversation's former participants,
+// other than the one who deleted it, that it is gone so open windows can close
+func (h *Hub) AnnounceConversationDeleted(conversationID, deletedBy int, participants []int) {
+	message := Message{
+		Type:           MessageTypeConversationDeleted,
+		UserID:         deletedBy,
+		ConversationID: conversationID,
+		Timestamp:      time.Now(),
+		Content: map[string]interface{}{
+			"conversation_id": conversationID,
+			"deleted_by":      deletedBy,
+		},
+	}
+
+	for _, participantID := range participants {
+		if participantID != deletedBy {
+			h.SendToUser(participantID, message)
+		}
+	}
+	h.logger.Info("Conversation deleted event for conversation %d sent to %d participants", conversationID, len(participants))
+}
+
+// displayName is the name shown for userID in events, or "Someone" when it
+// cannot be looked up
+func (h *Hub) displayName(userID int) string {
+	if db == nil {
+		return "Someone"
+	}
+	name, err := database.GetDisplayName(db, userID)
+	if err != nil {
+		h.logger.Error("Failed to get display name for user %d: %v", userID, err)
+		return "Someone"
+	}
+	return name
+}
+
+// GetConversationOnlineCount returns how many of a conversation's participants
+// currently hold a connection, leaving out those who hide their online status
+func (h *Hub) GetConversationOnlineCount(conversationID int) int {
+	if db == nil {
+		return 0
+	}
+	participants, err := database.GetConversationParticipants(db, conversationID)
+	if err != nil {
+		h.logger.Error("Failed to load participants for conversation %d: %v", conversationID, err)
+		return 0
+	}
+
+	h.mu.RLock()
+	online := make([]int, 0, len(participants))
+	for _, participantID := range participants {
+		if len(h.userConnections[participantID]) > 0 {
+			online = append(online, participantID)
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(online) == 0 {
+		return 0
+	}
+	hidden, err := database.HiddenPresenceUsers(db, online)
+	if err != nil {
+		h.logger.Error("Failed to load presence settings for conversation %d: %v", conversationID, err)
+		return 0
+	}
+	return len(online) - len(hidden)
+}
@@ -0,0 +1,51 @@
+package websocket
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// newPostLimitKey is the single bucket all new_post announcements share, since
+// the cap protects every connected client rather than limiting one author
+const newPostLimitKey = "new_post"
+
+// PostSummary is the lightweight description of a post carried by new_post
+// events; clients fetch the full post when the reader opens it
+type PostSummary struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Slug       string    `json:"slug,omitempty"`
+	AuthorID   int       `json:"author_id"`
+	Author     string    `json:"author"`
+	Categories []string  `json:"categories"`
+	PostedAt   time.Time `json:"posted_at"`
+}
+
+// AnnounceNewPost tells every connected client except the author that a post
+// was published. Beyond NewPostRate announcements per RateLimitPeriod the rest
+// are dropped; readers still pick those posts up from /api/posts?since=. Reports
+// whether the announcement was queued.
+func (h *Hub) AnnounceNewPost(post PostSummary) bool {
+	if allowed, _ := h.postLimiter.Allow(newPostLimitKey); !allowed {
+		h.logger.Debug("New post announcement for post %d skipped, broadcast cap reached", post.ID)
+		return false
+	}
+
+	message := Message{
+		Type:      MessageTypeNewPost,
+		UserID:    post.AuthorID,
+		Content:   post,
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case h.broadcast <- message:
+		h.logger.Debug("New post announcement queued for post %d", post.ID)
+		return true
+	default:
+		h.logger.Error("Broadcast channel full, new post announcement for post %d dropped", post.ID)
+		atomic.AddUint64(&h.stats.errors, 1)
+		atomic.AddUint64(&h.stats.broadcastDropped, 1)
+		return false
+	}
+}
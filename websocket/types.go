@@ -1,6 +1,10 @@
 package websocket
 
-import "time"
+import (
+	"time"
+
+	"connecthub/database"
+)
 
 // Buffer sizes
 const (
@@ -8,6 +12,7 @@ const (
 	writeBufferSize   = 1024
 	maxMessageSize    = 512 * 1024 // 512KB max message size
 	messageBufferSize = 256        // Size of message buffer per client
+	maxSyncMessages   = 200        // Messages replayed per sync request; stays below messageBufferSize
 )
 
 // Timeouts
@@ -31,9 +36,21 @@ const (
 	MessageTypeOnlineUsers     = "online_users"
 	MessageTypeTyping          = "typing"
 	MessageTypeNewConversation = "new_conversation"
-	MessageTypeReadStatus      = "read_status" // CRITICAL FIX: Add read status message type
+	MessageTypeReadStatus      = "read_status"      // CRITICAL FIX: Add read status message type
+	MessageTypeSync            = "sync"             // Client asks for messages it missed while disconnected
+	MessageTypeSyncComplete    = "sync_complete"    // Sent after the missed messages have been replayed
+	MessageTypeDeliveryReceipt = "delivery_receipt" // Tells the sender a message reached a recipient
+	MessageTypeNewPost         = "new_post"         // Announces a freshly published post to feed readers
+
+	MessageTypeConversationLeft    = "conversation_left"    // A participant left a conversation
+	MessageTypeConversationDeleted = "conversation_deleted" // A conversation was deleted for everyone
 )
 
+// ProtocolVersion is the message envelope version this server speaks. Every
+// outgoing message carries it as "v"; inbound messages without one are treated
+// as this version.
+const ProtocolVersion = 1
+
 // Typing action types
 const (
 	TypingActionStart = "start"
@@ -42,13 +59,28 @@ const (
 
 // Hub configuration defaults
 const (
-	DefaultMaxClients      = 10000
-	DefaultRateLimitPeriod = time.Minute
-	DefaultMessageRate     = 100 // messages per rate limit period
+	DefaultMaxClients            = 10000
+	DefaultRateLimitPeriod       = time.Minute
+	DefaultMessageRate           = 100             // messages per rate limit period
+	DefaultMaxMessageLength      = 4000            // characters per chat message
+	DefaultMaxConnectionsPerUser = 3               // open tabs or devices per user
+	DefaultTypingTTL             = 5 * time.Second // matches the client's typing indicator timeout
+	DefaultNewPostRate           = 30              // new_post announcements per rate limit period, across all authors
+	DefaultBroadcastBufferSize   = messageBufferSize
+	DefaultRegisterBufferSize    = 8
 )
 
+// OnlineUser is a connected user as listed in online_users payloads
+type OnlineUser struct {
+	ID          int    `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	Avatar      string `json:"avatar"`
+}
+
 // Message represents a message in the chat system
 type Message struct {
+	Version           int         `json:"v,omitempty"` // Envelope version, see ProtocolVersion
 	Type              string      `json:"type"`
 	From              int         `json:"from"`
 	To                int         `json:"to,omitempty"`
@@ -68,9 +100,20 @@ type Message struct {
 	SenderName string    `json:"sender_name,omitempty"` // Sender username
 	SentAt     time.Time `json:"sent_at,omitempty"`     // When the message was sent
 	IsRead     bool      `json:"is_read,omitempty"`     // Whether the message has been read
+	// Optional client-generated UUID; a resent message with the same ID is not stored twice
+	ClientMsgID string `json:"client_msg_id,omitempty"`
+	// Files previously uploaded through /api/messages/upload, referenced by URL
+	Attachments []database.Attachment `json:"attachments,omitempty"`
+	// Optional id of an earlier message in the conversation being replied to;
+	// the broadcast carries a preview of it in ReplyTo
+	ReplyToID int                      `json:"reply_to_message_id,omitempty"`
+	ReplyTo   *database.MessagePreview `json:"reply_to,omitempty"`
 
 	// Typing indicator fields
 	Action string `json:"action,omitempty"` // For typing messages: "start" or "stop"
+
+	// Sync fields: the newest message the client already has in ConversationID
+	LastSeenMessageID int `json:"last_seen_message_id,omitempty"`
 }
 
 // HubConfig contains configuration options for the Hub
@@ -78,5 +121,32 @@ type HubConfig struct {
 	MaxClients      int
 	RateLimitPeriod time.Duration
 	MessageRate     int
-	Debug           bool
+	// MaxMessageLength caps private message content, counted in characters
+	MaxMessageLength int
+	// MaxConnectionsPerUser caps simultaneous connections for one user; the oldest is closed when exceeded
+	MaxConnectionsPerUser int
+	// TypingTTL is how long a typing start stays active without a refresh or stop
+	TypingTTL time.Duration
+	// NewPostRate caps new_post announcements per RateLimitPeriod so a burst of posts cannot flood every client
+	NewPostRate int
+	// BroadcastBufferSize is how many broadcasts may queue before further ones are dropped
+	BroadcastBufferSize int
+	// RegisterBufferSize is how many connects and disconnects may queue for the hub
+	RegisterBufferSize int
+	Debug              bool
+}
+
+// DefaultHubConfig returns the settings NewHub uses
+func DefaultHubConfig() HubConfig {
+	return HubConfig{
+		MaxClients:            DefaultMaxClients,
+		RateLimitPeriod:       DefaultRateLimitPeriod,
+		MessageRate:           DefaultMessageRate,
+		MaxMessageLength:      DefaultMaxMessageLength,
+		MaxConnectionsPerUser: DefaultMaxConnectionsPerUser,
+		TypingTTL:             DefaultTypingTTL,
+		NewPostRate:           DefaultNewPostRate,
+		BroadcastBufferSize:   DefaultBroadcastBufferSize,
+		RegisterBufferSize:    DefaultRegisterBufferSize,
+	}
 }
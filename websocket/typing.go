@@ -0,0 +1,102 @@
+package websocket
+
+import (
+	"sort"
+	"time"
+
+	"connecthub/database"
+)
+
+// typingSweepInterval is how often Run drops expired typing entries, so
+// conversations nobody polls do not keep them forever
+const typingSweepInterval = time.Minute
+
+// setTyping records or clears userID's typing state in a conversation. A start
+// stays active for the configured TypingTTL unless it is refreshed or stopped.
+// Starts from users outside the conversation are refused; reports whether the
+// update was accepted.
+func (h *Hub) setTyping(conversationID, userID int, typing bool) bool {
+	if conversationID <= 0 {
+		return false
+	}
+
+	if typing && db != nil {
+		isParticipant, err := database.IsUserInConversation(db, userID, conversationID)
+		if err != nil {
+			h.logger.Error("Failed to check membership of user %d in conversation %d: %v", userID, conversationID, err)
+			return false
+		}
+		if !isParticipant {
+			h.logger.Info("Ignored typing from user %d outside conversation %d", userID, conversationID)
+			return false
+		}
+	}
+
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	if !typing {
+		delete(h.typing[conversationID], userID)
+		if len(h.typing[conversationID]) == 0 {
+			delete(h.typing, conversationID)
+		}
+		return true
+	}
+
+	if h.typing[conversationID] == nil {
+		h.typing[conversationID] = make(map[int]time.Time)
+	}
+	h.typing[conversationID][userID] = time.Now().Add(h.config.TypingTTL)
+	return true
+}
+
+// PruneTyping drops every expired typing entry and returns how many it removed
+func (h *Hub) PruneTyping() int {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for conversationID, users := range h.typing {
+		for userID, expires := range users {
+			if now.After(expires) {
+				delete(users, userID)
+				removed++
+			}
+		}
+		if len(users) == 0 {
+			delete(h.typing, conversationID)
+		}
+	}
+	return removed
+}
+
+// typingConversations counts the conversations with typing entries, expired or not
+func (h *Hub) typingConversations() int {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+	return len(h.typing)
+}
+
+// TypingUsers returns the users currently typing in a conversation, in
+// ascending id order. Expired entries are dropped.
+func (h *Hub) TypingUsers(conversationID int) []int {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	now := time.Now()
+	users := make([]int, 0, len(h.typing[conversationID]))
+	for userID, expires := range h.typing[conversationID] {
+		if now.After(expires) {
+			delete(h.typing[conversationID], userID)
+			continue
+		}
+		users = append(users, userID)
+	}
+	if len(h.typing[conversationID]) == 0 {
+		delete(h.typing, conversationID)
+	}
+
+	sort.Ints(users)
+	return users
+}
@@ -2,13 +2,18 @@ package websocket
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"connecthub/database"
+	"connecthub/ratelimit"
 )
 
 var db *sql.DB
@@ -73,8 +78,8 @@ type Hub struct {
 	// Registered clients
 	clients map[*Client]bool
 
-	// User ID to client mapping
-	userConnections map[int]*Client
+	// User ID to open connections, oldest first
+	userConnections map[int][]*Client
 
 	// Inbound messages from the clients
 	broadcast chan Message
@@ -99,10 +104,22 @@ type Hub struct {
 		connectionsActive uint64
 		lastActivity      time.Time
 		errors            uint64
+		dropped           uint64
+		broadcastDropped  uint64
 	}
 
 	// Configuration
 	config HubConfig
+
+	// limiter enforces config.MessageRate per sender on private messages
+	limiter *ratelimit.Limiter
+
+	// postLimiter enforces config.NewPostRate on new_post announcements
+	postLimiter *ratelimit.Limiter
+
+	// Conversation ID to typing user ID to expiry, for clients polling instead of listening
+	typing   map[int]map[int]time.Time
+	typingMu sync.Mutex
 }
 
 func NewHub() *Hub {
@@ -110,20 +127,34 @@ func NewHub() *Hub {
 }
 
 func NewHubWithLogging(debug bool) *Hub {
+	config := DefaultHubConfig()
+	config.Debug = debug
+	return NewHubWithConfig(config)
+}
+
+// NewHubWithConfig creates a hub with the given settings. Channel buffer sizes
+// are fixed here; non-positive ones fall back to the defaults.
+func NewHubWithConfig(config HubConfig) *Hub {
+	if config.BroadcastBufferSize <= 0 {
+		config.BroadcastBufferSize = DefaultBroadcastBufferSize
+	}
+	if config.RegisterBufferSize <= 0 {
+		config.RegisterBufferSize = DefaultRegisterBufferSize
+	}
+
 	hub := &Hub{
-		broadcast:       make(chan Message, messageBufferSize),
-		register:        make(chan *Client, 8),
-		unregister:      make(chan *Client, 8),
+		broadcast:       make(chan Message, config.BroadcastBufferSize),
+		register:        make(chan *Client, config.RegisterBufferSize),
+		unregister:      make(chan *Client, config.RegisterBufferSize),
 		clients:         make(map[*Client]bool),
-		userConnections: make(map[int]*Client),
-		logger:          NewLogger(debug),
+		userConnections: make(map[int][]*Client),
+		typing:          make(map[int]map[int]time.Time),
+		logger:          NewLogger(config.Debug),
+		config:          config,
 	}
 
-	hub.config = HubConfig{
-		MaxClients:      DefaultMaxClients,
-		RateLimitPeriod: DefaultRateLimitPeriod,
-		MessageRate:     DefaultMessageRate,
-	}
+	hub.limiter = ratelimit.New(hub.config.MessageRate, hub.config.RateLimitPeriod)
+	hub.postLimiter = ratelimit.New(hub.config.NewPostRate, hub.config.RateLimitPeriod)
 	hub.stats.lastActivity = time.Now()
 
 	return hub
@@ -131,13 +162,20 @@ func NewHubWithLogging(debug bool) *Hub {
 
 func (h *Hub) Run() {
 	h.logger.Info("WebSocket hub started")
+	sweep := time.NewTicker(typingSweepInterval)
+	defer sweep.Stop()
 	for {
 		select {
+		case <-sweep.C:
+			if removed := h.PruneTyping(); removed > 0 {
+				h.logger.Debug("Pruned %d expired typing entries", removed)
+			}
+
 		case client := <-h.register:
 			// Check max clients limit
 			if len(h.clients) >= h.config.MaxClients {
 				h.logger.Error("Max clients limit reached, rejecting connection")
-				close(client.send)
+				client.closeSend()
 				continue
 			}
 
@@ -166,13 +204,21 @@ func (h *Hub) registerClient(client *Client) {
 
 	if client.UserID > 0 {
 		h.mu.Lock()
-		if existingClient, ok := h.userConnections[client.UserID]; ok {
-			h.logger.Info("Replacing existing connection for user %d", client.UserID)
-			existingClient.close()
+		conns := append(h.userConnections[client.UserID], client)
+		var evicted []*Client
+		if limit := h.config.MaxConnectionsPerUser; limit > 0 && len(conns) > limit {
+			evicted = conns[:len(conns)-limit]
+			conns = append([]*Client(nil), conns[len(conns)-limit:]...)
 		}
-		h.userConnections[client.UserID] = client
+		h.userConnections[client.UserID] = conns
 		h.mu.Unlock()
 
+		// Closing rather than rejecting keeps the newest device connected
+		for _, oldest := range evicted {
+			h.logger.Info("User %d exceeded %d connections, closing the oldest", client.UserID, h.config.MaxConnectionsPerUser)
+			oldest.close()
+		}
+
 		// Update online status in database
 		if db != nil {
 			err := updateUserStatusInDB(client.UserID, "online")
@@ -185,15 +231,7 @@ func (h *Hub) registerClient(client *Client) {
 		h.broadcastUserStatus(client.UserID, true)
 
 		// Send current online users list to new client
-		onlineUsers := h.GetOnlineUsers()
-		client.send <- Message{
-			Type: MessageTypeOnlineUsers,
-			Content: map[string]interface{}{
-				"users": onlineUsers,
-			},
-			Timestamp: time.Now(),
-			UserID:    client.UserID,
-		}
+		client.send <- h.onlineUsersMessage(client.UserID)
 
 		h.logger.Info("User %d connected and is now online", client.UserID)
 	}
@@ -202,7 +240,7 @@ func (h *Hub) registerClient(client *Client) {
 func (h *Hub) unregisterClient(client *Client) {
 	if _, ok := h.clients[client]; ok {
 		delete(h.clients, client)
-		close(client.send)
+		client.closeSend()
 		atomic.AddUint64(&h.stats.connectionsActive, ^uint64(0)) // Decrement
 		h.stats.lastActivity = time.Now()
 
@@ -210,11 +248,20 @@ func (h *Hub) unregisterClient(client *Client) {
 
 		if client.UserID > 0 {
 			h.mu.Lock()
-			if currentClient, ok := h.userConnections[client.UserID]; ok && currentClient == client {
+			remaining := withoutClient(h.userConnections[client.UserID], client)
+			if len(remaining) == 0 {
 				delete(h.userConnections, client.UserID)
+			} else {
+				h.userConnections[client.UserID] = remaining
 			}
 			h.mu.Unlock()
 
+			// The user stays online while another tab or device is connected
+			if len(remaining) > 0 {
+				h.logger.Debug("User %d still has %d open connections", client.UserID, len(remaining))
+				return
+			}
+
 			// Update online status in database
 			if db != nil {
 				err := updateUserStatusInDB(client.UserID, "offline")
@@ -237,33 +284,21 @@ func (h *Hub) broadcastMessage(message Message) {
 
 	if message.Type == MessageTypePrivate {
 		// Handle private messages with database integration
-		h.mu.RLock()
-		recipientClient, ok := h.userConnections[message.RecipientID]
-		senderClient := h.userConnections[message.UserID]
-		h.mu.RUnlock()
-
-		if !ok || !recipientClient.hub.IsUserOnline(message.RecipientID) {
-			// Recipient is offline, send user-friendly error back to sender
-			if senderClient != nil {
-				senderClient.send <- Message{
-					Type:    "error",
-					Content: "The recipient is currently offline. Your message will be delivered when they come online.",
-					Code:    "RECIPIENT_OFFLINE",
-				}
-			}
-			return
-		}
+		senderClients := h.connectionsFor(message.UserID)
 
 		// Process the message with database operations
 		responseMessage, err := h.processPrivateMessage(message)
 		if err != nil {
 			h.logger.Error("Failed to process private message: %v", err)
-			if senderClient != nil {
+			if len(senderClients) > 0 {
 				// Provide user-friendly error message based on error type
 				errorMessage := "Failed to send message. Please try again."
 				errorCode := "MESSAGE_SEND_FAILED"
 
-				if strings.Contains(err.Error(), "conversation") {
+				if errors.Is(err, database.ErrDMsNotAllowed) {
+					errorMessage = "This user is not accepting messages from you."
+					errorCode = "DMS_NOT_ALLOWED"
+				} else if strings.Contains(err.Error(), "conversation") {
 					errorMessage = "Conversation not found. It may have been deleted or you don't have access to it."
 					errorCode = "CONVERSATION_NOT_FOUND"
 				} else if strings.Contains(err.Error(), "database") {
@@ -271,71 +306,78 @@ func (h *Hub) broadcastMessage(message Message) {
 					errorCode = "DATABASE_ERROR"
 				}
 
-				senderClient.send <- Message{
+				h.sendToClients(senderClients, Message{
 					Type:    "error",
 					Content: errorMessage,
 					Code:    errorCode,
-				}
+				})
 			}
 			return
 		}
 
-		// Send the processed message to recipient
-		select {
-		case recipientClient.send <- responseMessage:
-			recipientCount++
-			atomic.AddUint64(&h.stats.messagesSent, 1)
-			h.logger.Debug("Message sent to recipient %d", message.RecipientID)
-		default:
-			errorCount++
-			atomic.AddUint64(&h.stats.errors, 1)
-			h.logger.Error("Failed to send message to recipient %d", message.RecipientID)
-			if senderClient != nil {
-				senderClient.send <- Message{
+		// Deliver to every other participant of the conversation
+		reachedRecipient := false
+		for _, participantID := range h.conversationRecipients(responseMessage) {
+			participantClients := h.connectionsFor(participantID)
+
+			if len(participantClients) == 0 {
+				// Participant is offline; the message is stored and will load when they return
+				h.logger.Debug("Participant %d is offline, message %d stored for later", participantID, responseMessage.ID)
+				h.sendToClients(senderClients, Message{
+					Type:           "error",
+					Content:        "The recipient is currently offline. Your message will be delivered when they come online.",
+					Code:           "RECIPIENT_OFFLINE",
+					RecipientID:    participantID,
+					ConversationID: responseMessage.ConversationID,
+				})
+				continue
+			}
+
+			delivered := h.sendToClients(participantClients, responseMessage)
+			reachedRecipient = reachedRecipient || delivered > 0
+			recipientCount += delivered
+			atomic.AddUint64(&h.stats.messagesSent, uint64(delivered))
+			if failed := len(participantClients) - delivered; failed > 0 {
+				errorCount += failed
+				atomic.AddUint64(&h.stats.errors, uint64(failed))
+				h.logger.Error("Failed to send message to %d of participant %d's connections", failed, participantID)
+			}
+			if delivered == 0 {
+				h.sendToClients(senderClients, Message{
 					Type:    "error",
 					Content: "Failed to send message. Please check your connection and try again.",
 					Code:    "MESSAGE_SEND_FAILED",
-				}
+				})
 			}
 		}
 
-		// This ensures the sender sees their message confirmed and gets proper status indicators
-		if senderClient != nil {
-			select {
-			case senderClient.send <- responseMessage:
-				recipientCount++
-				atomic.AddUint64(&h.stats.messagesSent, 1)
-				h.logger.Debug("Message confirmation sent to sender %d", message.UserID)
-			default:
-				errorCount++
-				atomic.AddUint64(&h.stats.errors, 1)
-				h.logger.Error("Failed to send message confirmation to sender %d", message.UserID)
-			}
+		// Confirm to every sender connection with the database-populated fields, so
+		// the sender's other devices show the message too
+		confirmed := h.sendToClients(senderClients, responseMessage)
+		recipientCount += confirmed
+		atomic.AddUint64(&h.stats.messagesSent, uint64(confirmed))
+		if failed := len(senderClients) - confirmed; failed > 0 {
+			errorCount += failed
+			atomic.AddUint64(&h.stats.errors, uint64(failed))
+			h.logger.Error("Failed to send message confirmation to %d of sender %d's connections", failed, message.UserID)
 		}
 
-		// Send confirmation back to sender with database-populated fields
-		if senderClient != nil {
-			select {
-			case senderClient.send <- responseMessage:
-				recipientCount++
-				atomic.AddUint64(&h.stats.messagesSent, 1)
-			default:
-				errorCount++
-				atomic.AddUint64(&h.stats.errors, 1)
-				h.logger.Error("Failed to send confirmation to sender %d", message.UserID)
-			}
+		if reachedRecipient {
+			h.sendDeliveryReceipt(senderClients, responseMessage)
 		}
 	} else if message.Type == MessageTypeTyping {
-		// Handle typing indicators - send only to recipient
-		h.mu.RLock()
-		recipientClient, ok := h.userConnections[message.RecipientID]
-		h.mu.RUnlock()
+		// Handle typing indicators - remember them for polling clients, send only to recipient
+		if message.ConversationID > 0 && !h.setTyping(message.ConversationID, message.UserID, message.Action == TypingActionStart) {
+			return
+		}
+		recipientClients := h.connectionsFor(message.RecipientID)
 
-		if ok && recipientClient.hub.IsUserOnline(message.RecipientID) {
+		if len(recipientClients) > 0 {
 			// Get sender name for typing indicator
 			var senderName string
 			if db != nil {
-				err := db.QueryRow("SELECT Username FROM user WHERE userid = ?", message.UserID).Scan(&senderName)
+				var err error
+				senderName, err = database.GetDisplayName(db, message.UserID)
 				if err != nil {
 					h.logger.Error("Failed to get sender name for typing indicator: %v", err)
 					senderName = "Someone"
@@ -356,15 +398,14 @@ func (h *Hub) broadcastMessage(message Message) {
 				Timestamp:      time.Now(),
 			}
 
-			select {
-			case recipientClient.send <- typingMessage:
-				recipientCount++
-				atomic.AddUint64(&h.stats.messagesSent, 1)
-				h.logger.Debug("Typing indicator sent to user %d: %s", message.RecipientID, message.Action)
-			default:
-				errorCount++
-				atomic.AddUint64(&h.stats.errors, 1)
-				h.logger.Error("Failed to send typing indicator to user %d", message.RecipientID)
+			delivered := h.sendToClients(recipientClients, typingMessage)
+			recipientCount += delivered
+			atomic.AddUint64(&h.stats.messagesSent, uint64(delivered))
+			h.logger.Debug("Typing indicator sent to user %d: %s", message.RecipientID, message.Action)
+			if failed := len(recipientClients) - delivered; failed > 0 {
+				errorCount += failed
+				atomic.AddUint64(&h.stats.errors, uint64(failed))
+				h.logger.Error("Failed to send typing indicator to %d of user %d's connections", failed, message.RecipientID)
 			}
 		}
 	} else {
@@ -390,6 +431,28 @@ func (h *Hub) broadcastMessage(message Message) {
 		recipientCount, errorCount, duration)
 }
 
+// conversationRecipients returns every participant of the message's conversation except the sender,
+// falling back to the explicit recipient if participants cannot be loaded
+func (h *Hub) conversationRecipients(message Message) []int {
+	participants, err := database.GetConversationParticipants(db, message.ConversationID)
+	if err != nil || len(participants) == 0 {
+		h.logger.Error("Failed to load participants for conversation %d, falling back to recipient %d: %v",
+			message.ConversationID, message.RecipientID, err)
+		if message.RecipientID > 0 && message.RecipientID != message.UserID {
+			return []int{message.RecipientID}
+		}
+		return nil
+	}
+
+	recipients := make([]int, 0, len(participants))
+	for _, participantID := range participants {
+		if participantID != message.UserID {
+			recipients = append(recipients, participantID)
+		}
+	}
+	return recipients
+}
+
 // processPrivateMessage handles database operations for private messages
 func (h *Hub) processPrivateMessage(message Message) (Message, error) {
 	if db == nil {
@@ -399,33 +462,38 @@ func (h *Hub) processPrivateMessage(message Message) (Message, error) {
 	var conversationID int
 	var err error
 
-	// Get sender name from database
-	var senderName string
-	err = db.QueryRow("SELECT Username FROM user WHERE userid = ?", message.UserID).Scan(&senderName)
-	if err != nil {
-		h.logger.Error("Failed to get sender name for user %d: %v", message.UserID, err)
-		senderName = "Unknown User"
-	}
-
 	if message.IsNewConversation {
 		// Create new conversation
 		h.logger.Info("Creating new conversation between users %d and %d", message.UserID, message.RecipientID)
 		participants := []int{message.UserID, message.RecipientID}
 
-		// Use the database package function to create conversation
-		conversationID, err = h.createConversation(participants)
+		// A pair that already talks reuses its conversation; only a new one notifies the recipient
+		var created bool
+		conversationID, created, err = database.FindOrCreateConversation(db, message.UserID, participants)
 		if err != nil {
-			return message, fmt.Errorf("failed to create conversation: %v", err)
+			return message, fmt.Errorf("failed to create conversation: %w", err)
 		}
-		h.logger.Info("Created conversation %d for new private message", conversationID)
 
-		// Send new conversation notification to recipient
-		h.sendNewConversationNotification(conversationID, message.UserID, message.RecipientID)
+		if !created {
+			h.logger.Info("Reusing conversation %d between users %d and %d", conversationID, message.UserID, message.RecipientID)
+		} else {
+			h.logger.Info("Created conversation %d for new private message", conversationID)
+			h.sendNewConversationNotification(conversationID, message.UserID, message.RecipientID)
+		}
 	} else {
 		conversationID = message.ConversationID
 		if conversationID <= 0 {
 			return message, fmt.Errorf("invalid conversation ID for existing conversation")
 		}
+
+		// The message fans out to every participant, so the sender must belong to the conversation
+		isParticipant, err := database.IsUserInConversation(db, message.UserID, conversationID)
+		if err != nil {
+			return message, fmt.Errorf("failed to verify conversation membership: %v", err)
+		}
+		if !isParticipant {
+			return message, fmt.Errorf("user %d is not a participant of conversation %d", message.UserID, conversationID)
+		}
 	}
 
 	// Save message to database
@@ -434,10 +502,13 @@ func (h *Hub) processPrivateMessage(message Message) (Message, error) {
 		return message, fmt.Errorf("message content must be a string")
 	}
 
-	// Use the database package function to add message
-	dbMessage, err := h.addMessageToConversation(conversationID, message.UserID, contentStr)
+	if message.ClientMsgID != "" && !database.ValidClientMsgID(message.ClientMsgID) {
+		return message, fmt.Errorf("invalid client_msg_id")
+	}
+
+	dbMessage, err := database.AddMessageWithClientID(db, conversationID, message.UserID, contentStr, message.ClientMsgID, message.ReplyToID, message.Attachments...)
 	if err != nil {
-		return message, fmt.Errorf("failed to save message to database: %v", err)
+		return message, fmt.Errorf("failed to save message to database: %w", err)
 	}
 
 	// Construct response message with database-populated fields
@@ -457,12 +528,118 @@ func (h *Hub) processPrivateMessage(message Message) (Message, error) {
 		SenderName: dbMessage.SenderName,
 		SentAt:     dbMessage.SentAt,
 		IsRead:     dbMessage.IsRead,
+
+		ClientMsgID: message.ClientMsgID,
+		Attachments: dbMessage.Attachments,
+		ReplyToID:   dbMessage.ReplyToID,
+		ReplyTo:     dbMessage.ReplyTo,
 	}
 
 	h.logger.Info("Successfully processed private message %d in conversation %d", dbMessage.ID, conversationID)
 	return responseMessage, nil
 }
 
+// sendDeliveryReceipt records that a message reached a recipient and tells the
+// sender's connections, so they can show it as delivered
+func (h *Hub) sendDeliveryReceipt(senderClients []*Client, message Message) {
+	deliveredAt, err := database.MarkMessageDelivered(db, message.ID)
+	if err != nil {
+		h.logger.Error("Failed to record delivery of message %d: %v", message.ID, err)
+		return
+	}
+
+	h.sendToClients(senderClients, Message{
+		Type:           MessageTypeDeliveryReceipt,
+		ID:             message.ID,
+		MessageID:      message.ID,
+		ConversationID: message.ConversationID,
+		UserID:         message.UserID,
+		Timestamp:      deliveredAt,
+		Content: map[string]interface{}{
+			"message_id":      message.ID,
+			"conversation_id": message.ConversationID,
+			"status":          database.MessageStatusDelivered,
+			"delivered_at":    deliveredAt,
+		},
+	})
+}
+
+// syncConversation replays the messages a reconnecting client missed in one
+// conversation, oldest first, followed by a sync_complete frame. HasMore in the
+// completion frame tells the client to sync again from the last id it received.
+func (h *Hub) syncConversation(client *Client, request Message) {
+	if db == nil {
+		client.trySend(Message{Type: "error", Content: "Sync is unavailable", Code: "DATABASE_ERROR"})
+		return
+	}
+
+	isParticipant, err := database.IsUserInConversation(db, client.UserID, request.ConversationID)
+	if err != nil || !isParticipant {
+		h.logger.Error("User %d cannot sync conversation %d: %v", client.UserID, request.ConversationID, err)
+		client.trySend(Message{
+			Type:           "error",
+			Content:        "Conversation not found. It may have been deleted or you don't have access to it.",
+			Code:           "CONVERSATION_NOT_FOUND",
+			ConversationID: request.ConversationID,
+		})
+		return
+	}
+
+	// Ask for one extra row so the client learns whether another round is needed
+	missed, err := database.GetConversationMessagesAfter(db, request.ConversationID, request.LastSeenMessageID, maxSyncMessages+1)
+	if err != nil {
+		h.logger.Error("Failed to load missed messages for user %d in conversation %d: %v", client.UserID, request.ConversationID, err)
+		client.trySend(Message{Type: "error", Content: "Failed to sync messages. Please try again.", Code: "DATABASE_ERROR"})
+		return
+	}
+
+	hasMore := len(missed) > maxSyncMessages
+	if hasMore {
+		missed = missed[:maxSyncMessages]
+	}
+
+	// This runs on the client's read goroutine, which must not block on or
+	// race the hub closing send. A client that cannot take the whole replay
+	// is closed so it reconnects and syncs again from what it did receive.
+	for _, m := range missed {
+		replayed := client.trySend(Message{
+			Type:           MessageTypePrivate,
+			UserID:         m.SenderID,
+			Content:        m.Content,
+			Timestamp:      m.SentAt,
+			ConversationID: m.ConversationID,
+			ID:             m.ID,
+			MessageID:      m.ID,
+			SenderID:       m.SenderID,
+			SenderName:     m.SenderName,
+			SentAt:         m.SentAt,
+			IsRead:         m.IsRead,
+			Attachments:    m.Attachments,
+			ReplyToID:      m.ReplyToID,
+			ReplyTo:        m.ReplyTo,
+		})
+		if !replayed {
+			h.logger.Error("Send buffer of user %d full during sync of conversation %d, closing connection", client.UserID, request.ConversationID)
+			atomic.AddUint64(&h.stats.dropped, 1)
+			client.close()
+			return
+		}
+	}
+
+	client.trySend(Message{
+		Type:           MessageTypeSyncComplete,
+		ConversationID: request.ConversationID,
+		Content: map[string]interface{}{
+			"count":    len(missed),
+			"has_more": hasMore,
+		},
+		Timestamp: time.Now(),
+		UserID:    client.UserID,
+	})
+
+	h.logger.Info("Replayed %d missed messages to user %d in conversation %d", len(missed), client.UserID, request.ConversationID)
+}
+
 func (h *Hub) GetStats() map[string]interface{} {
 	return map[string]interface{}{
 		"messagesSent":      h.stats.messagesSent,
@@ -470,7 +647,15 @@ func (h *Hub) GetStats() map[string]interface{} {
 		"connectionsTotal":  h.stats.connectionsTotal,
 		"connectionsActive": h.stats.connectionsActive,
 		"lastActivity":      h.stats.lastActivity,
+		"messagesDropped":   atomic.LoadUint64(&h.stats.dropped),
 		"onlineUsers":       len(h.GetOnlineUsers()),
+		// Queue occupancy, to spot backpressure before broadcasts start dropping
+		"broadcastQueued":     len(h.broadcast),
+		"broadcastCapacity":   cap(h.broadcast),
+		"broadcastDropped":    atomic.LoadUint64(&h.stats.broadcastDropped),
+		"registerQueued":      len(h.register),
+		"unregisterQueued":    len(h.unregister),
+		"typingConversations": h.typingConversations(),
 	}
 }
 
@@ -488,29 +673,63 @@ func (h *Hub) shouldSendToClient(message Message, client *Client) bool {
 	case MessageTypeTyping:
 		// Typing indicators should only go to the recipient
 		return client.UserID == message.RecipientID
+	case MessageTypeNewPost:
+		// The author already has their post
+		return client.UserID != message.UserID
 	default:
 		return true
 	}
 }
 
+// SendToUser delivers message to every connection userID has open and reports
+// whether at least one of them accepted it
 func (h *Hub) SendToUser(userID int, message Message) bool {
+	clients := h.connectionsFor(userID)
+	if len(clients) == 0 {
+		h.logger.Debug("Attempted to send message to offline user %d", userID)
+		return false
+	}
+
+	delivered := h.sendToClients(clients, message)
+	atomic.AddUint64(&h.stats.messagesSent, uint64(delivered))
+	if delivered == 0 {
+		h.logger.Error("Failed to send direct message to user %d", userID)
+		return false
+	}
+	h.logger.Debug("Direct message sent to %d of user %d's connections", delivered, userID)
+	return true
+}
+
+// connectionsFor returns a snapshot of userID's open connections, oldest first
+func (h *Hub) connectionsFor(userID int) []*Client {
 	h.mu.RLock()
-	client, ok := h.userConnections[userID]
-	h.mu.RUnlock()
+	defer h.mu.RUnlock()
+	return append([]*Client(nil), h.userConnections[userID]...)
+}
 
-	if ok {
+// sendToClients queues message on each client without blocking the hub and
+// returns how many accepted it
+func (h *Hub) sendToClients(clients []*Client, message Message) int {
+	delivered := 0
+	for _, client := range clients {
 		select {
 		case client.send <- message:
-			h.stats.messagesSent++
-			h.logger.Debug("Direct message sent to user %d", userID)
-			return true
+			delivered++
 		default:
-			h.logger.Error("Failed to send direct message to user %d", userID)
-			return false
 		}
 	}
-	h.logger.Debug("Attempted to send message to offline user %d", userID)
-	return false
+	return delivered
+}
+
+// withoutClient returns conns minus client, keeping the remaining order
+func withoutClient(conns []*Client, client *Client) []*Client {
+	kept := make([]*Client, 0, len(conns))
+	for _, c := range conns {
+		if c != client {
+			kept = append(kept, c)
+		}
+	}
+	return kept
 }
 
 func (h *Hub) BroadcastToAll(message Message) {
@@ -523,14 +742,32 @@ func (h *Hub) BroadcastToAll(message Message) {
 	default:
 		h.logger.Error("Broadcast channel full, message dropped")
 		atomic.AddUint64(&h.stats.errors, 1)
+		atomic.AddUint64(&h.stats.broadcastDropped, 1)
 	}
 }
 
 func (h *Hub) IsUserOnline(userID int) bool {
+	return h.ConnectionCount(userID) > 0
+}
+
+// DisconnectUser closes every connection userID has open and returns how many
+// there were
+func (h *Hub) DisconnectUser(userID int) int {
+	conns := h.connectionsFor(userID)
+	for _, client := range conns {
+		client.close()
+	}
+	if len(conns) > 0 {
+		h.logger.Info("Closed %d connections for user %d", len(conns), userID)
+	}
+	return len(conns)
+}
+
+// ConnectionCount returns how many connections userID currently has open
+func (h *Hub) ConnectionCount(userID int) int {
 	h.mu.RLock()
-	_, online := h.userConnections[userID]
-	h.mu.RUnlock()
-	return online
+	defer h.mu.RUnlock()
+	return len(h.userConnections[userID])
 }
 
 func (h *Hub) GetOnlineUsers() []int {
@@ -544,12 +781,112 @@ func (h *Hub) GetOnlineUsers() []int {
 	return users
 }
 
+// visibleOnlineUsers returns the connected users who have not hidden their
+// online status. Users whose setting cannot be read are left out.
+func (h *Hub) visibleOnlineUsers() ([]int, error) {
+	ids := h.GetOnlineUsers()
+	if db == nil {
+		return ids, nil
+	}
+
+	hidden, err := database.HiddenPresenceUsers(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	visible := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !hidden[id] {
+			visible = append(visible, id)
+		}
+	}
+	return visible, nil
+}
+
+// presenceHidden reports whether userID's status changes should be kept from
+// other users. A failed lookup counts as hidden.
+func (h *Hub) presenceHidden(userID int) bool {
+	if db == nil {
+		return false
+	}
+	hidden, err := database.HiddenPresenceUsers(db, []int{userID})
+	if err != nil {
+		h.logger.Error("Failed to load presence setting for user %d: %v", userID, err)
+		return true
+	}
+	return hidden[userID]
+}
+
+// GetOnlineUsersDetailed returns the connected users with their usernames and
+// avatars, loaded in a single query, leaving out users who hide their online
+// status. Without a database only ids are filled in.
+func (h *Hub) GetOnlineUsersDetailed() ([]OnlineUser, error) {
+	ids, err := h.visibleOnlineUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	if db == nil {
+		sort.Ints(ids)
+		users := make([]OnlineUser, len(ids))
+		for i, id := range ids {
+			users[i] = OnlineUser{ID: id}
+		}
+		return users, nil
+	}
+
+	records, err := database.GetUsersByIDs(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]OnlineUser, len(records))
+	for i := range records {
+		users[i] = OnlineUser{
+			ID:          records[i].ID,
+			Username:    records[i].Username,
+			DisplayName: records[i].DisplayName(),
+			Avatar:      records[i].Avatar.String,
+		}
+	}
+	return users, nil
+}
+
+// onlineUsersMessage builds the online_users payload sent to userID. "users"
+// keeps the plain id list older clients read; "details" adds profile fields.
+// Users who hide their online status appear in neither.
+func (h *Hub) onlineUsersMessage(userID int) Message {
+	users, err := h.visibleOnlineUsers()
+	if err != nil {
+		h.logger.Error("Failed to load online users: %v", err)
+		users = []int{}
+	}
+	content := map[string]interface{}{
+		"users": users,
+	}
+	if details, err := h.GetOnlineUsersDetailed(); err != nil {
+		h.logger.Error("Failed to load online user details: %v", err)
+	} else {
+		content["details"] = details
+	}
+
+	return Message{
+		Type:      MessageTypeOnlineUsers,
+		Content:   content,
+		Timestamp: time.Now(),
+		UserID:    userID,
+	}
+}
+
 func (h *Hub) broadcastUserStatus(userID int, online bool) {
 	status := "offline"
 	if online {
 		status = "online"
 	}
 
+	if h.presenceHidden(userID) {
+		h.logger.Debug("User %d hides their online status, not broadcasting %s", userID, status)
+		return
+	}
+
 	h.logger.Info("Broadcasting user %d status change: %s", userID, status)
 	h.broadcast <- Message{
 		Type:   MessageTypeUserStatus,
@@ -563,24 +900,23 @@ func (h *Hub) broadcastUserStatus(userID int, online bool) {
 
 // sendNewConversationNotification sends a notification to the recipient about a new conversation
 func (h *Hub) sendNewConversationNotification(conversationID int, senderID int, recipientID int) {
-	h.mu.RLock()
-	recipientClient, ok := h.userConnections[recipientID]
-	h.mu.RUnlock()
+	recipientClients := h.connectionsFor(recipientID)
 
-	if !ok || !h.IsUserOnline(recipientID) {
+	if len(recipientClients) == 0 {
 		h.logger.Debug("Recipient %d is offline, skipping new conversation notification", recipientID)
 		return
 	}
 
 	// Get sender information
-	var senderName, senderFirstName, senderLastName, senderUsername string
+	var senderName, senderUsername string
 	if db != nil {
-		err := db.QueryRow("SELECT firstname, lastname, username FROM user WHERE userid = ?", senderID).Scan(&senderFirstName, &senderLastName, &senderUsername)
+		sender, err := database.GetUserByID(db, senderID)
 		if err != nil {
 			h.logger.Error("Failed to get sender info for new conversation notification: %v", err)
 			senderName = "Someone"
 		} else {
-			senderName = senderFirstName + " " + senderLastName
+			senderName = sender.DisplayName()
+			senderUsername = sender.Username
 		}
 	} else {
 		senderName = "Someone"
@@ -605,97 +941,13 @@ func (h *Hub) sendNewConversationNotification(conversationID int, senderID int,
 		},
 	}
 
-	select {
-	case recipientClient.send <- notification:
+	if h.sendToClients(recipientClients, notification) > 0 {
 		h.logger.Info("New conversation notification sent to user %d for conversation %d", recipientID, conversationID)
-	default:
+	} else {
 		h.logger.Error("Failed to send new conversation notification to user %d", recipientID)
 	}
 }
 
-// Helper methods for database operations
-
-// createConversation creates a new conversation between participants
-func (h *Hub) createConversation(participants []int) (int, error) {
-	if db == nil {
-		return 0, fmt.Errorf("database connection not available")
-	}
-
-	// Insert conversation
-	result, err := db.Exec("INSERT INTO conversation (created_at) VALUES (?)", time.Now())
-	if err != nil {
-		return 0, fmt.Errorf("failed to create conversation: %v", err)
-	}
-
-	conversationID64, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("failed to get conversation ID: %v", err)
-	}
-	conversationID := int(conversationID64)
-
-	// Add participants to conversation
-	for _, participantID := range participants {
-		_, err = db.Exec("INSERT INTO conversation_participants (conversation_id, user_id) VALUES (?, ?)",
-			conversationID, participantID)
-		if err != nil {
-			h.logger.Error("Failed to add participant %d to conversation %d: %v", participantID, conversationID, err)
-			// Continue with other participants even if one fails
-		}
-	}
-
-	h.logger.Info("Created conversation %d with %d participants", conversationID, len(participants))
-	return conversationID, nil
-}
-
-// DatabaseMessage represents a message from the database
-type DatabaseMessage struct {
-	ID         int       `json:"id"`
-	SenderID   int       `json:"sender_id"`
-	SenderName string    `json:"sender_name"`
-	Content    string    `json:"content"`
-	SentAt     time.Time `json:"sent_at"`
-	IsRead     bool      `json:"is_read"`
-}
-
-// addMessageToConversation adds a message to a conversation
-func (h *Hub) addMessageToConversation(conversationID, senderID int, content string) (*DatabaseMessage, error) {
-	if db == nil {
-		return nil, fmt.Errorf("database connection not available")
-	}
-
-	// Insert message
-	result, err := db.Exec("INSERT INTO message (conversation_id, sender_id, content, sent_at, is_read) VALUES (?, ?, ?, ?, ?)",
-		conversationID, senderID, content, time.Now(), false)
-	if err != nil {
-		return nil, fmt.Errorf("failed to insert message: %v", err)
-	}
-
-	messageID64, err := result.LastInsertId()
-	if err != nil {
-		return nil, fmt.Errorf("failed to get message ID: %v", err)
-	}
-	messageID := int(messageID64)
-
-	// Get sender name
-	var senderName string
-	err = db.QueryRow("SELECT Username FROM user WHERE userid = ?", senderID).Scan(&senderName)
-	if err != nil {
-		h.logger.Error("Failed to get sender name for user %d: %v", senderID, err)
-		senderName = "Unknown User"
-	}
-
-	dbMessage := &DatabaseMessage{
-		ID:         messageID,
-		SenderID:   senderID,
-		SenderName: senderName,
-		Content:    content,
-		SentAt:     time.Now(),
-		IsRead:     false,
-	}
-
-	h.logger.Info("Added message %d to conversation %d from user %d", messageID, conversationID, senderID)
-	return dbMessage, nil
-}
 func (h *Hub) SendReadStatusUpdate(conversationID int, readerID int) {
 	if db == nil {
 		h.logger.Error("Database connection not available for read status update")
@@ -705,7 +957,7 @@ func (h *Hub) SendReadStatusUpdate(conversationID int, readerID int) {
 	// Get all participants in the conversation except the reader
 	query := `
 		SELECT DISTINCT cp.user_id, u.Username
-		FROM conversation_participant cp
+		FROM conversation_participants cp
 		JOIN user u ON cp.user_id = u.userid
 		WHERE cp.conversation_id = ? AND cp.user_id != ?
 	`
@@ -718,8 +970,7 @@ func (h *Hub) SendReadStatusUpdate(conversationID int, readerID int) {
 	defer rows.Close()
 
 	// Get reader name
-	var readerName string
-	err = db.QueryRow("SELECT Username FROM user WHERE userid = ?", readerID).Scan(&readerName)
+	readerName, err := database.GetDisplayName(db, readerID)
 	if err != nil {
 		h.logger.Error("Failed to get reader name: %v", err)
 		readerName = "Someone"
@@ -735,11 +986,9 @@ func (h *Hub) SendReadStatusUpdate(conversationID int, readerID int) {
 			continue
 		}
 
-		h.mu.RLock()
-		participantClient, ok := h.userConnections[participantID]
-		h.mu.RUnlock()
+		participantClients := h.connectionsFor(participantID)
 
-		if ok && h.IsUserOnline(participantID) {
+		if len(participantClients) > 0 {
 			readStatusMessage := Message{
 				Type:           MessageTypeReadStatus,
 				ConversationID: conversationID,
@@ -754,10 +1003,9 @@ func (h *Hub) SendReadStatusUpdate(conversationID int, readerID int) {
 				},
 			}
 
-			select {
-			case participantClient.send <- readStatusMessage:
+			if h.sendToClients(participantClients, readStatusMessage) > 0 {
 				h.logger.Debug("Read status update sent to user %d for conversation %d", participantID, conversationID)
-			default:
+			} else {
 				h.logger.Error("Failed to send read status update to user %d", participantID)
 			}
 		}